@@ -26,6 +26,11 @@ type Config struct {
 	CloudinaryURL             string
 	CleanupNotificationsDays  string
 	CleanupAppointmentsMonths string
+	PaymentProvider           string
+	PaymentCurrency           string
+	PaymentWebhookSecret      string
+	StripeSecretKey           string
+	StripeWebhookSecret       string
 }
 
 func Load() *Config {
@@ -53,6 +58,11 @@ func Load() *Config {
 		CloudinaryURL:             getEnv("CLOUDINARY_URL", ""),
 		CleanupNotificationsDays:  getEnv("CLEANUP_NOTIFICATIONS_DAYS", "30"),
 		CleanupAppointmentsMonths: getEnv("CLEANUP_APPOINTMENTS_MONTHS", "6"),
+		PaymentProvider:           getEnv("PAYMENT_PROVIDER", "fake"),
+		PaymentCurrency:           getEnv("PAYMENT_CURRENCY", "usd"),
+		PaymentWebhookSecret:      getEnv("PAYMENT_WEBHOOK_SECRET", "fake-webhook-secret"),
+		StripeSecretKey:           getEnv("STRIPE_SECRET_KEY", ""),
+		StripeWebhookSecret:       getEnv("STRIPE_WEBHOOK_SECRET", ""),
 	}
 }
 
@@ -18,6 +18,12 @@ func NewAnalyticsHandler(db *pgxpool.Pool) *AnalyticsHandler {
 	return &AnalyticsHandler{DB: db}
 }
 
+// Payments that brought money in, and what of it went back out through the refund ledger
+const (
+	collectedStatuses = `('completed', 'partially_refunded', 'refunded')`
+	refundedSQL       = `(SELECT COALESCE(SUM(r.amount), 0) FROM refunds r WHERE r.payment_id = p.id)`
+)
+
 func (h *AnalyticsHandler) GetDashboard(c *gin.Context) {
 	salonID := c.Param("salon_id")
 
@@ -27,15 +33,41 @@ func (h *AnalyticsHandler) GetDashboard(c *gin.Context) {
 	h.DB.QueryRow(context.Background(),
 		"SELECT COUNT(*) FROM appointments WHERE salon_id = $1", salonID).Scan(&analytics.TotalAppointments)
 
-	// Total revenue
+	// Total revenue, net of refunds
 	h.DB.QueryRow(context.Background(),
-		`SELECT COALESCE(SUM(p.total), 0) FROM payments p 
+		`SELECT COALESCE(SUM(p.total - `+refundedSQL+`), 0) FROM payments p 
 		 JOIN appointments a ON a.id = p.appointment_id 
-		 WHERE a.salon_id = $1 AND p.status = 'completed'`, salonID).Scan(&analytics.TotalRevenue)
+		 WHERE a.salon_id = $1 AND p.status IN `+collectedStatuses, salonID).Scan(&analytics.TotalRevenue)
+
+	// Tips, kept out of revenue
+	h.DB.QueryRow(context.Background(),
+		`SELECT COALESCE(SUM(p.tip), 0) FROM payments p
+		 JOIN appointments a ON a.id = p.appointment_id
+		 WHERE a.salon_id = $1 AND p.status IN `+collectedStatuses, salonID).Scan(&analytics.TotalTips)
+
+	tipRows, _ := h.DB.Query(context.Background(),
+		`SELECT st.id, st.name, COUNT(*), SUM(p.tip) as tips
+		 FROM payments p
+		 JOIN appointments a ON a.id = p.appointment_id
+		 JOIN staff st ON st.id = p.tip_staff_id
+		 WHERE a.salon_id = $1 AND p.tip > 0 AND p.status IN `+collectedStatuses+`
+		 GROUP BY st.id, st.name
+		 ORDER BY tips DESC`, salonID)
+	if tipRows != nil {
+		for tipRows.Next() {
+			var t models.StaffTips
+			tipRows.Scan(&t.StaffID, &t.StaffName, &t.TipCount, &t.Tips)
+			analytics.TipsByStaff = append(analytics.TipsByStaff, t)
+		}
+		tipRows.Close()
+	}
+	if analytics.TipsByStaff == nil {
+		analytics.TipsByStaff = []models.StaffTips{}
+	}
 
 	// Average rating
 	h.DB.QueryRow(context.Background(),
-		"SELECT COALESCE(AVG(rating), 0) FROM reviews WHERE salon_id = $1", salonID).Scan(&analytics.AverageRating)
+		"SELECT COALESCE(AVG(rating), 0) FROM reviews WHERE salon_id = $1 AND NOT is_hidden", salonID).Scan(&analytics.AverageRating)
 
 	// Appointments by status
 	analytics.AppointmentsByStatus = make(map[string]int)
@@ -51,12 +83,16 @@ func (h *AnalyticsHandler) GetDashboard(c *gin.Context) {
 		statusRows.Close()
 	}
 
-	// Popular services
+	// Popular services, counted once per appointment they are booked in; refunds are spread
+	// over a payment's services by price
 	svcRows, _ := h.DB.Query(context.Background(),
-		`SELECT sv.name, COUNT(*) as book_count, COALESCE(SUM(p.total), 0) as revenue
-		 FROM appointments a
-		 JOIN services sv ON sv.id = a.service_id
-		 LEFT JOIN payments p ON p.appointment_id = a.id AND p.status = 'completed'
+		`SELECT sv.name, COUNT(DISTINCT aps.appointment_id) as book_count,
+		 COALESCE(SUM(CASE WHEN p.id IS NOT NULL
+		     THEN aps.price * (1 - `+refundedSQL+` / NULLIF(p.total, 0)) END), 0) as revenue
+		 FROM appointment_services aps
+		 JOIN appointments a ON a.id = aps.appointment_id
+		 JOIN services sv ON sv.id = aps.service_id
+		 LEFT JOIN payments p ON p.appointment_id = a.id AND p.status IN `+collectedStatuses+`
 		 WHERE a.salon_id = $1
 		 GROUP BY sv.name
 		 ORDER BY book_count DESC
@@ -92,15 +128,15 @@ func (h *AnalyticsHandler) GetDashboard(c *gin.Context) {
 
 	// Revenue by month
 	monthRows, _ := h.DB.Query(context.Background(),
-		`SELECT TO_CHAR(p.created_at, 'YYYY-MM') as month, SUM(p.total) as revenue
+		`SELECT TO_CHAR(p.created_at, 'YYYY-MM') as month, SUM(p.total - `+refundedSQL+`) as revenue, SUM(p.tip)
 		 FROM payments p
 		 JOIN appointments a ON a.id = p.appointment_id
-		 WHERE a.salon_id = $1 AND p.status = 'completed'
+		 WHERE a.salon_id = $1 AND p.status IN `+collectedStatuses+`
 		 GROUP BY month ORDER BY month DESC LIMIT 12`, salonID)
 	if monthRows != nil {
 		for monthRows.Next() {
 			var m models.MonthlyRevenue
-			monthRows.Scan(&m.Month, &m.Revenue)
+			monthRows.Scan(&m.Month, &m.Revenue, &m.Tips)
 			analytics.RevenueByMonth = append(analytics.RevenueByMonth, m)
 		}
 		monthRows.Close()
@@ -113,6 +149,7 @@ func (h *AnalyticsHandler) GetDashboard(c *gin.Context) {
 }
 
 // GetOwnerOverview provides aggregated data across all salons owned by the user for the current day.
+// "Today" is evaluated in each salon's own timezone.
 func (h *AnalyticsHandler) GetOwnerOverview(c *gin.Context) {
 	userID := c.GetString("user_id")
 
@@ -122,15 +159,24 @@ func (h *AnalyticsHandler) GetOwnerOverview(c *gin.Context) {
 	h.DB.QueryRow(context.Background(),
 		`SELECT COUNT(*) FROM appointments a
 		 JOIN salons s ON s.id = a.salon_id
-		 WHERE s.owner_id = $1 AND a.appointment_date = CURRENT_DATE 
+		 WHERE s.owner_id = $1 AND a.appointment_date = (NOW() AT TIME ZONE s.timezone)::date 
 		 AND a.status NOT IN ('cancelled', 'no_show')`, userID).Scan(&overview.TodaysAppointments)
 
-	// Todays Revenue
+	// Todays Revenue, net of refunds
 	h.DB.QueryRow(context.Background(),
-		`SELECT COALESCE(SUM(p.total), 0) FROM payments p 
+		`SELECT COALESCE(SUM(p.total - `+refundedSQL+`), 0) FROM payments p 
 		 JOIN appointments a ON a.id = p.appointment_id 
 		 JOIN salons s ON s.id = a.salon_id
-		 WHERE s.owner_id = $1 AND a.appointment_date = CURRENT_DATE AND p.status = 'completed'`, userID).Scan(&overview.TodaysRevenue)
+		 WHERE s.owner_id = $1 AND a.appointment_date = (NOW() AT TIME ZONE s.timezone)::date
+		 AND p.status IN `+collectedStatuses, userID).Scan(&overview.TodaysRevenue)
+
+	// Todays Tips
+	h.DB.QueryRow(context.Background(),
+		`SELECT COALESCE(SUM(p.tip), 0) FROM payments p
+		 JOIN appointments a ON a.id = p.appointment_id
+		 JOIN salons s ON s.id = a.salon_id
+		 WHERE s.owner_id = $1 AND a.appointment_date = (NOW() AT TIME ZONE s.timezone)::date
+		 AND p.status IN `+collectedStatuses, userID).Scan(&overview.TodaysTips)
 
 	// Pending Requests
 	h.DB.QueryRow(context.Background(),
@@ -142,7 +188,7 @@ func (h *AnalyticsHandler) GetOwnerOverview(c *gin.Context) {
 	h.DB.QueryRow(context.Background(),
 		`SELECT COUNT(*) FROM appointments a
 		 JOIN salons s ON s.id = a.salon_id
-		 WHERE s.owner_id = $1 AND a.appointment_date = CURRENT_DATE AND a.status = 'cancelled'`, userID).Scan(&overview.CancelledToday)
+		 WHERE s.owner_id = $1 AND a.appointment_date = (NOW() AT TIME ZONE s.timezone)::date AND a.status = 'cancelled'`, userID).Scan(&overview.CancelledToday)
 
 	c.JSON(http.StatusOK, overview)
 }
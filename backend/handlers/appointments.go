@@ -2,10 +2,11 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
-	"time"
 
 	"saloon-backend/middleware"
 	"saloon-backend/models"
@@ -20,13 +21,16 @@ type AppointmentHandler struct {
 	BookingService  *services.BookingService
 	PushService     *services.PushService
 	WaitlistService *services.WaitlistService
+	Loyalty         *services.LoyaltyService
 }
 
 func NewAppointmentHandler(db *pgxpool.Pool, scheduler *services.Scheduler) *AppointmentHandler {
+	booking := services.NewBookingService(db, scheduler)
 	return &AppointmentHandler{
 		DB:              db,
-		BookingService:  services.NewBookingService(db, scheduler),
-		WaitlistService: services.NewWaitlistService(db, nil), // PushService set later
+		BookingService:  booking,
+		WaitlistService: services.NewWaitlistService(db, booking, nil), // PushService set later
+		Loyalty:         services.NewLoyaltyService(db),
 	}
 }
 
@@ -40,6 +44,12 @@ func (h *AppointmentHandler) SetPushService(ps *services.PushService) {
 	}
 }
 
+func (h *AppointmentHandler) SetPaymentService(ps *services.PaymentService) {
+	if h.BookingService != nil {
+		h.BookingService.SetPaymentService(ps)
+	}
+}
+
 func (h *AppointmentHandler) BookAppointment(c *gin.Context) {
 	var req models.BookAppointmentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -50,6 +60,15 @@ func (h *AppointmentHandler) BookAppointment(c *gin.Context) {
 	customerID := middleware.GetUserID(c)
 
 	appt, payment, err := h.BookingService.BookAppointment(c.Request.Context(), customerID, req)
+	var promoErr *services.PromoError
+	if errors.As(err, &promoErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": promoErr.Message, "promo_reason": promoErr.Reason})
+		return
+	}
+	if errors.Is(err, services.ErrInsufficientPoints) || errors.Is(err, services.ErrPlanUnusable) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		return
@@ -60,8 +79,8 @@ func (h *AppointmentHandler) BookAppointment(c *gin.Context) {
 		"payment":     payment,
 	})
 
-	// Send immediate push notification (non-blocking)
-	if h.PushService != nil {
+	// Send immediate push notification (non-blocking); held bookings are confirmed by their deposit
+	if h.PushService != nil && appt.Status != "awaiting_deposit" {
 		go h.PushService.SendToUser(context.Background(), customerID, services.PushPayload{
 			Title: "Booking Confirmed! ✅",
 			Body:  fmt.Sprintf("Your appointment for %s on %s at %s has been confirmed.", appt.ServiceName, appt.AppointmentDate, appt.StartTime),
@@ -86,12 +105,17 @@ func (h *AppointmentHandler) GetMyAppointments(c *gin.Context) {
 
 	query := `SELECT a.id, a.customer_id, a.salon_id, a.staff_id, a.service_id,
 		a.appointment_date::text, a.start_time::text, a.end_time::text, a.status,
-		COALESCE(a.notes,''), a.promo_code_id, a.created_at, a.updated_at,
-		s.name, st.name, sv.name, sv.price, COALESCE(p.total, 0)
+		COALESCE(a.notes,''), a.promo_code_id, a.series_id, a.created_at, a.updated_at,
+		s.name, s.timezone, st.name, COALESCE(li.names, sv.name), COALESCE(li.price, sv.price), COALESCE(p.total, 0)
 		FROM appointments a
 		JOIN salons s ON s.id = a.salon_id
 		JOIN staff st ON st.id = a.staff_id
 		JOIN services sv ON sv.id = a.service_id
+		LEFT JOIN LATERAL (
+			SELECT string_agg(lsv.name, ' + ' ORDER BY aps.position) AS names, SUM(aps.price) AS price
+			FROM appointment_services aps JOIN services lsv ON lsv.id = aps.service_id
+			WHERE aps.appointment_id = a.id
+		) li ON true
 		LEFT JOIN payments p ON p.appointment_id = a.id
 		WHERE a.customer_id = $1`
 
@@ -99,7 +123,7 @@ func (h *AppointmentHandler) GetMyAppointments(c *gin.Context) {
 	argIdx := 2
 
 	if status == "upcoming" {
-		query += " AND a.status IN ('confirmed', 'pending') AND (a.appointment_date > CURRENT_DATE OR (a.appointment_date = CURRENT_DATE AND a.end_time >= CURRENT_TIME))"
+		query += " AND a.status IN ('confirmed', 'pending') AND (a.appointment_date + a.end_time) >= (NOW() AT TIME ZONE s.timezone)"
 	} else if status != "" {
 		query += " AND a.status = $" + strconv.Itoa(argIdx)
 		args = append(args, status)
@@ -122,8 +146,8 @@ func (h *AppointmentHandler) GetMyAppointments(c *gin.Context) {
 		var a models.Appointment
 		rows.Scan(&a.ID, &a.CustomerID, &a.SalonID, &a.StaffID, &a.ServiceID,
 			&a.AppointmentDate, &a.StartTime, &a.EndTime, &a.Status,
-			&a.Notes, &a.PromoCodeID, &a.CreatedAt, &a.UpdatedAt,
-			&a.SalonName, &a.StaffName, &a.ServiceName, &a.ServicePrice, &a.TotalPrice)
+			&a.Notes, &a.PromoCodeID, &a.SeriesID, &a.CreatedAt, &a.UpdatedAt,
+			&a.SalonName, &a.SalonTimezone, &a.StaffName, &a.ServiceName, &a.ServicePrice, &a.TotalPrice)
 		appointments = append(appointments, a)
 	}
 	if appointments == nil {
@@ -142,13 +166,18 @@ func (h *AppointmentHandler) GetSalonAppointments(c *gin.Context) {
 
 	query := `SELECT a.id, a.customer_id, a.salon_id, a.staff_id, a.service_id,
 		a.appointment_date::text, a.start_time::text, a.end_time::text, a.status,
-		COALESCE(a.notes,''), a.promo_code_id, a.created_at, a.updated_at,
-		s.name, st.name, sv.name, sv.price, u.name, u.email, COALESCE(u.phone,'')
+		COALESCE(a.notes,''), a.promo_code_id, a.series_id, a.created_at, a.updated_at,
+		s.name, s.timezone, st.name, COALESCE(li.names, sv.name), COALESCE(li.price, sv.price), u.name, u.email, COALESCE(u.phone,'')
 		FROM appointments a
 		JOIN salons s ON s.id = a.salon_id
 		JOIN staff st ON st.id = a.staff_id
 		JOIN services sv ON sv.id = a.service_id
 		JOIN users u ON u.id = a.customer_id
+		LEFT JOIN LATERAL (
+			SELECT string_agg(lsv.name, ' + ' ORDER BY aps.position) AS names, SUM(aps.price) AS price
+			FROM appointment_services aps JOIN services lsv ON lsv.id = aps.service_id
+			WHERE aps.appointment_id = a.id
+		) li ON true
 		WHERE a.salon_id = $1`
 
 	args := []interface{}{salonID}
@@ -189,8 +218,8 @@ func (h *AppointmentHandler) GetSalonAppointments(c *gin.Context) {
 		var a models.Appointment
 		rows.Scan(&a.ID, &a.CustomerID, &a.SalonID, &a.StaffID, &a.ServiceID,
 			&a.AppointmentDate, &a.StartTime, &a.EndTime, &a.Status,
-			&a.Notes, &a.PromoCodeID, &a.CreatedAt, &a.UpdatedAt,
-			&a.SalonName, &a.StaffName, &a.ServiceName, &a.ServicePrice,
+			&a.Notes, &a.PromoCodeID, &a.SeriesID, &a.CreatedAt, &a.UpdatedAt,
+			&a.SalonName, &a.SalonTimezone, &a.StaffName, &a.ServiceName, &a.ServicePrice,
 			&a.CustomerName, &a.CustomerEmail, &a.CustomerPhone)
 		appointments = append(appointments, a)
 	}
@@ -212,10 +241,10 @@ func (h *AppointmentHandler) RescheduleAppointment(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 
 	// Get current appointment
-	var staffID, serviceID, currentStatus string
+	var currentStatus string
 	err := h.DB.QueryRow(context.Background(),
-		"SELECT staff_id, service_id, status FROM appointments WHERE id = $1 AND customer_id = $2",
-		appointmentID, userID).Scan(&staffID, &serviceID, &currentStatus)
+		"SELECT status FROM appointments WHERE id = $1 AND customer_id = $2",
+		appointmentID, userID).Scan(&currentStatus)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
 		return
@@ -226,36 +255,9 @@ func (h *AppointmentHandler) RescheduleAppointment(c *gin.Context) {
 		return
 	}
 
-	// Get service duration
-	var durationMinutes int
-	h.DB.QueryRow(context.Background(),
-		"SELECT duration_minutes FROM services WHERE id = $1", serviceID).Scan(&durationMinutes)
-
-	// Calculate new end time
-	startTime, _ := time.Parse("15:04", req.StartTime)
-	endTime := startTime.Add(time.Duration(durationMinutes) * time.Minute)
-	endTimeStr := endTime.Format("15:04")
-
-	// Check for conflicts
-	var conflictCount int
-	h.DB.QueryRow(context.Background(),
-		`SELECT COUNT(*) FROM appointments 
-		 WHERE staff_id = $1 AND appointment_date = $2 AND id != $3
-		 AND status NOT IN ('cancelled', 'no_show')
-		 AND (start_time, end_time) OVERLAPS ($4::time, $5::time)`,
-		staffID, req.Date, appointmentID, req.StartTime, endTimeStr).Scan(&conflictCount)
-
-	if conflictCount > 0 {
-		c.JSON(http.StatusConflict, gin.H{"error": "New time slot conflicts with existing appointment"})
-		return
-	}
-
-	_, err = h.DB.Exec(context.Background(),
-		`UPDATE appointments SET appointment_date = $1, start_time = $2, end_time = $3, 
-		 status = 'confirmed', updated_at = NOW() WHERE id = $4`,
-		req.Date, req.StartTime, endTimeStr, appointmentID)
+	err = h.BookingService.RescheduleAppointment(c.Request.Context(), appointmentID, req.Date, req.StartTime)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reschedule"})
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -267,26 +269,67 @@ func (h *AppointmentHandler) CancelAppointment(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 	userRole := middleware.GetUserRole(c)
 
-	query := "UPDATE appointments SET status = 'cancelled', updated_at = NOW() WHERE id = $1"
+	var req models.CancelAppointmentRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Completed and no-show appointments stay as they are; their money is refunded explicitly
+	query := `UPDATE appointments SET status = 'cancelled', updated_at = NOW()
+		 WHERE id = $1 AND status NOT IN ('cancelled', 'completed', 'no_show')`
 	args := []interface{}{appointmentID}
 
+	// Customers cancelling inside the salon's free-cancel window owe its late-cancel fee and
+	// have to accept it first; cancellations by the salon are always free
+	var quote *models.CancellationQuote
 	if userRole != "salon_owner" && userRole != "admin" {
+		var ok bool
+		quote, ok = h.customerCancellationQuote(c, appointmentID)
+		if !ok {
+			return
+		}
+		if (quote.Fee > 0 || quote.CreditsForfeited > 0) && !req.AcceptFee {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":        "Cancelling now incurs a late cancellation fee or forfeits plan credits; resend with accept_fee to confirm",
+				"cancellation": quote,
+			})
+			return
+		}
+
 		query += " AND customer_id = $2"
 		args = append(args, userID)
+	} else if userRole == "salon_owner" {
+		// Owners only cancel the appointments of their own salons
+		query += " AND salon_id IN (SELECT id FROM salons WHERE owner_id = $2)"
+		args = append(args, userID)
 	}
 
 	result, err := h.DB.Exec(context.Background(), query, args...)
 	if err != nil || result.RowsAffected() == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found or already cancelled"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found or can no longer be cancelled"})
 		return
 	}
 
-	// Refund payment
-	h.DB.Exec(context.Background(),
-		"UPDATE payments SET status = 'refunded', updated_at = NOW() WHERE appointment_id = $1",
-		appointmentID)
+	// Charge the late-cancel fee, or release the card hold and refund what was collected
+	fee, event := services.CancellationCharge(quote)
+	if payments := h.BookingService.Payments; payments != nil {
+		if err := payments.ChargeFee(context.Background(), appointmentID, services.FeeLateCancel, fee, userID); err != nil {
+			log.Printf("⚠️  Payment for cancelled appointment %s: %v", appointmentID, err)
+		}
+	}
+	// Return redeemed points, and give the promo code use back or keep it per the salon's policy
+	if err := services.SettleDiscounts(context.Background(), h.DB, []string{appointmentID}, event); err != nil {
+		log.Printf("⚠️  Discounts of cancelled appointment %s: %v", appointmentID, err)
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Appointment cancelled"})
+	response := gin.H{"message": "Appointment cancelled"}
+	if quote != nil {
+		response["cancellation"] = quote
+	}
+	c.JSON(http.StatusOK, response)
 
 	// Notify waitlist
 	if h.WaitlistService != nil {
@@ -302,16 +345,39 @@ func (h *AppointmentHandler) CancelAppointment(c *gin.Context) {
 
 func (h *AppointmentHandler) MarkNoShow(c *gin.Context) {
 	appointmentID := c.Param("id")
+	userID := middleware.GetUserID(c)
 
-	_, err := h.DB.Exec(context.Background(),
-		"UPDATE appointments SET status = 'no_show', updated_at = NOW() WHERE id = $1",
-		appointmentID)
+	// The fee is worked out from the payment before it is re-priced
+	fee, err := h.BookingService.NoShowFee(context.Background(), appointmentID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+		return
+	}
+
+	result, err := h.DB.Exec(context.Background(),
+		`UPDATE appointments SET status = 'no_show', updated_at = NOW()
+		 WHERE id = $1 AND salon_id = $2 AND status IN ('pending', 'confirmed')`,
+		appointmentID, c.Param("salon_id"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark no-show"})
 		return
 	}
+	if result.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found or not awaiting the customer"})
+		return
+	}
+
+	// Charge the no-show fee; without one the payment is settled like a cancellation
+	if payments := h.BookingService.Payments; payments != nil {
+		if err := payments.ChargeFee(context.Background(), appointmentID, services.FeeNoShow, fee, userID); err != nil {
+			log.Printf("⚠️  Payment for no-show appointment %s: %v", appointmentID, err)
+		}
+	}
+	if err := services.SettleDiscounts(context.Background(), h.DB, []string{appointmentID}, services.PromoOnNoShow); err != nil {
+		log.Printf("⚠️  Discounts of no-show appointment %s: %v", appointmentID, err)
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Marked as no-show"})
+	c.JSON(http.StatusOK, gin.H{"message": "Marked as no-show", "no_show_fee": fee})
 
 	// Notify waitlist
 	if h.WaitlistService != nil {
@@ -356,38 +422,51 @@ func (h *AppointmentHandler) ApproveAppointment(c *gin.Context) {
 			URL:   "/appointments",
 		})
 	}
-
-	// 3. Schedule look-ahead reminders (if within next 70 mins)
-	if h.BookingService != nil && h.BookingService.Scheduler != nil {
-		st, _ := time.Parse("15:04", startTimeStr)
-		dt, _ := time.Parse("2006-01-02", apptDateStr)
-		apptTime := time.Date(dt.Year(), dt.Month(), dt.Day(), st.Hour(), st.Minute(), 0, 0, time.Local)
-
-		if time.Until(apptTime) < 70*time.Minute {
-			// Schedule 1h reminder
-			h.BookingService.Scheduler.ScheduleReminder(context.Background(), apptTime, 60, appointmentID, customerID, serviceName, salonName, "reminder_1h_sent", "Appointment in 1 Hour", "Your appointment for %s at %s is in 1 hour. Get ready! 💇")
-
-			// Schedule 20m reminder
-			h.BookingService.Scheduler.ScheduleReminder(context.Background(), apptTime, 20, appointmentID, customerID, serviceName, salonName, "reminder_20m_sent", "Appointment in 20 Minutes", "Your appointment for %s at %s starts in 20 minutes. Head over! 🏃")
-		}
-	}
 }
 
 func (h *AppointmentHandler) CompleteAppointment(c *gin.Context) {
 	appointmentID := c.Param("id")
 
-	_, err := h.DB.Exec(context.Background(),
-		"UPDATE appointments SET status = 'completed', updated_at = NOW() WHERE id = $1",
-		appointmentID)
+	salonID := c.Param("salon_id")
+
+	result, err := h.DB.Exec(context.Background(),
+		`UPDATE appointments SET status = 'completed', updated_at = NOW()
+		 WHERE id = $1 AND salon_id = $2 AND status IN ('pending', 'confirmed')`,
+		appointmentID, salonID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete appointment"})
 		return
 	}
+	if result.RowsAffected() == 0 {
+		var status string
+		err := h.DB.QueryRow(context.Background(),
+			"SELECT status FROM appointments WHERE id = $1 AND salon_id = $2",
+			appointmentID, salonID).Scan(&status)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Appointment is %s and can't be completed", status)})
+		return
+	}
+
+	// The customer earns loyalty points under the salon's program
+	if _, err := h.Loyalty.EarnPoints(context.Background(), appointmentID); err != nil {
+		log.Printf("⚠️  Loyalty points for appointment %s: %v", appointmentID, err)
+	}
 
-	// Mark payment as completed
-	h.DB.Exec(context.Background(),
-		"UPDATE payments SET status = 'completed', updated_at = NOW() WHERE appointment_id = $1",
-		appointmentID)
+	// Count the deposit towards the payment, then collect the rest of an authorized card
+	// payment; counter payments are taken through ProcessPayment
+	if payments := h.BookingService.Payments; payments != nil {
+		err := payments.ApplyDeposit(context.Background(), appointmentID)
+		if err == nil {
+			err = payments.Capture(context.Background(), appointmentID)
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"message": "Appointment completed", "payment_error": err.Error()})
+			return
+		}
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Appointment completed"})
 }
@@ -401,6 +480,10 @@ func (h *AppointmentHandler) AdjustAppointmentTime(c *gin.Context) {
 	}
 
 	err := h.BookingService.CascadeReschedule(c.Request.Context(), appointmentID, req.NewEndTime)
+	if errors.Is(err, services.ErrResourceUnavailable) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -411,15 +494,39 @@ func (h *AppointmentHandler) AdjustAppointmentTime(c *gin.Context) {
 
 func (h *AppointmentHandler) GetAvailableSlots(c *gin.Context) {
 	staffID := c.Query("staff_id")
-	serviceID := c.Query("service_id")
+	serviceIDs := services.RequestedServiceIDs(c.Query("service_id"), c.QueryArray("service_ids"))
+	date := c.Query("date")
+
+	if staffID == "" || len(serviceIDs) == 0 || date == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "staff_id, service_id (or service_ids), and date query params required"})
+		return
+	}
+
+	if staffID == services.AnyStaff {
+		h.GetAnyStaffSlots(c)
+		return
+	}
+
+	slots, err := h.BookingService.GetAvailableSlots(c.Request.Context(), staffID, serviceIDs, date)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, slots)
+}
+
+// GetAnyStaffSlots merges availability across every stylist who offers the service(s)
+func (h *AppointmentHandler) GetAnyStaffSlots(c *gin.Context) {
+	serviceIDs := services.RequestedServiceIDs(c.Query("service_id"), c.QueryArray("service_ids"))
 	date := c.Query("date")
 
-	if staffID == "" || serviceID == "" || date == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "staff_id, service_id, and date query params required"})
+	if len(serviceIDs) == 0 || date == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "service_id (or service_ids) and date query params required"})
 		return
 	}
 
-	slots, err := h.BookingService.GetAvailableSlots(c.Request.Context(), staffID, serviceID, date)
+	slots, err := h.BookingService.GetAnyStaffSlots(c.Request.Context(), serviceIDs, date)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
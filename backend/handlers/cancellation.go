@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"saloon-backend/middleware"
+	"saloon-backend/models"
+	"saloon-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetCancellationPolicy returns a salon's cancellation policy; a salon that never set one
+// charges no fees
+func (h *SalonHandler) GetCancellationPolicy(c *gin.Context) {
+	salonID := c.Param("id")
+	if salonID == "" {
+		salonID = c.Param("salon_id")
+	}
+
+	policy, err := services.LoadCancellationPolicy(context.Background(), h.DB, salonID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// UpdateCancellationPolicy sets the salon's free-cancel window and its late-cancel and
+// no-show fees, and when promo code uses are given back. Appointments cancelled or missed
+// afterwards are settled under the new policy; promo settings left out keep their defaults.
+func (h *SalonHandler) UpdateCancellationPolicy(c *gin.Context) {
+	salonID := c.Param("salon_id")
+	req := services.DefaultCancellationPolicy()
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateCancellationPolicy(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err := h.DB.Exec(context.Background(),
+		`INSERT INTO cancellation_policies
+		 (salon_id, free_cancel_hours, late_cancel_fee_type, late_cancel_fee, no_show_fee_type, no_show_fee,
+		  release_promo_on_cancel, release_promo_on_late_cancel, release_promo_on_no_show, release_promo_on_refund,
+		  restore_credit_on_late_cancel, restore_credit_on_no_show)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		 ON CONFLICT (salon_id) DO UPDATE SET
+		   free_cancel_hours = EXCLUDED.free_cancel_hours,
+		   late_cancel_fee_type = EXCLUDED.late_cancel_fee_type,
+		   late_cancel_fee = EXCLUDED.late_cancel_fee,
+		   no_show_fee_type = EXCLUDED.no_show_fee_type,
+		   no_show_fee = EXCLUDED.no_show_fee,
+		   release_promo_on_cancel = EXCLUDED.release_promo_on_cancel,
+		   release_promo_on_late_cancel = EXCLUDED.release_promo_on_late_cancel,
+		   release_promo_on_no_show = EXCLUDED.release_promo_on_no_show,
+		   release_promo_on_refund = EXCLUDED.release_promo_on_refund,
+		   restore_credit_on_late_cancel = EXCLUDED.restore_credit_on_late_cancel,
+		   restore_credit_on_no_show = EXCLUDED.restore_credit_on_no_show,
+		   updated_at = NOW()`,
+		salonID, req.FreeCancelHours, req.LateCancelFeeType, req.LateCancelFee, req.NoShowFeeType, req.NoShowFee,
+		req.ReleasePromoOnCancel, req.ReleasePromoOnLateCancel, req.ReleasePromoOnNoShow, req.ReleasePromoOnRefund,
+		req.RestoreCreditOnLateCancel, req.RestoreCreditOnNoShow)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cancellation policy"})
+		return
+	}
+	c.JSON(http.StatusOK, req)
+}
+
+// validateCancellationPolicy checks the fee types and amounts; a fee of type none is
+// stored as zero
+func validateCancellationPolicy(p *models.CancellationPolicy) error {
+	if p.FreeCancelHours < 0 {
+		return fmt.Errorf("free_cancel_hours cannot be negative")
+	}
+	for _, fee := range []struct {
+		name  string
+		kind  *string
+		value *float64
+	}{
+		{"late_cancel_fee", &p.LateCancelFeeType, &p.LateCancelFee},
+		{"no_show_fee", &p.NoShowFeeType, &p.NoShowFee},
+	} {
+		switch *fee.kind {
+		case "":
+			*fee.kind = services.FeeNone
+			*fee.value = 0
+		case services.FeeNone:
+			*fee.value = 0
+		case services.FeeFlat, services.FeePercent:
+		default:
+			return fmt.Errorf("%s_type must be none, flat or percent", fee.name)
+		}
+		if *fee.value < 0 {
+			return fmt.Errorf("%s cannot be negative", fee.name)
+		}
+		if *fee.kind == services.FeePercent && *fee.value > 100 {
+			return fmt.Errorf("%s cannot be more than 100 percent", fee.name)
+		}
+	}
+	return nil
+}
+
+// customerCancellationQuote quotes the cancellation of one of the signed-in customer's
+// appointments that can still be cancelled, responding with 404 when there is none
+func (h *AppointmentHandler) customerCancellationQuote(c *gin.Context, appointmentID string) (*models.CancellationQuote, bool) {
+	var customerID string
+	err := h.DB.QueryRow(context.Background(),
+		`SELECT customer_id FROM appointments
+		 WHERE id = $1 AND status NOT IN ('cancelled', 'completed', 'no_show')`,
+		appointmentID).Scan(&customerID)
+	if err != nil || customerID != middleware.GetUserID(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found or can no longer be cancelled"})
+		return nil, false
+	}
+
+	quote, err := h.BookingService.QuoteCancellation(context.Background(), appointmentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return quote, true
+}
+
+// GetCancellationQuote tells the customer what cancelling an appointment now would cost,
+// so the app can warn them before they confirm
+func (h *AppointmentHandler) GetCancellationQuote(c *gin.Context) {
+	quote, ok := h.customerCancellationQuote(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, quote)
+}
@@ -3,8 +3,10 @@ package handlers
 import (
 	"context"
 	"fmt"
+	"log"
 	"net/http"
 
+	"saloon-backend/middleware"
 	"saloon-backend/models"
 	"saloon-backend/services"
 
@@ -13,12 +15,13 @@ import (
 )
 
 type ClosureHandler struct {
-	DB   *pgxpool.Pool
-	Push *services.PushService
+	DB       *pgxpool.Pool
+	Push     *services.PushService
+	Payments *services.PaymentService
 }
 
-func NewClosureHandler(db *pgxpool.Pool, push *services.PushService) *ClosureHandler {
-	return &ClosureHandler{DB: db, Push: push}
+func NewClosureHandler(db *pgxpool.Pool, push *services.PushService, payments *services.PaymentService) *ClosureHandler {
+	return &ClosureHandler{DB: db, Push: push, Payments: payments}
 }
 
 // CreateClosure creates a new salon closure and returns any conflicting appointments
@@ -144,7 +147,7 @@ func (h *ClosureHandler) CancelConflicting(c *gin.Context) {
 		WHERE salon_id = $1
 		  AND appointment_date >= $2::date AND appointment_date <= $3::date
 		  AND status NOT IN ('cancelled', 'completed', 'no_show')
-		RETURNING customer_id, appointment_date::text, start_time::text
+		RETURNING id, customer_id, appointment_date::text, start_time::text
 	`
 	rows, err := h.DB.Query(context.Background(), updateQuery, salonID, startDate, endDate)
 	if err != nil {
@@ -158,10 +161,12 @@ func (h *ClosureHandler) CancelConflicting(c *gin.Context) {
 	_ = h.DB.QueryRow(context.Background(), "SELECT name FROM salons WHERE id = $1", salonID).Scan(&salonName)
 
 	var cancelledCount int64
+	var cancelledIDs []string
 	for rows.Next() {
-		var customerID, apptDate, apptTime string
-		if err := rows.Scan(&customerID, &apptDate, &apptTime); err == nil {
+		var apptID, customerID, apptDate, apptTime string
+		if err := rows.Scan(&apptID, &customerID, &apptDate, &apptTime); err == nil {
 			cancelledCount++
+			cancelledIDs = append(cancelledIDs, apptID)
 			// Send push notification
 			if h.Push != nil {
 				h.Push.SendToUser(context.Background(), customerID, services.PushPayload{
@@ -179,6 +184,13 @@ func (h *ClosureHandler) CancelConflicting(c *gin.Context) {
 				"appointment_cancelled")
 		}
 	}
+	// Release or refund each payment through the provider
+	if h.Payments != nil {
+		h.Payments.CancelPayments(context.Background(), cancelledIDs, middleware.GetUserID(c))
+	}
+	if err := services.SettleDiscounts(context.Background(), h.DB, cancelledIDs, services.PromoOnCancel); err != nil {
+		log.Printf("⚠️  Discounts of appointments cancelled by closure %s: %v", closureID, err)
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":         "Conflicting appointments cancelled and customers notified",
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"saloon-backend/middleware"
+	"saloon-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PayDeposit opens the payment for the deposit of one of the customer's bookings, e.g.
+// after the card was declined at booking time. It only works while the hold lasts.
+func (h *AppointmentHandler) PayDeposit(c *gin.Context) {
+	appointmentID := c.Param("id")
+	payments := h.BookingService.Payments
+	if payments == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Payments are not available"})
+		return
+	}
+
+	var customerID, status string
+	err := h.DB.QueryRow(context.Background(),
+		"SELECT customer_id, status FROM appointments WHERE id = $1", appointmentID).Scan(&customerID, &status)
+	if err != nil || customerID != middleware.GetUserID(c) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+		return
+	}
+	if status != "awaiting_deposit" {
+		c.JSON(http.StatusConflict, gin.H{"error": "This booking is not waiting for a deposit"})
+		return
+	}
+
+	deposit, err := payments.PayDeposit(c.Request.Context(), appointmentID)
+	if errors.Is(err, services.ErrDepositExpired) {
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, deposit)
+}
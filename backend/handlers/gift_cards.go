@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"saloon-backend/middleware"
+	"saloon-backend/models"
+	"saloon-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type GiftCardHandler struct {
+	DB        *pgxpool.Pool
+	GiftCards *services.GiftCardService
+}
+
+func NewGiftCardHandler(db *pgxpool.Pool) *GiftCardHandler {
+	return &GiftCardHandler{DB: db, GiftCards: services.NewGiftCardService(db)}
+}
+
+// IssueGiftCard sells a gift card at the salon and returns it with its code
+func (h *GiftCardHandler) IssueGiftCard(c *gin.Context) {
+	salonID := c.Param("salon_id")
+	var req models.IssueGiftCardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var timezone string
+	err := h.DB.QueryRow(context.Background(),
+		"SELECT timezone FROM salons WHERE id = $1", salonID).Scan(&timezone)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Salon not found"})
+		return
+	}
+	expiresAt, err := services.GiftCardExpiry(req.ExpiresOn, timezone, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	card, err := h.GiftCards.Issue(context.Background(), salonID, req, expiresAt, middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue gift card"})
+		return
+	}
+	c.JSON(http.StatusCreated, card)
+}
+
+// GetGiftCards lists the salon's gift cards, filtered with ?status= (active, expired or
+// voided) or looked up by ?code=
+func (h *GiftCardHandler) GetGiftCards(c *gin.Context) {
+	status := c.Query("status")
+	if status != "" && status != "active" && status != "expired" && status != "voided" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be active, expired or voided"})
+		return
+	}
+	cards, err := h.GiftCards.List(context.Background(), c.Param("salon_id"), status, c.Query("code"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch gift cards"})
+		return
+	}
+	c.JSON(http.StatusOK, cards)
+}
+
+// GetGiftCard returns one of the salon's gift cards with its balance history
+func (h *GiftCardHandler) GetGiftCard(c *gin.Context) {
+	card, err := h.GiftCards.Get(context.Background(), c.Param("salon_id"), c.Param("gift_card_id"))
+	if errors.Is(err, services.ErrGiftCardNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch gift card"})
+		return
+	}
+	c.JSON(http.StatusOK, card)
+}
+
+// VoidGiftCard cancels a gift card, e.g. one sold by mistake or reported stolen. Its
+// remaining balance is written off and it can no longer be used.
+func (h *GiftCardHandler) VoidGiftCard(c *gin.Context) {
+	var req models.VoidGiftCardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	card, err := h.GiftCards.Void(context.Background(), c.Param("salon_id"), c.Param("gift_card_id"),
+		req.Reason, middleware.GetUserID(c))
+	if errors.Is(err, services.ErrGiftCardNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, card)
+}
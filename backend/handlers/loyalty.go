@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"saloon-backend/middleware"
+	"saloon-backend/models"
+	"saloon-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type LoyaltyHandler struct {
+	DB      *pgxpool.Pool
+	Loyalty *services.LoyaltyService
+}
+
+func NewLoyaltyHandler(db *pgxpool.Pool, loyalty *services.LoyaltyService) *LoyaltyHandler {
+	return &LoyaltyHandler{DB: db, Loyalty: loyalty}
+}
+
+// GetMyLoyalty returns the signed-in customer's points per salon and their latest ledger
+// entries, of one salon with ?salon_id=
+func (h *LoyaltyHandler) GetMyLoyalty(c *gin.Context) {
+	limit := 50
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 500 {
+		limit = l
+	}
+	history, err := h.Loyalty.History(context.Background(), middleware.GetUserID(c), c.Query("salon_id"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+// GetLoyaltyProgram returns how a salon's customers earn and redeem points
+func (h *LoyaltyHandler) GetLoyaltyProgram(c *gin.Context) {
+	salonID := c.Param("id")
+	if salonID == "" {
+		salonID = c.Param("salon_id")
+	}
+
+	program, err := services.LoadLoyaltyProgram(context.Background(), h.DB, salonID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, program)
+}
+
+// UpdateLoyaltyProgram sets the salon's earn rate, point value, redemption limits and
+// point expiry. Points already earned keep the expiry they were earned with.
+func (h *LoyaltyHandler) UpdateLoyaltyProgram(c *gin.Context) {
+	salonID := c.Param("salon_id")
+	req := services.DefaultLoyaltyProgram()
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateLoyaltyProgram(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err := h.DB.Exec(context.Background(),
+		`INSERT INTO loyalty_programs
+		 (salon_id, enabled, points_per_unit, point_value, min_redeem_points, max_redeem_percent, expiry_days)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 ON CONFLICT (salon_id) DO UPDATE SET
+		   enabled = EXCLUDED.enabled,
+		   points_per_unit = EXCLUDED.points_per_unit,
+		   point_value = EXCLUDED.point_value,
+		   min_redeem_points = EXCLUDED.min_redeem_points,
+		   max_redeem_percent = EXCLUDED.max_redeem_percent,
+		   expiry_days = EXCLUDED.expiry_days,
+		   updated_at = NOW()`,
+		salonID, req.Enabled, req.PointsPerUnit, req.PointValue, req.MinRedeemPoints, req.MaxRedeemPercent, req.ExpiryDays)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update loyalty program"})
+		return
+	}
+	c.JSON(http.StatusOK, req)
+}
+
+// validateLoyaltyProgram checks the rates and limits of a loyalty program
+func validateLoyaltyProgram(p *models.LoyaltyProgram) error {
+	switch {
+	case p.PointsPerUnit < 0:
+		return fmt.Errorf("points_per_unit cannot be negative")
+	case p.PointValue < 0:
+		return fmt.Errorf("point_value cannot be negative")
+	case p.MinRedeemPoints < 0:
+		return fmt.Errorf("min_redeem_points cannot be negative")
+	case p.MaxRedeemPercent < 0 || p.MaxRedeemPercent > 100:
+		return fmt.Errorf("max_redeem_percent must be between 0 and 100")
+	case p.ExpiryDays < 0:
+		return fmt.Errorf("expiry_days cannot be negative")
+	}
+	return nil
+}
+
+// AdjustPoints adds points to or takes them from a customer of the salon, e.g. as a
+// goodwill gesture or to correct a mistake. The note is shown in the customer's history.
+func (h *LoyaltyHandler) AdjustPoints(c *gin.Context) {
+	salonID := c.Param("salon_id")
+	var req models.AdjustPointsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var isCustomer bool
+	err := h.DB.QueryRow(context.Background(),
+		"SELECT EXISTS(SELECT 1 FROM appointments WHERE salon_id = $1 AND customer_id = $2)",
+		salonID, req.CustomerID).Scan(&isCustomer)
+	if err != nil || !isCustomer {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found at this salon"})
+		return
+	}
+
+	err = h.Loyalty.AdjustPoints(context.Background(), salonID, req.CustomerID, req.Points, req.Note, middleware.GetUserID(c))
+	if errors.Is(err, services.ErrInsufficientPoints) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	history, err := h.Loyalty.History(context.Background(), req.CustomerID, salonID, 20)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
@@ -2,88 +2,138 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
-	"time"
 
 	"saloon-backend/models"
+	"saloon-backend/services"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type PaymentHandler struct {
-	DB *pgxpool.Pool
+	DB       *pgxpool.Pool
+	Payments *services.PaymentService
 }
 
-func NewPaymentHandler(db *pgxpool.Pool) *PaymentHandler {
-	return &PaymentHandler{DB: db}
+func NewPaymentHandler(db *pgxpool.Pool, payments *services.PaymentService) *PaymentHandler {
+	return &PaymentHandler{DB: db, Payments: payments}
 }
 
+// paymentColumns are the payments columns scanned by scanPayment
+const paymentColumns = `p.id, p.appointment_id, p.amount, p.discount, p.tax, p.total, p.method, p.status,
+	p.receipt_number, p.created_at, p.updated_at, COALESCE(p.provider, ''), COALESCE(p.provider_intent_id, ''),
+	(SELECT COALESCE(SUM(r.amount), 0) FROM refunds r WHERE r.payment_id = p.id), p.tax_inclusive, p.deposit_applied,
+	p.tip, p.tip_staff_id, p.invoice_number`
+
+func scanPayment(row pgx.Row, p *models.Payment) error {
+	return row.Scan(&p.ID, &p.AppointmentID, &p.Amount, &p.Discount, &p.Tax, &p.Total,
+		&p.Method, &p.Status, &p.ReceiptNumber, &p.CreatedAt, &p.UpdatedAt, &p.Provider, &p.ProviderIntentID,
+		&p.RefundedAmount, &p.TaxInclusive, &p.DepositApplied, &p.Tip, &p.TipStaffID, &p.InvoiceNumber)
+}
+
+// ProcessPayment collects payment for an appointment of the salon, with a single method or
+// split across tenders, plus an optional tip. The amount charged is always the amount due
+// on the appointment's payment, after any loyalty points redeemed with it; the status
+// changes once the provider (or, for cash, UPI and wallets, the counter) reports it.
 func (h *PaymentHandler) ProcessPayment(c *gin.Context) {
+	salonID := c.Param("salon_id")
 	var req models.ProcessPaymentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	tenders := req.Tenders
+	if len(tenders) == 0 {
+		if req.Method == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "method or tenders is required"})
+			return
+		}
+		tenders = []models.PaymentTender{{Method: req.Method, Amount: req.Amount, GiftCardCode: req.GiftCardCode}}
+	}
 
-	// Check if payment exists
-	var paymentID string
-	var currentStatus string
+	var exists bool
 	err := h.DB.QueryRow(context.Background(),
-		"SELECT id, status FROM payments WHERE appointment_id = $1",
-		req.AppointmentID).Scan(&paymentID, &currentStatus)
-
+		"SELECT EXISTS(SELECT 1 FROM payments WHERE appointment_id = $1) FROM appointments WHERE id = $1 AND salon_id = $2",
+		req.AppointmentID, salonID).Scan(&exists)
 	if err != nil {
-		// Create new payment
-		tax := req.Amount * 0.08
-		total := req.Amount + tax
-		receiptNumber := fmt.Sprintf("RCP-%s-%s", time.Now().Format("20060102150405"), req.AppointmentID[:8])
-
-		var payment models.Payment
-		err = h.DB.QueryRow(context.Background(),
-			`INSERT INTO payments (appointment_id, amount, discount, tax, total, method, status, receipt_number)
-			 VALUES ($1, $2, 0, $3, $4, $5, 'completed', $6)
-			 RETURNING id, appointment_id, amount, discount, tax, total, method, status, receipt_number, created_at, updated_at`,
-			req.AppointmentID, req.Amount, tax, total, req.Method, receiptNumber,
-		).Scan(&payment.ID, &payment.AppointmentID, &payment.Amount, &payment.Discount,
-			&payment.Tax, &payment.Total, &payment.Method, &payment.Status,
-			&payment.ReceiptNumber, &payment.CreatedAt, &payment.UpdatedAt)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Appointment not found"})
+		return
+	}
 
+	if !exists {
+		// Appointment without a payment row: price it from its services, never from the request
+		err = h.Payments.CreateAppointmentPayment(c.Request.Context(), req.AppointmentID, tenders[0].Method)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payment"})
 			return
 		}
+	}
 
-		c.JSON(http.StatusCreated, payment)
+	// Points come off the amount due before the tenders are checked against it, and go back
+	// to the customer if the checkout fails
+	clientSecret, err := h.Payments.Checkout(c.Request.Context(), req.AppointmentID, tenders, req.Tip, req.RedeemPoints)
+	if errors.Is(err, services.ErrAmountMismatch) || errors.Is(err, services.ErrGiftCardUnusable) ||
+		errors.Is(err, services.ErrInsufficientPoints) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Update existing payment
 	var payment models.Payment
-	err = h.DB.QueryRow(context.Background(),
-		`UPDATE payments SET method = $1, status = 'completed', updated_at = NOW()
-		 WHERE id = $2
-		 RETURNING id, appointment_id, amount, discount, tax, total, method, status, receipt_number, created_at, updated_at`,
-		req.Method, paymentID,
-	).Scan(&payment.ID, &payment.AppointmentID, &payment.Amount, &payment.Discount,
-		&payment.Tax, &payment.Total, &payment.Method, &payment.Status,
-		&payment.ReceiptNumber, &payment.CreatedAt, &payment.UpdatedAt)
-
+	err = scanPayment(h.DB.QueryRow(context.Background(),
+		`SELECT `+paymentColumns+` FROM payments p WHERE p.appointment_id = $1
+		 ORDER BY p.created_at DESC LIMIT 1`, req.AppointmentID), &payment)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update payment"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payment"})
 		return
 	}
+	payment.ClientSecret = clientSecret
 
 	c.JSON(http.StatusOK, payment)
 }
 
+// HandleWebhook applies an event pushed by the payment provider. The body is only trusted
+// once the provider's signature checks out.
+func (h *PaymentHandler) HandleWebhook(c *gin.Context) {
+	provider := h.Payments.Provider
+	if c.Param("provider") != provider.Name() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown payment provider"})
+		return
+	}
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read body"})
+		return
+	}
+
+	event, err := provider.VerifyWebhook(payload, c.Request.Header)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err = h.Payments.ApplyEvent(c.Request.Context(), provider.Name(), event)
+	if err != nil && !errors.Is(err, services.ErrUnknownPayment) {
+		// A non-2xx answer makes the provider retry later
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": true})
+}
+
 func (h *PaymentHandler) GetSalonPayments(c *gin.Context) {
 	salonID := c.Param("salon_id")
 
 	rows, err := h.DB.Query(context.Background(),
-		`SELECT p.id, p.appointment_id, p.amount, p.discount, p.tax, p.total, 
-		 p.method, p.status, p.receipt_number, p.created_at, p.updated_at
+		`SELECT `+paymentColumns+`
 		 FROM payments p
 		 JOIN appointments a ON a.id = p.appointment_id
 		 WHERE a.salon_id = $1
@@ -97,8 +147,7 @@ func (h *PaymentHandler) GetSalonPayments(c *gin.Context) {
 	var payments []models.Payment
 	for rows.Next() {
 		var p models.Payment
-		rows.Scan(&p.ID, &p.AppointmentID, &p.Amount, &p.Discount, &p.Tax, &p.Total,
-			&p.Method, &p.Status, &p.ReceiptNumber, &p.CreatedAt, &p.UpdatedAt)
+		scanPayment(rows, &p)
 		payments = append(payments, p)
 	}
 	if payments == nil {
@@ -108,21 +157,73 @@ func (h *PaymentHandler) GetSalonPayments(c *gin.Context) {
 	c.JSON(http.StatusOK, payments)
 }
 
+// GetReceipt returns a payment of the salon with its line items, tax, fees and tenders.
+// With ?format=pdf or ?format=html it renders the printable invoice instead.
 func (h *PaymentHandler) GetReceipt(c *gin.Context) {
+	salonID := c.Param("salon_id")
 	paymentID := c.Param("id")
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "pdf" && format != "html" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json, pdf or html"})
+		return
+	}
 
 	var p models.Payment
-	err := h.DB.QueryRow(context.Background(),
-		`SELECT id, appointment_id, amount, discount, tax, total, method, status, receipt_number, created_at, updated_at
-		 FROM payments WHERE id = $1`, paymentID,
-	).Scan(&p.ID, &p.AppointmentID, &p.Amount, &p.Discount, &p.Tax, &p.Total,
-		&p.Method, &p.Status, &p.ReceiptNumber, &p.CreatedAt, &p.UpdatedAt)
+	err := scanPayment(h.DB.QueryRow(context.Background(),
+		`SELECT `+paymentColumns+` FROM payments p WHERE p.id = $1 AND p.salon_id = $2`, paymentID, salonID), &p)
 
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
 		return
 	}
 
+	// Itemized tax
+	taxRows, err := h.DB.Query(context.Background(),
+		`SELECT name, rate_percent, taxable_amount, amount FROM payment_taxes
+		 WHERE payment_id = $1 ORDER BY name`, p.ID)
+	if err == nil {
+		for taxRows.Next() {
+			var t models.PaymentTax
+			taxRows.Scan(&t.Name, &t.RatePercent, &t.TaxableAmount, &t.Amount)
+			p.Taxes = append(p.Taxes, t)
+		}
+		taxRows.Close()
+	}
+	if p.Taxes == nil {
+		p.Taxes = []models.PaymentTax{}
+	}
+
+	// Late-cancel and no-show fees the payment was re-priced to
+	feeRows, err := h.DB.Query(context.Background(),
+		`SELECT kind, amount, original_total, created_at FROM payment_fees
+		 WHERE payment_id = $1 ORDER BY created_at`, p.ID)
+	if err == nil {
+		for feeRows.Next() {
+			var f models.PaymentFee
+			feeRows.Scan(&f.Kind, &f.Amount, &f.OriginalTotal, &f.CreatedAt)
+			p.Fees = append(p.Fees, f)
+		}
+		feeRows.Close()
+	}
+
+	// Tenders and who the tip went to
+	tenderRows, err := h.DB.Query(context.Background(),
+		`SELECT t.method, t.amount, COALESCE(g.code, '')
+		 FROM payment_tenders t LEFT JOIN gift_cards g ON g.id = t.gift_card_id
+		 WHERE t.payment_id = $1 ORDER BY t.method`, p.ID)
+	if err == nil {
+		for tenderRows.Next() {
+			var t models.PaymentTender
+			tenderRows.Scan(&t.Method, &t.Amount, &t.GiftCardCode)
+			p.Tenders = append(p.Tenders, t)
+		}
+		tenderRows.Close()
+	}
+	if p.TipStaffID != nil {
+		h.DB.QueryRow(context.Background(),
+			"SELECT name FROM staff WHERE id = $1", *p.TipStaffID).Scan(&p.TipStaffName)
+	}
+
 	// Get appointment details
 	var appt models.Appointment
 	h.DB.QueryRow(context.Background(),
@@ -136,8 +237,48 @@ func (h *PaymentHandler) GetReceipt(c *gin.Context) {
 	).Scan(&appt.AppointmentDate, &appt.StartTime, &appt.SalonName, &appt.StaffName,
 		&appt.ServiceName, &appt.CustomerName, &appt.CustomerEmail)
 
-	c.JSON(http.StatusOK, gin.H{
-		"payment":     p,
-		"appointment": appt,
-	})
+	// Line items
+	itemRows, err := h.DB.Query(context.Background(),
+		`SELECT aps.id, aps.appointment_id, aps.service_id, aps.position, aps.price, aps.duration_minutes,
+		 COALESCE(aps.buffer_minutes, 0), aps.start_time::text, aps.end_time::text, sv.name
+		 FROM appointment_services aps
+		 JOIN services sv ON sv.id = aps.service_id
+		 WHERE aps.appointment_id = $1
+		 ORDER BY aps.position`, p.AppointmentID)
+	if err == nil {
+		for itemRows.Next() {
+			var item models.AppointmentService
+			itemRows.Scan(&item.ID, &item.AppointmentID, &item.ServiceID, &item.Position, &item.Price,
+				&item.DurationMinutes, &item.BufferMinutes, &item.StartTime, &item.EndTime, &item.ServiceName)
+			appt.Services = append(appt.Services, item)
+		}
+		itemRows.Close()
+	}
+
+	if format == "json" {
+		c.JSON(http.StatusOK, gin.H{
+			"payment":     p,
+			"appointment": appt,
+		})
+		return
+	}
+
+	invoice := models.Invoice{Payment: p, Appointment: appt, Currency: h.Payments.Currency}
+	h.DB.QueryRow(context.Background(),
+		`SELECT name, address, city, COALESCE(state, ''), COALESCE(zip_code, ''), COALESCE(phone, ''), COALESCE(email, '')
+		 FROM salons WHERE id = $1`, salonID,
+	).Scan(&invoice.Salon.Name, &invoice.Salon.Address, &invoice.Salon.City, &invoice.Salon.State,
+		&invoice.Salon.ZipCode, &invoice.Salon.Phone, &invoice.Salon.Email)
+
+	if format == "html" {
+		page, err := services.InvoiceHTML(&invoice)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s.pdf"`, p.ReceiptNumber))
+	c.Data(http.StatusOK, "application/pdf", services.InvoicePDF(&invoice))
 }
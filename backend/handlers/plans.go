@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"saloon-backend/middleware"
+	"saloon-backend/models"
+	"saloon-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PlanHandler struct {
+	DB    *pgxpool.Pool
+	Plans *services.PlanService
+}
+
+func NewPlanHandler(db *pgxpool.Pool) *PlanHandler {
+	return &PlanHandler{DB: db, Plans: services.NewPlanService(db)}
+}
+
+// GetSalonPlans lists the packages and memberships on sale at a salon, or all of them
+// (also those taken off sale) on the dashboard
+func (h *PlanHandler) GetSalonPlans(c *gin.Context) {
+	salonID := c.Param("id")
+	activeOnly := true
+	if salonID == "" {
+		salonID, activeOnly = c.Param("salon_id"), false
+	}
+
+	plans, err := h.Plans.ListPlans(context.Background(), salonID, activeOnly)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch plans"})
+		return
+	}
+	c.JSON(http.StatusOK, plans)
+}
+
+// CreatePlan adds a package or membership to the salon's offer
+func (h *PlanHandler) CreatePlan(c *gin.Context) {
+	h.savePlan(c, "")
+}
+
+// UpdatePlan changes a plan for future sales; plans already sold keep their terms
+func (h *PlanHandler) UpdatePlan(c *gin.Context) {
+	h.savePlan(c, c.Param("plan_id"))
+}
+
+func (h *PlanHandler) savePlan(c *gin.Context, planID string) {
+	var req models.PrepaidPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validatePlanRequest(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	plan, err := h.Plans.SavePlan(context.Background(), c.Param("salon_id"), planID, req)
+	switch {
+	case errors.Is(err, services.ErrPlanNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPlanServices):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save plan"})
+	case planID == "":
+		c.JSON(http.StatusCreated, plan)
+	default:
+		c.JSON(http.StatusOK, plan)
+	}
+}
+
+// validatePlanRequest checks the credits, validity and discount of a plan. A package
+// needs credits for at least one service and has no member discount; a membership without
+// credits gives unlimited use of its services.
+func validatePlanRequest(req *models.PrepaidPlanRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	switch {
+	case req.Name == "":
+		return fmt.Errorf("name is required")
+	case req.Credits != nil && *req.Credits < 1:
+		return fmt.Errorf("credits must be at least 1")
+	case req.ValidityDays != nil && *req.ValidityDays < 1:
+		return fmt.Errorf("validity_days must be at least 1")
+	case req.MemberDiscountPercent < 0 || req.MemberDiscountPercent > 100:
+		return fmt.Errorf("member_discount_percent must be between 0 and 100")
+	}
+	if req.Kind == services.PlanPackage {
+		switch {
+		case req.Credits == nil:
+			return fmt.Errorf("a package needs credits")
+		case len(req.ServiceIDs) == 0:
+			return fmt.Errorf("a package needs service_ids")
+		case req.MemberDiscountPercent > 0:
+			return fmt.Errorf("only memberships have a member discount")
+		}
+	}
+	if len(req.ServiceIDs) == 0 && req.MemberDiscountPercent == 0 {
+		return fmt.Errorf("a membership needs service_ids or a member discount")
+	}
+	if req.ServiceIDs == nil {
+		req.ServiceIDs = []string{}
+	}
+	return nil
+}
+
+// SellPlan records that a customer bought one of the salon's plans at the counter
+func (h *PlanHandler) SellPlan(c *gin.Context) {
+	var req models.SellPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var isCustomer bool
+	err := h.DB.QueryRow(context.Background(),
+		"SELECT EXISTS(SELECT 1 FROM users WHERE id = $1 AND role = 'customer')", req.CustomerID).Scan(&isCustomer)
+	if err != nil || !isCustomer {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+
+	plan, err := h.Plans.Sell(context.Background(), c.Param("salon_id"), c.Param("plan_id"), req.CustomerID,
+		req.PricePaid, middleware.GetUserID(c))
+	if errors.Is(err, services.ErrPlanNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Plan not found or no longer on sale"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sell plan"})
+		return
+	}
+	c.JSON(http.StatusCreated, plan)
+}
+
+// GetPlanHolders lists the customers holding the salon's plans with the credits they have
+// left, only those still active unless ?all=true, optionally of one ?plan_id=
+func (h *PlanHandler) GetPlanHolders(c *gin.Context) {
+	plans, err := h.Plans.Holdings(context.Background(), services.HoldingsFilter{
+		SalonID:    c.Param("salon_id"),
+		PlanID:     c.Query("plan_id"),
+		ActiveOnly: c.Query("all") != "true",
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch plan holders"})
+		return
+	}
+	c.JSON(http.StatusOK, plans)
+}
+
+// CancelHolding ends a customer's plan, e.g. a membership they stopped paying for
+func (h *PlanHandler) CancelHolding(c *gin.Context) {
+	err := h.Plans.CancelHolding(context.Background(), c.Param("salon_id"), c.Param("customer_plan_id"))
+	if errors.Is(err, services.ErrPlanNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Plan not found or already cancelled"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Plan cancelled"})
+}
+
+// GetMyPlans lists the signed-in customer's packages and memberships with their credits
+// left, of one salon with ?salon_id=
+func (h *PlanHandler) GetMyPlans(c *gin.Context) {
+	plans, err := h.Plans.Holdings(context.Background(), services.HoldingsFilter{
+		UserID:  middleware.GetUserID(c),
+		SalonID: c.Query("salon_id"),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch plans"})
+		return
+	}
+	c.JSON(http.StatusOK, plans)
+}
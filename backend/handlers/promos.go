@@ -2,12 +2,18 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"saloon-backend/middleware"
 	"saloon-backend/models"
+	"saloon-backend/services"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -36,30 +42,118 @@ func (h *PromoHandler) CreatePromo(c *gin.Context) {
 		return
 	}
 
-	var promo models.PromoCode
-	err := h.DB.QueryRow(context.Background(),
-		`INSERT INTO promo_codes (salon_id, code, discount_percent, valid_from, valid_until, max_uses)
-		 VALUES ($1, $2, $3, COALESCE(NULLIF($4,'')::timestamptz, NOW()), NULLIF($5,'')::timestamptz, $6)
-		 RETURNING id, salon_id, code, discount_percent, valid_from, valid_until, max_uses, used_count, is_active, created_at`,
+	if err := validatePromoRequest(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.DB.Begin(context.Background())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create promo code"})
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	var promoID string
+	err = tx.QueryRow(context.Background(),
+		`INSERT INTO promo_codes (salon_id, code, discount_percent, valid_from, valid_until, max_uses,
+		 discount_type, discount_amount, min_order_amount, categories, first_visit_only, max_uses_per_customer,
+		 valid_weekdays, valid_start_time, valid_end_time)
+		 VALUES ($1, $2, $3, COALESCE(NULLIF($4,'')::timestamptz, NOW()), NULLIF($5,'')::timestamptz, $6,
+		 $7, $8, $9, $10, $11, $12, $13, NULLIF($14, '')::time, NULLIF($15, '')::time)
+		 RETURNING id`,
 		salonID, req.Code, req.DiscountPercent, req.ValidFrom, req.ValidUntil, req.MaxUses,
-	).Scan(&promo.ID, &promo.SalonID, &promo.Code, &promo.DiscountPercent,
-		&promo.ValidFrom, &promo.ValidUntil, &promo.MaxUses, &promo.UsedCount,
-		&promo.IsActive, &promo.CreatedAt)
+		req.DiscountType, req.DiscountAmount, req.MinOrderAmount, req.Categories, req.FirstVisitOnly,
+		req.MaxUsesPerCustomer, req.ValidWeekdays, req.ValidStartTime, req.ValidEndTime,
+	).Scan(&promoID)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		c.JSON(http.StatusConflict, gin.H{"error": "This salon already has a promo code " + req.Code})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create promo code", "details": err.Error()})
+		return
+	}
+
+	if len(req.ServiceIDs) > 0 {
+		tag, err := tx.Exec(context.Background(),
+			`INSERT INTO promo_code_services (promo_code_id, service_id)
+			 SELECT $1, id FROM services WHERE id = ANY($2) AND salon_id = $3`,
+			promoID, req.ServiceIDs, salonID)
+		if err != nil || int(tag.RowsAffected()) != len(req.ServiceIDs) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "service_ids must be services of this salon"})
+			return
+		}
+	}
 
+	var promo models.PromoCode
+	err = services.ScanPromo(tx.QueryRow(context.Background(),
+		`SELECT `+services.PromoColumns+` FROM promo_codes pc WHERE pc.id = $1`, promoID), &promo)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create promo code", "details": err.Error()})
 		return
 	}
+	if err := tx.Commit(context.Background()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create promo code"})
+		return
+	}
 
 	c.JSON(http.StatusCreated, promo)
 }
 
+// validatePromoRequest checks the discount and the rules of a new promo code and fills in
+// defaults
+func validatePromoRequest(req *models.CreatePromoRequest) error {
+	req.Code = strings.TrimSpace(req.Code)
+	switch req.DiscountType {
+	case "", services.PromoPercent:
+		req.DiscountType, req.DiscountAmount = services.PromoPercent, 0
+		if req.DiscountPercent <= 0 || req.DiscountPercent > 100 {
+			return fmt.Errorf("discount_percent must be more than 0 and at most 100")
+		}
+	case services.PromoFixed:
+		req.DiscountPercent = 0
+		if req.DiscountAmount <= 0 {
+			return fmt.Errorf("discount_amount must be positive")
+		}
+	default:
+		return fmt.Errorf("discount_type must be percent or fixed")
+	}
+	if req.MinOrderAmount < 0 {
+		return fmt.Errorf("min_order_amount cannot be negative")
+	}
+	if req.MaxUsesPerCustomer != nil && *req.MaxUsesPerCustomer < 1 {
+		return fmt.Errorf("max_uses_per_customer must be at least 1")
+	}
+	for _, d := range req.ValidWeekdays {
+		if d < 0 || d > 6 {
+			return fmt.Errorf("valid_weekdays must be between 0 (Sunday) and 6 (Saturday)")
+		}
+	}
+	for _, t := range []string{req.ValidStartTime, req.ValidEndTime} {
+		if _, err := time.Parse("15:04", t); t != "" && err != nil {
+			return fmt.Errorf("valid_start_time and valid_end_time must be HH:MM")
+		}
+	}
+	if req.ValidStartTime != "" && req.ValidEndTime != "" && req.ValidStartTime >= req.ValidEndTime {
+		return fmt.Errorf("valid_start_time must be before valid_end_time")
+	}
+	if req.Categories == nil {
+		req.Categories = []string{}
+	}
+	if req.ValidWeekdays == nil {
+		req.ValidWeekdays = []int{}
+	}
+	return nil
+}
+
 func (h *PromoHandler) GetSalonPromos(c *gin.Context) {
 	salonID := c.Param("salon_id")
 
 	rows, err := h.DB.Query(context.Background(),
-		`SELECT id, salon_id, code, discount_percent, valid_from, valid_until, max_uses, used_count, is_active, created_at
-		 FROM promo_codes WHERE salon_id = $1 ORDER BY created_at DESC`, salonID)
+		`SELECT `+services.PromoColumns+`
+		 FROM promo_codes pc WHERE pc.salon_id = $1 ORDER BY pc.created_at DESC`, salonID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch promo codes"})
 		return
@@ -69,17 +163,32 @@ func (h *PromoHandler) GetSalonPromos(c *gin.Context) {
 	var promos []models.PromoCode
 	for rows.Next() {
 		var p models.PromoCode
-		rows.Scan(&p.ID, &p.SalonID, &p.Code, &p.DiscountPercent, &p.ValidFrom,
-			&p.ValidUntil, &p.MaxUses, &p.UsedCount, &p.IsActive, &p.CreatedAt)
+		services.ScanPromo(rows, &p)
 		promos = append(promos, p)
 	}
+	rows.Close()
 	if promos == nil {
 		promos = []models.PromoCode{}
 	}
 
+	// Redemptions and the revenue of the bookings that used each code
+	stats, err := services.LoadPromoStats(context.Background(), h.DB, salonID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch promo stats"})
+		return
+	}
+	for i := range promos {
+		if promos[i].Stats = stats[promos[i].ID]; promos[i].Stats == nil {
+			promos[i].Stats = &models.PromoStats{}
+		}
+	}
+
 	c.JSON(http.StatusOK, promos)
 }
 
+// ValidatePromo tells the customer whether a code can be used and why not. Sending the
+// booking's service_ids, date and start_time checks every rule and returns the discount;
+// without them only the rules that don't depend on the booking are checked.
 func (h *PromoHandler) ValidatePromo(c *gin.Context) {
 	code := c.Query("code")
 	salonID := c.Query("salon_id")
@@ -89,29 +198,36 @@ func (h *PromoHandler) ValidatePromo(c *gin.Context) {
 		return
 	}
 
-	var promo models.PromoCode
-	err := h.DB.QueryRow(context.Background(),
-		`SELECT id, salon_id, code, discount_percent, valid_from, valid_until, max_uses, used_count, is_active
-		 FROM promo_codes 
-		 WHERE code = $1 AND salon_id = $2 AND is_active = true 
-		 AND (valid_until IS NULL OR valid_until > NOW())`,
-		code, salonID).Scan(&promo.ID, &promo.SalonID, &promo.Code, &promo.DiscountPercent,
-		&promo.ValidFrom, &promo.ValidUntil, &promo.MaxUses, &promo.UsedCount, &promo.IsActive)
-
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"valid": false, "error": "Invalid or expired promo code"})
+	promo, discount, err := services.CheckPromo(context.Background(), h.DB, services.PromoCheck{
+		SalonID:    salonID,
+		CustomerID: middleware.GetUserID(c),
+		Code:       code,
+		ServiceIDs: services.RequestedServiceIDs(c.Query("service_id"), c.QueryArray("service_ids")),
+		Date:       c.Query("date"),
+		StartTime:  c.Query("start_time"),
+	})
+	var promoErr *services.PromoError
+	if errors.As(err, &promoErr) {
+		status := http.StatusOK
+		if promoErr.Reason == services.PromoNotFound {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"valid": false, "reason": promoErr.Reason, "error": promoErr.Message})
 		return
 	}
-
-	if promo.MaxUses != nil && promo.UsedCount >= *promo.MaxUses {
-		c.JSON(http.StatusOK, gin.H{"valid": false, "error": "Promo code has reached maximum uses"})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"valid": false, "error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"valid":            true,
-		"discount_percent": promo.DiscountPercent,
 		"code":             promo.Code,
+		"discount_type":    promo.DiscountType,
+		"discount_percent": promo.DiscountPercent,
+		"discount_amount":  promo.DiscountAmount,
+		"min_order_amount": promo.MinOrderAmount,
+		"discount":         discount,
 	})
 }
 
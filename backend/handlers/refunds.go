@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"saloon-backend/middleware"
+	"saloon-backend/models"
+	"saloon-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// salonPayment loads the payment in the route, provided it belongs to the route's salon
+func (h *PaymentHandler) salonPayment(c *gin.Context) (*models.Payment, error) {
+	var p models.Payment
+	err := scanPayment(h.DB.QueryRow(context.Background(),
+		`SELECT `+paymentColumns+` FROM payments p
+		 JOIN appointments a ON a.id = p.appointment_id
+		 WHERE p.id = $1 AND a.salon_id = $2`, c.Param("id"), c.Param("salon_id")), &p)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetRefunds returns the refund ledger of a payment, oldest first
+func (h *PaymentHandler) GetRefunds(c *gin.Context) {
+	p, err := h.salonPayment(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+
+	rows, err := h.DB.Query(context.Background(),
+		`SELECT r.id, r.payment_id, r.amount, COALESCE(r.reason, ''), r.actor_id, r.provider, r.provider_ref,
+		 r.created_at, COALESCE(u.name, '')
+		 FROM refunds r
+		 LEFT JOIN users u ON u.id = r.actor_id
+		 WHERE r.payment_id = $1
+		 ORDER BY r.created_at`, p.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch refunds"})
+		return
+	}
+	defer rows.Close()
+
+	var refunds []models.Refund
+	for rows.Next() {
+		var r models.Refund
+		rows.Scan(&r.ID, &r.PaymentID, &r.Amount, &r.Reason, &r.ActorID, &r.Provider, &r.ProviderRef,
+			&r.CreatedAt, &r.ActorName)
+		refunds = append(refunds, r)
+	}
+	if refunds == nil {
+		refunds = []models.Refund{}
+	}
+
+	c.JSON(http.StatusOK, refunds)
+}
+
+// RefundPayment refunds part of a collected payment, or everything left when no amount is
+// given. The payment becomes partially_refunded or refunded once the refund is in the ledger.
+func (h *PaymentHandler) RefundPayment(c *gin.Context) {
+	var req models.CreateRefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	p, err := h.salonPayment(c)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+
+	refund, err := h.Payments.RefundPayment(c.Request.Context(), p.ID, req.Amount, req.Reason, middleware.GetUserID(c))
+	if errors.Is(err, services.ErrRefundTooLarge) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	p, _ = h.salonPayment(c)
+	if refund == nil {
+		// Accepted by the provider but not settled yet
+		c.JSON(http.StatusAccepted, gin.H{"message": "Refund submitted; it is recorded once the provider confirms it", "payment": p})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"refund": refund, "payment": p})
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"saloon-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ReminderHandler struct {
+	DB *pgxpool.Pool
+}
+
+func NewReminderHandler(db *pgxpool.Pool) *ReminderHandler {
+	return &ReminderHandler{DB: db}
+}
+
+// GetReminderJobs lists a salon's reminder jobs, e.g. ?status=dead for the dead-letter queue
+func (h *ReminderHandler) GetReminderJobs(c *gin.Context) {
+	salonID := c.Param("salon_id")
+	status := c.Query("status")
+
+	rows, err := h.DB.Query(context.Background(),
+		`SELECT j.id, j.appointment_id, j.offset_minutes, j.run_at, j.status, j.attempts, j.max_attempts,
+		 j.last_error, j.sent_at, j.created_at, a.appointment_date::text, a.start_time::text, u.name
+		 FROM reminder_jobs j
+		 JOIN appointments a ON a.id = j.appointment_id
+		 JOIN users u ON u.id = a.customer_id
+		 WHERE a.salon_id = $1 AND ($2 = '' OR j.status = $2)
+		 ORDER BY j.run_at DESC LIMIT 200`, salonID, status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reminder jobs"})
+		return
+	}
+	defer rows.Close()
+
+	var jobs []models.ReminderJob
+	for rows.Next() {
+		var j models.ReminderJob
+		rows.Scan(&j.ID, &j.AppointmentID, &j.OffsetMinutes, &j.RunAt, &j.Status, &j.Attempts, &j.MaxAttempts,
+			&j.LastError, &j.SentAt, &j.CreatedAt, &j.AppointmentDate, &j.StartTime, &j.CustomerName)
+		jobs = append(jobs, j)
+	}
+	if jobs == nil {
+		jobs = []models.ReminderJob{}
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+// RetryReminderJob puts a dead-lettered job back on the queue
+func (h *ReminderHandler) RetryReminderJob(c *gin.Context) {
+	salonID := c.Param("salon_id")
+	jobID := c.Param("job_id")
+
+	result, err := h.DB.Exec(context.Background(),
+		`UPDATE reminder_jobs j SET status = 'pending', attempts = 0, run_at = NOW(), updated_at = NOW()
+		 FROM appointments a
+		 WHERE j.id = $1 AND j.status = 'dead' AND a.id = j.appointment_id AND a.salon_id = $2`,
+		jobID, salonID)
+	if err != nil || result.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dead reminder job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Reminder requeued"})
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"saloon-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ResourceHandler struct {
+	DB *pgxpool.Pool
+}
+
+func NewResourceHandler(db *pgxpool.Pool) *ResourceHandler {
+	return &ResourceHandler{DB: db}
+}
+
+// GetResources lists the active resources of a salon
+func (h *ResourceHandler) GetResources(c *gin.Context) {
+	rows, err := h.DB.Query(context.Background(),
+		`SELECT id, salon_id, name, COALESCE(resource_type, ''), capacity, is_active, created_at, updated_at
+		 FROM salon_resources WHERE salon_id = $1 AND is_active = true
+		 ORDER BY name`, c.Param("salon_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch resources"})
+		return
+	}
+	defer rows.Close()
+
+	var resources []models.SalonResource
+	for rows.Next() {
+		var r models.SalonResource
+		rows.Scan(&r.ID, &r.SalonID, &r.Name, &r.ResourceType, &r.Capacity, &r.IsActive, &r.CreatedAt, &r.UpdatedAt)
+		resources = append(resources, r)
+	}
+	if resources == nil {
+		resources = []models.SalonResource{}
+	}
+
+	c.JSON(http.StatusOK, resources)
+}
+
+func (h *ResourceHandler) CreateResource(c *gin.Context) {
+	var req models.CreateResourceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Capacity == 0 {
+		req.Capacity = 1
+	}
+	if req.Capacity < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "capacity must be at least 1"})
+		return
+	}
+
+	var r models.SalonResource
+	err := h.DB.QueryRow(context.Background(),
+		`INSERT INTO salon_resources (salon_id, name, resource_type, capacity)
+		 VALUES ($1, $2, NULLIF($3, ''), $4)
+		 RETURNING id, salon_id, name, COALESCE(resource_type, ''), capacity, is_active, created_at, updated_at`,
+		c.Param("salon_id"), req.Name, req.ResourceType, req.Capacity,
+	).Scan(&r.ID, &r.SalonID, &r.Name, &r.ResourceType, &r.Capacity, &r.IsActive, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create resource", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, r)
+}
+
+// UpdateResource renames a resource or changes its capacity. Lowering the capacity does not
+// touch existing bookings; it only applies to new ones.
+func (h *ResourceHandler) UpdateResource(c *gin.Context) {
+	var req models.CreateResourceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Capacity == 0 {
+		req.Capacity = 1
+	}
+	if req.Capacity < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "capacity must be at least 1"})
+		return
+	}
+
+	var r models.SalonResource
+	err := h.DB.QueryRow(context.Background(),
+		`UPDATE salon_resources SET name = $1, resource_type = NULLIF($2, ''), capacity = $3, updated_at = NOW()
+		 WHERE id = $4 AND salon_id = $5
+		 RETURNING id, salon_id, name, COALESCE(resource_type, ''), capacity, is_active, created_at, updated_at`,
+		req.Name, req.ResourceType, req.Capacity, c.Param("resource_id"), c.Param("salon_id"),
+	).Scan(&r.ID, &r.SalonID, &r.Name, &r.ResourceType, &r.Capacity, &r.IsActive, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Resource not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, r)
+}
+
+// DeleteResource deactivates a resource; services stop waiting on it
+func (h *ResourceHandler) DeleteResource(c *gin.Context) {
+	tag, err := h.DB.Exec(context.Background(),
+		"UPDATE salon_resources SET is_active = false, updated_at = NOW() WHERE id = $1 AND salon_id = $2",
+		c.Param("resource_id"), c.Param("salon_id"))
+	if err != nil || tag.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Resource not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Resource deleted"})
+}
+
+// GetServiceResources lists the resources a service needs
+func (h *ResourceHandler) GetServiceResources(c *gin.Context) {
+	rows, err := h.DB.Query(context.Background(),
+		`SELECT sr.resource_id, r.name, sr.quantity
+		 FROM service_resources sr
+		 JOIN salon_resources r ON r.id = sr.resource_id
+		 JOIN services sv ON sv.id = sr.service_id
+		 WHERE sr.service_id = $1 AND sv.salon_id = $2 AND r.is_active = true
+		 ORDER BY r.name`, c.Param("service_id"), c.Param("salon_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch service resources"})
+		return
+	}
+	defer rows.Close()
+
+	var resources []models.ServiceResource
+	for rows.Next() {
+		var r models.ServiceResource
+		rows.Scan(&r.ResourceID, &r.ResourceName, &r.Quantity)
+		resources = append(resources, r)
+	}
+	if resources == nil {
+		resources = []models.ServiceResource{}
+	}
+
+	c.JSON(http.StatusOK, resources)
+}
+
+// UpdateServiceResources replaces the resources a service needs
+func (h *ResourceHandler) UpdateServiceResources(c *gin.Context) {
+	salonID := c.Param("salon_id")
+	serviceID := c.Param("service_id")
+	var req models.UpdateServiceResourcesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var exists bool
+	h.DB.QueryRow(context.Background(),
+		"SELECT EXISTS(SELECT 1 FROM services WHERE id = $1 AND salon_id = $2)", serviceID, salonID).Scan(&exists)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service not found"})
+		return
+	}
+
+	tx, err := h.DB.Begin(context.Background())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update service resources"})
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	tx.Exec(context.Background(), "DELETE FROM service_resources WHERE service_id = $1", serviceID)
+	for _, r := range req.Resources {
+		if r.Quantity == 0 {
+			r.Quantity = 1
+		}
+		// Only resources of the same salon can be mapped
+		tag, err := tx.Exec(context.Background(),
+			`INSERT INTO service_resources (service_id, resource_id, quantity)
+			 SELECT $1, id, $3 FROM salon_resources WHERE id = $2 AND salon_id = $4 AND is_active = true
+			 ON CONFLICT (service_id, resource_id) DO UPDATE SET quantity = EXCLUDED.quantity`,
+			serviceID, r.ResourceID, r.Quantity, salonID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid resource", "details": err.Error()})
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Resource not found: " + r.ResourceID})
+			return
+		}
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update service resources"})
+		return
+	}
+
+	h.GetServiceResources(c)
+}
@@ -2,23 +2,29 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"strings"
 
 	"saloon-backend/middleware"
 	"saloon-backend/models"
+	"saloon-backend/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type ReviewHandler struct {
-	DB *pgxpool.Pool
+	DB      *pgxpool.Pool
+	Reviews *services.ReviewService
 }
 
 func NewReviewHandler(db *pgxpool.Pool) *ReviewHandler {
-	return &ReviewHandler{DB: db}
+	return &ReviewHandler{DB: db, Reviews: services.NewReviewService(db)}
 }
 
+// CreateReview posts a review of the customer's own completed appointment, one per
+// appointment
 func (h *ReviewHandler) CreateReview(c *gin.Context) {
 	var req models.CreateReviewRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -26,52 +32,77 @@ func (h *ReviewHandler) CreateReview(c *gin.Context) {
 		return
 	}
 
-	customerID := middleware.GetUserID(c)
-
-	var staffID, appointmentID *string
-	if req.StaffID != "" {
-		staffID = &req.StaffID
+	review, err := h.Reviews.Create(context.Background(), middleware.GetUserID(c), req)
+	if errors.Is(err, services.ErrReviewNotAllowed) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
 	}
-	if req.AppointmentID != "" {
-		appointmentID = &req.AppointmentID
+	if errors.Is(err, services.ErrReviewExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
 	}
-
-	var review models.Review
-	err := h.DB.QueryRow(context.Background(),
-		`INSERT INTO reviews (customer_id, salon_id, staff_id, appointment_id, rating, comment)
-		 VALUES ($1, $2, $3, $4, $5, $6)
-		 RETURNING id, customer_id, salon_id, staff_id, appointment_id, rating, COALESCE(comment,''), created_at, updated_at`,
-		customerID, req.SalonID, staffID, appointmentID, req.Rating, req.Comment,
-	).Scan(&review.ID, &review.CustomerID, &review.SalonID, &review.StaffID,
-		&review.AppointmentID, &review.Rating, &review.Comment, &review.CreatedAt, &review.UpdatedAt)
-
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create review", "details": err.Error()})
 		return
 	}
 
-	// Update salon average rating
-	h.DB.Exec(context.Background(),
-		`UPDATE salons SET 
-		 rating = (SELECT COALESCE(AVG(rating), 0) FROM reviews WHERE salon_id = $1),
-		 total_reviews = (SELECT COUNT(*) FROM reviews WHERE salon_id = $1),
-		 updated_at = NOW()
-		 WHERE id = $1`, req.SalonID)
-
 	c.JSON(http.StatusCreated, review)
 }
 
+// UpdateReview changes the customer's review within the edit window
+func (h *ReviewHandler) UpdateReview(c *gin.Context) {
+	var req models.UpdateReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	review, err := h.Reviews.Update(context.Background(), middleware.GetUserID(c), c.Param("id"), req.Rating, req.Comment)
+	if errors.Is(err, services.ErrReviewNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrReviewLocked) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update review"})
+		return
+	}
+	c.JSON(http.StatusOK, review)
+}
+
+// DeleteReview removes the customer's review
+func (h *ReviewHandler) DeleteReview(c *gin.Context) {
+	err := h.Reviews.Delete(context.Background(), middleware.GetUserID(c), c.Param("id"))
+	if errors.Is(err, services.ErrReviewNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete review"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Review deleted"})
+}
+
+// GetSalonReviews lists a salon's reviews, newest first, only verified visits with
+// ?verified=true. The dashboard also lists the hidden ones.
 func (h *ReviewHandler) GetSalonReviews(c *gin.Context) {
 	salonID := c.Param("id")
+	withHidden := false
+	if salonID == "" {
+		salonID, withHidden = c.Param("salon_id"), true
+	}
 
 	rows, err := h.DB.Query(context.Background(),
-		`SELECT r.id, r.customer_id, r.salon_id, r.staff_id, r.appointment_id, 
-		 r.rating, COALESCE(r.comment,''), r.created_at, r.updated_at,
+		`SELECT `+services.ReviewColumns+`,
 		 u.name, COALESCE(u.avatar_url,'')
 		 FROM reviews r
 		 JOIN users u ON u.id = r.customer_id
-		 WHERE r.salon_id = $1
-		 ORDER BY r.created_at DESC`, salonID)
+		 WHERE r.salon_id = $1 AND (r.is_verified OR NOT $2) AND (NOT r.is_hidden OR $3)
+		 ORDER BY r.created_at DESC`, salonID, c.Query("verified") == "true", withHidden)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
 		return
@@ -82,7 +113,8 @@ func (h *ReviewHandler) GetSalonReviews(c *gin.Context) {
 	for rows.Next() {
 		var r models.Review
 		rows.Scan(&r.ID, &r.CustomerID, &r.SalonID, &r.StaffID, &r.AppointmentID,
-			&r.Rating, &r.Comment, &r.CreatedAt, &r.UpdatedAt,
+			&r.Rating, &r.Comment, &r.CreatedAt, &r.UpdatedAt, &r.IsVerified,
+			&r.OwnerReply, &r.OwnerRepliedAt, &r.IsHidden, &r.HiddenReason,
 			&r.CustomerName, &r.CustomerAvatar)
 		reviews = append(reviews, r)
 	}
@@ -92,3 +124,110 @@ func (h *ReviewHandler) GetSalonReviews(c *gin.Context) {
 
 	c.JSON(http.StatusOK, reviews)
 }
+
+// ReplyToReview sets the salon's public answer to a review
+func (h *ReviewHandler) ReplyToReview(c *gin.Context) {
+	var req models.ReviewReplyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.TrimSpace(req.Reply) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrReplyInvalid.Error()})
+		return
+	}
+	h.reply(c, req.Reply)
+}
+
+// DeleteReviewReply removes the salon's answer to a review
+func (h *ReviewHandler) DeleteReviewReply(c *gin.Context) {
+	h.reply(c, "")
+}
+
+func (h *ReviewHandler) reply(c *gin.Context, reply string) {
+	review, err := h.Reviews.Reply(context.Background(), c.Param("salon_id"), c.Param("review_id"),
+		middleware.GetUserID(c), reply)
+	if errors.Is(err, services.ErrReviewNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrReplyInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save reply"})
+		return
+	}
+	c.JSON(http.StatusOK, review)
+}
+
+// ReportReview flags a review for the moderators: any signed-in user on /reviews/:id, a
+// salon owner for their own salon's reviews on the dashboard
+func (h *ReviewHandler) ReportReview(c *gin.Context) {
+	var req models.ReportReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reviewID := c.Param("id")
+	if reviewID == "" {
+		reviewID = c.Param("review_id")
+	}
+	report, err := h.Reviews.Report(context.Background(), reviewID, c.Param("salon_id"), middleware.GetUserID(c), req)
+	if errors.Is(err, services.ErrReviewNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrReportExists) || errors.Is(err, services.ErrReviewHidden) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to report review"})
+		return
+	}
+	c.JSON(http.StatusCreated, report)
+}
+
+// GetModerationQueue lists the reported reviews awaiting a decision, or the hidden ones
+// with ?hidden=true
+func (h *ReviewHandler) GetModerationQueue(c *gin.Context) {
+	items, err := h.Reviews.ModerationQueue(context.Background(), c.Query("hidden") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch moderation queue"})
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// HideReview hides a review from the salon's listing and rating
+func (h *ReviewHandler) HideReview(c *gin.Context) {
+	var req models.HideReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	review, err := h.Reviews.Hide(context.Background(), c.Param("id"), middleware.GetUserID(c), req.Reason)
+	h.moderated(c, review, err)
+}
+
+// RestoreReview shows a hidden review again, or keeps a reported one, dismissing its
+// reports
+func (h *ReviewHandler) RestoreReview(c *gin.Context) {
+	review, err := h.Reviews.Restore(context.Background(), c.Param("id"), middleware.GetUserID(c))
+	h.moderated(c, review, err)
+}
+
+func (h *ReviewHandler) moderated(c *gin.Context, review *models.Review, err error) {
+	if errors.Is(err, services.ErrReviewNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to moderate review"})
+		return
+	}
+	c.JSON(http.StatusOK, review)
+}
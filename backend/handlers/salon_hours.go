@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"saloon-backend/models"
+	"saloon-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSalonHours returns the opening hours of every weekday, Sunday first
+func (h *SalonHandler) GetSalonHours(c *gin.Context) {
+	week, err := services.SalonWeek(context.Background(), h.DB, c.Param("salon_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Salon not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, week)
+}
+
+// UpdateSalonHours sets the hours of the weekdays in the request; other weekdays keep theirs
+func (h *SalonHandler) UpdateSalonHours(c *gin.Context) {
+	salonID := c.Param("salon_id")
+	var req models.UpdateSalonHoursRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateSalonHours(req.Hours); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.DB.Begin(context.Background())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update salon hours"})
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	for _, day := range req.Hours {
+		_, err := tx.Exec(context.Background(),
+			`INSERT INTO salon_hours (salon_id, day_of_week, open_time, close_time, is_closed)
+			 VALUES ($1, $2, $3, $4, $5)
+			 ON CONFLICT (salon_id, day_of_week) DO UPDATE
+			 SET open_time = $3, close_time = $4, is_closed = $5`,
+			salonID, day.DayOfWeek, day.OpenTime, day.CloseTime, day.IsClosed)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update salon hours", "details": err.Error()})
+			return
+		}
+	}
+	if err := tx.Commit(context.Background()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update salon hours"})
+		return
+	}
+
+	week, err := services.SalonWeek(context.Background(), h.DB, salonID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, week)
+}
+
+// validateSalonHours checks each weekday is listed once with open_time before close_time
+func validateSalonHours(hours []models.SalonHours) error {
+	seen := make(map[int]bool)
+	for i := range hours {
+		day := &hours[i]
+		if day.DayOfWeek < 0 || day.DayOfWeek > 6 {
+			return fmt.Errorf("day_of_week must be between 0 and 6")
+		}
+		if seen[day.DayOfWeek] {
+			return fmt.Errorf("day %d is listed twice", day.DayOfWeek)
+		}
+		seen[day.DayOfWeek] = true
+
+		// A closed day still stores times; keep them valid
+		if day.IsClosed && day.OpenTime == "" && day.CloseTime == "" {
+			day.OpenTime, day.CloseTime = "00:00", "00:00"
+		}
+		open, err := services.ParseClock(day.OpenTime)
+		if err != nil {
+			return fmt.Errorf("invalid open_time %q, use HH:MM", day.OpenTime)
+		}
+		closeAt, err := services.ParseClock(day.CloseTime)
+		if err != nil {
+			return fmt.Errorf("invalid close_time %q, use HH:MM", day.CloseTime)
+		}
+		if !day.IsClosed && !closeAt.After(open) {
+			return fmt.Errorf("close_time must be after open_time (day %d)", day.DayOfWeek)
+		}
+	}
+	return nil
+}
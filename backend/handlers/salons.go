@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"net/http"
+	"slices"
 	"strconv"
 
 	"saloon-backend/middleware"
@@ -49,7 +50,7 @@ func (h *SalonHandler) ListSalons(c *gin.Context) {
 	argIdx := 1
 
 	// Base query
-	selectCols := "s.id, s.owner_id, s.name, s.address, s.city, COALESCE(s.state,''), COALESCE(s.zip_code,''), COALESCE(s.lat,0), COALESCE(s.lng,0), COALESCE(s.phone,''), COALESCE(s.email,''), COALESCE(s.description,''), s.rating, s.total_reviews, COALESCE(s.image_url,''), s.is_active, s.opening_time::text, s.closing_time::text, s.created_at, s.updated_at"
+	selectCols := "s.id, s.owner_id, s.name, s.address, s.city, COALESCE(s.state,''), COALESCE(s.zip_code,''), COALESCE(s.lat,0), COALESCE(s.lng,0), COALESCE(s.phone,''), COALESCE(s.email,''), COALESCE(s.description,''), s.rating, s.total_reviews, COALESCE(s.image_url,''), s.is_active, s.opening_time::text, s.closing_time::text, s.slot_interval_minutes, s.minimize_gaps, s.timezone, s.reminder_offsets, s.deposit_hold_minutes, s.created_at, s.updated_at"
 
 	// Distance calculation if lat/lng provided
 	distanceCol := ""
@@ -136,7 +137,7 @@ func (h *SalonHandler) ListSalons(c *gin.Context) {
 		scanArgs := []interface{}{
 			&s.ID, &s.OwnerID, &s.Name, &s.Address, &s.City, &s.State, &s.ZipCode,
 			&s.Lat, &s.Lng, &s.Phone, &s.Email, &s.Description, &s.Rating,
-			&s.TotalReviews, &s.ImageURL, &s.IsActive, &s.OpeningTime, &s.ClosingTime,
+			&s.TotalReviews, &s.ImageURL, &s.IsActive, &s.OpeningTime, &s.ClosingTime, &s.SlotIntervalMinutes, &s.MinimizeGaps, &s.Timezone, &s.ReminderOffsets, &s.DepositHoldMinutes,
 			&s.CreatedAt, &s.UpdatedAt,
 		}
 		if distanceCol != "" {
@@ -177,11 +178,11 @@ func (h *SalonHandler) GetSalon(c *gin.Context) {
 		`SELECT id, owner_id, name, address, city, COALESCE(state,''), COALESCE(zip_code,''),
 		 COALESCE(lat,0), COALESCE(lng,0), COALESCE(phone,''), COALESCE(email,''), 
 		 COALESCE(description,''), rating, total_reviews, COALESCE(image_url,''), 
-		 is_active, opening_time::text, closing_time::text, created_at, updated_at 
+		 is_active, opening_time::text, closing_time::text, slot_interval_minutes, minimize_gaps, timezone, reminder_offsets, deposit_hold_minutes, created_at, updated_at 
 		 FROM salons WHERE id = $1`, salonID,
 	).Scan(&s.ID, &s.OwnerID, &s.Name, &s.Address, &s.City, &s.State, &s.ZipCode,
 		&s.Lat, &s.Lng, &s.Phone, &s.Email, &s.Description, &s.Rating,
-		&s.TotalReviews, &s.ImageURL, &s.IsActive, &s.OpeningTime, &s.ClosingTime,
+		&s.TotalReviews, &s.ImageURL, &s.IsActive, &s.OpeningTime, &s.ClosingTime, &s.SlotIntervalMinutes, &s.MinimizeGaps, &s.Timezone, &s.ReminderOffsets, &s.DepositHoldMinutes,
 		&s.CreatedAt, &s.UpdatedAt)
 
 	if err != nil {
@@ -197,6 +198,8 @@ func (h *SalonHandler) GetSalon(c *gin.Context) {
 		s.IsFavorited = &fav
 	}
 
+	s.WeeklyHours, _ = services.SalonWeek(context.Background(), h.DB, salonID)
+
 	c.JSON(http.StatusOK, s)
 }
 
@@ -214,6 +217,37 @@ func (h *SalonHandler) CreateSalon(c *gin.Context) {
 	if req.ClosingTime == "" {
 		req.ClosingTime = "21:00"
 	}
+	if len(req.ReminderOffsets) == 0 {
+		req.ReminderOffsets = []int{60, 20}
+	}
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	if req.DepositHoldMinutes == 0 {
+		req.DepositHoldMinutes = 30
+	}
+	if req.SlotIntervalMinutes == nil {
+		req.SlotIntervalMinutes = new(int)
+	}
+	if req.MinimizeGaps == nil {
+		req.MinimizeGaps = new(bool)
+	}
+	if !validSlotInterval(req.SlotIntervalMinutes) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "slot_interval_minutes must be 5, 10, 15 or 30"})
+		return
+	}
+	if req.Timezone != "" && !services.ValidTimezone(req.Timezone) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "timezone must be an IANA name such as Europe/London"})
+		return
+	}
+	if !validReminderOffsets(req.ReminderOffsets) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reminder_offsets must be up to 5 distinct values between 5 and 10080 minutes"})
+		return
+	}
+	if req.DepositHoldMinutes != 0 && (req.DepositHoldMinutes < 5 || req.DepositHoldMinutes > 1440) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "deposit_hold_minutes must be between 5 and 1440"})
+		return
+	}
 
 	// Handle Image Upload
 	file, header, err := c.Request.FormFile("image")
@@ -237,18 +271,18 @@ func (h *SalonHandler) CreateSalon(c *gin.Context) {
 	// Insert into Database
 	var s models.Salon
 	err = h.DB.QueryRow(context.Background(),
-		`INSERT INTO salons (owner_id, name, address, city, state, zip_code, lat, lng, phone, email, description, image_url, opening_time, closing_time) 
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		`INSERT INTO salons (owner_id, name, address, city, state, zip_code, lat, lng, phone, email, description, image_url, opening_time, closing_time, slot_interval_minutes, minimize_gaps, timezone, reminder_offsets, deposit_hold_minutes) 
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
 		 RETURNING id, owner_id, name, address, city, COALESCE(state,''), COALESCE(zip_code,''),
 		 COALESCE(lat,0), COALESCE(lng,0), COALESCE(phone,''), COALESCE(email,''), 
 		 COALESCE(description,''), rating, total_reviews, COALESCE(image_url,''), 
-		 is_active, opening_time::text, closing_time::text, created_at, updated_at`,
+		 is_active, opening_time::text, closing_time::text, slot_interval_minutes, minimize_gaps, timezone, reminder_offsets, deposit_hold_minutes, created_at, updated_at`,
 		ownerID, req.Name, req.Address, req.City, req.State, req.ZipCode,
 		req.Lat, req.Lng, req.Phone, req.Email, req.Description, req.ImageURL,
-		req.OpeningTime, req.ClosingTime,
+		req.OpeningTime, req.ClosingTime, req.SlotIntervalMinutes, req.MinimizeGaps, req.Timezone, req.ReminderOffsets, req.DepositHoldMinutes,
 	).Scan(&s.ID, &s.OwnerID, &s.Name, &s.Address, &s.City, &s.State, &s.ZipCode,
 		&s.Lat, &s.Lng, &s.Phone, &s.Email, &s.Description, &s.Rating,
-		&s.TotalReviews, &s.ImageURL, &s.IsActive, &s.OpeningTime, &s.ClosingTime,
+		&s.TotalReviews, &s.ImageURL, &s.IsActive, &s.OpeningTime, &s.ClosingTime, &s.SlotIntervalMinutes, &s.MinimizeGaps, &s.Timezone, &s.ReminderOffsets, &s.DepositHoldMinutes,
 		&s.CreatedAt, &s.UpdatedAt)
 
 	if err != nil {
@@ -282,6 +316,22 @@ func (h *SalonHandler) UpdateSalon(c *gin.Context) {
 	if req.ClosingTime == "" {
 		req.ClosingTime = "21:00"
 	}
+	if req.SlotIntervalMinutes != nil && !validSlotInterval(req.SlotIntervalMinutes) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "slot_interval_minutes must be 5, 10, 15 or 30"})
+		return
+	}
+	if req.Timezone != "" && !services.ValidTimezone(req.Timezone) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "timezone must be an IANA name such as Europe/London"})
+		return
+	}
+	if !validReminderOffsets(req.ReminderOffsets) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reminder_offsets must be up to 5 distinct values between 5 and 10080 minutes"})
+		return
+	}
+	if req.DepositHoldMinutes != 0 && (req.DepositHoldMinutes < 5 || req.DepositHoldMinutes > 1440) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "deposit_hold_minutes must be between 5 and 1440"})
+		return
+	}
 
 	// Handle Optional Image Upload
 	file, header, err := c.Request.FormFile("image")
@@ -295,22 +345,43 @@ func (h *SalonHandler) UpdateSalon(c *gin.Context) {
 		}
 	}
 
+	ctx := context.Background()
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update salon"})
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Reminder jobs were timed from the old timezone and offsets
+	var oldTimezone string
+	var oldOffsets []int
+	err = tx.QueryRow(ctx, "SELECT timezone, reminder_offsets FROM salons WHERE id = $1 FOR UPDATE",
+		salonID).Scan(&oldTimezone, &oldOffsets)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Salon not found"})
+		return
+	}
+
 	var s models.Salon
-	err = h.DB.QueryRow(context.Background(),
+	err = tx.QueryRow(ctx,
 		`UPDATE salons SET name=$1, address=$2, city=$3, state=$4, zip_code=$5, lat=$6, lng=$7,
 		 phone=$8, email=$9, description=$10, image_url=COALESCE(NULLIF($11, ''), image_url), 
-		 opening_time=$12, closing_time=$13, updated_at=NOW()
-		 WHERE id=$14
+		 opening_time=$12, closing_time=$13, slot_interval_minutes=COALESCE($14, slot_interval_minutes),
+		 minimize_gaps=COALESCE($15, minimize_gaps),
+		 timezone=COALESCE(NULLIF($16, ''), timezone), reminder_offsets=COALESCE($17, reminder_offsets),
+		 deposit_hold_minutes=COALESCE(NULLIF($18, 0), deposit_hold_minutes), updated_at=NOW()
+		 WHERE id=$19
 		 RETURNING id, owner_id, name, address, city, COALESCE(state,''), COALESCE(zip_code,''),
 		 COALESCE(lat,0), COALESCE(lng,0), COALESCE(phone,''), COALESCE(email,''), 
 		 COALESCE(description,''), rating, total_reviews, COALESCE(image_url,''), 
-		 is_active, opening_time::text, closing_time::text, created_at, updated_at`,
+		 is_active, opening_time::text, closing_time::text, slot_interval_minutes, minimize_gaps, timezone, reminder_offsets, deposit_hold_minutes, created_at, updated_at`,
 		req.Name, req.Address, req.City, req.State, req.ZipCode, req.Lat, req.Lng,
 		req.Phone, req.Email, req.Description, req.ImageURL,
-		req.OpeningTime, req.ClosingTime, salonID,
+		req.OpeningTime, req.ClosingTime, req.SlotIntervalMinutes, req.MinimizeGaps, req.Timezone, req.ReminderOffsets, req.DepositHoldMinutes, salonID,
 	).Scan(&s.ID, &s.OwnerID, &s.Name, &s.Address, &s.City, &s.State, &s.ZipCode,
 		&s.Lat, &s.Lng, &s.Phone, &s.Email, &s.Description, &s.Rating,
-		&s.TotalReviews, &s.ImageURL, &s.IsActive, &s.OpeningTime, &s.ClosingTime,
+		&s.TotalReviews, &s.ImageURL, &s.IsActive, &s.OpeningTime, &s.ClosingTime, &s.SlotIntervalMinutes, &s.MinimizeGaps, &s.Timezone, &s.ReminderOffsets, &s.DepositHoldMinutes,
 		&s.CreatedAt, &s.UpdatedAt)
 
 	if err != nil {
@@ -318,10 +389,48 @@ func (h *SalonHandler) UpdateSalon(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update salon"})
 		return
 	}
+	if s.Timezone != oldTimezone || !slices.Equal(s.ReminderOffsets, oldOffsets) {
+		if err := services.RequeueSalonReminders(ctx, tx, salonID); err != nil {
+			fmt.Printf("Error requeueing reminders: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update salon"})
+			return
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update salon"})
+		return
+	}
 
 	c.JSON(http.StatusOK, s)
 }
 
+// validSlotInterval defaults an omitted interval to 30 minutes and rejects unsupported ones
+func validSlotInterval(minutes *int) bool {
+	switch *minutes {
+	case 0:
+		*minutes = 30
+	case 5, 10, 15, 30:
+	default:
+		return false
+	}
+	return true
+}
+
+// validReminderOffsets accepts up to five distinct lead times of 5 minutes to 7 days
+func validReminderOffsets(offsets []int) bool {
+	if len(offsets) > 5 {
+		return false
+	}
+	seen := make(map[int]bool)
+	for _, o := range offsets {
+		if o < 5 || o > 7*24*60 || seen[o] {
+			return false
+		}
+		seen[o] = true
+	}
+	return true
+}
+
 func (h *SalonHandler) GetGallery(c *gin.Context) {
 	salonID := c.Param("id")
 
@@ -355,7 +464,7 @@ func (h *SalonHandler) GetMySalons(c *gin.Context) {
 		`SELECT id, owner_id, name, address, city, COALESCE(state,''), COALESCE(zip_code,''),
 		 COALESCE(lat,0), COALESCE(lng,0), COALESCE(phone,''), COALESCE(email,''), 
 		 COALESCE(description,''), rating, total_reviews, COALESCE(image_url,''), 
-		 is_active, opening_time::text, closing_time::text, created_at, updated_at 
+		 is_active, opening_time::text, closing_time::text, slot_interval_minutes, minimize_gaps, timezone, reminder_offsets, deposit_hold_minutes, created_at, updated_at 
 		 FROM salons WHERE owner_id = $1 ORDER BY created_at DESC`, ownerID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch salons"})
@@ -368,7 +477,7 @@ func (h *SalonHandler) GetMySalons(c *gin.Context) {
 		var s models.Salon
 		rows.Scan(&s.ID, &s.OwnerID, &s.Name, &s.Address, &s.City, &s.State, &s.ZipCode,
 			&s.Lat, &s.Lng, &s.Phone, &s.Email, &s.Description, &s.Rating,
-			&s.TotalReviews, &s.ImageURL, &s.IsActive, &s.OpeningTime, &s.ClosingTime,
+			&s.TotalReviews, &s.ImageURL, &s.IsActive, &s.OpeningTime, &s.ClosingTime, &s.SlotIntervalMinutes, &s.MinimizeGaps, &s.Timezone, &s.ReminderOffsets, &s.DepositHoldMinutes,
 			&s.CreatedAt, &s.UpdatedAt)
 		salons = append(salons, s)
 	}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"saloon-backend/middleware"
+	"saloon-backend/models"
+	"saloon-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// seriesAccessible checks the series belongs to the salon in the route (dashboard)
+// or to the authenticated customer (customer routes)
+func (h *AppointmentHandler) seriesAccessible(c *gin.Context, seriesID string) bool {
+	var ok bool
+	if salonID := c.Param("salon_id"); salonID != "" {
+		h.DB.QueryRow(context.Background(),
+			"SELECT EXISTS(SELECT 1 FROM appointment_series WHERE id = $1 AND salon_id = $2)",
+			seriesID, salonID).Scan(&ok)
+	} else {
+		h.DB.QueryRow(context.Background(),
+			"SELECT EXISTS(SELECT 1 FROM appointment_series WHERE id = $1 AND customer_id = $2)",
+			seriesID, middleware.GetUserID(c)).Scan(&ok)
+	}
+	return ok
+}
+
+func (h *AppointmentHandler) CreateSeries(c *gin.Context) {
+	var req models.CreateSeriesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	customerID := middleware.GetUserID(c)
+
+	resp, err := h.BookingService.CreateSeries(c.Request.Context(), customerID, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+
+	if h.PushService != nil && resp.BookedCount > 0 {
+		go h.PushService.SendToUser(context.Background(), customerID, services.PushPayload{
+			Title: "Recurring Booking Confirmed! ✅",
+			Body:  fmt.Sprintf("%d of %d appointments in your series were booked.", resp.BookedCount, len(resp.Occurrences)),
+			Icon:  "/vite.svg",
+			URL:   "/appointments",
+		})
+	}
+}
+
+func (h *AppointmentHandler) GetSeries(c *gin.Context) {
+	seriesID := c.Param("series_id")
+	if !h.seriesAccessible(c, seriesID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Series not found"})
+		return
+	}
+
+	series, err := h.BookingService.GetSeries(c.Request.Context(), seriesID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, series)
+}
+
+// GetSalonSeries lists the active recurring series of a salon
+func (h *AppointmentHandler) GetSalonSeries(c *gin.Context) {
+	salonID := c.Param("salon_id")
+
+	rows, err := h.DB.Query(context.Background(),
+		`SELECT id, customer_id, salon_id, staff_id, service_ids::text[], frequency, interval, count, until_date::text,
+		 start_date::text, start_time::text, COALESCE(notes,''), status, created_at, updated_at
+		 FROM appointment_series WHERE salon_id = $1 AND status = 'active'
+		 ORDER BY created_at DESC`, salonID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch series"})
+		return
+	}
+	defer rows.Close()
+
+	var list []models.AppointmentSeries
+	for rows.Next() {
+		var s models.AppointmentSeries
+		rows.Scan(&s.ID, &s.CustomerID, &s.SalonID, &s.StaffID, &s.ServiceIDs,
+			&s.Frequency, &s.Interval, &s.Count, &s.UntilDate,
+			&s.StartDate, &s.StartTime, &s.Notes, &s.Status, &s.CreatedAt, &s.UpdatedAt)
+		list = append(list, s)
+	}
+	if list == nil {
+		list = []models.AppointmentSeries{}
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *AppointmentHandler) CancelSeries(c *gin.Context) {
+	seriesID := c.Param("series_id")
+	var req models.CancelSeriesRequest
+	c.ShouldBindJSON(&req)
+
+	if !h.seriesAccessible(c, seriesID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Series not found"})
+		return
+	}
+
+	// A customer owes the late-cancel fee of every occurrence inside the free-cancel window
+	// and has to accept it first; cancellations by the salon are always free
+	var quotes map[string]*models.CancellationQuote
+	var fees float64
+	if c.Param("salon_id") == "" {
+		var err error
+		quotes, err = h.BookingService.QuoteSeriesCancellation(c.Request.Context(), seriesID, req.FromDate)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		var credits int
+		fees, credits = services.SeriesCancellationCost(quotes)
+		if (fees > 0 || credits > 0) && !req.AcceptFee {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":             "Cancelling now incurs late cancellation fees or forfeits plan credits; resend with accept_fee to confirm",
+				"fees":              fees,
+				"credits_forfeited": credits,
+			})
+			return
+		}
+	}
+
+	cancelled, err := h.BookingService.CancelSeries(c.Request.Context(), seriesID, req.FromDate, middleware.GetUserID(c), quotes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Series cancelled", "cancelled_count": len(cancelled), "fees": fees})
+
+	// Cancelled by the salon: let the customer know
+	if c.Param("salon_id") != "" && h.PushService != nil && len(cancelled) > 0 {
+		go h.PushService.SendToUser(context.Background(), cancelled[0].CustomerID, services.PushPayload{
+			Title: "Recurring Appointments Cancelled",
+			Body:  fmt.Sprintf("The salon cancelled %d upcoming appointments in your series.", len(cancelled)),
+			Icon:  "/vite.svg",
+			URL:   "/appointments",
+		})
+	}
+
+	// Notify waitlist for each freed slot
+	if h.WaitlistService != nil {
+		for _, a := range cancelled {
+			go h.WaitlistService.AutoAssignWaitlist(context.Background(), a.SalonID, a.ServiceID, a.StaffID, a.AppointmentDate, a.StartTime)
+		}
+	}
+}
+
+func (h *AppointmentHandler) RescheduleSeries(c *gin.Context) {
+	seriesID := c.Param("series_id")
+	var req models.RescheduleSeriesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.seriesAccessible(c, seriesID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Series not found"})
+		return
+	}
+
+	results, err := h.BookingService.RescheduleSeries(c.Request.Context(), seriesID, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	conflicts := 0
+	for _, r := range results {
+		if r.Status == "conflict" {
+			conflicts++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Series rescheduled",
+		"occurrences":    results,
+		"conflict_count": conflicts,
+	})
+}
@@ -2,10 +2,12 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 
 	"saloon-backend/middleware"
 	"saloon-backend/models"
+	"saloon-backend/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -27,7 +29,7 @@ func (h *ServiceHandler) ListServices(c *gin.Context) {
 	category := c.Query("category")
 
 	query := `SELECT id, salon_id, name, COALESCE(description,''), price, duration_minutes, 
-			  buffer_minutes, COALESCE(category,''), is_active, created_at, updated_at 
+			  buffer_minutes, COALESCE(category,''), is_active, created_at, updated_at, deposit_type, deposit_value 
 			  FROM services WHERE salon_id = $1 AND is_active = true`
 	args := []interface{}{salonID}
 
@@ -48,7 +50,7 @@ func (h *ServiceHandler) ListServices(c *gin.Context) {
 	for rows.Next() {
 		var s models.Service
 		rows.Scan(&s.ID, &s.SalonID, &s.Name, &s.Description, &s.Price, &s.DurationMinutes,
-			&s.BufferMinutes, &s.Category, &s.IsActive, &s.CreatedAt, &s.UpdatedAt)
+			&s.BufferMinutes, &s.Category, &s.IsActive, &s.CreatedAt, &s.UpdatedAt, &s.DepositType, &s.DepositValue)
 		services = append(services, s)
 	}
 	if services == nil {
@@ -65,6 +67,10 @@ func (h *ServiceHandler) CreateService(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := validateDeposit(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// Verify ownership
 	ownerID := middleware.GetUserID(c)
@@ -77,12 +83,12 @@ func (h *ServiceHandler) CreateService(c *gin.Context) {
 
 	var s models.Service
 	err := h.DB.QueryRow(context.Background(),
-		`INSERT INTO services (salon_id, name, description, price, duration_minutes, buffer_minutes, category)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7)
-		 RETURNING id, salon_id, name, COALESCE(description,''), price, duration_minutes, buffer_minutes, COALESCE(category,''), is_active, created_at, updated_at`,
-		salonID, req.Name, req.Description, req.Price, req.DurationMinutes, req.BufferMinutes, req.Category,
+		`INSERT INTO services (salon_id, name, description, price, duration_minutes, buffer_minutes, category, deposit_type, deposit_value)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		 RETURNING id, salon_id, name, COALESCE(description,''), price, duration_minutes, buffer_minutes, COALESCE(category,''), is_active, created_at, updated_at, deposit_type, deposit_value`,
+		salonID, req.Name, req.Description, req.Price, req.DurationMinutes, req.BufferMinutes, req.Category, req.DepositType, req.DepositValue,
 	).Scan(&s.ID, &s.SalonID, &s.Name, &s.Description, &s.Price, &s.DurationMinutes,
-		&s.BufferMinutes, &s.Category, &s.IsActive, &s.CreatedAt, &s.UpdatedAt)
+		&s.BufferMinutes, &s.Category, &s.IsActive, &s.CreatedAt, &s.UpdatedAt, &s.DepositType, &s.DepositValue)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create service", "details": err.Error()})
@@ -99,15 +105,20 @@ func (h *ServiceHandler) UpdateService(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := validateDeposit(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	var s models.Service
 	err := h.DB.QueryRow(context.Background(),
-		`UPDATE services SET name=$1, description=$2, price=$3, duration_minutes=$4, buffer_minutes=$5, category=$6, updated_at=NOW()
-		 WHERE id=$7
-		 RETURNING id, salon_id, name, COALESCE(description,''), price, duration_minutes, buffer_minutes, COALESCE(category,''), is_active, created_at, updated_at`,
-		req.Name, req.Description, req.Price, req.DurationMinutes, req.BufferMinutes, req.Category, serviceID,
+		`UPDATE services SET name=$1, description=$2, price=$3, duration_minutes=$4, buffer_minutes=$5, category=$6,
+		 deposit_type=$7, deposit_value=$8, updated_at=NOW()
+		 WHERE id=$9
+		 RETURNING id, salon_id, name, COALESCE(description,''), price, duration_minutes, buffer_minutes, COALESCE(category,''), is_active, created_at, updated_at, deposit_type, deposit_value`,
+		req.Name, req.Description, req.Price, req.DurationMinutes, req.BufferMinutes, req.Category, req.DepositType, req.DepositValue, serviceID,
 	).Scan(&s.ID, &s.SalonID, &s.Name, &s.Description, &s.Price, &s.DurationMinutes,
-		&s.BufferMinutes, &s.Category, &s.IsActive, &s.CreatedAt, &s.UpdatedAt)
+		&s.BufferMinutes, &s.Category, &s.IsActive, &s.CreatedAt, &s.UpdatedAt, &s.DepositType, &s.DepositValue)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update service"})
@@ -129,3 +140,22 @@ func (h *ServiceHandler) DeleteService(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Service deleted successfully"})
 }
+
+// validateDeposit checks the deposit a service requires; an omitted type means none
+func validateDeposit(req *models.CreateServiceRequest) error {
+	switch req.DepositType {
+	case "", services.FeeNone:
+		req.DepositType, req.DepositValue = services.FeeNone, 0
+	case services.FeeFlat:
+		if req.DepositValue <= 0 || req.DepositValue > req.Price {
+			return fmt.Errorf("a flat deposit must be more than 0 and at most the price")
+		}
+	case services.FeePercent:
+		if req.DepositValue <= 0 || req.DepositValue > 100 {
+			return fmt.Errorf("a percent deposit must be more than 0 and at most 100")
+		}
+	default:
+		return fmt.Errorf("deposit_type must be none, flat or percent")
+	}
+	return nil
+}
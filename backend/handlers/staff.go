@@ -7,6 +7,7 @@ import (
 
 	"saloon-backend/middleware"
 	"saloon-backend/models"
+	"saloon-backend/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -115,37 +116,18 @@ func (h *StaffHandler) CreateStaff(c *gin.Context) {
 			s.ID, svcID)
 	}
 
-	// Fetch salon hours for defaults
-	var openTime, closeTime string
-	h.DB.QueryRow(context.Background(), "SELECT opening_time::text, closing_time::text FROM salons WHERE id = $1", salonID).Scan(&openTime, &closeTime)
-	if openTime == "" {
-		openTime = "09:00"
-		closeTime = "21:00"
-	}
-
-	// Assign default working hours based on salon hours
-	defaultHours := []struct {
-		day   int
-		start string
-		end   string
-		off   bool
-	}{
-		{0, openTime, closeTime, true},  // Sunday (Off)
-		{1, openTime, closeTime, false}, // Monday
-		{2, openTime, closeTime, false}, // Tuesday
-		{3, openTime, closeTime, false}, // Wednesday
-		{4, openTime, closeTime, false}, // Thursday
-		{5, openTime, closeTime, false}, // Friday
-		{6, openTime, closeTime, false}, // Saturday
+	// Assign default working hours: the salon's hours of each weekday, off on closed days
+	week, err := services.SalonWeek(context.Background(), h.DB, salonID)
+	if err != nil {
+		fmt.Printf("Failed to fetch salon hours for staff %s: %v\n", s.ID, err)
 	}
-
-	for _, dh := range defaultHours {
+	for _, day := range week {
 		_, err := h.DB.Exec(context.Background(),
 			`INSERT INTO staff_working_hours (staff_id, day_of_week, start_time, end_time, is_off)
 			 VALUES ($1, $2, $3, $4, $5)`,
-			s.ID, dh.day, dh.start, dh.end, dh.off)
+			s.ID, day.DayOfWeek, day.OpenTime, day.CloseTime, day.IsClosed)
 		if err != nil {
-			fmt.Printf("Failed to set default hours for staff %s day %d: %v\n", s.ID, dh.day, err)
+			fmt.Printf("Failed to set default hours for staff %s day %d: %v\n", s.ID, day.DayOfWeek, err)
 		}
 	}
 
@@ -205,8 +187,9 @@ func (h *StaffHandler) GetWorkingHours(c *gin.Context) {
 	staffID := c.Param("staff_id")
 
 	rows, err := h.DB.Query(context.Background(),
-		`SELECT id, staff_id, day_of_week, start_time::text, end_time::text, is_off 
-		 FROM staff_working_hours WHERE staff_id = $1 ORDER BY day_of_week`, staffID)
+		`SELECT id, staff_id, day_of_week, start_time::text, end_time::text, is_off, kind
+		 FROM staff_working_hours WHERE staff_id = $1
+		 ORDER BY day_of_week, kind = 'break', start_time`, staffID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch working hours"})
 		return
@@ -216,7 +199,7 @@ func (h *StaffHandler) GetWorkingHours(c *gin.Context) {
 	var hours []models.StaffWorkingHours
 	for rows.Next() {
 		var h models.StaffWorkingHours
-		rows.Scan(&h.ID, &h.StaffID, &h.DayOfWeek, &h.StartTime, &h.EndTime, &h.IsOff)
+		rows.Scan(&h.ID, &h.StaffID, &h.DayOfWeek, &h.StartTime, &h.EndTime, &h.IsOff, &h.Kind)
 		hours = append(hours, h)
 	}
 	if hours == nil {
@@ -234,20 +217,100 @@ func (h *StaffHandler) UpdateWorkingHours(c *gin.Context) {
 		return
 	}
 
+	if err := validateWorkingHours(req.Hours); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.DB.Begin(context.Background())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update working hours"})
+		return
+	}
+	defer tx.Rollback(context.Background())
+
 	// Delete existing and re-insert
-	h.DB.Exec(context.Background(), "DELETE FROM staff_working_hours WHERE staff_id = $1", staffID)
+	tx.Exec(context.Background(), "DELETE FROM staff_working_hours WHERE staff_id = $1", staffID)
 
 	for _, wh := range req.Hours {
-		h.DB.Exec(context.Background(),
-			`INSERT INTO staff_working_hours (staff_id, day_of_week, start_time, end_time, is_off)
-			 VALUES ($1, $2, $3, $4, $5) ON CONFLICT (staff_id, day_of_week) DO UPDATE 
-			 SET start_time = $3, end_time = $4, is_off = $5`,
-			staffID, wh.DayOfWeek, wh.StartTime, wh.EndTime, wh.IsOff)
+		_, err := tx.Exec(context.Background(),
+			`INSERT INTO staff_working_hours (staff_id, day_of_week, start_time, end_time, is_off, kind)
+			 VALUES ($1, $2, $3, $4, $5, $6)`,
+			staffID, wh.DayOfWeek, wh.StartTime, wh.EndTime, wh.IsOff, wh.Kind)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update working hours", "details": err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update working hours"})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Working hours updated"})
 }
 
+// validateWorkingHours defaults the kind of each row to shift and checks that shifts on the
+// same day don't overlap and that every break falls inside one of that day's shifts
+func validateWorkingHours(hours []models.StaffWorkingHours) error {
+	shifts := make(map[int][]services.Interval)
+	var breaks []models.StaffWorkingHours
+	for i := range hours {
+		wh := &hours[i]
+		if wh.Kind == "" {
+			wh.Kind = services.HoursShift
+		}
+		if wh.Kind != services.HoursShift && wh.Kind != services.HoursBreak {
+			return fmt.Errorf("kind must be shift or break")
+		}
+		if wh.DayOfWeek < 0 || wh.DayOfWeek > 6 {
+			return fmt.Errorf("day_of_week must be between 0 and 6")
+		}
+		start, err := services.ParseClock(wh.StartTime)
+		if err != nil {
+			return fmt.Errorf("invalid start_time %q, use HH:MM", wh.StartTime)
+		}
+		end, err := services.ParseClock(wh.EndTime)
+		if err != nil {
+			return fmt.Errorf("invalid end_time %q, use HH:MM", wh.EndTime)
+		}
+		if wh.IsOff {
+			continue
+		}
+		if !end.After(start) {
+			return fmt.Errorf("end_time must be after start_time (day %d, %s-%s)", wh.DayOfWeek, wh.StartTime, wh.EndTime)
+		}
+		if wh.Kind == services.HoursBreak {
+			breaks = append(breaks, *wh)
+			continue
+		}
+		span := services.Interval{Start: start, End: end}
+		for _, other := range shifts[wh.DayOfWeek] {
+			if span.Overlaps(other) {
+				return fmt.Errorf("shifts overlap on day %d", wh.DayOfWeek)
+			}
+		}
+		shifts[wh.DayOfWeek] = append(shifts[wh.DayOfWeek], span)
+	}
+
+	for _, b := range breaks {
+		start, _ := services.ParseClock(b.StartTime)
+		end, _ := services.ParseClock(b.EndTime)
+		inside := false
+		for _, sh := range shifts[b.DayOfWeek] {
+			if !start.Before(sh.Start) && !end.After(sh.End) {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			return fmt.Errorf("break %s-%s on day %d is not inside a shift", b.StartTime, b.EndTime, b.DayOfWeek)
+		}
+	}
+	return nil
+}
+
 // GetStaffForService returns staff members who can perform a specific service
 func (h *StaffHandler) GetStaffForService(c *gin.Context) {
 	salonID := c.Param("id")
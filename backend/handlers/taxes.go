@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"saloon-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadTaxConfig reads the tax settings and rates of a salon
+func (h *SalonHandler) loadTaxConfig(salonID string) (*models.SalonTaxConfig, error) {
+	var cfg models.SalonTaxConfig
+	err := h.DB.QueryRow(context.Background(),
+		"SELECT prices_include_tax FROM salons WHERE id = $1", salonID).Scan(&cfg.PricesIncludeTax)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := h.DB.Query(context.Background(),
+		`SELECT id, name, rate_percent, COALESCE(category, '') FROM tax_rates
+		 WHERE salon_id = $1 ORDER BY category NULLS FIRST, created_at, name`, salonID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r models.TaxRate
+		rows.Scan(&r.ID, &r.Name, &r.RatePercent, &r.Category)
+		cfg.Rates = append(cfg.Rates, r)
+	}
+	if cfg.Rates == nil {
+		cfg.Rates = []models.TaxRate{}
+	}
+	return &cfg, nil
+}
+
+// GetTaxConfig returns the salon's tax rates and whether its prices include tax
+func (h *SalonHandler) GetTaxConfig(c *gin.Context) {
+	cfg, err := h.loadTaxConfig(c.Param("salon_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Salon not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, cfg)
+}
+
+// UpdateTaxConfig replaces the salon's tax rates. Payments already created keep the tax
+// they were created with.
+func (h *SalonHandler) UpdateTaxConfig(c *gin.Context) {
+	salonID := c.Param("salon_id")
+	var req models.UpdateTaxConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateTaxRates(req.Rates); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.DB.Begin(context.Background())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tax settings"})
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(context.Background(),
+		"UPDATE salons SET prices_include_tax = $1, updated_at = NOW() WHERE id = $2", req.PricesIncludeTax, salonID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tax settings"})
+		return
+	}
+	_, err = tx.Exec(context.Background(), "DELETE FROM tax_rates WHERE salon_id = $1", salonID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tax settings"})
+		return
+	}
+	for _, r := range req.Rates {
+		_, err := tx.Exec(context.Background(),
+			`INSERT INTO tax_rates (salon_id, name, rate_percent, category)
+			 VALUES ($1, $2, $3, NULLIF($4, ''))`,
+			salonID, r.Name, r.RatePercent, r.Category)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tax settings", "details": err.Error()})
+			return
+		}
+	}
+	if err := tx.Commit(context.Background()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tax settings"})
+		return
+	}
+
+	cfg, err := h.loadTaxConfig(salonID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, cfg)
+}
+
+// validateTaxRates checks every rate is named, between 0 and 100 percent, and listed once
+// per category
+func validateTaxRates(rates []models.TaxRate) error {
+	seen := make(map[string]bool)
+	for i := range rates {
+		r := &rates[i]
+		r.Name = strings.TrimSpace(r.Name)
+		r.Category = strings.TrimSpace(r.Category)
+		if r.Name == "" {
+			return fmt.Errorf("every tax rate needs a name")
+		}
+		if r.RatePercent < 0 || r.RatePercent > 100 {
+			return fmt.Errorf("rate_percent of %q must be between 0 and 100", r.Name)
+		}
+		key := strings.ToLower(r.Category) + "|" + strings.ToLower(r.Name)
+		if seen[key] {
+			return fmt.Errorf("tax rate %q is listed twice", r.Name)
+		}
+		seen[key] = true
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"saloon-backend/middleware"
+	"saloon-backend/models"
+	"saloon-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type TimeOffHandler struct {
+	DB             *pgxpool.Pool
+	Push           *services.PushService
+	Payments       *services.PaymentService
+	BookingService *services.BookingService
+}
+
+func NewTimeOffHandler(db *pgxpool.Pool, scheduler *services.Scheduler, push *services.PushService, payments *services.PaymentService) *TimeOffHandler {
+	booking := services.NewBookingService(db, scheduler)
+	booking.SetPushService(push)
+	return &TimeOffHandler{DB: db, Push: push, Payments: payments, BookingService: booking}
+}
+
+// staffName checks that the staff member belongs to the salon and returns their name
+func (h *TimeOffHandler) staffName(c *gin.Context) (string, bool) {
+	var name string
+	err := h.DB.QueryRow(context.Background(),
+		"SELECT name FROM staff WHERE id = $1 AND salon_id = $2",
+		c.Param("staff_id"), c.Param("salon_id")).Scan(&name)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Staff member not found"})
+		return "", false
+	}
+	return name, true
+}
+
+// CreateTimeOff adds time off or custom hours for a staff member and returns the
+// appointments that no longer fit their schedule
+func (h *TimeOffHandler) CreateTimeOff(c *gin.Context) {
+	salonID := c.Param("salon_id")
+	staffID := c.Param("staff_id")
+	if _, ok := h.staffName(c); !ok {
+		return
+	}
+
+	var req models.CreateTimeOffRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Kind == "" {
+		req.Kind = services.TimeOffOff
+	}
+	if msg := validateTimeOff(req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var t models.StaffTimeOff
+	err := h.DB.QueryRow(context.Background(),
+		`INSERT INTO staff_time_off (staff_id, start_date, end_date, kind, start_time, end_time, reason)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING id, staff_id, start_date::text, end_date::text, kind,
+		 start_time::text, end_time::text, COALESCE(reason, ''), created_at`,
+		staffID, req.StartDate, req.EndDate, req.Kind, req.StartTime, req.EndTime, req.Reason,
+	).Scan(&t.ID, &t.StaffID, &t.StartDate, &t.EndDate, &t.Kind,
+		&t.StartTime, &t.EndTime, &t.Reason, &t.CreatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create time off", "details": err.Error()})
+		return
+	}
+
+	ids, err := h.BookingService.TimeOffConflicts(c.Request.Context(), salonID, staffID, t.StartDate, t.EndDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	conflicts := h.conflictingBookings(ids)
+
+	c.JSON(http.StatusCreated, models.CreateTimeOffResponse{
+		TimeOff:             t,
+		ConflictingCount:    len(conflicts),
+		ConflictingBookings: conflicts,
+	})
+}
+
+// validateTimeOff returns an error message for an invalid request, or ""
+func validateTimeOff(req models.CreateTimeOffRequest) string {
+	start, err := time.Parse("2006-01-02", req.StartDate)
+	if err != nil {
+		return "Invalid start_date format, use YYYY-MM-DD"
+	}
+	end, err := time.Parse("2006-01-02", req.EndDate)
+	if err != nil {
+		return "Invalid end_date format, use YYYY-MM-DD"
+	}
+	if end.Before(start) {
+		return "end_date must not be before start_date"
+	}
+	if req.Kind != services.TimeOffOff && req.Kind != services.TimeOffHours {
+		return "kind must be off or hours"
+	}
+	if (req.StartTime == nil) != (req.EndTime == nil) {
+		return "start_time and end_time must be given together"
+	}
+	if req.StartTime == nil {
+		if req.Kind == services.TimeOffHours {
+			return "start_time and end_time are required for custom hours"
+		}
+		return ""
+	}
+	from, err := time.Parse("15:04", *req.StartTime)
+	if err != nil {
+		return "Invalid start_time format, use HH:MM"
+	}
+	to, err := time.Parse("15:04", *req.EndTime)
+	if err != nil {
+		return "Invalid end_time format, use HH:MM"
+	}
+	if !to.After(from) {
+		return "end_time must be after start_time"
+	}
+	return ""
+}
+
+// GetTimeOff lists a staff member's time off and custom hours
+func (h *TimeOffHandler) GetTimeOff(c *gin.Context) {
+	if _, ok := h.staffName(c); !ok {
+		return
+	}
+
+	rows, err := h.DB.Query(context.Background(),
+		`SELECT id, staff_id, start_date::text, end_date::text, kind,
+		 start_time::text, end_time::text, COALESCE(reason, ''), created_at
+		 FROM staff_time_off WHERE staff_id = $1
+		 ORDER BY start_date ASC, start_time ASC NULLS FIRST`, c.Param("staff_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch time off"})
+		return
+	}
+	defer rows.Close()
+
+	var entries []models.StaffTimeOff
+	for rows.Next() {
+		var t models.StaffTimeOff
+		rows.Scan(&t.ID, &t.StaffID, &t.StartDate, &t.EndDate, &t.Kind,
+			&t.StartTime, &t.EndTime, &t.Reason, &t.CreatedAt)
+		entries = append(entries, t)
+	}
+	if entries == nil {
+		entries = []models.StaffTimeOff{}
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// DeleteTimeOff removes a time off entry
+func (h *TimeOffHandler) DeleteTimeOff(c *gin.Context) {
+	if _, ok := h.staffName(c); !ok {
+		return
+	}
+
+	tag, err := h.DB.Exec(context.Background(),
+		"DELETE FROM staff_time_off WHERE id = $1 AND staff_id = $2",
+		c.Param("time_off_id"), c.Param("staff_id"))
+	if err != nil || tag.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Time off not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Time off deleted"})
+}
+
+// CancelConflicting cancels the appointments that conflict with a time off entry
+func (h *TimeOffHandler) CancelConflicting(c *gin.Context) {
+	staffName, ok := h.staffName(c)
+	if !ok {
+		return
+	}
+	ids, ok := h.entryConflicts(c)
+	if !ok {
+		return
+	}
+
+	rows, err := h.DB.Query(context.Background(),
+		`UPDATE appointments SET status = 'cancelled', updated_at = NOW()
+		 WHERE id = ANY($1) AND status NOT IN ('cancelled', 'completed', 'no_show')
+		 RETURNING id, customer_id, appointment_date::text, start_time::text`, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update appointments"})
+		return
+	}
+	type cancelled struct{ id, customerID, date, start string }
+	var done []cancelled
+	for rows.Next() {
+		var a cancelled
+		if err := rows.Scan(&a.id, &a.customerID, &a.date, &a.start); err == nil {
+			done = append(done, a)
+		}
+	}
+	rows.Close()
+
+	var salonName string
+	_ = h.DB.QueryRow(context.Background(), "SELECT name FROM salons WHERE id = $1", c.Param("salon_id")).Scan(&salonName)
+
+	for _, a := range done {
+		msg := fmt.Sprintf("%s is unavailable on %s at %s, so your appointment at %s was cancelled. Please rebook at your convenience.",
+			staffName, a.date, a.start, salonName)
+		if h.Push != nil {
+			h.Push.SendToUser(context.Background(), a.customerID, services.PushPayload{
+				Title: "Appointment Cancelled",
+				Body:  msg,
+				URL:   "/appointments",
+			})
+		}
+		_, _ = h.DB.Exec(context.Background(),
+			`INSERT INTO notifications (user_id, title, message, type, appointment_id)
+			 VALUES ($1, $2, $3, $4, $5)`,
+			a.customerID, "Appointment Cancelled", msg, "appointment_cancelled", a.id)
+	}
+	cancelledIDs := make([]string, len(done))
+	for i, a := range done {
+		cancelledIDs[i] = a.id
+	}
+	// Release or refund each payment through the provider
+	if h.Payments != nil {
+		h.Payments.CancelPayments(context.Background(), cancelledIDs, middleware.GetUserID(c))
+	}
+	if err := services.SettleDiscounts(context.Background(), h.DB, cancelledIDs, services.PromoOnCancel); err != nil {
+		log.Printf("⚠️  Discounts of appointments cancelled by time off: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Conflicting appointments cancelled and customers notified",
+		"cancelled_count": len(done),
+	})
+}
+
+// ReassignConflicting moves the appointments that conflict with a time off entry to other
+// staff members who are free at the same time. Appointments nobody can take are left as they
+// are and reported, so they can be cancelled or rescheduled by hand.
+func (h *TimeOffHandler) ReassignConflicting(c *gin.Context) {
+	staffName, ok := h.staffName(c)
+	if !ok {
+		return
+	}
+
+	var req models.ReassignConflictingRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	ids, ok := h.entryConflicts(c)
+	if !ok {
+		return
+	}
+
+	results := []models.ReassignResult{}
+	reassigned := 0
+	for _, id := range ids {
+		result := models.ReassignResult{AppointmentID: id}
+		newStaffID, err := h.BookingService.ReassignAppointment(c.Request.Context(), id, req.StaffPreference)
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+		reassigned++
+		result.NewStaffID = newStaffID
+
+		var customerID, apptDate, apptTime string
+		_ = h.DB.QueryRow(context.Background(),
+			`SELECT a.customer_id, a.appointment_date::text, a.start_time::text, st.name
+			 FROM appointments a JOIN staff st ON st.id = a.staff_id WHERE a.id = $1`,
+			id).Scan(&customerID, &apptDate, &apptTime, &result.NewStaffName)
+		results = append(results, result)
+
+		msg := fmt.Sprintf("%s is unavailable on %s at %s. %s will take care of you instead.",
+			staffName, apptDate, apptTime, result.NewStaffName)
+		if h.Push != nil {
+			h.Push.SendToUser(context.Background(), customerID, services.PushPayload{
+				Title: "Your stylist has changed",
+				Body:  msg,
+				URL:   "/appointments",
+			})
+		}
+		_, err = h.DB.Exec(context.Background(),
+			`INSERT INTO notifications (user_id, title, message, type, appointment_id)
+			 VALUES ($1, $2, $3, $4, $5)`,
+			customerID, "Your stylist has changed", msg, "appointment_reassigned", id)
+		if err != nil {
+			log.Printf("⚠️  Reassignment notification for appointment %s: %v", id, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reassigned_count": reassigned,
+		"unassigned_count": len(ids) - reassigned,
+		"results":          results,
+	})
+}
+
+// entryConflicts loads the time off entry named in the URL and returns the ids of the
+// appointments that conflict with the staff member's schedule over its dates
+func (h *TimeOffHandler) entryConflicts(c *gin.Context) ([]string, bool) {
+	var startDate, endDate string
+	err := h.DB.QueryRow(context.Background(),
+		"SELECT start_date::text, end_date::text FROM staff_time_off WHERE id = $1 AND staff_id = $2",
+		c.Param("time_off_id"), c.Param("staff_id")).Scan(&startDate, &endDate)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Time off not found"})
+		return nil, false
+	}
+
+	ids, err := h.BookingService.TimeOffConflicts(c.Request.Context(), c.Param("salon_id"), c.Param("staff_id"), startDate, endDate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return ids, true
+}
+
+// conflictingBookings loads the display rows for a list of appointment ids
+func (h *TimeOffHandler) conflictingBookings(ids []string) []models.ConflictingAppointment {
+	conflicts := []models.ConflictingAppointment{}
+	if len(ids) == 0 {
+		return conflicts
+	}
+
+	rows, err := h.DB.Query(context.Background(),
+		`SELECT a.id, u.name, sv.name, a.appointment_date::text, a.start_time::text, a.status
+		 FROM appointments a
+		 JOIN users u ON u.id = a.customer_id
+		 JOIN services sv ON sv.id = a.service_id
+		 WHERE a.id = ANY($1)
+		 ORDER BY a.appointment_date, a.start_time`, ids)
+	if err != nil {
+		return conflicts
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ca models.ConflictingAppointment
+		rows.Scan(&ca.ID, &ca.CustomerName, &ca.ServiceName, &ca.AppointmentDate, &ca.StartTime, &ca.Status)
+		conflicts = append(conflicts, ca)
+	}
+	return conflicts
+}
@@ -88,7 +88,7 @@ func (h *WaitlistHandler) GetSalonWaitlist(c *gin.Context) {
 		 FROM waitlist w
 		 JOIN users u ON u.id = w.customer_id
 		 JOIN services sv ON sv.id = w.service_id
-		 WHERE w.salon_id = $1 AND w.status = 'waiting' AND w.preferred_date >= CURRENT_DATE
+		 WHERE w.salon_id = $1 AND w.status = 'waiting' AND w.preferred_date >= (SELECT (NOW() AT TIME ZONE timezone)::date FROM salons WHERE id = w.salon_id)
 		 ORDER BY w.created_at`, salonID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch waitlist"})
@@ -63,8 +63,26 @@ func main() {
 		log.Printf("⚠️  Failed to initialize Cloudinary service: %v", err)
 	}
 
+	// Initialize payment provider (the in-process fake unless Stripe is configured)
+	var provider services.PaymentProvider = services.NewFakeProvider(cfg.PaymentWebhookSecret)
+	if cfg.PaymentProvider == "stripe" {
+		if cfg.StripeSecretKey == "" {
+			log.Fatalf("❌ PAYMENT_PROVIDER=stripe needs STRIPE_SECRET_KEY")
+		}
+		provider = services.NewStripeProvider(cfg.StripeSecretKey, cfg.StripeWebhookSecret)
+	}
+	log.Printf("💳 Payment provider: %s", provider.Name())
+	paymentService := services.NewPaymentService(db, provider, cfg.PaymentCurrency)
+
+	// Release bookings whose deposit wasn't paid in time
+	go paymentService.StartDepositExpiry(ctx)
+
+	// Take lapsed loyalty points off balances
+	loyaltyService := services.NewLoyaltyService(db)
+	go loyaltyService.StartPointsExpiry(ctx)
+
 	// Register routes
-	routes.RegisterRoutes(r, db, pushService, scheduler, cloudinaryService)
+	routes.RegisterRoutes(r, db, pushService, scheduler, cloudinaryService, paymentService, loyaltyService)
 
 	// Start server
 	log.Printf("🚀 Server starting on port %s", cfg.ServerPort)
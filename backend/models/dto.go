@@ -44,6 +44,15 @@ type CreateSalonRequest struct {
 	ImageURL    string  `json:"image_url" form:"image_url"`
 	OpeningTime string  `json:"opening_time" form:"opening_time"`
 	ClosingTime string  `json:"closing_time" form:"closing_time"`
+	// 5, 10, 15 or 30; defaults to 30 on create, unchanged on update
+	SlotIntervalMinutes *int  `json:"slot_interval_minutes" form:"slot_interval_minutes"`
+	MinimizeGaps        *bool `json:"minimize_gaps" form:"minimize_gaps"`
+	// IANA name, e.g. "Europe/London"; defaults to UTC on create, unchanged on update
+	Timezone string `json:"timezone" form:"timezone"`
+	// Minutes before an appointment to send reminders; defaults to 60 and 20 on create, unchanged on update
+	ReminderOffsets []int `json:"reminder_offsets" form:"reminder_offsets"`
+	// Minutes a booking waits for its deposit before the slot is freed; defaults to 30 on create, unchanged on update
+	DepositHoldMinutes int `json:"deposit_hold_minutes" form:"deposit_hold_minutes"`
 }
 
 type CreateServiceRequest struct {
@@ -53,6 +62,9 @@ type CreateServiceRequest struct {
 	DurationMinutes int     `json:"duration_minutes" binding:"required"`
 	BufferMinutes   int     `json:"buffer_minutes"`
 	Category        string  `json:"category"`
+	// Paid up front when booking: none, flat (an amount) or percent (of the price)
+	DepositType  string  `json:"deposit_type"`
+	DepositValue float64 `json:"deposit_value"`
 }
 
 type CreateStaffRequest struct {
@@ -64,18 +76,40 @@ type CreateStaffRequest struct {
 	ServiceIDs     []string `json:"service_ids"`
 }
 
+type UpdateSalonHoursRequest struct {
+	Hours []SalonHours `json:"hours" binding:"required"`
+}
+
+// CancelAppointmentRequest confirms the customer accepts the late-cancel fee, if any
+type CancelAppointmentRequest struct {
+	AcceptFee bool `json:"accept_fee"`
+}
+
+// UpdateTaxConfigRequest replaces all tax rates of a salon
+type UpdateTaxConfigRequest struct {
+	PricesIncludeTax bool      `json:"prices_include_tax"`
+	Rates            []TaxRate `json:"rates"`
+}
+
 type UpdateStaffWorkingHoursRequest struct {
 	Hours []StaffWorkingHours `json:"hours" binding:"required"`
 }
 
 type BookAppointmentRequest struct {
-	SalonID   string `json:"salon_id" binding:"required"`
-	StaffID   string `json:"staff_id" binding:"required"`
-	ServiceID string `json:"service_id" binding:"required"`
-	Date      string `json:"date" binding:"required"`
-	StartTime string `json:"start_time" binding:"required"`
-	Notes     string `json:"notes"`
-	PromoCode string `json:"promo_code"`
+	SalonID    string   `json:"salon_id" binding:"required"`
+	StaffID    string   `json:"staff_id"` // empty or "any": the server picks a stylist
+	ServiceID  string   `json:"service_id"`
+	ServiceIDs []string `json:"service_ids"` // ordered; performed back-to-back by the same staff member
+	Date       string   `json:"date" binding:"required"`
+	StartTime  string   `json:"start_time" binding:"required"`
+	Notes      string   `json:"notes"`
+	PromoCode  string   `json:"promo_code"`
+	// Loyalty points to take off the price, on top of any promo code
+	RedeemPoints int `json:"redeem_points" binding:"min=0"`
+	// Prepaid plan of the customer's whose credits pay for the services it covers
+	CustomerPlanID string `json:"customer_plan_id"`
+	// How to pick the stylist for an "any" booking: round_robin (default), least_booked, highest_rated
+	StaffPreference string `json:"staff_preference"`
 }
 
 type RescheduleRequest struct {
@@ -87,26 +121,94 @@ type AdjustAppointmentTimeRequest struct {
 	NewEndTime string `json:"new_end_time" binding:"required"`
 }
 
+// CreateReviewRequest reviews the customer's completed appointment; the salon and stylist
+// are those of the appointment
 type CreateReviewRequest struct {
-	SalonID       string `json:"salon_id" binding:"required"`
-	StaffID       string `json:"staff_id"`
-	AppointmentID string `json:"appointment_id"`
+	SalonID       string `json:"salon_id"`
+	AppointmentID string `json:"appointment_id" binding:"required"`
 	Rating        int    `json:"rating" binding:"required,min=1,max=5"`
 	Comment       string `json:"comment"`
 }
 
+// UpdateReviewRequest changes a review; the comment is kept when omitted
+type UpdateReviewRequest struct {
+	Rating  int     `json:"rating" binding:"required,min=1,max=5"`
+	Comment *string `json:"comment"`
+}
+
+// ReviewReplyRequest sets the salon's answer to a review
+type ReviewReplyRequest struct {
+	Reply string `json:"reply" binding:"required"`
+}
+
+// ReportReviewRequest flags a review for the moderators
+type ReportReviewRequest struct {
+	Reason  string `json:"reason" binding:"required,oneof=spam offensive fake off_topic other"`
+	Details string `json:"details"`
+}
+
+// HideReviewRequest hides a review, with the reason shown to its author and the salon
+type HideReviewRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
 type ProcessPaymentRequest struct {
 	AppointmentID string  `json:"appointment_id" binding:"required"`
-	Method        string  `json:"method" binding:"required"`
-	Amount        float64 `json:"amount" binding:"required"`
+	Method        string  `json:"method" binding:"omitempty,oneof=cash card upi wallet gift_card"`
+	Amount        float64 `json:"amount"` // optional; must equal the amount due (plus the tip) when sent
+	GiftCardCode  string  `json:"gift_card_code"`
+	// Split tender instead of Method and Amount: the tenders add up to the amount due plus the tip
+	Tenders []PaymentTender `json:"tenders" binding:"omitempty,dive"`
+	Tip     float64         `json:"tip" binding:"min=0"`
+	// Loyalty points of the customer to take off the amount due first
+	RedeemPoints int `json:"redeem_points" binding:"min=0"`
+}
+
+// IssueGiftCardRequest sells a gift card of Amount. ExpiresOn (YYYY-MM-DD) is the last day
+// it can be used, in the salon's time; without it the card doesn't expire.
+type IssueGiftCardRequest struct {
+	Amount         float64 `json:"amount" binding:"gt=0"`
+	ExpiresOn      string  `json:"expires_on"`
+	RecipientName  string  `json:"recipient_name"`
+	RecipientEmail string  `json:"recipient_email" binding:"omitempty,email"`
+	Note           string  `json:"note"`
+}
+
+type VoidGiftCardRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// AdjustPointsRequest adds points to (or, when negative, takes them from) a customer's
+// balance at the salon
+type AdjustPointsRequest struct {
+	CustomerID string `json:"customer_id" binding:"required"`
+	Points     int    `json:"points" binding:"required"`
+	Note       string `json:"note" binding:"required"`
+}
+
+// CreateRefundRequest refunds part of a payment, or all that is left when Amount is 0
+type CreateRefundRequest struct {
+	Amount float64 `json:"amount" binding:"min=0"`
+	Reason string  `json:"reason" binding:"required"`
 }
 
 type CreatePromoRequest struct {
 	Code            string  `json:"code" binding:"required"`
-	DiscountPercent float64 `json:"discount_percent" binding:"required"`
+	DiscountPercent float64 `json:"discount_percent"`
 	ValidFrom       string  `json:"valid_from"`
 	ValidUntil      string  `json:"valid_until"`
 	MaxUses         *int    `json:"max_uses"`
+	// percent (default, DiscountPercent) or fixed (DiscountAmount)
+	DiscountType       string   `json:"discount_type"`
+	DiscountAmount     float64  `json:"discount_amount"`
+	MinOrderAmount     float64  `json:"min_order_amount"`
+	ServiceIDs         []string `json:"service_ids"`
+	Categories         []string `json:"categories"`
+	FirstVisitOnly     bool     `json:"first_visit_only"`
+	MaxUsesPerCustomer *int     `json:"max_uses_per_customer"`
+	ValidWeekdays      []int    `json:"valid_weekdays"`   // 0 = Sunday
+	ValidStartTime     string   `json:"valid_start_time"` // HH:MM, appointment start in the salon's time
+	ValidEndTime       string   `json:"valid_end_time"`
 }
 
 type JoinWaitlistRequest struct {
@@ -118,17 +220,23 @@ type JoinWaitlistRequest struct {
 }
 
 type AvailableSlotsRequest struct {
-	SalonID   string `form:"salon_id" binding:"required"`
-	StaffID   string `form:"staff_id" binding:"required"`
-	ServiceID string `form:"service_id" binding:"required"`
-	Date      string `form:"date" binding:"required"`
+	SalonID    string   `form:"salon_id" binding:"required"`
+	StaffID    string   `form:"staff_id" binding:"required"`
+	ServiceID  string   `form:"service_id"`
+	ServiceIDs []string `form:"service_ids"`
+	Date       string   `form:"date" binding:"required"`
 }
 
 type TimeSlot struct {
 	StartTime          string `json:"start_time"`
 	EndTime            string `json:"end_time"`
 	Available          bool   `json:"available"`
-	AvailabilityReason string `json:"availability_reason"` // available, booked, out_of_shift
+	AvailabilityReason string `json:"availability_reason"` // available, booked, closed, out_of_shift, time_off, break, resource_unavailable
+	// Score ranks available slots by how little idle time they leave around them
+	// (100 = flush against bookings or shift edges on both sides, 0 = unavailable)
+	Score int `json:"score"`
+	// Any-staff availability: how many stylists can take this slot
+	AvailableStaff int `json:"available_staff,omitempty"`
 }
 
 type AnalyticsResponse struct {
@@ -139,6 +247,16 @@ type AnalyticsResponse struct {
 	PeakHours            []HourStats      `json:"peak_hours"`
 	RevenueByMonth       []MonthlyRevenue `json:"revenue_by_month"`
 	AppointmentsByStatus map[string]int   `json:"appointments_by_status"`
+	// Tips are not part of the revenue figures
+	TotalTips   float64     `json:"total_tips"`
+	TipsByStaff []StaffTips `json:"tips_by_staff"`
+}
+
+type StaffTips struct {
+	StaffID   string  `json:"staff_id"`
+	StaffName string  `json:"staff_name"`
+	TipCount  int     `json:"tip_count"`
+	Tips      float64 `json:"tips"`
 }
 
 type ServiceStats struct {
@@ -155,6 +273,7 @@ type HourStats struct {
 type MonthlyRevenue struct {
 	Month   string  `json:"month"`
 	Revenue float64 `json:"revenue"`
+	Tips    float64 `json:"tips"`
 }
 
 type PaginationParams struct {
@@ -175,4 +294,25 @@ type OwnerOverview struct {
 	TodaysAppointments int     `json:"todays_appointments"`
 	PendingRequests    int     `json:"pending_requests"`
 	CancelledToday     int     `json:"cancelled_today"`
+	TodaysTips         float64 `json:"todays_tips"`
+}
+
+// PrepaidPlanRequest creates or updates a salon's package or membership
+type PrepaidPlanRequest struct {
+	Kind                  string   `json:"kind" binding:"required,oneof=package membership"`
+	Name                  string   `json:"name" binding:"required"`
+	Description           string   `json:"description"`
+	Price                 float64  `json:"price" binding:"min=0"`
+	Credits               *int     `json:"credits"`
+	ValidityDays          *int     `json:"validity_days"`
+	MemberDiscountPercent float64  `json:"member_discount_percent"`
+	ServiceIDs            []string `json:"service_ids"`
+	IsActive              *bool    `json:"is_active"`
+}
+
+// SellPlanRequest records the sale of a plan to a customer, at the plan's price unless
+// PricePaid says otherwise
+type SellPlanRequest struct {
+	CustomerID string   `json:"customer_id" binding:"required"`
+	PricePaid  *float64 `json:"price_paid" binding:"omitempty,min=0"`
 }
@@ -39,11 +39,85 @@ type Salon struct {
 	ClosingTime  string    `json:"closing_time"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+	// Slot grid: start times every SlotIntervalMinutes, or only gap-free ones
+	SlotIntervalMinutes int  `json:"slot_interval_minutes"`
+	MinimizeGaps        bool `json:"minimize_gaps"`
+	// IANA timezone appointment dates and times are expressed in
+	Timezone string `json:"timezone"`
+	// Minutes before an appointment each reminder is sent
+	ReminderOffsets []int `json:"reminder_offsets"`
+	// Minutes a booking waits for its deposit before the slot is freed
+	DepositHoldMinutes int `json:"deposit_hold_minutes"`
+	// Hours of each weekday, Sunday first (salon details only)
+	WeeklyHours []SalonHours `json:"weekly_hours,omitempty"`
 	// Computed / Joined fields
 	Distance    *float64 `json:"distance,omitempty"`
 	IsFavorited *bool    `json:"is_favorited,omitempty"`
 }
 
+// SalonHours are the opening hours of one weekday (0 = Sunday)
+type SalonHours struct {
+	DayOfWeek int    `json:"day_of_week"`
+	OpenTime  string `json:"open_time"`
+	CloseTime string `json:"close_time"`
+	IsClosed  bool   `json:"is_closed"`
+}
+
+// TaxRate is a named tax rate of a salon; with a category it only applies to (and
+// replaces the salon-wide rates for) services of that category
+type TaxRate struct {
+	ID          string  `json:"id,omitempty"`
+	Name        string  `json:"name"`
+	RatePercent float64 `json:"rate_percent"`
+	Category    string  `json:"category,omitempty"`
+}
+
+// SalonTaxConfig is how a salon taxes its services
+type SalonTaxConfig struct {
+	PricesIncludeTax bool      `json:"prices_include_tax"`
+	Rates            []TaxRate `json:"rates"`
+}
+
+// CancellationPolicy is what a salon charges for late cancellations and no-shows. Fee
+// types are none, flat (an amount) or percent (of the appointment total).
+type CancellationPolicy struct {
+	FreeCancelHours   int     `json:"free_cancel_hours"`
+	LateCancelFeeType string  `json:"late_cancel_fee_type"`
+	LateCancelFee     float64 `json:"late_cancel_fee"`
+	NoShowFeeType     string  `json:"no_show_fee_type"`
+	NoShowFee         float64 `json:"no_show_fee"`
+	// Whether the promo code use of a booking is given back when it is cancelled in time,
+	// cancelled late, missed, or fully refunded
+	ReleasePromoOnCancel     bool `json:"release_promo_on_cancel"`
+	ReleasePromoOnLateCancel bool `json:"release_promo_on_late_cancel"`
+	ReleasePromoOnNoShow     bool `json:"release_promo_on_no_show"`
+	ReleasePromoOnRefund     bool `json:"release_promo_on_refund"`
+	// Whether prepaid plan credits are given back when a booking is cancelled late or
+	// missed; a cancellation in time always gives them back
+	RestoreCreditOnLateCancel bool `json:"restore_credit_on_late_cancel"`
+	RestoreCreditOnNoShow     bool `json:"restore_credit_on_no_show"`
+}
+
+// CancellationQuote is what cancelling an appointment now would cost the customer
+type CancellationQuote struct {
+	AppointmentID   string             `json:"appointment_id"`
+	Policy          CancellationPolicy `json:"policy"`
+	FreeCancelUntil time.Time          `json:"free_cancel_until"`
+	IsLate          bool               `json:"is_late"`
+	Fee             float64            `json:"fee"`
+	AppointmentCost float64            `json:"appointment_cost"`
+	// Prepaid plan credits the booking uses that cancelling now would not give back
+	CreditsForfeited int `json:"credits_forfeited"`
+}
+
+// PaymentFee is a late-cancel or no-show fee charged against a payment
+type PaymentFee struct {
+	Kind          string    `json:"kind"`
+	Amount        float64   `json:"amount"`
+	OriginalTotal float64   `json:"original_total"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
 type SalonGallery struct {
 	ID        string    `json:"id"`
 	SalonID   string    `json:"salon_id"`
@@ -76,6 +150,7 @@ type StaffWorkingHours struct {
 	StartTime string `json:"start_time"`
 	EndTime   string `json:"end_time"`
 	IsOff     bool   `json:"is_off"`
+	Kind      string `json:"kind"` // shift (default) or break; a day may have several of each
 }
 
 type Service struct {
@@ -90,6 +165,9 @@ type Service struct {
 	IsActive        bool      `json:"is_active"`
 	CreatedAt       time.Time `json:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"`
+	// Required up front when booking: none, flat (an amount) or percent (of the price)
+	DepositType  string  `json:"deposit_type"`
+	DepositValue float64 `json:"deposit_value"`
 }
 
 type Appointment struct {
@@ -104,10 +182,12 @@ type Appointment struct {
 	Status          string    `json:"status"`
 	Notes           string    `json:"notes,omitempty"`
 	PromoCodeID     *string   `json:"promo_code_id,omitempty"`
+	SeriesID        *string   `json:"series_id,omitempty"`
 	CreatedAt       time.Time `json:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"`
 	// Joined
 	SalonName     string  `json:"salon_name,omitempty"`
+	SalonTimezone string  `json:"salon_timezone,omitempty"`
 	StaffName     string  `json:"staff_name,omitempty"`
 	ServiceName   string  `json:"service_name,omitempty"`
 	ServicePrice  float64 `json:"service_price,omitempty"`
@@ -115,6 +195,37 @@ type Appointment struct {
 	CustomerName  string  `json:"customer_name,omitempty"`
 	CustomerEmail string  `json:"customer_email,omitempty"`
 	CustomerPhone string  `json:"customer_phone,omitempty"`
+	// Line items (multi-service bookings)
+	Services []AppointmentService `json:"services,omitempty"`
+	// Deposit the booking waits for (awaiting_deposit bookings)
+	Deposit *Deposit `json:"deposit,omitempty"`
+}
+
+// Deposit is the part of an appointment's price paid up front to confirm the booking.
+// It is applied to the appointment's payment once the appointment is settled.
+type Deposit struct {
+	ID            string     `json:"id"`
+	AppointmentID string     `json:"appointment_id"`
+	Amount        float64    `json:"amount"`
+	Status        string     `json:"status"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	PaidAt        *time.Time `json:"paid_at,omitempty"`
+	// Returned once, when the intent is opened, for the customer's browser to confirm it
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+type AppointmentService struct {
+	ID              string  `json:"id"`
+	AppointmentID   string  `json:"appointment_id"`
+	ServiceID       string  `json:"service_id"`
+	Position        int     `json:"position"`
+	Price           float64 `json:"price"`
+	DurationMinutes int     `json:"duration_minutes"`
+	BufferMinutes   int     `json:"buffer_minutes"`
+	StartTime       string  `json:"start_time"`
+	EndTime         string  `json:"end_time"`
+	// Joined
+	ServiceName string `json:"service_name,omitempty"`
 }
 
 type Payment struct {
@@ -129,6 +240,141 @@ type Payment struct {
 	ReceiptNumber string    `json:"receipt_number"`
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
+	// Sum of the refund ledger
+	RefundedAmount float64 `json:"refunded_amount"`
+	// Gateway intent the payment is collected through (empty for counter payments)
+	Provider         string `json:"provider,omitempty"`
+	ProviderIntentID string `json:"provider_intent_id,omitempty"`
+	// Returned once, when an intent is opened, for the customer's browser to confirm it
+	ClientSecret string `json:"client_secret,omitempty"`
+	// Tax per named rate (receipts); TaxInclusive means Tax is part of Amount
+	Taxes        []PaymentTax `json:"taxes,omitempty"`
+	TaxInclusive bool         `json:"tax_inclusive"`
+	// Late-cancel / no-show fees the payment was re-priced to (receipts)
+	Fees []PaymentFee `json:"fees,omitempty"`
+	// Deposit paid up front and counted towards Total; the balance is what is left to collect
+	DepositApplied float64 `json:"deposit_applied"`
+	// Tip on top of Total for the appointment's stylist, and the tenders that paid both
+	Tip          float64         `json:"tip"`
+	TipStaffID   *string         `json:"tip_staff_id,omitempty"`
+	TipStaffName string          `json:"tip_staff_name,omitempty"`
+	Tenders      []PaymentTender `json:"tenders,omitempty"`
+	// Position in the salon's gap-free invoice sequence
+	InvoiceNumber int `json:"invoice_number"`
+}
+
+// Invoice is what a payment's printable receipt shows
+type Invoice struct {
+	Salon       Salon       `json:"salon"`
+	Payment     Payment     `json:"payment"`
+	Appointment Appointment `json:"appointment"`
+	Currency    string      `json:"currency"`
+}
+
+// PaymentTender is one of the methods a payment was collected with
+type PaymentTender struct {
+	Method string  `json:"method" binding:"required,oneof=cash card upi wallet gift_card"`
+	Amount float64 `json:"amount" binding:"gt=0"`
+	// The card a gift_card tender is paid from
+	GiftCardCode string `json:"gift_card_code,omitempty"`
+}
+
+// PaymentTax is the tax charged on a payment at one named rate
+type PaymentTax struct {
+	Name          string  `json:"name"`
+	RatePercent   float64 `json:"rate_percent"`
+	TaxableAmount float64 `json:"taxable_amount"`
+	Amount        float64 `json:"amount"`
+}
+
+// GiftCard is a stored-value card sold by a salon and spent as a checkout tender there.
+// Status is active, voided, or expired once ExpiresAt has passed.
+type GiftCard struct {
+	ID             string     `json:"id"`
+	SalonID        string     `json:"salon_id"`
+	Code           string     `json:"code"`
+	InitialAmount  float64    `json:"initial_amount"`
+	Balance        float64    `json:"balance"`
+	Status         string     `json:"status"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	RecipientName  string     `json:"recipient_name,omitempty"`
+	RecipientEmail string     `json:"recipient_email,omitempty"`
+	Note           string     `json:"note,omitempty"`
+	IssuedBy       *string    `json:"issued_by,omitempty"`
+	VoidedAt       *time.Time `json:"voided_at,omitempty"`
+	VoidReason     string     `json:"void_reason,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	// Filled in when a single card is looked up
+	Transactions []GiftCardTransaction `json:"transactions,omitempty"`
+}
+
+// GiftCardTransaction is one change to a gift card's balance: issue, redeem, reverse (a
+// redemption whose payment didn't go through), refund or void. Amount is negative when
+// it leaves the balance.
+type GiftCardTransaction struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Amount    float64   `json:"amount"`
+	PaymentID *string   `json:"payment_id,omitempty"`
+	ActorID   *string   `json:"actor_id,omitempty"`
+	Note      string    `json:"note,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LoyaltyProgram is how a salon's customers earn and redeem points. Points are earned per
+// unit of currency paid for services when an appointment is completed, and each is worth
+// PointValue off a later booking at the same salon.
+type LoyaltyProgram struct {
+	Enabled          bool    `json:"enabled"`
+	PointsPerUnit    float64 `json:"points_per_unit"`
+	PointValue       float64 `json:"point_value"`
+	MinRedeemPoints  int     `json:"min_redeem_points"`
+	MaxRedeemPercent float64 `json:"max_redeem_percent"` // of the booking's price after discounts
+	ExpiryDays       int     `json:"expiry_days"`        // 0 = points never expire
+}
+
+// LoyaltyTransaction is one entry of a customer's points ledger: earn, redeem, expire or
+// adjust. Points are negative when they leave the balance.
+type LoyaltyTransaction struct {
+	ID            string     `json:"id"`
+	SalonID       string     `json:"salon_id"`
+	Kind          string     `json:"kind"`
+	Points        int        `json:"points"`
+	AppointmentID *string    `json:"appointment_id,omitempty"`
+	Note          string     `json:"note,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	// Joined
+	SalonName string `json:"salon_name,omitempty"`
+}
+
+// LoyaltyBalance is a customer's points at one salon
+type LoyaltyBalance struct {
+	SalonID   string  `json:"salon_id"`
+	SalonName string  `json:"salon_name"`
+	Points    int     `json:"points"`
+	Value     float64 `json:"value"` // what the points take off a booking at the salon today
+}
+
+// LoyaltyHistory is a customer's balances and their most recent ledger entries
+type LoyaltyHistory struct {
+	TotalPoints  int                  `json:"total_points"`
+	Balances     []LoyaltyBalance     `json:"balances"`
+	Transactions []LoyaltyTransaction `json:"transactions"`
+}
+
+// Refund is one entry of a payment's refund ledger
+type Refund struct {
+	ID          string    `json:"id"`
+	PaymentID   string    `json:"payment_id"`
+	Amount      float64   `json:"amount"`
+	Reason      string    `json:"reason,omitempty"`
+	ActorID     *string   `json:"actor_id,omitempty"` // nil when issued at the provider
+	Provider    string    `json:"provider"`
+	ProviderRef string    `json:"provider_ref"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Joined
+	ActorName string `json:"actor_name,omitempty"`
 }
 
 type Review struct {
@@ -141,11 +387,42 @@ type Review struct {
 	Comment       string    `json:"comment,omitempty"`
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
+	// Written for the reviewer's own completed appointment
+	IsVerified bool `json:"is_verified"`
+	// The salon's public answer
+	OwnerReply     string     `json:"owner_reply,omitempty"`
+	OwnerRepliedAt *time.Time `json:"owner_replied_at,omitempty"`
+	// Hidden by a moderator: left out of the salon's listing and rating
+	IsHidden     bool   `json:"is_hidden"`
+	HiddenReason string `json:"hidden_reason,omitempty"`
 	// Joined
 	CustomerName   string `json:"customer_name,omitempty"`
 	CustomerAvatar string `json:"customer_avatar,omitempty"`
 }
 
+// ReviewReport flags a review as abusive for the admin moderation queue
+type ReviewReport struct {
+	ID         string     `json:"id"`
+	ReviewID   string     `json:"review_id"`
+	ReporterID string     `json:"reporter_id"`
+	Reason     string     `json:"reason"`
+	Details    string     `json:"details,omitempty"`
+	Status     string     `json:"status"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	// Joined
+	ReporterName string `json:"reporter_name,omitempty"`
+	ReporterRole string `json:"reporter_role,omitempty"`
+}
+
+// ModerationItem is a review in the admin moderation queue with the reports against it
+type ModerationItem struct {
+	Review      Review         `json:"review"`
+	SalonName   string         `json:"salon_name"`
+	OpenReports int            `json:"open_reports"`
+	Reports     []ReviewReport `json:"reports"`
+}
+
 type Favorite struct {
 	ID        string    `json:"id"`
 	UserID    string    `json:"user_id"`
@@ -166,6 +443,31 @@ type PromoCode struct {
 	UsedCount       int        `json:"used_count"`
 	IsActive        bool       `json:"is_active"`
 	CreatedAt       time.Time  `json:"created_at"`
+	// Rules: a percentage or a fixed amount off the services in scope (every service when
+	// ServiceIDs and Categories are empty), and when and by whom the code can be used
+	DiscountType       string   `json:"discount_type"`
+	DiscountAmount     float64  `json:"discount_amount"`
+	MinOrderAmount     float64  `json:"min_order_amount"`
+	ServiceIDs         []string `json:"service_ids"`
+	Categories         []string `json:"categories"`
+	FirstVisitOnly     bool     `json:"first_visit_only"`
+	MaxUsesPerCustomer *int     `json:"max_uses_per_customer,omitempty"`
+	ValidWeekdays      []int    `json:"valid_weekdays"` // 0 = Sunday; empty = every day
+	ValidStartTime     string   `json:"valid_start_time,omitempty"`
+	ValidEndTime       string   `json:"valid_end_time,omitempty"`
+	// Filled in on the salon's own list
+	Stats *PromoStats `json:"stats,omitempty"`
+}
+
+// PromoStats sums up the redemptions of a promo code. Released redemptions were given back
+// when their booking fell through; discount and revenue count active ones only, revenue
+// being what their payments collected net of refunds.
+type PromoStats struct {
+	Redemptions       int     `json:"redemptions"`
+	Active            int     `json:"active"`
+	Released          int     `json:"released"`
+	TotalDiscount     float64 `json:"total_discount"`
+	AttributedRevenue float64 `json:"attributed_revenue"`
 }
 
 type Waitlist struct {
@@ -180,6 +482,23 @@ type Waitlist struct {
 	CreatedAt     time.Time `json:"created_at"`
 }
 
+type ReminderJob struct {
+	ID            string     `json:"id"`
+	AppointmentID string     `json:"appointment_id"`
+	OffsetMinutes int        `json:"offset_minutes"`
+	RunAt         time.Time  `json:"run_at"`
+	Status        string     `json:"status"` // pending, sent, skipped, dead
+	Attempts      int        `json:"attempts"`
+	MaxAttempts   int        `json:"max_attempts"`
+	LastError     *string    `json:"last_error,omitempty"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	// Joined
+	AppointmentDate string `json:"appointment_date,omitempty"`
+	StartTime       string `json:"start_time,omitempty"`
+	CustomerName    string `json:"customer_name,omitempty"`
+}
+
 type Notification struct {
 	ID            string    `json:"id"`
 	UserID        string    `json:"user_id"`
@@ -190,3 +509,47 @@ type Notification struct {
 	AppointmentID *string   `json:"appointment_id,omitempty"`
 	CreatedAt     time.Time `json:"created_at"`
 }
+
+// PrepaidPlan is a package or membership a salon sells. A package is a bundle of Credits
+// for its services; a membership gives Credits a month (nil for unlimited) and takes
+// MemberDiscountPercent off everything else booked at the salon.
+type PrepaidPlan struct {
+	ID                    string    `json:"id"`
+	SalonID               string    `json:"salon_id"`
+	Kind                  string    `json:"kind"` // package, membership
+	Name                  string    `json:"name"`
+	Description           string    `json:"description"`
+	Price                 float64   `json:"price"`
+	Credits               *int      `json:"credits"`
+	ValidityDays          *int      `json:"validity_days"`
+	MemberDiscountPercent float64   `json:"member_discount_percent"`
+	ServiceIDs            []string  `json:"service_ids"`
+	IsActive              bool      `json:"is_active"`
+	CreatedAt             time.Time `json:"created_at"`
+}
+
+// CustomerPlan is a plan held by a customer, with the credits it has left for the current
+// month (memberships) or in total (packages); CreditsRemaining is nil when unlimited
+type CustomerPlan struct {
+	ID                    string     `json:"id"`
+	UserID                string     `json:"user_id"`
+	SalonID               string     `json:"salon_id"`
+	PlanID                string     `json:"plan_id"`
+	Kind                  string     `json:"kind"`
+	Name                  string     `json:"name"`
+	Credits               *int       `json:"credits"`
+	MemberDiscountPercent float64    `json:"member_discount_percent"`
+	PricePaid             float64    `json:"price_paid"`
+	StartsAt              time.Time  `json:"starts_at"`
+	ExpiresAt             *time.Time `json:"expires_at"`
+	Status                string     `json:"status"` // active, expired, cancelled
+	CreatedAt             time.Time  `json:"created_at"`
+	ServiceIDs            []string   `json:"service_ids"`
+	// Computed
+	PeriodStart      string `json:"period_start"`
+	CreditsUsed      int    `json:"credits_used"`
+	CreditsRemaining *int   `json:"credits_remaining"`
+	// Joined
+	CustomerName  string `json:"customer_name,omitempty"`
+	CustomerEmail string `json:"customer_email,omitempty"`
+}
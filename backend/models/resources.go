@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// SalonResource is a shared chair, station or room; at most Capacity units are in use at once
+type SalonResource struct {
+	ID           string    `json:"id"`
+	SalonID      string    `json:"salon_id"`
+	Name         string    `json:"name"`
+	ResourceType string    `json:"resource_type,omitempty"`
+	Capacity     int       `json:"capacity"`
+	IsActive     bool      `json:"is_active"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type CreateResourceRequest struct {
+	Name         string `json:"name" binding:"required"`
+	ResourceType string `json:"resource_type"` // e.g. chair, wash_station, room
+	Capacity     int    `json:"capacity"`      // defaults to 1
+}
+
+// ServiceResource is a resource a service holds while it is performed
+type ServiceResource struct {
+	ResourceID   string `json:"resource_id" binding:"required"`
+	ResourceName string `json:"resource_name,omitempty"`
+	Quantity     int    `json:"quantity"` // defaults to 1
+}
+
+type UpdateServiceResourcesRequest struct {
+	Resources []ServiceResource `json:"resources"`
+}
@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+type AppointmentSeries struct {
+	ID         string    `json:"id"`
+	CustomerID string    `json:"customer_id"`
+	SalonID    string    `json:"salon_id"`
+	StaffID    string    `json:"staff_id"`
+	ServiceIDs []string  `json:"service_ids"`
+	Frequency  string    `json:"frequency"` // daily, weekly, monthly
+	Interval   int       `json:"interval"`
+	Count      *int      `json:"count,omitempty"`
+	UntilDate  *string   `json:"until_date,omitempty"`
+	StartDate  string    `json:"start_date"`
+	StartTime  string    `json:"start_time"`
+	Notes      string    `json:"notes,omitempty"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	// Joined
+	Appointments []Appointment `json:"appointments,omitempty"`
+}
+
+type CreateSeriesRequest struct {
+	SalonID    string   `json:"salon_id" binding:"required"`
+	StaffID    string   `json:"staff_id" binding:"required"`
+	ServiceID  string   `json:"service_id"`
+	ServiceIDs []string `json:"service_ids"`
+	StartDate  string   `json:"start_date" binding:"required"`
+	StartTime  string   `json:"start_time" binding:"required"`
+	Frequency  string   `json:"frequency" binding:"required"`
+	Interval   int      `json:"interval"`
+	Count      *int     `json:"count"`      // either count or until_date is required
+	UntilDate  string   `json:"until_date"` // inclusive, YYYY-MM-DD
+	Notes      string   `json:"notes"`
+}
+
+type RescheduleSeriesRequest struct {
+	StartTime string `json:"start_time" binding:"required"`
+	DayOffset int    `json:"day_offset"` // shift every remaining occurrence by N days
+	FromDate  string `json:"from_date"`  // only occurrences on/after this date, default today
+}
+
+type CancelSeriesRequest struct {
+	FromDate string `json:"from_date"` // only occurrences on/after this date, default today
+	// The customer accepts the late-cancel fees of occurrences inside the free-cancel window
+	AcceptFee bool `json:"accept_fee"`
+}
+
+// SeriesOccurrence reports the outcome of materializing or moving one occurrence
+type SeriesOccurrence struct {
+	Occurrence    int     `json:"occurrence"`
+	Date          string  `json:"date"`
+	StartTime     string  `json:"start_time"`
+	Status        string  `json:"status"`           // booked, rescheduled, conflict
+	Reason        string  `json:"reason,omitempty"` // booked, closed, out_of_shift, time_off, break, resource_unavailable, past, or an error message
+	AppointmentID *string `json:"appointment_id,omitempty"`
+}
+
+type SeriesResponse struct {
+	Series        AppointmentSeries  `json:"series"`
+	Occurrences   []SeriesOccurrence `json:"occurrences"`
+	BookedCount   int                `json:"booked_count"`
+	ConflictCount int                `json:"conflict_count"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// StaffTimeOff is a per-date exception to a staff member's weekly hours
+type StaffTimeOff struct {
+	ID        string    `json:"id"`
+	StaffID   string    `json:"staff_id"`
+	StartDate string    `json:"start_date"`
+	EndDate   string    `json:"end_date"`
+	Kind      string    `json:"kind"`                 // off or hours
+	StartTime *string   `json:"start_time,omitempty"` // nil = full day (off only)
+	EndTime   *string   `json:"end_time,omitempty"`   // nil = full day (off only)
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CreateTimeOffRequest struct {
+	StartDate string  `json:"start_date" binding:"required"`
+	EndDate   string  `json:"end_date" binding:"required"`
+	Kind      string  `json:"kind"`       // off (default) or hours
+	StartTime *string `json:"start_time"` // required for hours, optional partial day for off
+	EndTime   *string `json:"end_time"`
+	Reason    string  `json:"reason"`
+}
+
+type CreateTimeOffResponse struct {
+	TimeOff             StaffTimeOff             `json:"time_off"`
+	ConflictingCount    int                      `json:"conflicting_count"`
+	ConflictingBookings []ConflictingAppointment `json:"conflicting_bookings"`
+}
+
+type ReassignConflictingRequest struct {
+	StaffPreference string `json:"staff_preference"` // round_robin (default), least_booked, highest_rated
+}
+
+// ReassignResult reports where each conflicting appointment went; NewStaffID is empty when
+// nobody could take it
+type ReassignResult struct {
+	AppointmentID string `json:"appointment_id"`
+	NewStaffID    string `json:"new_staff_id,omitempty"`
+	NewStaffName  string `json:"new_staff_name,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
@@ -9,7 +9,7 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func RegisterRoutes(r *gin.Engine, db *pgxpool.Pool, pushService *services.PushService, scheduler *services.Scheduler, cloudinaryService *services.CloudinaryService) {
+func RegisterRoutes(r *gin.Engine, db *pgxpool.Pool, pushService *services.PushService, scheduler *services.Scheduler, cloudinaryService *services.CloudinaryService, paymentService *services.PaymentService, loyaltyService *services.LoyaltyService) {
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(db)
 	salonHandler := handlers.NewSalonHandler(db, cloudinaryService)
@@ -17,17 +17,24 @@ func RegisterRoutes(r *gin.Engine, db *pgxpool.Pool, pushService *services.PushS
 	staffHandler := handlers.NewStaffHandler(db)
 	appointmentHandler := handlers.NewAppointmentHandler(db, scheduler)
 	reviewHandler := handlers.NewReviewHandler(db)
-	paymentHandler := handlers.NewPaymentHandler(db)
+	paymentHandler := handlers.NewPaymentHandler(db, paymentService)
 	favoriteHandler := handlers.NewFavoriteHandler(db)
 	promoHandler := handlers.NewPromoHandler(db)
 	waitlistHandler := handlers.NewWaitlistHandler(db)
 	analyticsHandler := handlers.NewAnalyticsHandler(db)
 	notificationHandler := handlers.NewNotificationHandler(db)
 	pushHandler := handlers.NewPushHandler(pushService)
-	closureHandler := handlers.NewClosureHandler(db, pushService)
+	closureHandler := handlers.NewClosureHandler(db, pushService, paymentService)
+	reminderHandler := handlers.NewReminderHandler(db)
+	timeOffHandler := handlers.NewTimeOffHandler(db, scheduler, pushService, paymentService)
+	resourceHandler := handlers.NewResourceHandler(db)
+	loyaltyHandler := handlers.NewLoyaltyHandler(db, loyaltyService)
+	giftCardHandler := handlers.NewGiftCardHandler(db)
+	planHandler := handlers.NewPlanHandler(db)
 
 	// Inject push service into appointment handler
 	appointmentHandler.SetPushService(pushService)
+	appointmentHandler.SetPaymentService(paymentService)
 
 	api := r.Group("/api")
 
@@ -61,6 +68,9 @@ func RegisterRoutes(r *gin.Engine, db *pgxpool.Pool, pushService *services.PushS
 		salons.GET("/:id/staff-for-service", staffHandler.GetStaffForService)
 		salons.GET("/:id/reviews", reviewHandler.GetSalonReviews)
 		salons.GET("/:id/gallery", salonHandler.GetGallery)
+		salons.GET("/:id/cancellation-policy", salonHandler.GetCancellationPolicy)
+		salons.GET("/:id/loyalty-program", loyaltyHandler.GetLoyaltyProgram)
+		salons.GET("/:id/plans", planHandler.GetSalonPlans)
 	}
 
 	// ─────────────────────────────────────────────
@@ -68,6 +78,11 @@ func RegisterRoutes(r *gin.Engine, db *pgxpool.Pool, pushService *services.PushS
 	// ─────────────────────────────────────────────
 	api.GET("/push/vapid-key", pushHandler.GetVAPIDKey)
 
+	// ─────────────────────────────────────────────
+	// PAYMENT PROVIDER WEBHOOKS (authenticated by the provider's signature)
+	// ─────────────────────────────────────────────
+	api.POST("/payments/webhook/:provider", paymentHandler.HandleWebhook)
+
 	// ─────────────────────────────────────────────
 	// AUTHENTICATED CUSTOMER ROUTES
 	// ─────────────────────────────────────────────
@@ -78,11 +93,23 @@ func RegisterRoutes(r *gin.Engine, db *pgxpool.Pool, pushService *services.PushS
 		customer.POST("/appointments", appointmentHandler.BookAppointment)
 		customer.GET("/appointments", appointmentHandler.GetMyAppointments)
 		customer.PUT("/appointments/:id/reschedule", appointmentHandler.RescheduleAppointment)
+		customer.POST("/appointments/:id/deposit", appointmentHandler.PayDeposit)
+		customer.GET("/appointments/:id/cancellation", appointmentHandler.GetCancellationQuote)
 		customer.PUT("/appointments/:id/cancel", appointmentHandler.CancelAppointment)
 		customer.GET("/appointments/available-slots", appointmentHandler.GetAvailableSlots)
+		customer.GET("/appointments/available-slots/any-staff", appointmentHandler.GetAnyStaffSlots)
+
+		// Recurring appointment series
+		customer.POST("/appointments/series", appointmentHandler.CreateSeries)
+		customer.GET("/appointments/series/:series_id", appointmentHandler.GetSeries)
+		customer.PUT("/appointments/series/:series_id/cancel", appointmentHandler.CancelSeries)
+		customer.PUT("/appointments/series/:series_id/reschedule", appointmentHandler.RescheduleSeries)
 
 		// Reviews
 		customer.POST("/reviews", reviewHandler.CreateReview)
+		customer.PUT("/reviews/:id", reviewHandler.UpdateReview)
+		customer.DELETE("/reviews/:id", reviewHandler.DeleteReview)
+		customer.POST("/reviews/:id/report", reviewHandler.ReportReview)
 
 		// Favorites
 		customer.POST("/favorites/:salon_id", favoriteHandler.ToggleFavorite)
@@ -91,6 +118,12 @@ func RegisterRoutes(r *gin.Engine, db *pgxpool.Pool, pushService *services.PushS
 		// Promo validation
 		customer.GET("/promos/validate", promoHandler.ValidatePromo)
 
+		// Loyalty points balance and history
+		customer.GET("/loyalty", loyaltyHandler.GetMyLoyalty)
+
+		// Prepaid packages and memberships held
+		customer.GET("/plans", planHandler.GetMyPlans)
+
 		// Waitlist
 		customer.POST("/waitlist", waitlistHandler.JoinWaitlist)
 		customer.DELETE("/waitlist/:id", waitlistHandler.LeaveWaitlist)
@@ -125,11 +158,31 @@ func RegisterRoutes(r *gin.Engine, db *pgxpool.Pool, pushService *services.PushS
 		salon := dashboard.Group("/salons/:salon_id")
 		salon.Use(middleware.EnsureSalonOwnership(db))
 		{
+			// Opening hours per weekday
+			salon.GET("/hours", salonHandler.GetSalonHours)
+			salon.PUT("/hours", salonHandler.UpdateSalonHours)
+
+			// Tax rates
+			salon.GET("/tax", salonHandler.GetTaxConfig)
+			salon.PUT("/tax", salonHandler.UpdateTaxConfig)
+
+			// Cancellation policy and fees
+			salon.GET("/cancellation-policy", salonHandler.GetCancellationPolicy)
+			salon.PUT("/cancellation-policy", salonHandler.UpdateCancellationPolicy)
+
 			// Services
 			salon.GET("/services", serviceHandler.ListServices)
 			salon.POST("/services", serviceHandler.CreateService)
 			salon.PUT("/services/:service_id", serviceHandler.UpdateService)
 			salon.DELETE("/services/:service_id", serviceHandler.DeleteService)
+			salon.GET("/services/:service_id/resources", resourceHandler.GetServiceResources)
+			salon.PUT("/services/:service_id/resources", resourceHandler.UpdateServiceResources)
+
+			// Shared resources (chairs, stations, rooms)
+			salon.GET("/resources", resourceHandler.GetResources)
+			salon.POST("/resources", resourceHandler.CreateResource)
+			salon.PUT("/resources/:resource_id", resourceHandler.UpdateResource)
+			salon.DELETE("/resources/:resource_id", resourceHandler.DeleteResource)
 
 			// Staff
 			salon.GET("/staff", staffHandler.ListStaff)
@@ -139,6 +192,13 @@ func RegisterRoutes(r *gin.Engine, db *pgxpool.Pool, pushService *services.PushS
 			salon.GET("/staff/:staff_id/hours", staffHandler.GetWorkingHours)
 			salon.PUT("/staff/:staff_id/hours", staffHandler.UpdateWorkingHours)
 
+			// Staff time off / per-date hours
+			salon.GET("/staff/:staff_id/time-off", timeOffHandler.GetTimeOff)
+			salon.POST("/staff/:staff_id/time-off", timeOffHandler.CreateTimeOff)
+			salon.DELETE("/staff/:staff_id/time-off/:time_off_id", timeOffHandler.DeleteTimeOff)
+			salon.POST("/staff/:staff_id/time-off/:time_off_id/cancel-appointments", timeOffHandler.CancelConflicting)
+			salon.POST("/staff/:staff_id/time-off/:time_off_id/reassign-appointments", timeOffHandler.ReassignConflicting)
+
 			// Appointments
 			salon.GET("/appointments", appointmentHandler.GetSalonAppointments)
 			salon.PUT("/appointments/:id/approve", appointmentHandler.ApproveAppointment)
@@ -146,16 +206,53 @@ func RegisterRoutes(r *gin.Engine, db *pgxpool.Pool, pushService *services.PushS
 			salon.PUT("/appointments/:id/complete", appointmentHandler.CompleteAppointment)
 			salon.PUT("/appointments/:id/adjust-time", appointmentHandler.AdjustAppointmentTime)
 
+			// Recurring series
+			salon.GET("/series", appointmentHandler.GetSalonSeries)
+			salon.GET("/series/:series_id", appointmentHandler.GetSeries)
+			salon.PUT("/series/:series_id/cancel", appointmentHandler.CancelSeries)
+			salon.PUT("/series/:series_id/reschedule", appointmentHandler.RescheduleSeries)
+
+			// Reminder queue
+			salon.GET("/reminders", reminderHandler.GetReminderJobs)
+			salon.POST("/reminders/:job_id/retry", reminderHandler.RetryReminderJob)
+
 			// Payments
 			salon.GET("/payments", paymentHandler.GetSalonPayments)
 			salon.POST("/payments", paymentHandler.ProcessPayment)
 			salon.GET("/payments/:id/receipt", paymentHandler.GetReceipt)
+			salon.GET("/payments/:id/refunds", paymentHandler.GetRefunds)
+			salon.POST("/payments/:id/refunds", paymentHandler.RefundPayment)
 
 			// Promo codes
 			salon.POST("/promos", promoHandler.CreatePromo)
 			salon.GET("/promos", promoHandler.GetSalonPromos)
 			salon.DELETE("/promos/:promo_id", promoHandler.DeletePromo)
 
+			// Loyalty program
+			salon.GET("/loyalty-program", loyaltyHandler.GetLoyaltyProgram)
+			salon.PUT("/loyalty-program", loyaltyHandler.UpdateLoyaltyProgram)
+			salon.POST("/loyalty/adjust", loyaltyHandler.AdjustPoints)
+
+			// Gift cards
+			salon.POST("/gift-cards", giftCardHandler.IssueGiftCard)
+			salon.GET("/gift-cards", giftCardHandler.GetGiftCards)
+			salon.GET("/gift-cards/:gift_card_id", giftCardHandler.GetGiftCard)
+			salon.POST("/gift-cards/:gift_card_id/void", giftCardHandler.VoidGiftCard)
+
+			// Prepaid packages and memberships
+			salon.GET("/plans", planHandler.GetSalonPlans)
+			salon.POST("/plans", planHandler.CreatePlan)
+			salon.PUT("/plans/:plan_id", planHandler.UpdatePlan)
+			salon.POST("/plans/:plan_id/sell", planHandler.SellPlan)
+			salon.GET("/plan-holders", planHandler.GetPlanHolders)
+			salon.POST("/plan-holders/:customer_plan_id/cancel", planHandler.CancelHolding)
+
+			// Reviews: replies and reports
+			salon.GET("/reviews", reviewHandler.GetSalonReviews)
+			salon.PUT("/reviews/:review_id/reply", reviewHandler.ReplyToReview)
+			salon.DELETE("/reviews/:review_id/reply", reviewHandler.DeleteReviewReply)
+			salon.POST("/reviews/:review_id/report", reviewHandler.ReportReview)
+
 			// Waitlist
 			salon.GET("/waitlist", waitlistHandler.GetSalonWaitlist)
 
@@ -169,4 +266,17 @@ func RegisterRoutes(r *gin.Engine, db *pgxpool.Pool, pushService *services.PushS
 			salon.POST("/closures/:closure_id/cancel-appointments", closureHandler.CancelConflicting)
 		}
 	}
+
+	// ─────────────────────────────────────────────
+	// ADMIN ROUTES
+	// ─────────────────────────────────────────────
+	admin := api.Group("/admin")
+	admin.Use(middleware.AuthRequired())
+	admin.Use(middleware.RoleRequired("admin"))
+	{
+		// Review moderation
+		admin.GET("/reviews/moderation", reviewHandler.GetModerationQueue)
+		admin.POST("/reviews/:id/hide", reviewHandler.HideReview)
+		admin.POST("/reviews/:id/restore", reviewHandler.RestoreReview)
+	}
 }
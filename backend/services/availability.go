@@ -0,0 +1,404 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"saloon-backend/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// occupiesSlotSQL matches the appointments (aliased a) that hold their time: all but
+// cancellations, no-shows and deposit holds that ran out
+const occupiesSlotSQL = `a.status NOT IN ('cancelled', 'no_show')
+		 AND (a.status <> 'awaiting_deposit' OR a.deposit_expires_at > NOW())`
+
+// querier is satisfied by both *pgxpool.Pool and pgx.Tx, so the availability engine can
+// read a day either for display or inside a booking transaction after the staff row lock
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// Availability reasons, shared with models.TimeSlot.AvailabilityReason
+const (
+	ReasonAvailable  = "available"
+	ReasonBooked     = "booked"
+	ReasonClosed     = "closed"
+	ReasonOutOfShift = "out_of_shift"
+	ReasonTimeOff    = "time_off"
+	ReasonBreak      = "break"
+	ReasonResource   = "resource_unavailable"
+)
+
+// Kinds of staff_working_hours rows
+const (
+	HoursShift = "shift"
+	HoursBreak = "break"
+)
+
+// Interval is a half-open [Start, End) span of a day
+type Interval struct {
+	Start, End time.Time
+}
+
+func (i Interval) Overlaps(o Interval) bool {
+	return i.Start.Before(o.End) && o.Start.Before(i.End)
+}
+
+// Occupied is the span an appointment blocks for its staff member: its service time
+// followed by the buffer needed to turn the chair around
+func Occupied(start, end time.Time, bufferMinutes int) Interval {
+	return Interval{Start: start, End: end.Add(time.Duration(bufferMinutes) * time.Minute)}
+}
+
+// DayAvailability is everything that decides whether a staff member can take a booking on one date
+type DayAvailability struct {
+	SalonOpen, SalonClose time.Time
+	Shifts                []Interval // working intervals, more than one for a split shift
+	Breaks                []Interval // recurring breaks inside the shifts
+	StaffOff              bool
+	TimeOff               bool       // full-day staff time off
+	TimeOffBlocks         []Interval // partial-day staff time off
+	Closed                bool       // closed weekday or full-day salon closure
+	Closures              []Interval // partial-day salon closures
+	Busy                  []Interval // occupied intervals of existing appointments, buffers included
+	NotBefore             time.Time  // zero = no cutoff; used to hide past slots today
+	Location              *time.Location
+	Resources             *ResourceDay // shared resources the booking needs; nil = none
+	// Salon slot settings
+	Step         time.Duration // grid spacing of offered start times
+	MinimizeGaps bool          // offer only start times flush against an edge
+}
+
+// Check returns the availability reason for a booking starting at start. The service itself
+// (serviceLen) must fit the salon hours and one of the staff shifts; the whole occupied block
+// (blockLen, buffers included) must not touch closures, time off, breaks or other
+// appointments' blocks, and the salon resources it needs must have a free unit.
+func (d DayAvailability) Check(start time.Time, serviceLen, blockLen time.Duration) string {
+	service := Interval{Start: start, End: start.Add(serviceLen)}
+	block := Interval{Start: start, End: start.Add(blockLen)}
+
+	if d.Closed || service.Start.Before(d.SalonOpen) || service.End.After(d.SalonClose) {
+		return ReasonClosed
+	}
+	for _, c := range d.Closures {
+		if block.Overlaps(c) {
+			return ReasonClosed
+		}
+	}
+	if d.TimeOff {
+		return ReasonTimeOff
+	}
+	if _, ok := d.shiftAt(service); d.StaffOff || !ok {
+		return ReasonOutOfShift
+	}
+	for _, t := range d.TimeOffBlocks {
+		if block.Overlaps(t) {
+			return ReasonTimeOff
+		}
+	}
+	for _, b := range d.Breaks {
+		if block.Overlaps(b) {
+			return ReasonBreak
+		}
+	}
+	for _, b := range d.Busy {
+		if block.Overlaps(b) {
+			return ReasonBooked
+		}
+	}
+	if !d.Resources.Fits(start) {
+		return ReasonResource
+	}
+	return ReasonAvailable
+}
+
+// shiftAt returns the shift that fully contains span
+func (d DayAvailability) shiftAt(span Interval) (Interval, bool) {
+	for _, sh := range d.Shifts {
+		if !span.Start.Before(sh.Start) && !span.End.After(sh.End) {
+			return sh, true
+		}
+	}
+	return Interval{}, false
+}
+
+// HidePast hides start times that are already over in the salon's timezone: the
+// elapsed part of today, or the whole day for a past date
+func (d *DayAvailability) HidePast(date, now time.Time) {
+	if d.Location != nil {
+		now = now.In(d.Location)
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	switch {
+	case day.Before(today):
+		d.NotBefore = d.SalonClose.Add(time.Minute)
+	case day.Equal(today):
+		d.NotBefore = time.Date(0, 1, 1, now.Hour(), now.Minute(), 0, 0, time.UTC)
+	}
+}
+
+// Slots lists the start times offered for a booking. Normally that is every Step across
+// the salon day, each marked with its availability; in MinimizeGaps mode only available
+// start times that sit flush against a booking, closure or shift edge are offered.
+func (d DayAvailability) Slots(serviceLen, blockLen time.Duration) []models.TimeSlot {
+	step := d.Step
+	if step <= 0 {
+		step = 30 * time.Minute
+	}
+
+	var starts []time.Time
+	if d.MinimizeGaps {
+		starts = d.edgeStarts(serviceLen, blockLen, step)
+	} else {
+		for t := d.SalonOpen; !t.Add(serviceLen).After(d.SalonClose); t = t.Add(step) {
+			starts = append(starts, t)
+		}
+	}
+
+	slots := []models.TimeSlot{}
+	for _, t := range starts {
+		if !d.NotBefore.IsZero() && t.Before(d.NotBefore) {
+			continue
+		}
+		reason := d.Check(t, serviceLen, blockLen)
+		if d.MinimizeGaps && reason != ReasonAvailable {
+			continue
+		}
+		slot := models.TimeSlot{
+			StartTime:          t.Format("15:04"),
+			EndTime:            t.Add(serviceLen).Format("15:04"),
+			Available:          reason == ReasonAvailable,
+			AvailabilityReason: reason,
+		}
+		if slot.Available {
+			slot.Score = d.Score(t, serviceLen, blockLen, step)
+		}
+		slots = append(slots, slot)
+	}
+	return slots
+}
+
+// edges are the intervals a booking can sit flush against besides the shift bounds
+func (d DayAvailability) edges() []Interval {
+	edges := append(append([]Interval{}, d.Busy...), d.Closures...)
+	edges = append(edges, d.Breaks...)
+	return append(edges, d.TimeOffBlocks...)
+}
+
+// edgeStarts are the start times that leave no gap on at least one side: right after a
+// booking, closure, break, time off, a shift start or the first bookable time today, or
+// ending right before a booking, closure, break, time off or a shift end
+func (d DayAvailability) edgeStarts(serviceLen, blockLen, step time.Duration) []time.Time {
+	var starts []time.Time
+	for _, sh := range d.Shifts {
+		starts = append(starts, sh.Start, sh.End.Add(-serviceLen))
+	}
+	if !d.NotBefore.IsZero() {
+		starts = append(starts, d.firstStart(step))
+	}
+	for _, e := range d.edges() {
+		starts = append(starts, e.End, e.Start.Add(-blockLen))
+	}
+
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+	unique := starts[:0]
+	for i, t := range starts {
+		if i == 0 || !t.Equal(starts[i-1]) {
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
+
+// firstStart is the first grid start at or after NotBefore
+func (d DayAvailability) firstStart(step time.Duration) time.Time {
+	t := d.SalonOpen
+	for t.Before(d.NotBefore) {
+		t = t.Add(step)
+	}
+	return t
+}
+
+// gaps returns the idle time a booking leaves before it (back to the previous booking,
+// closure, break, start of its shift or first bookable time) and after it (up to the next
+// one or the end of its shift)
+func (d DayAvailability) gaps(start time.Time, serviceLen, blockLen, step time.Duration) (before, after time.Duration) {
+	shift, _ := d.shiftAt(Interval{Start: start, End: start.Add(serviceLen)})
+	before = start.Sub(shift.Start)
+	after = shift.End.Sub(start.Add(serviceLen))
+	if !d.NotBefore.IsZero() {
+		if first := d.firstStart(step); !first.After(start) && start.Sub(first) < before {
+			before = start.Sub(first)
+		}
+	}
+
+	blockEnd := start.Add(blockLen)
+	for _, e := range d.edges() {
+		if !e.End.After(start) && start.Sub(e.End) < before {
+			before = start.Sub(e.End)
+		}
+		if !e.Start.Before(blockEnd) && e.Start.Sub(blockEnd) < after {
+			after = e.Start.Sub(blockEnd)
+		}
+	}
+	if after < 0 {
+		// the trailing buffer may run past the end of the shift
+		after = 0
+	}
+	return before, after
+}
+
+// Score rates an available start time from 0 to 100. Each side scores 50 when the
+// booking is flush against an edge, 25 when the gap left could still take another
+// booking of the same length, and 0 when it leaves a dead hole.
+func (d DayAvailability) Score(start time.Time, serviceLen, blockLen, step time.Duration) int {
+	before, after := d.gaps(start, serviceLen, blockLen, step)
+	return sideScore(before, blockLen) + sideScore(after, blockLen)
+}
+
+func sideScore(gap, blockLen time.Duration) int {
+	switch {
+	case gap == 0:
+		return 50
+	case gap >= blockLen:
+		return 25
+	}
+	return 0
+}
+
+// ParseClock accepts both "15:04" and the "15:04:05" Postgres returns for TIME::text
+func ParseClock(t string) (time.Time, error) {
+	if len(t) == 5 {
+		return time.Parse("15:04", t)
+	}
+	return time.Parse("15:04:05", t)
+}
+
+// loadDay reads the salon hours of the weekday, closures, the staff shifts and breaks with any time off or
+// per-date hours, and the staff member's occupied intervals for a date. excludeApptID leaves out the appointment being moved.
+func loadDay(ctx context.Context, q querier, salonID, staffID string, date time.Time, excludeApptID string) (*DayAvailability, error) {
+	dateStr := date.Format("2006-01-02")
+	var d DayAvailability
+
+	// Salon hours of this weekday, falling back to the flat opening hours
+	var openStr, closeStr, timezone string
+	var stepMinutes int
+	err := q.QueryRow(ctx,
+		`SELECT COALESCE(h.open_time, s.opening_time)::text, COALESCE(h.close_time, s.closing_time)::text,
+		 COALESCE(h.is_closed, false), s.slot_interval_minutes, s.minimize_gaps, s.timezone
+		 FROM salons s
+		 LEFT JOIN salon_hours h ON h.salon_id = s.id AND h.day_of_week = $2
+		 WHERE s.id = $1`, salonID, int(date.Weekday())).Scan(&openStr, &closeStr, &d.Closed, &stepMinutes, &d.MinimizeGaps, &timezone)
+	if err != nil {
+		return nil, fmt.Errorf("salon not found")
+	}
+	d.Step = time.Duration(stepMinutes) * time.Minute
+	d.Location = SalonLocation(timezone)
+	d.SalonOpen, _ = ParseClock(openStr)
+	d.SalonClose, _ = ParseClock(closeStr)
+
+	// Closures: any NULL bound means the whole day
+	rows, err := q.Query(ctx,
+		`SELECT start_time::text, end_time::text FROM salon_closures
+		 WHERE salon_id = $1 AND $2::date >= start_date AND $2::date <= end_date`, salonID, dateStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check closures: %w", err)
+	}
+	for rows.Next() {
+		var cs, ce *string
+		rows.Scan(&cs, &ce)
+		if cs == nil || ce == nil {
+			d.Closed = true
+			continue
+		}
+		start, _ := ParseClock(*cs)
+		end, _ := ParseClock(*ce)
+		d.Closures = append(d.Closures, Interval{Start: start, End: end})
+	}
+	rows.Close()
+
+	// Staff shifts and breaks; a weekday without a working shift is a day off
+	rows, err = q.Query(ctx,
+		`SELECT kind, start_time::text, end_time::text
+		 FROM staff_working_hours
+		 WHERE staff_id = $1 AND day_of_week = $2 AND NOT COALESCE(is_off, false)
+		 ORDER BY start_time`,
+		staffID, int(date.Weekday()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check working hours: %w", err)
+	}
+	for rows.Next() {
+		var kind, ss, se string
+		rows.Scan(&kind, &ss, &se)
+		start, _ := ParseClock(ss)
+		end, _ := ParseClock(se)
+		if kind == HoursBreak {
+			d.Breaks = append(d.Breaks, Interval{Start: start, End: end})
+		} else {
+			d.Shifts = append(d.Shifts, Interval{Start: start, End: end})
+		}
+	}
+	rows.Close()
+	d.StaffOff = len(d.Shifts) == 0
+
+	// Time off and per-date hours; custom hours replace the weekly shifts first,
+	// then time off is taken out of whatever shift applies
+	rows, err = q.Query(ctx,
+		`SELECT kind, start_time::text, end_time::text FROM staff_time_off
+		 WHERE staff_id = $1 AND $2::date >= start_date AND $2::date <= end_date
+		 ORDER BY kind = 'off', created_at`, staffID, dateStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check time off: %w", err)
+	}
+	for rows.Next() {
+		var kind string
+		var ts, te *string
+		rows.Scan(&kind, &ts, &te)
+		if ts == nil || te == nil {
+			d.TimeOff = true
+			continue
+		}
+		start, _ := ParseClock(*ts)
+		end, _ := ParseClock(*te)
+		if kind == TimeOffHours {
+			d.StaffOff = false
+			d.Shifts = []Interval{{Start: start, End: end}}
+		} else {
+			d.TimeOffBlocks = append(d.TimeOffBlocks, Interval{Start: start, End: end})
+		}
+	}
+	rows.Close()
+
+	// Existing appointments, each extended by the buffer of its last service
+	rows, err = q.Query(ctx,
+		`SELECT a.start_time::text, a.end_time::text,
+		 COALESCE((SELECT aps.buffer_minutes FROM appointment_services aps
+		           WHERE aps.appointment_id = a.id ORDER BY aps.position DESC LIMIT 1),
+		          sv.buffer_minutes, 0)
+		 FROM appointments a
+		 JOIN services sv ON sv.id = a.service_id
+		 WHERE a.staff_id = $1 AND a.appointment_date = $2
+		 AND `+occupiesSlotSQL+`
+		 AND a.id IS DISTINCT FROM NULLIF($3, '')::uuid
+		 ORDER BY a.start_time`, staffID, dateStr, excludeApptID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check availability: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var startStr, endStr string
+		var buffer int
+		rows.Scan(&startStr, &endStr, &buffer)
+		start, _ := ParseClock(startStr)
+		end, _ := ParseClock(endStr)
+		d.Busy = append(d.Busy, Occupied(start, end, buffer))
+	}
+
+	return &d, nil
+}
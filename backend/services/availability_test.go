@@ -0,0 +1,351 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"saloon-backend/models"
+)
+
+func clock(t *testing.T, s string) time.Time {
+	t.Helper()
+	c, err := ParseClock(s)
+	if err != nil {
+		t.Fatalf("bad clock %q: %v", s, err)
+	}
+	return c
+}
+
+// splitShift is 10:00-11:00 and 13:00-17:00
+func splitShift(t *testing.T) []Interval {
+	return []Interval{
+		{Start: clock(t, "10:00"), End: clock(t, "11:00")},
+		{Start: clock(t, "13:00"), End: clock(t, "17:00")},
+	}
+}
+
+func TestCheck(t *testing.T) {
+	base := func(t *testing.T) DayAvailability {
+		return DayAvailability{
+			SalonOpen:  clock(t, "09:00"),
+			SalonClose: clock(t, "18:00"),
+			Shifts:     []Interval{{Start: clock(t, "10:00"), End: clock(t, "17:00")}},
+			// 12:00-12:45 service followed by a 15 minute buffer
+			Busy: []Interval{Occupied(clock(t, "12:00"), clock(t, "12:45"), 15)},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(d *DayAvailability)
+		start   string
+		service int // minutes
+		buffer  int // trailing buffer of the new booking
+		want    string
+	}{
+		{name: "free slot", start: "10:00", service: 60, want: ReasonAvailable},
+		{name: "ends exactly at shift end", start: "16:00", service: 60, want: ReasonAvailable},
+		{name: "buffer may run past shift end", start: "16:00", service: 60, buffer: 15, want: ReasonAvailable},
+		{name: "service runs past shift end", start: "16:30", service: 60, want: ReasonOutOfShift},
+		{name: "starts before shift", start: "09:30", service: 30, want: ReasonOutOfShift},
+		{name: "runs past salon close", start: "17:30", service: 60, want: ReasonClosed},
+		{name: "starts during existing service", start: "12:30", service: 30, want: ReasonBooked},
+		{name: "starts inside existing buffer", start: "12:45", service: 30, want: ReasonBooked},
+		{name: "starts right after existing buffer", start: "13:00", service: 30, want: ReasonAvailable},
+		{name: "ends exactly at existing start", start: "11:00", service: 60, want: ReasonAvailable},
+		{name: "own buffer runs into existing start", start: "11:00", service: 60, buffer: 10, want: ReasonBooked},
+		{name: "own buffer ends exactly at existing start", start: "11:00", service: 50, buffer: 10, want: ReasonAvailable},
+		{name: "staff day off", start: "10:00", service: 30, want: ReasonOutOfShift,
+			modify: func(d *DayAvailability) { d.StaffOff = true }},
+		{name: "full-day closure", start: "10:00", service: 30, want: ReasonClosed,
+			modify: func(d *DayAvailability) { d.Closed = true }},
+		{name: "buffer overlaps partial closure", start: "14:00", service: 60, buffer: 15, want: ReasonClosed,
+			modify: func(d *DayAvailability) {
+				d.Closures = []Interval{{Start: clock(t, "15:10"), End: clock(t, "16:00")}}
+			}},
+		{name: "ends exactly at partial closure", start: "14:00", service: 60, want: ReasonAvailable,
+			modify: func(d *DayAvailability) {
+				d.Closures = []Interval{{Start: clock(t, "15:00"), End: clock(t, "16:00")}}
+			}},
+		{name: "full-day time off", start: "10:00", service: 30, want: ReasonTimeOff,
+			modify: func(d *DayAvailability) { d.TimeOff = true }},
+		{name: "buffer overlaps partial time off", start: "14:00", service: 60, buffer: 15, want: ReasonTimeOff,
+			modify: func(d *DayAvailability) {
+				d.TimeOffBlocks = []Interval{{Start: clock(t, "15:10"), End: clock(t, "16:00")}}
+			}},
+		{name: "ends exactly at partial time off", start: "14:00", service: 60, want: ReasonAvailable,
+			modify: func(d *DayAvailability) {
+				d.TimeOffBlocks = []Interval{{Start: clock(t, "15:00"), End: clock(t, "16:00")}}
+			}},
+		{name: "inside second half of split shift", start: "14:00", service: 60, want: ReasonAvailable,
+			modify: func(d *DayAvailability) { d.Shifts = splitShift(t) }},
+		{name: "between split shifts", start: "12:00", service: 60, want: ReasonOutOfShift,
+			modify: func(d *DayAvailability) { d.Shifts = splitShift(t) }},
+		{name: "spans the gap of a split shift", start: "10:30", service: 60, want: ReasonOutOfShift,
+			modify: func(d *DayAvailability) { d.Shifts = splitShift(t) }},
+		{name: "overlaps break", start: "13:30", service: 60, want: ReasonBreak,
+			modify: func(d *DayAvailability) {
+				d.Breaks = []Interval{{Start: clock(t, "14:00"), End: clock(t, "14:30")}}
+			}},
+		{name: "buffer runs into break", start: "13:00", service: 60, buffer: 10, want: ReasonBreak,
+			modify: func(d *DayAvailability) {
+				d.Breaks = []Interval{{Start: clock(t, "14:00"), End: clock(t, "14:30")}}
+			}},
+		{name: "starts when break ends", start: "14:30", service: 60, want: ReasonAvailable,
+			modify: func(d *DayAvailability) {
+				d.Breaks = []Interval{{Start: clock(t, "14:00"), End: clock(t, "14:30")}}
+			}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := base(t)
+			if tt.modify != nil {
+				tt.modify(&d)
+			}
+			serviceLen := time.Duration(tt.service) * time.Minute
+			blockLen := serviceLen + time.Duration(tt.buffer)*time.Minute
+			if got := d.Check(clock(t, tt.start), serviceLen, blockLen); got != tt.want {
+				t.Errorf("Check(%s, %dm+%dm) = %s, want %s", tt.start, tt.service, tt.buffer, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlots(t *testing.T) {
+	d := DayAvailability{
+		SalonOpen:  clock(t, "09:00"),
+		SalonClose: clock(t, "11:00"),
+		Shifts:     []Interval{{Start: clock(t, "09:00"), End: clock(t, "11:00")}},
+		Busy:       []Interval{Occupied(clock(t, "10:00"), clock(t, "10:15"), 15)},
+		NotBefore:  clock(t, "09:10"),
+		Step:       30 * time.Minute,
+	}
+
+	got := d.Slots(30*time.Minute, 40*time.Minute)
+	want := []struct {
+		start, reason string
+		score         int
+	}{
+		{"09:30", ReasonBooked, 0}, // 09:30-10:10 incl. buffer runs into 10:00
+		{"10:00", ReasonBooked, 0},
+		{"10:30", ReasonAvailable, 100}, // existing block ends 10:30, shift ends 11:00
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d slots, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		if got[i].StartTime != w.start || got[i].AvailabilityReason != w.reason || got[i].Score != w.score {
+			t.Errorf("slot %d = %s/%s/%d, want %s/%s/%d", i, got[i].StartTime, got[i].AvailabilityReason, got[i].Score,
+				w.start, w.reason, w.score)
+		}
+		if got[i].Available != (w.reason == ReasonAvailable) {
+			t.Errorf("slot %d Available = %v", i, got[i].Available)
+		}
+	}
+}
+
+func TestSlotsMinimizeGaps(t *testing.T) {
+	d := DayAvailability{
+		SalonOpen:    clock(t, "09:00"),
+		SalonClose:   clock(t, "13:00"),
+		Shifts:       []Interval{{Start: clock(t, "09:00"), End: clock(t, "13:00")}},
+		Busy:         []Interval{Occupied(clock(t, "10:00"), clock(t, "10:45"), 0)},
+		Step:         15 * time.Minute,
+		MinimizeGaps: true,
+	}
+
+	got := d.Slots(45*time.Minute, 45*time.Minute)
+	want := []struct {
+		start string
+		score int
+	}{
+		{"09:00", 50}, // flush with shift start, leaves a dead 15 minutes before 10:00
+		{"09:15", 50}, // ends flush with the booking, leaves a dead 15 minutes after 09:00
+		{"10:45", 75}, // flush with the booking, room for another 45 minutes after
+		{"12:15", 75}, // ends flush with the shift
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d slots, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		if got[i].StartTime != w.start || got[i].Score != w.score || !got[i].Available {
+			t.Errorf("slot %d = %s/%d/%v, want %s/%d/true", i, got[i].StartTime, got[i].Score, got[i].Available, w.start, w.score)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	d := DayAvailability{
+		SalonOpen:  clock(t, "09:00"),
+		SalonClose: clock(t, "18:00"),
+		Shifts:     []Interval{{Start: clock(t, "09:00"), End: clock(t, "18:00")}},
+		Busy: []Interval{
+			Occupied(clock(t, "10:00"), clock(t, "11:00"), 0),
+			Occupied(clock(t, "12:00"), clock(t, "12:30"), 15),
+		},
+	}
+
+	tests := []struct {
+		start   string
+		service int
+		buffer  int
+		want    int
+	}{
+		{"09:00", 60, 0, 100},  // fills the hole before 10:00 exactly
+		{"11:00", 60, 0, 100},  // fills the hole between bookings exactly
+		{"11:00", 45, 15, 100}, // own buffer closes the hole
+		{"11:00", 30, 0, 75},   // flush before, room for another 30 minutes after
+		{"11:15", 30, 0, 0},    // dead holes on both sides
+		{"12:45", 60, 0, 75},   // flush with the buffer, plenty of room after
+		{"17:00", 60, 15, 75},  // buffer past shift end still counts as flush
+	}
+	for _, tt := range tests {
+		serviceLen := time.Duration(tt.service) * time.Minute
+		blockLen := serviceLen + time.Duration(tt.buffer)*time.Minute
+		if got := d.Score(clock(t, tt.start), serviceLen, blockLen, 30*time.Minute); got != tt.want {
+			t.Errorf("Score(%s, %dm+%dm) = %d, want %d", tt.start, tt.service, tt.buffer, got, tt.want)
+		}
+	}
+}
+
+func TestOccupied(t *testing.T) {
+	tests := []struct {
+		start, end string
+		buffer     int
+		wantEnd    string
+	}{
+		{"10:00", "10:30", 0, "10:30"},
+		{"10:00", "10:30", 15, "10:45"},
+		{"23:00", "23:45", 10, "23:55"},
+	}
+	for _, tt := range tests {
+		got := Occupied(clock(t, tt.start), clock(t, tt.end), tt.buffer)
+		if got.End.Format("15:04") != tt.wantEnd || !got.Start.Equal(clock(t, tt.start)) {
+			t.Errorf("Occupied(%s, %s, %d) = %s-%s, want %s-%s", tt.start, tt.end, tt.buffer,
+				got.Start.Format("15:04"), got.End.Format("15:04"), tt.start, tt.wantEnd)
+		}
+	}
+}
+
+func TestMergeSlots(t *testing.T) {
+	slot := func(start, reason string, score int) models.TimeSlot {
+		return models.TimeSlot{StartTime: start, Available: reason == ReasonAvailable, AvailabilityReason: reason, Score: score}
+	}
+	perStaff := [][]models.TimeSlot{
+		{slot("09:00", ReasonOutOfShift, 0), slot("09:30", ReasonAvailable, 50), slot("10:00", ReasonBooked, 0)},
+		{slot("09:00", ReasonBooked, 0), slot("09:30", ReasonAvailable, 100), slot("10:00", ReasonAvailable, 75)},
+		{slot("09:00", ReasonClosed, 0), slot("09:30", ReasonBooked, 0), slot("09:45", ReasonAvailable, 25)},
+	}
+
+	got := MergeSlots(perStaff)
+	want := []struct {
+		start, reason string
+		score, staff  int
+	}{
+		{"09:00", ReasonBooked, 0, 0},
+		{"09:30", ReasonAvailable, 100, 2},
+		{"09:45", ReasonAvailable, 25, 1},
+		{"10:00", ReasonAvailable, 75, 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d slots, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.StartTime != w.start || g.AvailabilityReason != w.reason || g.Score != w.score || g.AvailableStaff != w.staff {
+			t.Errorf("slot %d = %s/%s/%d/%d, want %s/%s/%d/%d", i, g.StartTime, g.AvailabilityReason, g.Score, g.AvailableStaff,
+				w.start, w.reason, w.score, w.staff)
+		}
+		if g.Available != (w.reason == ReasonAvailable) {
+			t.Errorf("slot %d Available = %v", i, g.Available)
+		}
+	}
+}
+
+func TestHidePast(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip("tzdata not available")
+	}
+	// 2026-03-10 23:30 UTC is already 08:30 on the 11th in Tokyo
+	now := time.Date(2026, 3, 10, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		date string
+		loc  *time.Location
+		want string // NotBefore as HH:MM, "" for none
+	}{
+		{"today in salon timezone", "2026-03-11", tokyo, "08:30"},
+		{"yesterday in salon timezone", "2026-03-10", tokyo, "18:01"},
+		{"tomorrow in salon timezone", "2026-03-12", tokyo, ""},
+		{"today in UTC", "2026-03-10", time.UTC, "23:30"},
+		{"tomorrow in UTC", "2026-03-11", time.UTC, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := DayAvailability{SalonOpen: clock(t, "09:00"), SalonClose: clock(t, "18:00"), Location: tt.loc}
+			date, _ := time.Parse("2006-01-02", tt.date)
+			d.HidePast(date, now)
+			got := ""
+			if !d.NotBefore.IsZero() {
+				got = d.NotBefore.Format("15:04")
+			}
+			if got != tt.want {
+				t.Errorf("NotBefore = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppointmentTime(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("tzdata not available")
+	}
+	got, err := AppointmentTime("2026-07-01", "14:30:00", ny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2026, 7, 1, 18, 30, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("AppointmentTime = %s, want %s", got.UTC(), want)
+	}
+}
+
+func TestResourceFits(t *testing.T) {
+	// Two color stations: one held 10:00-11:00, another 10:30-11:30
+	r := &ResourceDay{
+		Capacity: map[string]int{"color": 2, "room": 1},
+		Use: []ResourceUse{
+			{ResourceID: "color", Interval: Interval{Start: clock(t, "10:00"), End: clock(t, "11:00")}, Quantity: 1},
+			{ResourceID: "color", Interval: Interval{Start: clock(t, "10:30"), End: clock(t, "11:30")}, Quantity: 1},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		needs []ResourceNeed
+		start string
+		want  bool
+	}{
+		{"one station free", []ResourceNeed{{ResourceID: "color", Length: 30 * time.Minute, Quantity: 1}}, "10:00", true},
+		{"both stations taken", []ResourceNeed{{ResourceID: "color", Length: 30 * time.Minute, Quantity: 1}}, "10:30", false},
+		{"peak inside window", []ResourceNeed{{ResourceID: "color", Length: 60 * time.Minute, Quantity: 1}}, "09:45", false},
+		{"starts when first ends", []ResourceNeed{{ResourceID: "color", Length: 60 * time.Minute, Quantity: 1}}, "11:00", true},
+		{"offset past the peak", []ResourceNeed{{ResourceID: "color", Offset: 90 * time.Minute, Length: 30 * time.Minute, Quantity: 1}}, "10:00", true},
+		{"needs more than capacity", []ResourceNeed{{ResourceID: "room", Length: 30 * time.Minute, Quantity: 2}}, "08:00", false},
+		{"unused resource", []ResourceNeed{{ResourceID: "room", Length: 30 * time.Minute, Quantity: 1}}, "10:30", true},
+	}
+	for _, tt := range tests {
+		r.Needs = tt.needs
+		if got := r.Fits(clock(t, tt.start)); got != tt.want {
+			t.Errorf("%s: Fits(%s) = %v, want %v", tt.name, tt.start, got, tt.want)
+		}
+	}
+
+	var none *ResourceDay
+	if !none.Fits(clock(t, "10:00")) {
+		t.Error("nil ResourceDay should always fit")
+	}
+}
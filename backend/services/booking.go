@@ -2,18 +2,35 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"math"
+	"strings"
 	"time"
 
 	"saloon-backend/models"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Booking conflicts callers may want to tell apart (e.g. when materializing a recurring series)
+var (
+	ErrStaffUnavailable    = errors.New("staff member is not working at this time")
+	ErrSalonClosed         = errors.New("salon is closed during this time")
+	ErrSlotBooked          = errors.New("time slot is already booked")
+	ErrStaffTimeOff        = errors.New("staff member is on time off at this time")
+	ErrStaffOnBreak        = errors.New("staff member is on a break at this time")
+	ErrResourceUnavailable = errors.New("a room or station this service needs is fully booked at this time")
+	ErrInPast              = errors.New("this time has already passed at the salon")
+)
+
 type BookingService struct {
 	DB          *pgxpool.Pool
 	Scheduler   *Scheduler
 	PushService *PushService
+	Payments    *PaymentService
 }
 
 func NewBookingService(db *pgxpool.Pool, scheduler *Scheduler) *BookingService {
@@ -24,7 +41,127 @@ func (s *BookingService) SetPushService(ps *PushService) {
 	s.PushService = ps
 }
 
-// CascadeReschedule adjusts the target appointment and ripples the shift to subsequent ones
+func (s *BookingService) SetPaymentService(ps *PaymentService) {
+	s.Payments = ps
+}
+
+// serviceLine is one service of a booking, in the order it will be performed
+type serviceLine struct {
+	ID       string
+	Name     string
+	Price    float64
+	Duration int
+	Buffer   int
+	Category string
+	// Deposit the service requires when booked (none, flat or percent)
+	DepositType  string
+	DepositValue float64
+}
+
+// RequestedServiceIDs merges the legacy single service_id with the ordered service_ids list.
+// Comma-separated entries are split so "?service_ids=a,b" works as well as repeated params.
+func RequestedServiceIDs(serviceID string, serviceIDs []string) []string {
+	var ids []string
+	for _, raw := range append([]string{serviceID}, serviceIDs...) {
+		for _, id := range strings.Split(raw, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// loadServiceLines resolves the requested services in order and returns the salon they belong to
+func (s *BookingService) loadServiceLines(ctx context.Context, serviceIDs []string) ([]serviceLine, string, error) {
+	return loadServiceLines(ctx, s.DB, serviceIDs)
+}
+
+func loadServiceLines(ctx context.Context, q querier, serviceIDs []string) ([]serviceLine, string, error) {
+	if len(serviceIDs) == 0 {
+		return nil, "", fmt.Errorf("at least one service is required")
+	}
+
+	rows, err := q.Query(ctx,
+		`SELECT id, salon_id, name, price, duration_minutes, COALESCE(buffer_minutes, 0), COALESCE(category, ''),
+		 deposit_type, deposit_value
+		 FROM services WHERE id = ANY($1) AND is_active = true`, serviceIDs)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	byID := make(map[string]serviceLine)
+	salonOf := make(map[string]string)
+	for rows.Next() {
+		var l serviceLine
+		var salonID string
+		if err := rows.Scan(&l.ID, &salonID, &l.Name, &l.Price, &l.Duration, &l.Buffer, &l.Category,
+			&l.DepositType, &l.DepositValue); err != nil {
+			return nil, "", err
+		}
+		byID[l.ID] = l
+		salonOf[l.ID] = salonID
+	}
+	rows.Close()
+
+	var salonID string
+	lines := make([]serviceLine, 0, len(serviceIDs))
+	for _, id := range serviceIDs {
+		l, ok := byID[id]
+		if !ok {
+			return nil, "", fmt.Errorf("service not found")
+		}
+		if salonID == "" {
+			salonID = salonOf[id]
+		} else if salonOf[id] != salonID {
+			return nil, "", fmt.Errorf("all services must belong to the same salon")
+		}
+		lines = append(lines, l)
+	}
+	return lines, salonID, nil
+}
+
+// serviceMinutes is the time from the first service's start to the last service's end
+// (buffers between services included, the trailing buffer excluded)
+func serviceMinutes(lines []serviceLine) int {
+	total := 0
+	for i, l := range lines {
+		total += l.Duration
+		if i < len(lines)-1 {
+			total += l.Buffer
+		}
+	}
+	return total
+}
+
+// blockMinutes is the full time the staff member is occupied, every buffer included
+func blockMinutes(lines []serviceLine) int {
+	total := 0
+	for _, l := range lines {
+		total += l.Duration + l.Buffer
+	}
+	return total
+}
+
+func joinServiceNames(lines []serviceLine) string {
+	names := make([]string, len(lines))
+	for i, l := range lines {
+		names[i] = l.Name
+	}
+	return strings.Join(names, " + ")
+}
+
+func sumServicePrices(lines []serviceLine) float64 {
+	total := 0.0
+	for _, l := range lines {
+		total += l.Price
+	}
+	return total
+}
+
+// CascadeReschedule adjusts the target appointment and ripples the shift to subsequent ones.
+// It fails if a shifted appointment would push a shared resource over capacity.
 func (s *BookingService) CascadeReschedule(ctx context.Context, apptID string, newEndTimeStr string) error {
 	tx, err := s.DB.Begin(ctx)
 	if err != nil {
@@ -33,28 +170,56 @@ func (s *BookingService) CascadeReschedule(ctx context.Context, apptID string, n
 	defer tx.Rollback(ctx)
 
 	// 1. Fetch the targeted appointment
-	var staffID, dateStr, currentStartTime string
+	var salonID, staffID, dateStr, currentStartTime string
 	err = tx.QueryRow(ctx,
-		"SELECT staff_id, appointment_date::text, start_time::text FROM appointments WHERE id = $1",
-		apptID).Scan(&staffID, &dateStr, &currentStartTime)
+		"SELECT salon_id, staff_id, appointment_date::text, start_time::text FROM appointments WHERE id = $1",
+		apptID).Scan(&salonID, &staffID, &dateStr, &currentStartTime)
 	if err != nil {
 		return fmt.Errorf("appointment not found")
 	}
 
+	// Serialize with bookings for the same staff member
+	if _, err := tx.Exec(ctx, "SELECT 1 FROM staff WHERE id = $1 FOR UPDATE", staffID); err != nil {
+		return fmt.Errorf("failed to lock staff row: %w", err)
+	}
+
 	// Update the target appointment's end time
 	_, err = tx.Exec(ctx, "UPDATE appointments SET end_time = $1 WHERE id = $2", newEndTimeStr, apptID)
 	if err != nil {
 		return fmt.Errorf("failed to update target end time")
 	}
 
+	// The overrun belongs to the last service of the target appointment
+	_, err = tx.Exec(ctx,
+		`UPDATE appointment_services SET end_time = $1
+		 WHERE appointment_id = $2
+		 AND position = (SELECT MAX(position) FROM appointment_services WHERE appointment_id = $2)`,
+		newEndTimeStr, apptID)
+	if err != nil {
+		return fmt.Errorf("failed to update target line items")
+	}
+
+	// Buffer after the target's last service, which the next appointment must respect
+	var targetBuffer int
+	tx.QueryRow(ctx,
+		`SELECT COALESCE((SELECT aps.buffer_minutes FROM appointment_services aps
+		                  WHERE aps.appointment_id = a.id ORDER BY aps.position DESC LIMIT 1),
+		                 sv.buffer_minutes, 0)
+		 FROM appointments a JOIN services sv ON sv.id = a.service_id WHERE a.id = $1`,
+		apptID).Scan(&targetBuffer)
+
 	// 2. Fetch all subsequent appointments for this staff member today
 	rows, err := tx.Query(ctx,
-		`SELECT id, customer_id, start_time::text, end_time::text, service_id 
-		 FROM appointments 
-		 WHERE staff_id = $1 AND appointment_date = $2 
-		 AND status IN ('pending', 'confirmed') 
-		 AND start_time > $3::time 
-		 ORDER BY start_time ASC`,
+		`SELECT a.id, a.customer_id, a.start_time::text, a.end_time::text,
+		 COALESCE((SELECT aps.buffer_minutes FROM appointment_services aps
+		           WHERE aps.appointment_id = a.id ORDER BY aps.position DESC LIMIT 1),
+		          sv.buffer_minutes, 0)
+		 FROM appointments a
+		 JOIN services sv ON sv.id = a.service_id
+		 WHERE a.staff_id = $1 AND a.appointment_date = $2
+		 AND a.status IN ('pending', 'confirmed')
+		 AND a.start_time > $3::time
+		 ORDER BY a.start_time ASC`,
 		staffID, dateStr, currentStartTime)
 	if err != nil {
 		return err
@@ -62,39 +227,47 @@ func (s *BookingService) CascadeReschedule(ctx context.Context, apptID string, n
 	defer rows.Close()
 
 	type apptShift struct {
-		id, customerID, serviceID string
-		oldStart, oldEnd          string
-		duration                  time.Duration
+		id, customerID string
+		oldStart       string
+		start          time.Time
+		duration       time.Duration
+		buffer         int
 	}
 	var subsequent []apptShift
 
 	for rows.Next() {
 		var a apptShift
 		var startStr, endStr string
-		rows.Scan(&a.id, &a.customerID, &startStr, &endStr, &a.serviceID)
+		rows.Scan(&a.id, &a.customerID, &startStr, &endStr, &a.buffer)
 
-		st, _ := time.Parse("15:04:05", startStr)
-		en, _ := time.Parse("15:04:05", endStr)
+		st, _ := ParseClock(startStr)
+		en, _ := ParseClock(endStr)
+		a.start = st
 		a.duration = en.Sub(st)
 		a.oldStart = startStr
 		subsequent = append(subsequent, a)
 	}
 	rows.Close()
 
-	// 3. Ripple the changes
-	lastEndTime, _ := time.Parse("15:04", newEndTimeStr)
-	if lastEndTime.IsZero() {
-		lastEndTime, _ = time.Parse("15:04:05", newEndTimeStr)
+	// 3. Ripple the changes: each appointment only moves if the previous occupied
+	// interval (service + buffer) now runs into it, and the ripple stops at the first gap
+	newEnd, err := ParseClock(newEndTimeStr)
+	if err != nil {
+		return fmt.Errorf("invalid end time format, use HH:MM")
 	}
-
-	buffer := 5 * time.Minute
+	occupiedUntil := Occupied(time.Time{}, newEnd, targetBuffer).End
+	changed := []string{apptID}
+	var shifted []apptShift
 
 	for _, a := range subsequent {
-		newStart := lastEndTime.Add(buffer)
-		newEnd := newStart.Add(a.duration)
+		if !a.start.Before(occupiedUntil) {
+			break
+		}
+		newStart := occupiedUntil
+		shiftedEnd := newStart.Add(a.duration)
 
 		newStartStr := newStart.Format("15:04:05")
-		newEndStr := newEnd.Format("15:04:05")
+		newEndStr := shiftedEnd.Format("15:04:05")
 
 		_, err = tx.Exec(ctx,
 			"UPDATE appointments SET start_time = $1, end_time = $2, notes = COALESCE(notes, '') || '\n(Time shifted due to preceding appointment delay)' WHERE id = $3",
@@ -103,67 +276,143 @@ func (s *BookingService) CascadeReschedule(ctx context.Context, apptID string, n
 			return fmt.Errorf("failed to update subsequent appointment %s", a.id)
 		}
 
-		// Notify the user immediately if PushService is available
-		if s.PushService != nil {
+		// Shift the line items by the same offset
+		_, err = tx.Exec(ctx,
+			`UPDATE appointment_services
+			 SET start_time = start_time + ($1::time - $2::time), end_time = end_time + ($1::time - $2::time)
+			 WHERE appointment_id = $3`,
+			newStartStr, a.oldStart, a.id)
+		if err != nil {
+			return fmt.Errorf("failed to update line items of appointment %s", a.id)
+		}
+		if err := EnqueueReminders(ctx, tx, a.id); err != nil {
+			return err
+		}
+
+		a.start = newStart
+		shifted = append(shifted, a)
+		occupiedUntil = Occupied(newStart, shiftedEnd, a.buffer).End
+		changed = append(changed, a.id)
+	}
+
+	// Every appointment that now runs at a different time must still get its resources
+	var needed []serviceLine
+	for _, id := range changed {
+		lines, _, err := appointmentLines(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		needed = append(needed, lines...)
+	}
+	if err := lockResources(ctx, tx, needed); err != nil {
+		return err
+	}
+	date, _ := time.Parse("2006-01-02", dateStr)
+	for _, id := range changed {
+		if err := checkAppointmentResources(ctx, tx, salonID, date, id); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	// Notify the users once the new times are final
+	if s.PushService != nil {
+		for _, a := range shifted {
 			go s.PushService.SendToUser(context.Background(), a.customerID, PushPayload{
 				Title: "Appointment Update 🕒",
-				Body:  fmt.Sprintf("Your appointment today has been shifted to %s due to a slight delay. We apologize for the inconvenience!", newStart.Format("15:04")),
+				Body:  fmt.Sprintf("Your appointment today has been shifted to %s due to a slight delay. We apologize for the inconvenience!", a.start.Format("15:04")),
 				Icon:  "/vite.svg",
 				URL:   "/appointments",
 			})
 		}
-
-		lastEndTime = newEnd
 	}
+	return nil
+}
 
-	return tx.Commit(ctx)
+// bookingOptions carries extras for bookings made on the customer's behalf (e.g. series occurrences)
+type bookingOptions struct {
+	SeriesID   *string
+	Occurrence int
+	// Quiet skips the per-appointment confirmation notification
+	Quiet bool
+	// TakeDeposit holds the booking in awaiting_deposit when its services require a deposit
+	TakeDeposit bool
 }
 
-// BookAppointment handles concurrency-safe booking using database-level locking
+// BookAppointment handles concurrency-safe booking using database-level locking, then opens
+// a card authorization for the amount due. A failed authorization leaves the payment
+// pending so it can still be collected at the salon. A booking that requires a deposit
+// opens a payment for the deposit instead and holds its slot until it is paid; the balance
+// is collected at the salon. A booking paid for in full by the customer's prepaid plan has
+// no payment.
 func (s *BookingService) BookAppointment(ctx context.Context, customerID string, req models.BookAppointmentRequest) (*models.Appointment, *models.Payment, error) {
-	// Get service details for computing end time
-	var durationMinutes, bufferMinutes int
-	var servicePrice float64
-	var serviceName string
-	err := s.DB.QueryRow(ctx,
-		`SELECT s.name, s.duration_minutes, s.buffer_minutes, s.price 
-		 FROM services s 
-		 WHERE s.id = $1 AND s.is_active = true`,
-		req.ServiceID).Scan(&serviceName, &durationMinutes, &bufferMinutes, &servicePrice)
+	appt, payment, err := s.book(ctx, customerID, req, bookingOptions{TakeDeposit: true})
+	if err != nil || s.Payments == nil || payment == nil {
+		return appt, payment, err
+	}
+
+	if appt.Deposit != nil {
+		deposit, err := s.Payments.PayDeposit(ctx, appt.ID)
+		if err != nil {
+			log.Printf("⚠️  Deposit payment for appointment %s: %v", appt.ID, err)
+			return appt, payment, nil
+		}
+		appt.Deposit = deposit
+		s.DB.QueryRow(ctx, "SELECT status FROM appointments WHERE id = $1", appt.ID).Scan(&appt.Status)
+		return appt, payment, nil
+	}
+
+	secret, err := s.Payments.Authorize(ctx, payment.ID, appt.ServiceName)
+	if err != nil {
+		log.Printf("⚠️  Payment authorization for appointment %s: %v", appt.ID, err)
+		return appt, payment, nil
+	}
+	s.DB.QueryRow(ctx,
+		"SELECT status, COALESCE(provider, ''), COALESCE(provider_intent_id, '') FROM payments WHERE id = $1",
+		payment.ID).Scan(&payment.Status, &payment.Provider, &payment.ProviderIntentID)
+	payment.ClientSecret = secret
+	return appt, payment, nil
+}
+
+func (s *BookingService) book(ctx context.Context, customerID string, req models.BookAppointmentRequest, opts bookingOptions) (*models.Appointment, *models.Payment, error) {
+	// Resolve the ordered list of services for computing the combined block
+	lines, serviceSalonID, err := s.loadServiceLines(ctx, RequestedServiceIDs(req.ServiceID, req.ServiceIDs))
 	if err != nil {
-		return nil, nil, fmt.Errorf("service not found")
+		return nil, nil, err
+	}
+	if serviceSalonID != req.SalonID {
+		return nil, nil, fmt.Errorf("service does not belong to this salon")
 	}
+	servicePrice := sumServicePrices(lines)
+	serviceName := joinServiceNames(lines)
 
-	// Parse start time and calculate end time
+	// Parse start time and calculate end time (last service end)
 	startTime, err := time.Parse("15:04", req.StartTime)
 	if err != nil {
 		return nil, nil, fmt.Errorf("invalid start time format, use HH:MM")
 	}
-	endTime := startTime.Add(time.Duration(durationMinutes) * time.Minute)
-	endTimeStr := endTime.Format("15:04")
+	serviceLen := time.Duration(serviceMinutes(lines)) * time.Minute
+	endTimeStr := startTime.Add(serviceLen).Format("15:04")
 
-	// Get salon name for notifications
-	var salonName string
-	err = s.DB.QueryRow(ctx, "SELECT name FROM salons WHERE id = $1", req.SalonID).Scan(&salonName)
+	// Get salon name for notifications and the timezone the date and time are in
+	var salonName, timezone string
+	var holdMinutes int
+	err = s.DB.QueryRow(ctx, "SELECT name, timezone, deposit_hold_minutes FROM salons WHERE id = $1",
+		req.SalonID).Scan(&salonName, &timezone, &holdMinutes)
 	if err != nil {
 		return nil, nil, fmt.Errorf("salon not found")
 	}
 
-	// Check staff working hours
 	date, err := time.Parse("2006-01-02", req.Date)
 	if err != nil {
 		return nil, nil, fmt.Errorf("invalid date format, use YYYY-MM-DD")
 	}
-	dayOfWeek := int(date.Weekday())
-
-	var isOff bool
-	var workStart, workEnd string
-	err = s.DB.QueryRow(ctx,
-		`SELECT is_off, start_time::text, end_time::text 
-		 FROM staff_working_hours WHERE staff_id = $1 AND day_of_week = $2`,
-		req.StaffID, dayOfWeek).Scan(&isOff, &workStart, &workEnd)
-	if err == nil && isOff {
-		return nil, nil, fmt.Errorf("staff member is not available on this day")
+	apptTime, _ := AppointmentTime(req.Date, req.StartTime, SalonLocation(timezone))
+	if apptTime.Before(time.Now()) {
+		return nil, nil, ErrInPast
 	}
 
 	// Begin transaction with row-level lock to prevent double booking
@@ -173,312 +422,324 @@ func (s *BookingService) BookAppointment(ctx context.Context, customerID string,
 	}
 	defer tx.Rollback(ctx)
 
-	// Check for salon closure
-	var closureCount int
-	err = tx.QueryRow(ctx,
-		`SELECT COUNT(*) FROM salon_closures
-		 WHERE salon_id = $1
-		 AND $2::date >= start_date AND $2::date <= end_date
-		 AND (
-			 start_time IS NULL OR 
-			 end_time IS NULL OR 
-			 (start_time::time < $4::time AND end_time::time > $3::time)
-		 )`,
-		req.SalonID, req.Date, req.StartTime, endTimeStr).Scan(&closureCount)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to check closures: %w", err)
+	if req.StaffID == "" || req.StaffID == AnyStaff {
+		// Pick the stylist now, under the same row locks a direct booking takes
+		req.StaffID, err = assignStaff(ctx, tx, req.SalonID, lines, req.StaffPreference, date, startTime, "")
+		if err != nil {
+			return nil, nil, err
+		}
+	} else if err := ensureSlotFree(ctx, tx, req.SalonID, req.StaffID, lines, date, startTime, ""); err != nil {
+		return nil, nil, err
 	}
-	if closureCount > 0 {
-		return nil, nil, fmt.Errorf("salon is closed during this time")
+
+	// Credits of the customer's plan pay for the services it covers, which are free from
+	// here on
+	var cover *planCover
+	if req.CustomerPlanID != "" {
+		cover, err = claimPlanCredits(ctx, tx, customerID, req.SalonID, req.CustomerPlanID, lines, apptTime)
+		if err != nil {
+			return nil, nil, err
+		}
+		lines = cover.apply(lines)
+		servicePrice = sumServicePrices(lines)
 	}
 
-	// Lock the staff row to serialize bookings for this staff member
-	// This prevents race conditions where two concurrent requests see the slot as available
-	_, err = tx.Exec(ctx, "SELECT 1 FROM staff WHERE id = $1 FOR UPDATE", req.StaffID)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to lock staff row: %w", err)
+	// Apply the promo code; a code that doesn't apply fails the booking with the reason
+	var promoCodeID *string
+	var discount float64
+	if req.PromoCode != "" {
+		order := promoOrder{Lines: lines, Date: req.Date, Start: req.StartTime}
+		promo, d, err := evaluatePromoCode(ctx, tx, req.SalonID, customerID, req.PromoCode, order, true)
+		if err != nil {
+			return nil, nil, err
+		}
+		promoCodeID, discount = &promo.ID, d
 	}
 
-	// Lock overlapping appointment rows for this staff on this date
-	// This prevents concurrent bookings from creating overlapping slots
-	var conflictCount int
-	err = tx.QueryRow(ctx,
-		`SELECT COUNT(*) FROM appointments 
-		 WHERE staff_id = $1 AND appointment_date = $2 
-		 AND status NOT IN ('cancelled', 'no_show')
-		 AND (start_time, end_time) OVERLAPS ($3::time, $4::time)`,
-		req.StaffID, req.Date, req.StartTime, endTimeStr).Scan(&conflictCount)
+	// Members get their discount on what is left after the promo
+	memberPercent, err := memberDiscountPercent(ctx, tx, customerID, req.SalonID, apptTime)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to check availability: %w", err)
-	}
-	if conflictCount > 0 {
-		return nil, nil, fmt.Errorf("time slot is already booked")
+		return nil, nil, err
 	}
+	memberDiscount := roundCents((servicePrice - discount) * memberPercent / 100)
 
-	// Handle promo code
-	var promoCodeID *string
-	var discount float64
-	if req.PromoCode != "" {
-		var pc models.PromoCode
-		err = tx.QueryRow(ctx,
-			`SELECT id, discount_percent, max_uses, used_count FROM promo_codes 
-			 WHERE code = $1 AND salon_id = $2 AND is_active = true 
-			 AND (valid_until IS NULL OR valid_until > NOW())
-			 FOR UPDATE`,
-			req.PromoCode, req.SalonID).Scan(&pc.ID, &pc.DiscountPercent, &pc.MaxUses, &pc.UsedCount)
-		if err == nil {
-			if pc.MaxUses != nil && pc.UsedCount >= *pc.MaxUses {
-				return nil, nil, fmt.Errorf("promo code has reached maximum uses")
-			}
-			promoCodeID = &pc.ID
-			discount = servicePrice * (pc.DiscountPercent / 100.0)
+	// Redeemed loyalty points come off what is left after the promo and member discounts
+	var pointsDiscount float64
+	if req.RedeemPoints > 0 {
+		pointsDiscount, err = quotePointsRedemption(ctx, tx, customerID, req.SalonID, req.RedeemPoints,
+			servicePrice-discount-memberDiscount)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
 
-			tx.Exec(ctx, "UPDATE promo_codes SET used_count = used_count + 1 WHERE id = $1", pc.ID)
+	// Price the booking, taxed per the salon's rules
+	price, err := priceServiceLines(ctx, tx, req.SalonID, lines, discount+memberDiscount+pointsDiscount)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// A deposit holds the slot for a limited time until it is paid
+	status := "pending"
+	var deposit float64
+	var depositExpires *time.Time
+	if opts.TakeDeposit {
+		if deposit = math.Min(depositFor(lines), price.Total); deposit > 0 {
+			status = "awaiting_deposit"
+			expires := time.Now().Add(time.Duration(holdMinutes) * time.Minute)
+			depositExpires = &expires
 		}
 	}
 
 	// Insert appointment
 	var appt models.Appointment
 	err = tx.QueryRow(ctx,
-		`INSERT INTO appointments (customer_id, salon_id, staff_id, service_id, appointment_date, start_time, end_time, status, notes, promo_code_id)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, 'pending', $8, $9)
-		 RETURNING id, customer_id, salon_id, staff_id, service_id, appointment_date::text, start_time::text, end_time::text, status, COALESCE(notes,''), promo_code_id, created_at, updated_at`,
-		customerID, req.SalonID, req.StaffID, req.ServiceID, req.Date, req.StartTime, endTimeStr, req.Notes, promoCodeID,
+		`INSERT INTO appointments (customer_id, salon_id, staff_id, service_id, appointment_date, start_time, end_time, status, notes, promo_code_id, series_id, series_occurrence, deposit_expires_at,
+		 promo_discount, points_discount, member_discount)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NULLIF($12, 0), $13, $14, $15, $16)
+		 RETURNING id, customer_id, salon_id, staff_id, service_id, appointment_date::text, start_time::text, end_time::text, status, COALESCE(notes,''), promo_code_id, series_id, created_at, updated_at`,
+		customerID, req.SalonID, req.StaffID, lines[0].ID, req.Date, req.StartTime, endTimeStr, status, req.Notes, promoCodeID, opts.SeriesID, opts.Occurrence, depositExpires,
+		discount, pointsDiscount, memberDiscount,
 	).Scan(&appt.ID, &appt.CustomerID, &appt.SalonID, &appt.StaffID, &appt.ServiceID,
 		&appt.AppointmentDate, &appt.StartTime, &appt.EndTime, &appt.Status,
-		&appt.Notes, &appt.PromoCodeID, &appt.CreatedAt, &appt.UpdatedAt)
+		&appt.Notes, &appt.PromoCodeID, &appt.SeriesID, &appt.CreatedAt, &appt.UpdatedAt)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create appointment: %w", err)
 	}
-
-	// Create payment record
-	tax := 0.0
-	total := servicePrice - discount
-	receiptNumber := fmt.Sprintf("RCP-%s-%s", time.Now().Format("20060102"), appt.ID[:8])
-
-	var payment models.Payment
-	err = tx.QueryRow(ctx,
-		`INSERT INTO payments (appointment_id, amount, discount, tax, total, method, status, receipt_number) 
-		 VALUES ($1, $2, $3, $4, $5, 'card', 'pending', $6)
-		 RETURNING id, appointment_id, amount, discount, tax, total, method, status, receipt_number, created_at, updated_at`,
-		appt.ID, servicePrice, discount, tax, total, receiptNumber,
-	).Scan(&payment.ID, &payment.AppointmentID, &payment.Amount, &payment.Discount,
-		&payment.Tax, &payment.Total, &payment.Method, &payment.Status,
-		&payment.ReceiptNumber, &payment.CreatedAt, &payment.UpdatedAt)
+	appt.ServiceName = serviceName
+	appt.ServicePrice = servicePrice
+	appt.SalonTimezone = timezone
+	if promoCodeID != nil {
+		if err := redeemPromo(ctx, tx, *promoCodeID, customerID, appt.ID, discount); err != nil {
+			return nil, nil, err
+		}
+	}
+	err = addPoints(ctx, tx, pointsEntry{
+		UserID: customerID, SalonID: req.SalonID, Kind: PointsRedeem, Points: -req.RedeemPoints,
+		AppointmentID: appt.ID, Note: "Redeemed at booking",
+	})
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create payment: %w", err)
+		return nil, nil, err
+	}
+
+	// Insert one line item per service, back-to-back with each service's buffer in between
+	cursor := startTime
+	for i, l := range lines {
+		itemEnd := cursor.Add(time.Duration(l.Duration) * time.Minute)
+		item := models.AppointmentService{
+			ServiceID:       l.ID,
+			ServiceName:     l.Name,
+			Position:        i,
+			Price:           l.Price,
+			DurationMinutes: l.Duration,
+			BufferMinutes:   l.Buffer,
+		}
+		err = tx.QueryRow(ctx,
+			`INSERT INTO appointment_services (appointment_id, service_id, position, price, duration_minutes, buffer_minutes, start_time, end_time)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			 RETURNING id, appointment_id, start_time::text, end_time::text`,
+			appt.ID, l.ID, i, l.Price, l.Duration, l.Buffer, cursor.Format("15:04"), itemEnd.Format("15:04"),
+		).Scan(&item.ID, &item.AppointmentID, &item.StartTime, &item.EndTime)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create appointment line item: %w", err)
+		}
+		appt.Services = append(appt.Services, item)
+		cursor = itemEnd.Add(time.Duration(l.Buffer) * time.Minute)
+	}
+
+	// Create payment record, unless the plan paid for everything
+	var payment *models.Payment
+	if cover != nil {
+		if err := cover.useCredits(ctx, tx, appt.ID, appt.Services); err != nil {
+			return nil, nil, err
+		}
+	}
+	if cover == nil || servicePrice > 0 {
+		if payment, err = insertPayment(ctx, tx, appt.SalonID, appt.ID, price, "card"); err != nil {
+			return nil, nil, err
+		}
+	}
+	if depositExpires != nil {
+		if appt.Deposit, err = insertDeposit(ctx, tx, appt.ID, payment.ID, deposit, *depositExpires); err != nil {
+			return nil, nil, err
+		}
 	}
 
 	// Create notification
-	tx.Exec(ctx,
-		`INSERT INTO notifications (user_id, type, title, message, appointment_id)
-		 VALUES ($1, 'appointment_confirmed', 'Appointment Confirmed', $2, $3)`,
-		customerID,
-		fmt.Sprintf("Your appointment for %s on %s at %s has been confirmed.", serviceName, req.Date, req.StartTime),
-		appt.ID)
-
-	// Award loyalty points (1 point per dollar spent)
-	tx.Exec(ctx,
-		"UPDATE users SET loyalty_points = loyalty_points + $1 WHERE id = $2",
-		int(servicePrice), customerID)
+	if appt.Deposit != nil && !opts.Quiet {
+		tx.Exec(ctx,
+			`INSERT INTO notifications (user_id, type, title, message, appointment_id)
+			 VALUES ($1, 'general', 'Deposit Required', $2, $3)`,
+			customerID,
+			fmt.Sprintf("Pay the %.2f deposit for %s on %s at %s within %d minutes to confirm your booking.",
+				deposit, serviceName, req.Date, req.StartTime, holdMinutes),
+			appt.ID)
+	} else if !opts.Quiet {
+		tx.Exec(ctx,
+			`INSERT INTO notifications (user_id, type, title, message, appointment_id)
+			 VALUES ($1, 'appointment_confirmed', 'Appointment Confirmed', $2, $3)`,
+			customerID,
+			fmt.Sprintf("Your appointment for %s on %s at %s has been confirmed.", serviceName, req.Date, req.StartTime),
+			appt.ID)
+	}
+
+	if err := EnqueueReminders(ctx, tx, appt.ID); err != nil {
+		return nil, nil, err
+	}
 
 	if err := tx.Commit(ctx); err != nil {
 		return nil, nil, fmt.Errorf("failed to commit booking: %w", err)
 	}
 
-	// Parse full appointment time for scheduler
-	st, _ := time.Parse("15:04", req.StartTime)
-	dt, _ := time.Parse("2006-01-02", req.Date)
-	apptTime := time.Date(dt.Year(), dt.Month(), dt.Day(), st.Hour(), st.Minute(), 0, 0, time.Local)
+	return &appt, payment, nil
+}
 
-	// If the appointment is within the next 70 minutes, schedule reminders immediately
-	// (Scheduler loop only runs hourly, so we handle mid-hour bookings here)
-	if s.Scheduler != nil && time.Until(apptTime) < 70*time.Minute {
-		// Schedule 1h reminder
-		s.Scheduler.ScheduleReminder(ctx, apptTime, 60, appt.ID, customerID, serviceName, salonName, "reminder_1h_sent", "Appointment in 1 Hour", "Your appointment for %s at %s is in 1 hour. Get ready! 💇")
+// ensureSlotFree locks the staff row and the resources the services need, then runs the
+// availability engine inside tx, so two concurrent requests can't both see the same block
+// as free. excludeApptID lets a reschedule ignore the appointment being moved.
+func ensureSlotFree(ctx context.Context, tx pgx.Tx, salonID, staffID string, lines []serviceLine, date, start time.Time, excludeApptID string) error {
+	// Lock the staff row to serialize bookings for this staff member
+	_, err := tx.Exec(ctx, "SELECT 1 FROM staff WHERE id = $1 FOR UPDATE", staffID)
+	if err != nil {
+		return fmt.Errorf("failed to lock staff row: %w", err)
+	}
+	if err := lockResources(ctx, tx, lines); err != nil {
+		return err
+	}
 
-		// Schedule 20m reminder
-		s.Scheduler.ScheduleReminder(ctx, apptTime, 20, appt.ID, customerID, serviceName, salonName, "reminder_20m_sent", "Appointment in 20 Minutes", "Your appointment for %s at %s starts in 20 minutes. Head over! 🏃")
+	day, err := loadDay(ctx, tx, salonID, staffID, date, excludeApptID)
+	if err != nil {
+		return err
+	}
+	if day.Resources, err = loadResources(ctx, tx, salonID, date, lines, excludeApptID); err != nil {
+		return err
 	}
 
-	return &appt, &payment, nil
+	serviceLen := time.Duration(serviceMinutes(lines)) * time.Minute
+	blockLen := time.Duration(blockMinutes(lines)) * time.Minute
+	switch day.Check(start, serviceLen, blockLen) {
+	case ReasonClosed:
+		return ErrSalonClosed
+	case ReasonOutOfShift:
+		return ErrStaffUnavailable
+	case ReasonTimeOff:
+		return ErrStaffTimeOff
+	case ReasonBreak:
+		return ErrStaffOnBreak
+	case ReasonBooked:
+		return ErrSlotBooked
+	case ReasonResource:
+		return ErrResourceUnavailable
+	}
+	return nil
 }
 
-// GetAvailableSlots returns time slots within SALON hours, marked with staff shift availability
-func (s *BookingService) GetAvailableSlots(ctx context.Context, staffID, serviceID, dateStr string) ([]models.TimeSlot, error) {
-	// 1. Get service duration and salon ID
-	var durationMinutes int
-	var salonID string
-	err := s.DB.QueryRow(ctx,
-		"SELECT duration_minutes, salon_id FROM services WHERE id = $1", serviceID).Scan(&durationMinutes, &salonID)
+// RescheduleAppointment moves an appointment to a new date/start and confirms it
+func (s *BookingService) RescheduleAppointment(ctx context.Context, apptID, dateStr, startStr string) error {
+	date, err := time.Parse("2006-01-02", dateStr)
+	if err != nil {
+		return fmt.Errorf("invalid date format, use YYYY-MM-DD")
+	}
+	newStart, err := time.Parse("15:04", startStr)
 	if err != nil {
-		return nil, fmt.Errorf("service not found")
+		return fmt.Errorf("invalid start time format, use HH:MM")
 	}
 
-	// 2. Get SALON working hours (the overall grid boundaries)
-	var salonStartStr, salonEndStr string
+	var salonID, staffID, oldStart, timezone string
 	err = s.DB.QueryRow(ctx,
-		"SELECT opening_time::text, closing_time::text FROM salons WHERE id = $1", salonID).Scan(&salonStartStr, &salonEndStr)
+		`SELECT a.salon_id, a.staff_id, a.start_time::text, s.timezone
+		 FROM appointments a JOIN salons s ON s.id = a.salon_id WHERE a.id = $1`,
+		apptID).Scan(&salonID, &staffID, &oldStart, &timezone)
 	if err != nil {
-		return nil, fmt.Errorf("salon not found")
-	}
-
-	// 2b. Check for salon closures on this date
-	var closureStartTime, closureEndTime *string
-	var isFullDayClosure bool
-	closureRow := s.DB.QueryRow(ctx,
-		`SELECT start_time::text, end_time::text
-		 FROM salon_closures
-		 WHERE salon_id = $1 AND $2::date >= start_date AND $2::date <= end_date
-		 ORDER BY created_at DESC LIMIT 1`, salonID, dateStr)
-	var cst, cet *string
-	var cstVal, cetVal string
-	if err := closureRow.Scan(&cstVal, &cetVal); err == nil {
-		// Found a closure
-		if cstVal == "" && cetVal == "" {
-			isFullDayClosure = true
-		} else {
-			cst = &cstVal
-			cet = &cetVal
-			closureStartTime = cst
-			closureEndTime = cet
-		}
-	} else {
-		// Check for full-day closure with NULL times
-		_ = s.DB.QueryRow(ctx,
-			`SELECT 1 FROM salon_closures
-			 WHERE salon_id = $1 AND $2::date >= start_date AND $2::date <= end_date
-			 AND start_time IS NULL AND end_time IS NULL
-			 LIMIT 1`, salonID, dateStr).Scan(new(int))
-		// if scan succeeds, it's a full day closure; otherwise, no closure
-		err2 := s.DB.QueryRow(ctx,
-			`SELECT 1 FROM salon_closures
-			 WHERE salon_id = $1 AND $2::date >= start_date AND $2::date <= end_date
-			 AND start_time IS NULL
-			 LIMIT 1`, salonID, dateStr).Scan(new(int))
-		if err2 == nil {
-			isFullDayClosure = true
-		}
+		return fmt.Errorf("appointment not found")
 	}
-
-	// If full-day closure, return a single "closed" marker
-	if isFullDayClosure {
-		return []models.TimeSlot{{
-			StartTime:          salonStartStr,
-			EndTime:            salonEndStr,
-			Available:          false,
-			AvailabilityReason: "closed",
-		}}, nil
+	if at, _ := AppointmentTime(dateStr, startStr, SalonLocation(timezone)); at.Before(time.Now()) {
+		return ErrInPast
 	}
 
-	// 3. Get STAFF working hours for this specific day
-	date, err := time.Parse("2006-01-02", dateStr)
+	return s.moveAppointment(ctx, apptID, salonID, staffID, oldStart, date, newStart, true)
+}
+
+// moveAppointment re-checks the new slot with the appointment's own line items (their
+// times, buffers and resources) and shifts the appointment and its line items.
+// confirm also sets the status to confirmed, as a customer reschedule does.
+func (s *BookingService) moveAppointment(ctx context.Context, apptID, salonID, staffID, oldStart string, date, newStart time.Time, confirm bool) error {
+	lines, _, err := appointmentLines(ctx, s.DB, apptID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid date")
+		return err
 	}
-	dayOfWeek := int(date.Weekday())
+	serviceLen := time.Duration(serviceMinutes(lines)) * time.Minute
+	dateStr := date.Format("2006-01-02")
+	startStr := newStart.Format("15:04")
+	endStr := newStart.Add(serviceLen).Format("15:04")
 
-	var staffOff bool
-	var staffStartStr, staffEndStr string
-	err = s.DB.QueryRow(ctx,
-		`SELECT is_off, start_time::text, end_time::text 
-		 FROM staff_working_hours WHERE staff_id = $1 AND day_of_week = $2`,
-		staffID, dayOfWeek).Scan(&staffOff, &staffStartStr, &staffEndStr)
-
-	// 4. Get existing appointments to check for "booked" slots
-	rows, err := s.DB.Query(ctx,
-		`SELECT start_time::text, end_time::text FROM appointments 
-		 WHERE staff_id = $1 AND appointment_date = $2 
-		 AND status NOT IN ('cancelled', 'no_show')
-		 ORDER BY start_time`, staffID, dateStr)
+	tx, err := s.DB.Begin(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	defer tx.Rollback(ctx)
 
-	type bookedSlot struct {
-		start, end time.Time
-	}
-	var booked []bookedSlot
-	for rows.Next() {
-		var startStr, endStr string
-		rows.Scan(&startStr, &endStr)
-		st, _ := time.Parse("15:04:05", startStr)
-		en, _ := time.Parse("15:04:05", endStr)
-		booked = append(booked, bookedSlot{st, en})
+	if err := ensureSlotFree(ctx, tx, salonID, staffID, lines, date, newStart, apptID); err != nil {
+		return err
 	}
 
-	// 5. Setup parsing and generation
-	parseTime := func(t string) (time.Time, error) {
-		if len(t) == 5 {
-			return time.Parse("15:04", t)
-		}
-		return time.Parse("15:04:05", t)
+	_, err = tx.Exec(ctx,
+		`UPDATE appointments SET appointment_date = $1, start_time = $2, end_time = $3,
+		 status = CASE WHEN $5 AND status <> 'awaiting_deposit' THEN 'confirmed' ELSE status END, updated_at = NOW()
+		 WHERE id = $4`,
+		dateStr, startStr, endStr, apptID, confirm)
+	if err != nil {
+		return fmt.Errorf("failed to move appointment: %w", err)
 	}
-
-	salonStart, _ := parseTime(salonStartStr)
-	salonEnd, _ := parseTime(salonEndStr)
-	staffStart, _ := parseTime(staffStartStr)
-	staffEnd, _ := parseTime(staffEndStr)
-
-	// Parse partial closure times if present
-	var closureStart, closureEnd time.Time
-	hasPartialClosure := false
-	if closureStartTime != nil && closureEndTime != nil {
-		closureStart, _ = parseTime(*closureStartTime)
-		closureEnd, _ = parseTime(*closureEndTime)
-		hasPartialClosure = true
+	_, err = tx.Exec(ctx,
+		`UPDATE appointment_services
+		 SET start_time = start_time + ($1::time - $2::time), end_time = end_time + ($1::time - $2::time)
+		 WHERE appointment_id = $3`,
+		startStr, oldStart, apptID)
+	if err != nil {
+		return fmt.Errorf("failed to move line items: %w", err)
+	}
+	if err := EnqueueReminders(ctx, tx, apptID); err != nil {
+		return err
 	}
 
-	var slots []models.TimeSlot
-	slotDuration := time.Duration(durationMinutes) * time.Minute
-
-	// Today's filtering logic
-	now := time.Now()
-	isToday := date.Year() == now.Year() && date.Month() == now.Month() && date.Day() == now.Day()
-	currentTimeStr := now.Format("15:04")
-	currentTime, _ := time.Parse("15:04", currentTimeStr)
-
-	// 6. Generate slots based on SALON hours
-	for t := salonStart; t.Add(slotDuration).Before(salonEnd) || t.Add(slotDuration).Equal(salonEnd); t = t.Add(30 * time.Minute) {
-		slotEnd := t.Add(slotDuration)
-
-		// Filter past slots if today
-		if isToday && t.Before(currentTime) {
-			continue
-		}
+	return tx.Commit(ctx)
+}
 
-		available := true
-		reason := "available"
-
-		// 0. Check partial closure
-		if hasPartialClosure && t.Before(closureEnd) && slotEnd.After(closureStart) {
-			available = false
-			reason = "closed"
-		} else if !staffOff && (t.After(staffStart) || t.Equal(staffStart)) && (slotEnd.Before(staffEnd) || slotEnd.Equal(staffEnd)) {
-			// A. Within staff shift — check for booked
-			for _, b := range booked {
-				if t.Before(b.end) && slotEnd.After(b.start) {
-					available = false
-					reason = "booked"
-					break
-				}
-			}
-		} else {
-			available = false
-			reason = "out_of_shift"
-		}
+// GetAvailableSlots returns time slots within SALON hours, marked with staff shift availability.
+// Multiple services are checked as one back-to-back block, buffers included.
+func (s *BookingService) GetAvailableSlots(ctx context.Context, staffID string, serviceIDs []string, dateStr string) ([]models.TimeSlot, error) {
+	lines, salonID, err := s.loadServiceLines(ctx, serviceIDs)
+	if err != nil {
+		return nil, err
+	}
+	date, err := time.Parse("2006-01-02", dateStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date")
+	}
 
-		slots = append(slots, models.TimeSlot{
-			StartTime:          t.Format("15:04"),
-			EndTime:            slotEnd.Format("15:04"),
-			Available:          available,
-			AvailabilityReason: reason,
-		})
+	day, err := loadDay(ctx, s.DB, salonID, staffID, date, "")
+	if err != nil {
+		return nil, err
+	}
+	if day.Resources, err = loadResources(ctx, s.DB, salonID, date, lines, ""); err != nil {
+		return nil, err
 	}
 
-	if slots == nil {
-		slots = []models.TimeSlot{}
+	// If full-day closure, return a single "closed" marker
+	if day.Closed {
+		return []models.TimeSlot{{
+			StartTime:          day.SalonOpen.Format("15:04"),
+			EndTime:            day.SalonClose.Format("15:04"),
+			Available:          false,
+			AvailabilityReason: ReasonClosed,
+		}}, nil
 	}
-	return slots, nil
+
+	// Hide slots that already started in the salon's timezone
+	day.HidePast(date, time.Now())
+
+	serviceLen := time.Duration(serviceMinutes(lines)) * time.Minute
+	blockLen := time.Duration(blockMinutes(lines)) * time.Minute
+	return day.Slots(serviceLen, blockLen), nil
 }
@@ -0,0 +1,252 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"saloon-backend/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Fee types of a cancellation policy
+const (
+	FeeNone    = "none"
+	FeeFlat    = "flat"
+	FeePercent = "percent"
+)
+
+// Kinds of fees charged against a payment
+const (
+	FeeLateCancel = "late_cancel"
+	FeeNoShow     = "no_show"
+)
+
+// feeLabels describe fee kinds on refunds and receipts
+var feeLabels = map[string]string{
+	FeeLateCancel: "Late cancellation fee",
+	FeeNoShow:     "No-show fee",
+}
+
+// policyFee is a fee of feeType and value on an appointment costing total, never more
+// than the total itself
+func policyFee(feeType string, value, total float64) float64 {
+	var fee float64
+	switch feeType {
+	case FeeFlat:
+		fee = value
+	case FeePercent:
+		fee = total * value / 100
+	}
+	return roundCents(math.Min(fee, total))
+}
+
+// quoteCancellation works out whether cancelling at now is late and what it costs
+func quoteCancellation(policy models.CancellationPolicy, start, now time.Time, total float64) models.CancellationQuote {
+	q := models.CancellationQuote{
+		Policy:          policy,
+		FreeCancelUntil: start.Add(-time.Duration(policy.FreeCancelHours) * time.Hour),
+		AppointmentCost: total,
+	}
+	q.IsLate = policy.FreeCancelHours > 0 && now.After(q.FreeCancelUntil)
+	if q.IsLate {
+		q.Fee = policyFee(policy.LateCancelFeeType, policy.LateCancelFee, total)
+	}
+	return q
+}
+
+// DefaultCancellationPolicy is the policy of a salon that never set one: no fees, and a
+// promo code use is given back when a booking is cancelled in time or refunded
+func DefaultCancellationPolicy() models.CancellationPolicy {
+	return models.CancellationPolicy{
+		LateCancelFeeType:    FeeNone,
+		NoShowFeeType:        FeeNone,
+		ReleasePromoOnCancel: true,
+		ReleasePromoOnRefund: true,
+	}
+}
+
+// LoadCancellationPolicy reads a salon's policy, or the default one
+func LoadCancellationPolicy(ctx context.Context, q querier, salonID string) (models.CancellationPolicy, error) {
+	p := DefaultCancellationPolicy()
+	err := q.QueryRow(ctx,
+		`SELECT free_cancel_hours, late_cancel_fee_type, late_cancel_fee, no_show_fee_type, no_show_fee,
+		 release_promo_on_cancel, release_promo_on_late_cancel, release_promo_on_no_show, release_promo_on_refund,
+		 restore_credit_on_late_cancel, restore_credit_on_no_show
+		 FROM cancellation_policies WHERE salon_id = $1`, salonID,
+	).Scan(&p.FreeCancelHours, &p.LateCancelFeeType, &p.LateCancelFee, &p.NoShowFeeType, &p.NoShowFee,
+		&p.ReleasePromoOnCancel, &p.ReleasePromoOnLateCancel, &p.ReleasePromoOnNoShow, &p.ReleasePromoOnRefund,
+		&p.RestoreCreditOnLateCancel, &p.RestoreCreditOnNoShow)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return p, fmt.Errorf("failed to fetch cancellation policy: %w", err)
+	}
+	return p, nil
+}
+
+// appointmentCharge is what the fees of an appointment are based on
+type appointmentCharge struct {
+	salonID string
+	status  string
+	start   time.Time // in the salon's timezone
+	total   float64   // the appointment's payment total, before any fee
+	// Without a payment (paid for by a prepaid plan) there is nothing to charge a fee to
+	hasPayment bool
+}
+
+func loadAppointmentCharge(ctx context.Context, q querier, apptID string) (*appointmentCharge, error) {
+	var c appointmentCharge
+	var date, start, timezone string
+	err := q.QueryRow(ctx,
+		`SELECT a.salon_id, a.status, a.appointment_date::text, a.start_time::text, s.timezone,
+		 COALESCE((SELECT total FROM payments WHERE appointment_id = a.id ORDER BY created_at DESC LIMIT 1), 0),
+		 EXISTS(SELECT 1 FROM payments WHERE appointment_id = a.id)
+		 FROM appointments a JOIN salons s ON s.id = a.salon_id
+		 WHERE a.id = $1`, apptID).Scan(&c.salonID, &c.status, &date, &start, &timezone, &c.total, &c.hasPayment)
+	if err != nil {
+		return nil, fmt.Errorf("appointment not found")
+	}
+	c.start, err = AppointmentTime(date, start, SalonLocation(timezone))
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// QuoteCancellation tells what cancelling an appointment now would cost the customer: a
+// fee, and the prepaid plan credits it uses when the policy keeps them on late cancellation
+func (s *BookingService) QuoteCancellation(ctx context.Context, apptID string) (*models.CancellationQuote, error) {
+	c, err := loadAppointmentCharge(ctx, s.DB, apptID)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := LoadCancellationPolicy(ctx, s.DB, c.salonID)
+	if err != nil {
+		return nil, err
+	}
+	q := quoteCancellation(policy, c.start, time.Now(), c.total)
+	q.AppointmentID = apptID
+	if c.status == "awaiting_deposit" {
+		// Not confirmed yet, so nothing to charge for
+		q.IsLate, q.Fee = false, 0
+	}
+	if !c.hasPayment {
+		q.Fee = 0
+	}
+	if q.IsLate && !restoresCredit(policy, PromoOnLateCancel) {
+		if q.CreditsForfeited, err = appointmentCredits(ctx, s.DB, apptID); err != nil {
+			return nil, err
+		}
+	}
+	return &q, nil
+}
+
+// CancellationCharge is what cancelling under quote costs and the discount settlement
+// event it counts as; without a quote (cancelled by the salon) it is free
+func CancellationCharge(quote *models.CancellationQuote) (float64, string) {
+	if quote == nil {
+		return 0, PromoOnCancel
+	}
+	if quote.IsLate {
+		return quote.Fee, PromoOnLateCancel
+	}
+	return quote.Fee, PromoOnCancel
+}
+
+// NoShowFee is the fee the salon's policy charges for missing an appointment
+func (s *BookingService) NoShowFee(ctx context.Context, apptID string) (float64, error) {
+	c, err := loadAppointmentCharge(ctx, s.DB, apptID)
+	if err != nil {
+		return 0, err
+	}
+	policy, err := LoadCancellationPolicy(ctx, s.DB, c.salonID)
+	if err != nil {
+		return 0, err
+	}
+	if !c.hasPayment {
+		return 0, nil
+	}
+	return policyFee(policy.NoShowFeeType, policy.NoShowFee, c.total), nil
+}
+
+// ChargeFee settles the payment of a cancelled or missed appointment by charging a fee
+// instead of the appointment price. The payment is re-priced to the fee and a paid deposit
+// counts towards it; an authorized card is captured for just the rest of the fee, money
+// already collected beyond it is refunded, and an uncollected payment stays pending for
+// the salon to collect. Without a fee the payment is settled like any cancellation.
+func (s *PaymentService) ChargeFee(ctx context.Context, apptID, kind string, fee float64, actorID string) error {
+	if fee <= 0 {
+		return s.CancelPayment(ctx, apptID, actorID)
+	}
+	p, err := s.loadByAppointment(ctx, apptID)
+	if err != nil {
+		return nil
+	}
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	_, err = tx.Exec(ctx,
+		`INSERT INTO payment_fees (payment_id, kind, amount, original_total) VALUES ($1, $2, $3, $4)`,
+		p.ID, kind, fee, p.Total)
+	if err != nil {
+		return fmt.Errorf("failed to record fee: %w", err)
+	}
+	// Fees are not taxed; the tax lines of the original price no longer apply. What was
+	// already collected stays on record for the refund of the excess.
+	_, err = tx.Exec(ctx,
+		`UPDATE payments SET amount = $1, discount = 0, tax = 0, total = $1, tax_inclusive = false,
+		 captured_amount = CASE WHEN status IN ('completed', 'partially_refunded', 'refunded')
+		     THEN COALESCE(captured_amount, total) ELSE captured_amount END,
+		 updated_at = NOW()
+		 WHERE id = $2`, fee, p.ID)
+	if err != nil {
+		return fmt.Errorf("failed to re-price payment: %w", err)
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM payment_taxes WHERE payment_id = $1", p.ID); err != nil {
+		return fmt.Errorf("failed to re-price payment: %w", err)
+	}
+	if p.Status == "pending" || p.Status == "authorized" {
+		// Tenders of a checkout that never went through were for the price, not the fee
+		if err := clearTenders(ctx, tx, p.ID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "UPDATE payments SET tip = 0, tip_staff_id = NULL WHERE id = $1", p.ID); err != nil {
+			return fmt.Errorf("failed to re-price payment: %w", err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	if err := s.ApplyDeposit(ctx, apptID); err != nil {
+		return err
+	}
+	if err := s.releaseDeposit(ctx, apptID, actorID); err != nil {
+		return err
+	}
+	if p, err = s.loadByAppointment(ctx, apptID); err != nil {
+		return err
+	}
+	switch p.Status {
+	case "authorized":
+		return s.Capture(ctx, apptID)
+	case "completed", "partially_refunded":
+		var kept float64
+		err := s.DB.QueryRow(ctx,
+			`SELECT `+collectedSQL+` - (SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE payment_id = $1)
+			 FROM payments WHERE id = $1`, p.ID).Scan(&kept)
+		if err != nil {
+			return err
+		}
+		if excess := roundCents(kept - fee); excess > 0 {
+			_, err = s.RefundPayment(ctx, p.ID, excess, feeLabels[kind]+" kept, rest refunded", actorID)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"saloon-backend/models"
+)
+
+func TestQuoteCancellation(t *testing.T) {
+	start := time.Date(2026, 3, 10, 14, 0, 0, 0, time.UTC)
+	policy := models.CancellationPolicy{
+		FreeCancelHours:   24,
+		LateCancelFeeType: FeePercent,
+		LateCancelFee:     50,
+		NoShowFeeType:     FeeFlat,
+		NoShowFee:         80,
+	}
+
+	tests := []struct {
+		name     string
+		policy   models.CancellationPolicy
+		now      time.Time
+		wantLate bool
+		wantFee  float64
+	}{
+		{name: "inside the free window", policy: policy, now: start.Add(-25 * time.Hour)},
+		{name: "after the free window", policy: policy, now: start.Add(-2 * time.Hour), wantLate: true, wantFee: 30},
+		{name: "flat fee", now: start.Add(-time.Hour), wantLate: true, wantFee: 15,
+			policy: models.CancellationPolicy{FreeCancelHours: 12, LateCancelFeeType: FeeFlat, LateCancelFee: 15}},
+		{name: "late without a fee", now: start.Add(-time.Hour), wantLate: true,
+			policy: models.CancellationPolicy{FreeCancelHours: 12, LateCancelFeeType: FeeNone}},
+		{name: "no window", now: start.Add(-time.Minute), policy: models.CancellationPolicy{LateCancelFeeType: FeeFlat, LateCancelFee: 15}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := quoteCancellation(tt.policy, start, tt.now, 60)
+			if q.IsLate != tt.wantLate || q.Fee != tt.wantFee {
+				t.Errorf("late, fee = %v, %v, want %v, %v", q.IsLate, q.Fee, tt.wantLate, tt.wantFee)
+			}
+		})
+	}
+
+	// A flat fee never exceeds what the appointment costs
+	if fee := policyFee(policy.NoShowFeeType, policy.NoShowFee, 60); fee != 60 {
+		t.Errorf("no-show fee = %v, want 60", fee)
+	}
+}
+
+// Cancelling a weekly series an hour before its next occurrence charges the late-cancel fee
+// for that occurrence only
+func TestSeriesCancellationCharge(t *testing.T) {
+	now := time.Date(2026, 3, 10, 13, 0, 0, 0, time.UTC)
+	policy := models.CancellationPolicy{FreeCancelHours: 24, LateCancelFeeType: FeeFlat, LateCancelFee: 20}
+	quotes := map[string]*models.CancellationQuote{}
+	for i, id := range []string{"next", "week-2", "week-3"} {
+		q := quoteCancellation(policy, now.Add(time.Hour).AddDate(0, 0, 7*i), now, 60)
+		quotes[id] = &q
+	}
+
+	tests := []struct {
+		id        string
+		wantFee   float64
+		wantEvent string
+	}{
+		{id: "next", wantFee: 20, wantEvent: PromoOnLateCancel},
+		{id: "week-2", wantEvent: PromoOnCancel},
+		{id: "week-3", wantEvent: PromoOnCancel},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			fee, event := CancellationCharge(quotes[tt.id])
+			if fee != tt.wantFee || event != tt.wantEvent {
+				t.Errorf("CancellationCharge = %v, %s, want %v, %s", fee, event, tt.wantFee, tt.wantEvent)
+			}
+		})
+	}
+
+	if fees, credits := SeriesCancellationCost(quotes); fees != 20 || credits != 0 {
+		t.Errorf("SeriesCancellationCost = %v, %d, want 20, 0", fees, credits)
+	}
+	// Cancelled by the salon: free
+	if fee, event := CancellationCharge(nil); fee != 0 || event != PromoOnCancel {
+		t.Errorf("CancellationCharge(nil) = %v, %s, want 0, %s", fee, event, PromoOnCancel)
+	}
+}
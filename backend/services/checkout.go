@@ -0,0 +1,264 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+
+	"saloon-backend/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// MethodSplit is the method of a payment collected with more than one tender
+const MethodSplit = "split"
+
+// cardTenderSQL is the card tender of a payments row's checkout, 0 without one
+const cardTenderSQL = `(SELECT COALESCE(SUM(t.amount), 0) FROM payment_tenders t
+	 WHERE t.payment_id = payments.id AND t.method = 'card')`
+
+// checkTenders checks that tenders add up to the amount due plus the tip, with at most
+// one card and each gift card once among them, and returns the card's share (0 without a
+// card)
+func checkTenders(tenders []models.PaymentTender, due, tip float64) (float64, error) {
+	if tip < 0 {
+		return 0, fmt.Errorf("tip cannot be negative")
+	}
+	var sum, card float64
+	cards := 0
+	giftCards := map[string]bool{}
+	for _, t := range tenders {
+		if t.Amount <= 0 {
+			return 0, fmt.Errorf("tender amounts must be positive")
+		}
+		switch t.Method {
+		case "card":
+			cards++
+			card = t.Amount
+		case MethodGiftCard:
+			code := NormalizeGiftCardCode(t.GiftCardCode)
+			if code == "" {
+				return 0, fmt.Errorf("gift card tenders need a gift_card_code")
+			}
+			if giftCards[code] {
+				return 0, fmt.Errorf("gift card %s is used more than once", code)
+			}
+			giftCards[code] = true
+		}
+		sum += t.Amount
+	}
+	if cards > 1 {
+		return 0, fmt.Errorf("only one card tender is allowed")
+	}
+	if math.Abs(sum-(due+tip)) >= 0.005 {
+		return 0, ErrAmountMismatch
+	}
+	return roundCents(card), nil
+}
+
+// Checkout takes payment for an appointment at the salon: the amount due on the payment,
+// after any deposit, plus an optional tip for the appointment's stylist, paid with one or
+// more tenders. A single tender of amount 0 pays exactly that. A card tender is charged
+// through the provider, re-authorizing the card when the tender is more than was held on
+// it, and the payment completes once it is captured; without one the tenders are recorded as an in-store capture. Loyalty
+// points, when given, come off the amount due first and go back to the customer if the
+// checkout fails before the payment is collected. It returns the client secret when the
+// card still has to be confirmed by the customer.
+func (s *PaymentService) Checkout(ctx context.Context, apptID string, tenders []models.PaymentTender, tip float64, points int) (string, error) {
+	if err := s.ApplyDeposit(ctx, apptID); err != nil {
+		return "", err
+	}
+	if points <= 0 {
+		return s.checkout(ctx, apptID, tenders, tip)
+	}
+
+	discount, err := s.RedeemPoints(ctx, apptID, points)
+	if err != nil {
+		return "", err
+	}
+	secret, err := s.checkout(ctx, apptID, tenders, tip)
+	if err != nil {
+		if returnErr := s.returnPoints(ctx, apptID, points, discount); returnErr != nil {
+			log.Printf("⚠️  Points of failed checkout for appointment %s: %v", apptID, returnErr)
+		}
+		return "", err
+	}
+	return secret, nil
+}
+
+// checkout collects the amount due on an appointment's payment with the tenders
+func (s *PaymentService) checkout(ctx context.Context, apptID string, tenders []models.PaymentTender, tip float64) (string, error) {
+	p, err := s.loadByAppointment(ctx, apptID)
+	if err != nil {
+		return "", err
+	}
+	tip = roundCents(tip)
+	if p.Status == "completed" && p.balance() <= 0 && p.Deposit > 0 && tip == 0 {
+		// Settled by the deposit
+		return "", nil
+	}
+	if p.Status != "pending" && p.Status != "authorized" {
+		return "", fmt.Errorf("payment is already %s", p.Status)
+	}
+
+	if len(tenders) == 1 && tenders[0].Amount == 0 {
+		tenders[0].Amount = roundCents(p.balance() + tip)
+		if tenders[0].Amount <= 0 {
+			tenders = nil
+		}
+	}
+	card, err := checkTenders(tenders, p.balance(), tip)
+	if err != nil {
+		return "", err
+	}
+	if card > 0 && p.Status == "pending" && p.IntentID != "" {
+		return "", fmt.Errorf("card payment is waiting for the customer to confirm it")
+	}
+
+	method := p.Method
+	switch {
+	case len(tenders) == 1:
+		method = tenders[0].Method
+	case len(tenders) > 1:
+		method = MethodSplit
+	}
+	if err := s.recordTenders(ctx, p.ID, method, tenders, tip); err != nil {
+		return "", err
+	}
+
+	if card > 0 {
+		secret, err := s.chargeCardTender(ctx, apptID, p, card)
+		if err != nil {
+			// Nothing was collected, so the checkout can be tried again from scratch
+			if clearErr := s.recordTenders(ctx, p.ID, p.Method, nil, 0); clearErr != nil {
+				return "", clearErr
+			}
+			return "", err
+		}
+		return secret, nil
+	}
+
+	// Paid over the counter. The tenders are recorded first so a later cancel knows the
+	// money was taken at the salon, then any card hold is released so the customer isn't
+	// charged twice; its void event arrives after the capture and no longer applies.
+	if err := s.ApplyEvent(ctx, ProviderInStore, inStoreEvent(EventCaptured, p.ID, p.balance())); err != nil {
+		return "", err
+	}
+	if p.IntentID != "" {
+		event, err := s.Provider.Void(ctx, p.IntentID)
+		if err != nil {
+			return "", fmt.Errorf("failed to release card authorization: %w", err)
+		}
+		return "", s.ApplyEvent(ctx, p.Provider, event)
+	}
+	return "", nil
+}
+
+// exceedsHold reports whether the card tender of a checkout is more than is held on the
+// card, as when a tip goes on the card, so the hold has to be replaced before capture
+func exceedsHold(p *paymentRow, card float64) bool {
+	return p.Status == "authorized" && card > p.Authorized+0.005
+}
+
+// chargeCardTender captures the card tender of a checkout, opening an intent for it first
+// when the card was not held at booking, or held for less than the tender
+func (s *PaymentService) chargeCardTender(ctx context.Context, apptID string, p *paymentRow, card float64) (string, error) {
+	if exceedsHold(p, card) {
+		if err := s.releaseHold(ctx, p); err != nil {
+			return "", err
+		}
+	} else if p.Status == "authorized" {
+		return "", s.Capture(ctx, apptID)
+	}
+	secret, err := s.authorize(ctx, p.ID, card, "")
+	if err != nil {
+		return "", err
+	}
+	// Providers that authorize on the spot (the fake one) can be captured right away
+	return secret, s.Capture(ctx, apptID)
+}
+
+// releaseHold voids the card hold of an authorized payment and puts the payment back to
+// pending without an intent, so a new one can be opened for a larger amount. The void is
+// recorded as an event of the payment, so its webhook is a no-op.
+func (s *PaymentService) releaseHold(ctx context.Context, p *paymentRow) error {
+	event, err := s.Provider.Void(ctx, p.IntentID)
+	if err != nil {
+		return fmt.Errorf("failed to release card authorization: %w", err)
+	}
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO payment_events (payment_id, provider, event_id, type, intent_id, amount)
+		 VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)
+		 ON CONFLICT (provider, event_id) DO NOTHING`,
+		p.ID, p.Provider, event.ID, event.Type, p.IntentID, event.Amount)
+	if err != nil {
+		return fmt.Errorf("failed to record payment event: %w", err)
+	}
+	_, err = tx.Exec(ctx,
+		`UPDATE payments SET status = 'pending', provider_intent_id = NULL, authorized_amount = NULL,
+		 updated_at = NOW()
+		 WHERE id = $1 AND status = 'authorized'`, p.ID)
+	if err != nil {
+		return fmt.Errorf("failed to release card authorization: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// recordTenders replaces the tenders and tip of a payment's checkout, paying gift card
+// tenders from their cards. The tip goes to the appointment's stylist.
+func (s *PaymentService) recordTenders(ctx context.Context, paymentID, method string, tenders []models.PaymentTender, tip float64) error {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := clearTenders(ctx, tx, paymentID); err != nil {
+		return err
+	}
+	for _, t := range tenders {
+		var giftCardID *string
+		if t.Method == MethodGiftCard {
+			id, err := redeemGiftCard(ctx, tx, paymentID, t.GiftCardCode, t.Amount)
+			if err != nil {
+				return err
+			}
+			giftCardID = &id
+		}
+		_, err := tx.Exec(ctx,
+			"INSERT INTO payment_tenders (payment_id, method, amount, gift_card_id) VALUES ($1, $2, $3, $4)",
+			paymentID, t.Method, roundCents(t.Amount), giftCardID)
+		if err != nil {
+			return fmt.Errorf("failed to record tenders: %w", err)
+		}
+	}
+	_, err = tx.Exec(ctx,
+		`UPDATE payments SET method = $1, tip = $2,
+		 tip_staff_id = CASE WHEN $2 > 0 THEN (SELECT staff_id FROM appointments WHERE id = payments.appointment_id) END,
+		 updated_at = NOW()
+		 WHERE id = $3`, method, tip, paymentID)
+	if err != nil {
+		return fmt.Errorf("failed to update payment: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// clearTenders drops the tenders of a payment that wasn't collected, putting back what
+// they took from gift cards
+func clearTenders(ctx context.Context, tx pgx.Tx, paymentID string) error {
+	if err := reverseGiftCards(ctx, tx, paymentID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM payment_tenders WHERE payment_id = $1", paymentID); err != nil {
+		return fmt.Errorf("failed to clear tenders: %w", err)
+	}
+	return nil
+}
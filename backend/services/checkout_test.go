@@ -0,0 +1,92 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"saloon-backend/models"
+)
+
+func TestCheckTenders(t *testing.T) {
+	tests := []struct {
+		name     string
+		tenders  []models.PaymentTender
+		due, tip float64
+		card     float64
+		err      error
+		fails    bool
+	}{
+		{name: "single cash", tenders: []models.PaymentTender{{Method: "cash", Amount: 50}}, due: 50},
+		{name: "cash and card with tip", due: 80, tip: 12, card: 62, tenders: []models.PaymentTender{
+			{Method: "cash", Amount: 30}, {Method: "card", Amount: 62},
+		}},
+		{name: "cents add up", due: 0.3, tenders: []models.PaymentTender{
+			{Method: "cash", Amount: 0.1}, {Method: "upi", Amount: 0.2},
+		}},
+		{name: "nothing due", due: 0},
+		{name: "short", due: 80, tip: 10, err: ErrAmountMismatch, tenders: []models.PaymentTender{
+			{Method: "cash", Amount: 80},
+		}},
+		{name: "two cards", due: 40, fails: true, tenders: []models.PaymentTender{
+			{Method: "card", Amount: 20}, {Method: "card", Amount: 20},
+		}},
+		{name: "zero tender", due: 40, fails: true, tenders: []models.PaymentTender{
+			{Method: "cash", Amount: 40}, {Method: "upi", Amount: 0},
+		}},
+		{name: "negative tip", due: 40, tip: -5, fails: true, tenders: []models.PaymentTender{
+			{Method: "cash", Amount: 35},
+		}},
+		{name: "gift cards and card", due: 90, card: 20, tenders: []models.PaymentTender{
+			{Method: "gift_card", Amount: 50, GiftCardCode: "ABCD-EFGH-JKLM-NPQR"},
+			{Method: "gift_card", Amount: 20, GiftCardCode: "STUV-WXYZ-2345-6789"},
+			{Method: "card", Amount: 20},
+		}},
+		{name: "gift card without code", due: 40, fails: true, tenders: []models.PaymentTender{
+			{Method: "gift_card", Amount: 40},
+		}},
+		{name: "same gift card twice", due: 40, fails: true, tenders: []models.PaymentTender{
+			{Method: "gift_card", Amount: 20, GiftCardCode: "ABCD-EFGH-JKLM-NPQR"},
+			{Method: "gift_card", Amount: 20, GiftCardCode: "abcd efgh jklm npqr"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			card, err := checkTenders(tt.tenders, tt.due, tt.tip)
+			switch {
+			case tt.err != nil:
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("err = %v, want %v", err, tt.err)
+				}
+			case tt.fails:
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case card != tt.card:
+				t.Errorf("card = %v, want %v", card, tt.card)
+			}
+		})
+	}
+}
+
+func TestExceedsHold(t *testing.T) {
+	tests := []struct {
+		name string
+		p    paymentRow
+		card float64
+		want bool
+	}{
+		{name: "within the hold", p: paymentRow{Status: "authorized", Authorized: 80}, card: 60},
+		{name: "the whole hold", p: paymentRow{Status: "authorized", Authorized: 80}, card: 80},
+		{name: "tip on the card", p: paymentRow{Status: "authorized", Authorized: 80}, card: 92, want: true},
+		{name: "nothing held yet", p: paymentRow{Status: "pending"}, card: 92},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exceedsHold(&tt.p, tt.card); got != tt.want {
+				t.Errorf("exceedsHold(%v) = %v, want %v", tt.card, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,406 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"saloon-backend/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Deposit statuses
+const (
+	DepositPending  = "pending"
+	DepositPaid     = "paid"
+	DepositApplied  = "applied"
+	DepositRefunded = "refunded"
+	DepositVoided   = "voided"
+	DepositFailed   = "failed"
+)
+
+// DepositPollInterval is how often the expiry worker looks for holds that ran out
+const DepositPollInterval = time.Minute
+
+// depositBatch caps how many holds one poll releases
+const depositBatch = 100
+
+var (
+	// ErrDepositExpired is returned when paying a deposit after the booking's hold ran out
+	ErrDepositExpired = errors.New("the booking hold has expired")
+	// ErrSeriesDeposit is returned for a recurring series of services that require a deposit,
+	// since each occurrence would need its own deposit paid within the hold
+	ErrSeriesDeposit = errors.New("services that require a deposit can't be booked as a recurring series")
+)
+
+// depositFor is the deposit a booking of these services requires: each service's flat
+// amount or percent of its price, never more than that price
+func depositFor(lines []serviceLine) float64 {
+	total := 0.0
+	for _, l := range lines {
+		total += policyFee(l.DepositType, l.DepositValue, l.Price)
+	}
+	return roundCents(total)
+}
+
+// depositRow is what the service needs to know about a deposit to drive the provider
+type depositRow struct {
+	ID            string
+	AppointmentID string
+	PaymentID     string
+	Amount        float64
+	Status        string
+	Provider      string
+	IntentID      string
+	ExpiresAt     time.Time
+}
+
+const depositColumns = `id, appointment_id, payment_id, amount, status,
+	COALESCE(provider, ''), COALESCE(provider_intent_id, ''), expires_at`
+
+func scanDeposit(row pgx.Row, d *depositRow) error {
+	return row.Scan(&d.ID, &d.AppointmentID, &d.PaymentID, &d.Amount, &d.Status,
+		&d.Provider, &d.IntentID, &d.ExpiresAt)
+}
+
+// loadDeposit returns the deposit of an appointment, or nil when it needs none
+func loadDeposit(ctx context.Context, q querier, apptID string) (*depositRow, error) {
+	var d depositRow
+	err := scanDeposit(q.QueryRow(ctx, `SELECT `+depositColumns+` FROM deposits WHERE appointment_id = $1`, apptID), &d)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch deposit: %w", err)
+	}
+	return &d, nil
+}
+
+// lockDepositByIntent locks the deposit a provider intent was opened for, if any
+func lockDepositByIntent(ctx context.Context, tx pgx.Tx, provider, intentID string) (*depositRow, error) {
+	if intentID == "" {
+		return nil, nil
+	}
+	var d depositRow
+	err := scanDeposit(tx.QueryRow(ctx,
+		`SELECT `+depositColumns+` FROM deposits
+		 WHERE provider = $1 AND provider_intent_id = $2 FOR UPDATE`, provider, intentID), &d)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find deposit: %w", err)
+	}
+	return &d, nil
+}
+
+// insertDeposit records the deposit a new booking waits for
+func insertDeposit(ctx context.Context, tx pgx.Tx, apptID, paymentID string, amount float64, expiresAt time.Time) (*models.Deposit, error) {
+	d := models.Deposit{AppointmentID: apptID, Amount: amount, Status: DepositPending, ExpiresAt: expiresAt}
+	err := tx.QueryRow(ctx,
+		`INSERT INTO deposits (appointment_id, payment_id, amount, expires_at)
+		 VALUES ($1, $2, $3, $4) RETURNING id`, apptID, paymentID, amount, expiresAt).Scan(&d.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create deposit: %w", err)
+	}
+	return &d, nil
+}
+
+// Deposit returns the deposit of an appointment, or nil when it needs none
+func (s *PaymentService) Deposit(ctx context.Context, apptID string) (*models.Deposit, error) {
+	var d models.Deposit
+	err := s.DB.QueryRow(ctx,
+		`SELECT id, appointment_id, amount, status, expires_at, paid_at FROM deposits
+		 WHERE appointment_id = $1`, apptID,
+	).Scan(&d.ID, &d.AppointmentID, &d.Amount, &d.Status, &d.ExpiresAt, &d.PaidAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch deposit: %w", err)
+	}
+	return &d, nil
+}
+
+// PayDeposit opens a provider intent for an appointment's deposit, captured as soon as the
+// customer confirms it. It can be retried after a declined card while the hold lasts.
+func (s *PaymentService) PayDeposit(ctx context.Context, apptID string) (*models.Deposit, error) {
+	d, err := loadDeposit(ctx, s.DB, apptID)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return nil, fmt.Errorf("this booking needs no deposit")
+	}
+	if d.Status != DepositPending && d.Status != DepositFailed {
+		return nil, fmt.Errorf("deposit is already %s", d.Status)
+	}
+	if d.Status == DepositPending && d.IntentID != "" {
+		return nil, fmt.Errorf("deposit payment is waiting for the customer to confirm it")
+	}
+	if !time.Now().Before(d.ExpiresAt) {
+		return nil, ErrDepositExpired
+	}
+
+	intent, err := s.Provider.Authorize(ctx, AuthorizeRequest{
+		PaymentID:   d.PaymentID,
+		Amount:      d.Amount,
+		Currency:    s.Currency,
+		Description: "Booking deposit",
+		DepositID:   d.ID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open deposit payment: %w", err)
+	}
+	_, err = s.DB.Exec(ctx,
+		`UPDATE deposits SET status = 'pending', provider = $1, provider_intent_id = $2, updated_at = NOW()
+		 WHERE id = $3`, s.Provider.Name(), intent.ID, d.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record deposit intent: %w", err)
+	}
+	if err := s.ApplyEvent(ctx, s.Provider.Name(), intent.Event); err != nil {
+		return nil, err
+	}
+
+	deposit, err := s.Deposit(ctx, apptID)
+	if err != nil {
+		return nil, err
+	}
+	deposit.ClientSecret = intent.ClientSecret
+	return deposit, nil
+}
+
+// applyDepositEvent moves a deposit on. A paid deposit confirms its booking while the hold
+// lasts; it reports released when the booking is gone by the time the money arrived, so
+// the caller gives the deposit back. The caller holds the deposit row lock.
+func applyDepositEvent(ctx context.Context, tx pgx.Tx, d *depositRow, event *PaymentEvent) (bool, error) {
+	var next string
+	switch event.Type {
+	case EventCaptured:
+		if d.Status == DepositPending || d.Status == DepositFailed {
+			next = DepositPaid
+		}
+	case EventFailed:
+		if d.Status == DepositPending {
+			next = DepositFailed
+		}
+	case EventVoided:
+		if d.Status == DepositPending || d.Status == DepositFailed {
+			next = DepositVoided
+		}
+	case EventRefunded:
+		if d.Status == DepositPaid {
+			next = DepositRefunded
+		}
+	}
+	if next == "" {
+		return false, nil
+	}
+	_, err := tx.Exec(ctx,
+		`UPDATE deposits SET status = $1, paid_at = CASE WHEN $1 = 'paid' THEN NOW() ELSE paid_at END,
+		 updated_at = NOW() WHERE id = $2`, next, d.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to update deposit: %w", err)
+	}
+	if next != DepositPaid {
+		return false, nil
+	}
+
+	var apptStatus string
+	var holding bool
+	err = tx.QueryRow(ctx,
+		`SELECT status, COALESCE(deposit_expires_at > NOW(), false) FROM appointments WHERE id = $1 FOR UPDATE`,
+		d.AppointmentID).Scan(&apptStatus, &holding)
+	if err != nil {
+		return false, fmt.Errorf("failed to find appointment: %w", err)
+	}
+	switch {
+	case apptStatus == "awaiting_deposit" && holding:
+		_, err = tx.Exec(ctx,
+			`UPDATE appointments SET status = 'pending', deposit_expires_at = NULL, updated_at = NOW()
+			 WHERE id = $1`, d.AppointmentID)
+		if err != nil {
+			return false, fmt.Errorf("failed to confirm appointment: %w", err)
+		}
+		return false, nil
+	case apptStatus == "awaiting_deposit":
+		// The slot may already be someone else's
+		_, err = tx.Exec(ctx,
+			"UPDATE appointments SET status = 'cancelled', updated_at = NOW() WHERE id = $1", d.AppointmentID)
+		if err != nil {
+			return false, fmt.Errorf("failed to release appointment: %w", err)
+		}
+		if err := settleDiscounts(ctx, tx, d.AppointmentID, PromoOnCancel); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	return apptStatus == "cancelled", nil
+}
+
+// ApplyDeposit counts an appointment's paid deposit towards its payment, leaving only the
+// balance to collect. When the deposit covers everything the payment is settled on the
+// spot and any card hold is released.
+func (s *PaymentService) ApplyDeposit(ctx context.Context, apptID string) error {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var paymentID string
+	var amount float64
+	err = tx.QueryRow(ctx,
+		`UPDATE deposits SET status = 'applied', updated_at = NOW()
+		 WHERE appointment_id = $1 AND status = 'paid'
+		 RETURNING payment_id, amount`, apptID).Scan(&paymentID, &amount)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to apply deposit: %w", err)
+	}
+	_, err = tx.Exec(ctx,
+		"UPDATE payments SET deposit_applied = $1, updated_at = NOW() WHERE id = $2", amount, paymentID)
+	if err != nil {
+		return fmt.Errorf("failed to apply deposit: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	p, err := s.loadByAppointment(ctx, apptID)
+	if err != nil {
+		return err
+	}
+	if p.balance() > 0 || (p.Status != "pending" && p.Status != "authorized") {
+		return nil
+	}
+	if err := s.ApplyEvent(ctx, ProviderInStore, inStoreEvent(EventCaptured, p.ID, 0)); err != nil {
+		return err
+	}
+	if p.IntentID != "" {
+		event, err := s.Provider.Void(ctx, p.IntentID)
+		if err != nil {
+			return fmt.Errorf("failed to release card authorization: %w", err)
+		}
+		return s.ApplyEvent(ctx, p.Provider, event)
+	}
+	return nil
+}
+
+// voidDeposit gives up on a deposit that was never paid
+func (s *PaymentService) voidDeposit(ctx context.Context, d *depositRow) error {
+	if d.Status == DepositPending && d.IntentID != "" {
+		event, err := s.Provider.Void(ctx, d.IntentID)
+		if err != nil {
+			return fmt.Errorf("failed to void deposit: %w", err)
+		}
+		return s.ApplyEvent(ctx, d.Provider, event)
+	}
+	_, err := s.DB.Exec(ctx,
+		`UPDATE deposits SET status = 'voided', updated_at = NOW()
+		 WHERE id = $1 AND status IN ('pending', 'failed')`, d.ID)
+	return err
+}
+
+// releaseDeposit settles the deposit of a cancelled appointment: an unpaid one is voided
+// and a paid one that was not applied to the payment yet is refunded in full
+func (s *PaymentService) releaseDeposit(ctx context.Context, apptID, actorID string) error {
+	d, err := loadDeposit(ctx, s.DB, apptID)
+	if err != nil || d == nil {
+		return err
+	}
+	switch d.Status {
+	case DepositPending, DepositFailed:
+		return s.voidDeposit(ctx, d)
+	case DepositPaid:
+		event, err := s.Provider.Refund(ctx, RefundRequest{
+			IntentID:  d.IntentID,
+			PaymentID: d.PaymentID,
+			Amount:    d.Amount,
+			Reason:    "Booking cancelled",
+			ActorID:   actorID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to refund deposit: %w", err)
+		}
+		return s.ApplyEvent(ctx, d.Provider, event)
+	}
+	return nil
+}
+
+// StartDepositExpiry releases bookings whose deposit hold ran out until ctx is cancelled.
+// Call this in a goroutine.
+func (s *PaymentService) StartDepositExpiry(ctx context.Context) {
+	ticker := time.NewTicker(DepositPollInterval)
+	defer ticker.Stop()
+	for {
+		s.ExpireDeposits(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ExpireDeposits cancels the bookings still waiting for their deposit after the hold ran
+// out, which frees their slots. A deposit that turns out to be paid meanwhile is left for
+// its event to settle.
+func (s *PaymentService) ExpireDeposits(ctx context.Context) {
+	rows, err := s.DB.Query(ctx,
+		`SELECT id FROM appointments
+		 WHERE status = 'awaiting_deposit' AND deposit_expires_at <= NOW()
+		 ORDER BY deposit_expires_at LIMIT $1`, depositBatch)
+	if err != nil {
+		log.Printf("Deposit expiry: %v", err)
+		return
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		d, err := loadDeposit(ctx, s.DB, id)
+		if err != nil {
+			log.Printf("Deposit expiry for appointment %s: %v", id, err)
+			continue
+		}
+		if d != nil {
+			if d.Status != DepositPending && d.Status != DepositFailed && d.Status != DepositVoided {
+				continue
+			}
+			if err := s.voidDeposit(ctx, d); err != nil {
+				log.Printf("Deposit expiry for appointment %s: %v", id, err)
+				continue
+			}
+		}
+
+		var customerID string
+		err = s.DB.QueryRow(ctx,
+			`UPDATE appointments SET status = 'cancelled', updated_at = NOW()
+			 WHERE id = $1 AND status = 'awaiting_deposit' AND deposit_expires_at <= NOW()
+			 RETURNING customer_id`, id).Scan(&customerID)
+		if err != nil {
+			continue
+		}
+		if err := s.CancelPayment(ctx, id, ""); err != nil {
+			log.Printf("Deposit expiry for appointment %s: %v", id, err)
+		}
+		if err := SettleDiscounts(ctx, s.DB, []string{id}, PromoOnCancel); err != nil {
+			log.Printf("Deposit expiry for appointment %s: %v", id, err)
+		}
+		s.DB.Exec(ctx,
+			`INSERT INTO notifications (user_id, type, title, message, appointment_id)
+			 VALUES ($1, 'appointment_cancelled', 'Booking Released', $2, $3)`,
+			customerID, "The deposit for your booking wasn't paid in time, so the slot has been released.", id)
+	}
+}
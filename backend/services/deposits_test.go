@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDepositFor(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []serviceLine
+		want  float64
+	}{
+		{name: "no deposit", lines: []serviceLine{{Price: 80, DepositType: FeeNone}}},
+		{name: "flat", lines: []serviceLine{{Price: 80, DepositType: FeeFlat, DepositValue: 25}}, want: 25},
+		{name: "percent", lines: []serviceLine{{Price: 250, DepositType: FeePercent, DepositValue: 30}}, want: 75},
+		{name: "flat capped at the price", lines: []serviceLine{{Price: 20, DepositType: FeeFlat, DepositValue: 25}}, want: 20},
+		{name: "summed over services", want: 95, lines: []serviceLine{
+			{Price: 250, DepositType: FeePercent, DepositValue: 30},
+			{Price: 40, DepositType: FeeNone},
+			{Price: 60, DepositType: FeeFlat, DepositValue: 20},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := depositFor(tt.lines); got != tt.want {
+				t.Errorf("depositFor = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFakeProviderDeposit(t *testing.T) {
+	ctx := context.Background()
+	f := NewFakeProvider("secret")
+
+	intent, err := f.Authorize(ctx, AuthorizeRequest{PaymentID: "pay-1", Amount: 30, DepositID: "dep-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if intent.Event == nil || intent.Event.Type != EventCaptured || intent.Event.Amount != 30 {
+		t.Fatalf("deposit event = %+v, want captured for 30", intent.Event)
+	}
+	if _, err := f.Void(ctx, intent.ID); err == nil {
+		t.Error("voided a paid deposit")
+	}
+	if _, err := f.Refund(ctx, RefundRequest{IntentID: intent.ID, Amount: 30}); err != nil {
+		t.Errorf("refunding the deposit: %v", err)
+	}
+}
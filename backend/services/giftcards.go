@@ -0,0 +1,382 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"saloon-backend/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// MethodGiftCard is the tender of a payment paid from a gift card; refunds of it go back
+// to the card through ProviderGiftCard
+const (
+	MethodGiftCard   = "gift_card"
+	ProviderGiftCard = "gift_card"
+)
+
+// Kinds of gift card transactions
+const (
+	GiftCardIssue   = "issue"
+	GiftCardRedeem  = "redeem"
+	GiftCardReverse = "reverse"
+	GiftCardRefund  = "refund"
+	GiftCardVoid    = "void"
+)
+
+var (
+	// ErrGiftCardUnusable is returned when a gift card tender can't be paid from the card
+	ErrGiftCardUnusable = errors.New("gift card cannot be used")
+	// ErrGiftCardNotFound is returned for a card that isn't the salon's
+	ErrGiftCardNotFound = errors.New("gift card not found")
+)
+
+// giftCardAlphabet leaves out 0/O and 1/I, which are easy to mistype from a printed card
+const giftCardAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// newGiftCardCode returns a random code of four groups of four characters
+func newGiftCardCode() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	for i := range b {
+		b[i] = giftCardAlphabet[int(b[i])%len(giftCardAlphabet)]
+	}
+	return formatGiftCardCode(string(b))
+}
+
+func formatGiftCardCode(s string) string {
+	var groups []string
+	for len(s) > 4 {
+		groups = append(groups, s[:4])
+		s = s[4:]
+	}
+	return strings.Join(append(groups, s), "-")
+}
+
+// NormalizeGiftCardCode turns a code as typed ("abcd efgh-...") into the stored form
+func NormalizeGiftCardCode(code string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(code) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return formatGiftCardCode(b.String())
+}
+
+// checkGiftCard tells whether amount can be paid from a card at now
+func checkGiftCard(status string, expiresAt *time.Time, balance, amount float64, now time.Time) error {
+	switch {
+	case status == "voided":
+		return fmt.Errorf("%w: it has been voided", ErrGiftCardUnusable)
+	case expiresAt != nil && !now.Before(*expiresAt):
+		return fmt.Errorf("%w: it expired on %s", ErrGiftCardUnusable, expiresAt.Format("2006-01-02"))
+	case amount > balance+0.005:
+		return fmt.Errorf("%w: its balance is only %.2f", ErrGiftCardUnusable, balance)
+	}
+	return nil
+}
+
+// giftCardColumns are the gift_cards columns scanned by scanGiftCard
+const giftCardColumns = `id, salon_id, code, initial_amount, balance,
+	CASE WHEN status = 'active' AND expires_at <= NOW() THEN 'expired' ELSE status END,
+	expires_at, COALESCE(recipient_name, ''), COALESCE(recipient_email, ''), COALESCE(note, ''), issued_by,
+	voided_at, COALESCE(void_reason, ''), created_at`
+
+func scanGiftCard(row pgx.Row, g *models.GiftCard) error {
+	return row.Scan(&g.ID, &g.SalonID, &g.Code, &g.InitialAmount, &g.Balance, &g.Status,
+		&g.ExpiresAt, &g.RecipientName, &g.RecipientEmail, &g.Note, &g.IssuedBy,
+		&g.VoidedAt, &g.VoidReason, &g.CreatedAt)
+}
+
+// giftCardEntry writes a transaction and moves the card's balance with it
+func giftCardEntry(ctx context.Context, tx pgx.Tx, cardID, kind string, amount float64, paymentID, actorID, note string) error {
+	_, err := tx.Exec(ctx,
+		`INSERT INTO gift_card_transactions (gift_card_id, kind, amount, payment_id, actor_id, note)
+		 VALUES ($1, $2, $3, NULLIF($4, '')::uuid, NULLIF($5, '')::uuid, NULLIF($6, ''))`,
+		cardID, kind, amount, paymentID, actorID, note)
+	if err != nil {
+		return fmt.Errorf("failed to record gift card transaction: %w", err)
+	}
+	_, err = tx.Exec(ctx,
+		"UPDATE gift_cards SET balance = balance + $1, updated_at = NOW() WHERE id = $2", amount, cardID)
+	if err != nil {
+		return fmt.Errorf("failed to update gift card balance: %w", err)
+	}
+	return nil
+}
+
+// redeemGiftCard pays amount of a payment from the salon's gift card with code and returns
+// the card's id
+func redeemGiftCard(ctx context.Context, tx pgx.Tx, paymentID, code string, amount float64) (string, error) {
+	var id, status string
+	var balance float64
+	var expiresAt *time.Time
+	err := tx.QueryRow(ctx,
+		`SELECT id, status, balance, expires_at FROM gift_cards
+		 WHERE code = $1 AND salon_id = (SELECT salon_id FROM payments WHERE id = $2)
+		 FOR UPDATE`, NormalizeGiftCardCode(code), paymentID).Scan(&id, &status, &balance, &expiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("%w: no card %s at this salon", ErrGiftCardUnusable, code)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch gift card: %w", err)
+	}
+	if err := checkGiftCard(status, expiresAt, balance, amount, time.Now()); err != nil {
+		return "", err
+	}
+	return id, giftCardEntry(ctx, tx, id, GiftCardRedeem, -roundCents(amount), paymentID, "", "")
+}
+
+// reverseGiftCards puts back what a payment took from gift cards and hasn't put back yet,
+// for a checkout that is redone or a payment that didn't go through
+func reverseGiftCards(ctx context.Context, tx pgx.Tx, paymentID string) error {
+	rows, err := tx.Query(ctx,
+		`SELECT gift_card_id, -SUM(amount) FROM gift_card_transactions
+		 WHERE payment_id = $1 AND kind IN ('redeem', 'reverse')
+		 GROUP BY gift_card_id HAVING SUM(amount) < 0`, paymentID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch gift card redemptions: %w", err)
+	}
+	type redemption struct {
+		cardID string
+		amount float64
+	}
+	var open []redemption
+	for rows.Next() {
+		var r redemption
+		if err := rows.Scan(&r.cardID, &r.amount); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to fetch gift card redemptions: %w", err)
+		}
+		open = append(open, r)
+	}
+	rows.Close()
+
+	for _, r := range open {
+		if _, err := tx.Exec(ctx, "SELECT 1 FROM gift_cards WHERE id = $1 FOR UPDATE", r.cardID); err != nil {
+			return fmt.Errorf("failed to lock gift card: %w", err)
+		}
+		if err := giftCardEntry(ctx, tx, r.cardID, GiftCardReverse, r.amount, paymentID, "", ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refundToGiftCards gives amount of a payment back to the gift cards it was paid from, each
+// up to what it paid less what it already got back
+func refundToGiftCards(ctx context.Context, tx pgx.Tx, paymentID string, amount float64, actorID, note string) error {
+	rows, err := tx.Query(ctx,
+		`SELECT t.gift_card_id, t.amount - COALESCE((SELECT SUM(g.amount) FROM gift_card_transactions g
+		     WHERE g.payment_id = t.payment_id AND g.gift_card_id = t.gift_card_id AND g.kind = 'refund'), 0)
+		 FROM payment_tenders t
+		 WHERE t.payment_id = $1 AND t.gift_card_id IS NOT NULL
+		 ORDER BY t.amount DESC, t.id`, paymentID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch gift card tenders: %w", err)
+	}
+	type tender struct {
+		cardID string
+		left   float64
+	}
+	var tenders []tender
+	for rows.Next() {
+		var t tender
+		if err := rows.Scan(&t.cardID, &t.left); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to fetch gift card tenders: %w", err)
+		}
+		tenders = append(tenders, t)
+	}
+	rows.Close()
+
+	left := roundCents(amount)
+	for _, t := range tenders {
+		part := roundCents(math.Min(left, t.left))
+		if part <= 0 {
+			continue
+		}
+		if _, err := tx.Exec(ctx, "SELECT 1 FROM gift_cards WHERE id = $1 FOR UPDATE", t.cardID); err != nil {
+			return fmt.Errorf("failed to lock gift card: %w", err)
+		}
+		if err := giftCardEntry(ctx, tx, t.cardID, GiftCardRefund, part, paymentID, actorID, note); err != nil {
+			return err
+		}
+		left = roundCents(left - part)
+	}
+	if left > 0 {
+		return fmt.Errorf("refund of %.2f is more than the gift cards paid", amount)
+	}
+	return nil
+}
+
+type GiftCardService struct {
+	DB *pgxpool.Pool
+}
+
+func NewGiftCardService(db *pgxpool.Pool) *GiftCardService {
+	return &GiftCardService{DB: db}
+}
+
+// GiftCardExpiry is when a card expiring on day (YYYY-MM-DD, "" for never) stops working:
+// the end of that day in the salon's timezone
+func GiftCardExpiry(day, timezone string, now time.Time) (*time.Time, error) {
+	if day == "" {
+		return nil, nil
+	}
+	start, err := time.ParseInLocation("2006-01-02", day, SalonLocation(timezone))
+	if err != nil {
+		return nil, fmt.Errorf("invalid expires_on, use YYYY-MM-DD")
+	}
+	end := start.AddDate(0, 0, 1)
+	if !end.After(now) {
+		return nil, fmt.Errorf("expires_on must not be in the past")
+	}
+	return &end, nil
+}
+
+// Issue sells a gift card with a new code, usable until expiresAt (nil for no expiry)
+func (s *GiftCardService) Issue(ctx context.Context, salonID string, req models.IssueGiftCardRequest, expiresAt *time.Time, actorID string) (*models.GiftCard, error) {
+	amount := roundCents(req.Amount)
+
+	// A new code can collide with an existing one; try again with another
+	for attempt := 0; ; attempt++ {
+		card, err := s.issue(ctx, salonID, newGiftCardCode(), amount, expiresAt, req, actorID)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" && attempt < 5 {
+			continue
+		}
+		return card, err
+	}
+}
+
+func (s *GiftCardService) issue(ctx context.Context, salonID, code string, amount float64, expiresAt *time.Time, req models.IssueGiftCardRequest, actorID string) (*models.GiftCard, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var card models.GiftCard
+	err = scanGiftCard(tx.QueryRow(ctx,
+		`INSERT INTO gift_cards (salon_id, code, initial_amount, balance, expires_at, recipient_name, recipient_email,
+		 note, issued_by)
+		 VALUES ($1, $2, $3, 0, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, '')::uuid)
+		 RETURNING `+giftCardColumns,
+		salonID, code, amount, expiresAt, req.RecipientName, req.RecipientEmail, req.Note, actorID), &card)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue gift card: %w", err)
+	}
+	if err := giftCardEntry(ctx, tx, card.ID, GiftCardIssue, amount, "", actorID, ""); err != nil {
+		return nil, err
+	}
+	card.Balance = amount
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &card, nil
+}
+
+// Void cancels a salon's gift card; whatever is left on it is written off
+func (s *GiftCardService) Void(ctx context.Context, salonID, cardID, reason, actorID string) (*models.GiftCard, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var status string
+	var balance float64
+	err = tx.QueryRow(ctx,
+		"SELECT status, balance FROM gift_cards WHERE id = $1 AND salon_id = $2 FOR UPDATE",
+		cardID, salonID).Scan(&status, &balance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrGiftCardNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch gift card: %w", err)
+	}
+	if status == "voided" {
+		return nil, fmt.Errorf("gift card is already voided")
+	}
+	if balance > 0 {
+		if err := giftCardEntry(ctx, tx, cardID, GiftCardVoid, -balance, "", actorID, reason); err != nil {
+			return nil, err
+		}
+	}
+	_, err = tx.Exec(ctx,
+		`UPDATE gift_cards SET status = 'voided', voided_at = NOW(), void_reason = $1, updated_at = NOW()
+		 WHERE id = $2`, reason, cardID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to void gift card: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, salonID, cardID)
+}
+
+// Get returns a salon's gift card with its transactions, newest first
+func (s *GiftCardService) Get(ctx context.Context, salonID, cardID string) (*models.GiftCard, error) {
+	var card models.GiftCard
+	err := scanGiftCard(s.DB.QueryRow(ctx,
+		`SELECT `+giftCardColumns+` FROM gift_cards WHERE id = $1 AND salon_id = $2`, cardID, salonID), &card)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrGiftCardNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch gift card: %w", err)
+	}
+
+	rows, err := s.DB.Query(ctx,
+		`SELECT id, kind, amount, payment_id, actor_id, COALESCE(note, ''), created_at
+		 FROM gift_card_transactions WHERE gift_card_id = $1
+		 ORDER BY created_at DESC, id`, cardID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch gift card transactions: %w", err)
+	}
+	defer rows.Close()
+	card.Transactions = []models.GiftCardTransaction{}
+	for rows.Next() {
+		var t models.GiftCardTransaction
+		if err := rows.Scan(&t.ID, &t.Kind, &t.Amount, &t.PaymentID, &t.ActorID, &t.Note, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to fetch gift card transactions: %w", err)
+		}
+		card.Transactions = append(card.Transactions, t)
+	}
+	return &card, nil
+}
+
+// List returns a salon's gift cards, newest first, optionally only those with status
+// (active, expired or voided) or the one with code
+func (s *GiftCardService) List(ctx context.Context, salonID, status, code string) ([]models.GiftCard, error) {
+	if code != "" {
+		code = NormalizeGiftCardCode(code)
+	}
+	rows, err := s.DB.Query(ctx,
+		`SELECT * FROM (SELECT `+giftCardColumns+` FROM gift_cards WHERE salon_id = $1) g
+		 WHERE (g.status = NULLIF($2, '') OR $2 = '') AND (g.code = NULLIF($3, '') OR $3 = '')
+		 ORDER BY g.created_at DESC`, salonID, status, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch gift cards: %w", err)
+	}
+	defer rows.Close()
+	cards := []models.GiftCard{}
+	for rows.Next() {
+		var card models.GiftCard
+		if err := scanGiftCard(rows, &card); err != nil {
+			return nil, fmt.Errorf("failed to fetch gift cards: %w", err)
+		}
+		cards = append(cards, card)
+	}
+	return cards, nil
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestNormalizeGiftCardCode(t *testing.T) {
+	tests := []struct {
+		code, want string
+	}{
+		{code: "ABCD-EFGH-JKLM-NPQR", want: "ABCD-EFGH-JKLM-NPQR"},
+		{code: "abcd efgh jklm npqr", want: "ABCD-EFGH-JKLM-NPQR"},
+		{code: " abcdefghjklmnpqr ", want: "ABCD-EFGH-JKLM-NPQR"},
+		{code: "ab-cd", want: "ABCD"},
+		{code: "--", want: ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeGiftCardCode(tt.code); got != tt.want {
+			t.Errorf("NormalizeGiftCardCode(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestNewGiftCardCode(t *testing.T) {
+	format := regexp.MustCompile(`^[A-HJ-NP-Z2-9]{4}(-[A-HJ-NP-Z2-9]{4}){3}$`)
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		code := newGiftCardCode()
+		if !format.MatchString(code) {
+			t.Fatalf("code %q is not four groups of four", code)
+		}
+		if NormalizeGiftCardCode(code) != code {
+			t.Fatalf("code %q is not in normal form", code)
+		}
+		if seen[code] {
+			t.Fatalf("code %q repeated", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestCheckGiftCard(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	later := now.Add(time.Hour)
+	earlier := now.Add(-time.Hour)
+
+	tests := []struct {
+		name      string
+		status    string
+		expiresAt *time.Time
+		balance   float64
+		amount    float64
+		ok        bool
+	}{
+		{name: "covered", status: "active", balance: 50, amount: 30, ok: true},
+		{name: "whole balance", status: "active", balance: 50, amount: 50, ok: true},
+		{name: "not yet expired", status: "active", expiresAt: &later, balance: 50, amount: 10, ok: true},
+		{name: "over the balance", status: "active", balance: 50, amount: 50.01},
+		{name: "expired", status: "active", expiresAt: &earlier, balance: 50, amount: 10},
+		{name: "voided", status: "voided", balance: 50, amount: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkGiftCard(tt.status, tt.expiresAt, tt.balance, tt.amount, now)
+			if tt.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrGiftCardUnusable) {
+				t.Fatalf("err = %v, want %v", err, ErrGiftCardUnusable)
+			}
+		})
+	}
+}
+
+func TestGiftCardExpiry(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	if at, err := GiftCardExpiry("", "UTC", now); err != nil || at != nil {
+		t.Fatalf("no expiry = %v, %v", at, err)
+	}
+	at, err := GiftCardExpiry("2026-12-31", "Asia/Kolkata", now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := time.Date(2026, 12, 31, 18, 30, 0, 0, time.UTC); !at.Equal(want) {
+		t.Errorf("expires at %v, want %v", at.UTC(), want)
+	}
+	if _, err := GiftCardExpiry("2026-03-10", "UTC", now); err != nil {
+		t.Errorf("today should still be usable: %v", err)
+	}
+	if _, err := GiftCardExpiry("2026-03-09", "UTC", now); err == nil {
+		t.Error("expected an error for a past day")
+	}
+	if _, err := GiftCardExpiry("10/03/2026", "UTC", now); err == nil {
+		t.Error("expected an error for a malformed day")
+	}
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+
+	"saloon-backend/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// nextInvoiceNumber allocates the next number of a salon's invoice sequence. The counter
+// row stays locked until tx ends, so concurrent payments of a salon are numbered one after
+// the other and a rolled-back payment gives its number back.
+func nextInvoiceNumber(ctx context.Context, tx pgx.Tx, salonID string) (int, error) {
+	var n int
+	err := tx.QueryRow(ctx,
+		`INSERT INTO invoice_counters (salon_id, last_number) VALUES ($1, 1)
+		 ON CONFLICT (salon_id) DO UPDATE SET last_number = invoice_counters.last_number + 1
+		 RETURNING last_number`, salonID).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate invoice number: %w", err)
+	}
+	return n, nil
+}
+
+// InvoiceReceiptNumber is the receipt number printed for a salon's nth invoice
+func InvoiceReceiptNumber(n int) string {
+	return fmt.Sprintf("INV-%06d", n)
+}
+
+// invoiceRow is a label and an amount on an invoice
+type invoiceRow struct {
+	Label  string
+	Amount string
+	Strong bool
+}
+
+// invoiceView is an invoice laid out for printing, shared by the HTML and PDF renderings
+type invoiceView struct {
+	Title    string
+	Number   string
+	Date     string
+	Status   string
+	Salon    []string
+	Customer []string
+	Items    []invoiceRow
+	Totals   []invoiceRow
+	Payments []invoiceRow
+}
+
+var tenderLabels = map[string]string{
+	"cash":         "Cash",
+	"card":         "Card",
+	"upi":          "UPI",
+	"wallet":       "Wallet",
+	MethodGiftCard: "Gift card",
+	MethodSplit:    "Split",
+}
+
+func invoiceMoney(amount float64, currency string) string {
+	return fmt.Sprintf("%s %.2f", strings.ToUpper(currency), amount)
+}
+
+// buildInvoiceView lays out the salon's details, the line items, tax and fees, the total
+// and how it was paid
+func buildInvoiceView(inv *models.Invoice) invoiceView {
+	p, a, s := &inv.Payment, &inv.Appointment, &inv.Salon
+	money := func(amount float64) string { return invoiceMoney(amount, inv.Currency) }
+
+	v := invoiceView{
+		Title:  "Invoice " + p.ReceiptNumber,
+		Number: p.ReceiptNumber,
+		Date:   p.CreatedAt.Format("2006-01-02"),
+		Status: p.Status,
+	}
+	if s.Name != "" {
+		v.Title = s.Name + " - " + v.Title
+	}
+	locality := strings.TrimSpace(strings.Join(nonEmpty(s.City, s.State, s.ZipCode), " "))
+	v.Salon = nonEmpty(s.Name, s.Address, locality, s.Phone, s.Email)
+	v.Customer = nonEmpty(a.CustomerName, a.CustomerEmail)
+	if a.AppointmentDate != "" {
+		appt := "Appointment " + a.AppointmentDate + " " + strings.TrimSuffix(a.StartTime, ":00")
+		if a.StaffName != "" {
+			appt += " with " + a.StaffName
+		}
+		v.Customer = append(v.Customer, appt)
+	}
+
+	for _, item := range a.Services {
+		v.Items = append(v.Items, invoiceRow{Label: item.ServiceName, Amount: money(item.Price)})
+	}
+	if len(v.Items) == 0 {
+		v.Items = append(v.Items, invoiceRow{Label: a.ServiceName, Amount: money(p.Amount)})
+	}
+
+	for _, f := range p.Fees {
+		label := feeLabels[f.Kind]
+		if label == "" {
+			label = f.Kind
+		}
+		v.Totals = append(v.Totals, invoiceRow{
+			Label:  fmt.Sprintf("%s (charged instead of %s)", label, money(f.OriginalTotal)),
+			Amount: money(f.Amount),
+		})
+	}
+	if len(p.Fees) == 0 {
+		v.Totals = append(v.Totals, invoiceRow{Label: "Subtotal", Amount: money(p.Amount)})
+		if p.Discount > 0 {
+			v.Totals = append(v.Totals, invoiceRow{Label: "Discount", Amount: money(-p.Discount)})
+		}
+		for _, t := range p.Taxes {
+			label := fmt.Sprintf("%s %s%%", t.Name, strconv.FormatFloat(t.RatePercent, 'f', -1, 64))
+			if p.TaxInclusive {
+				label += " (included)"
+			}
+			v.Totals = append(v.Totals, invoiceRow{Label: label, Amount: money(t.Amount)})
+		}
+	}
+	v.Totals = append(v.Totals, invoiceRow{Label: "Total", Amount: money(p.Total), Strong: true})
+	if p.Tip > 0 {
+		label := "Tip"
+		if p.TipStaffName != "" {
+			label += " for " + p.TipStaffName
+		}
+		v.Totals = append(v.Totals, invoiceRow{Label: label, Amount: money(p.Tip)})
+	}
+
+	if p.DepositApplied > 0 {
+		v.Payments = append(v.Payments, invoiceRow{Label: "Deposit", Amount: money(p.DepositApplied)})
+	}
+	if len(p.Tenders) > 0 {
+		for _, t := range p.Tenders {
+			v.Payments = append(v.Payments, invoiceRow{Label: tenderLabels[t.Method], Amount: money(t.Amount)})
+		}
+	} else if balance := roundCents(p.Total + p.Tip - p.DepositApplied); balance > 0 {
+		label := tenderLabels[p.Method]
+		if label == "" {
+			label = p.Method
+		}
+		v.Payments = append(v.Payments, invoiceRow{Label: label, Amount: money(balance)})
+	}
+	if p.RefundedAmount > 0 {
+		v.Payments = append(v.Payments, invoiceRow{Label: "Refunded", Amount: money(-p.RefundedAmount)})
+	}
+	return v
+}
+
+// nonEmpty drops the empty strings of values
+func nonEmpty(values ...string) []string {
+	var out []string
+	for _, s := range values {
+		if strings.TrimSpace(s) != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+var invoiceTemplate = template.Must(template.New("invoice").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; color: #222; max-width: 640px; margin: 2em auto; }
+h1 { font-size: 1.4em; margin-bottom: 0; }
+.meta { color: #666; margin-top: 0.2em; }
+.parties { display: flex; justify-content: space-between; margin: 1.5em 0; }
+table { width: 100%; border-collapse: collapse; margin-bottom: 1em; }
+td { padding: 0.3em 0; }
+td.amount { text-align: right; white-space: nowrap; }
+tr.strong td { font-weight: bold; border-top: 1px solid #222; }
+th { text-align: left; border-bottom: 1px solid #ccc; padding: 0.3em 0; }
+</style>
+</head>
+<body>
+<h1>Invoice {{.Number}}</h1>
+<p class="meta">{{.Date}} &middot; {{.Status}}</p>
+<div class="parties">
+<div>{{range .Salon}}{{.}}<br>{{end}}</div>
+<div>{{range .Customer}}{{.}}<br>{{end}}</div>
+</div>
+<table>
+<tr><th>Service</th><th></th></tr>
+{{range .Items}}<tr><td>{{.Label}}</td><td class="amount">{{.Amount}}</td></tr>
+{{end}}</table>
+<table>
+{{range .Totals}}<tr{{if .Strong}} class="strong"{{end}}><td>{{.Label}}</td><td class="amount">{{.Amount}}</td></tr>
+{{end}}</table>
+{{if .Payments}}<table>
+<tr><th>Paid with</th><th></th></tr>
+{{range .Payments}}<tr><td>{{.Label}}</td><td class="amount">{{.Amount}}</td></tr>
+{{end}}</table>{{end}}
+</body>
+</html>
+`))
+
+// InvoiceHTML renders a payment's invoice as a standalone HTML page
+func InvoiceHTML(inv *models.Invoice) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := invoiceTemplate.Execute(&buf, buildInvoiceView(inv)); err != nil {
+		return nil, fmt.Errorf("failed to render invoice: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// InvoicePDF renders a payment's invoice as an A4 PDF
+func InvoicePDF(inv *models.Invoice) []byte {
+	v := buildInvoiceView(inv)
+	d := newPDFDoc()
+	right := pdfWidth - pdfMargin
+
+	d.text(pdfMargin, pdfBold, 18, "Invoice "+v.Number)
+	d.space(18)
+	d.text(pdfMargin, pdfRegular, 10, v.Date+"  -  "+v.Status)
+	d.space(28)
+
+	lines := max(len(v.Salon), len(v.Customer))
+	for i := 0; i < lines; i++ {
+		if i < len(v.Salon) {
+			font := pdfRegular
+			if i == 0 {
+				font = pdfBold
+			}
+			d.text(pdfMargin, font, 10, v.Salon[i])
+		}
+		if i < len(v.Customer) {
+			d.text(pdfWidth/2, pdfRegular, 10, v.Customer[i])
+		}
+		d.space(14)
+	}
+	d.space(14)
+
+	section := func(heading string, rows []invoiceRow) {
+		if heading != "" {
+			d.text(pdfMargin, pdfBold, 11, heading)
+			d.space(18)
+		}
+		for _, row := range rows {
+			font := pdfRegular
+			if row.Strong {
+				font = pdfBold
+				d.rule()
+			}
+			d.text(pdfMargin, font, 10, row.Label)
+			d.textRight(right, 10, row.Amount)
+			d.space(15)
+		}
+		d.space(12)
+	}
+	section("Services", v.Items)
+	section("", v.Totals)
+	if len(v.Payments) > 0 {
+		section("Paid with", v.Payments)
+	}
+	return d.bytes()
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"saloon-backend/models"
+)
+
+func testInvoice() *models.Invoice {
+	staff := "st-1"
+	return &models.Invoice{
+		Currency: "usd",
+		Salon:    models.Salon{Name: "Glow & Co", Address: "1 Main St", City: "Springfield", ZipCode: "12345"},
+		Appointment: models.Appointment{
+			AppointmentDate: "2026-03-01", StartTime: "10:00:00", StaffName: "Emma",
+			CustomerName: "Alice <Admin>",
+			Services: []models.AppointmentService{
+				{ServiceName: "Haircut", Price: 50},
+				{ServiceName: "Blow dry (long)", Price: 30},
+			},
+		},
+		Payment: models.Payment{
+			ReceiptNumber: InvoiceReceiptNumber(42), InvoiceNumber: 42,
+			Amount: 80, Tax: 8, Total: 88, Method: MethodSplit, Status: "completed",
+			CreatedAt:  time.Date(2026, 3, 1, 11, 0, 0, 0, time.UTC),
+			Taxes:      []models.PaymentTax{{Name: "Sales tax", RatePercent: 10, TaxableAmount: 80, Amount: 8}},
+			Tip:        12,
+			TipStaffID: &staff, TipStaffName: "Emma",
+			Tenders: []models.PaymentTender{{Method: "card", Amount: 60}, {Method: "cash", Amount: 40}},
+		},
+	}
+}
+
+func TestInvoiceReceiptNumber(t *testing.T) {
+	if got := InvoiceReceiptNumber(42); got != "INV-000042" {
+		t.Errorf("InvoiceReceiptNumber(42) = %q", got)
+	}
+}
+
+func TestBuildInvoiceView(t *testing.T) {
+	v := buildInvoiceView(testInvoice())
+
+	want := []invoiceRow{
+		{Label: "Subtotal", Amount: "USD 80.00"},
+		{Label: "Sales tax 10%", Amount: "USD 8.00"},
+		{Label: "Total", Amount: "USD 88.00", Strong: true},
+		{Label: "Tip for Emma", Amount: "USD 12.00"},
+	}
+	if fmt.Sprint(v.Totals) != fmt.Sprint(want) {
+		t.Errorf("totals = %v, want %v", v.Totals, want)
+	}
+	if len(v.Items) != 2 || v.Items[1].Amount != "USD 30.00" {
+		t.Errorf("items = %v", v.Items)
+	}
+	if len(v.Payments) != 2 || v.Payments[0].Label != "Card" || v.Payments[1].Amount != "USD 40.00" {
+		t.Errorf("payments = %v", v.Payments)
+	}
+	if v.Salon[2] != "Springfield 12345" {
+		t.Errorf("salon = %v", v.Salon)
+	}
+}
+
+func TestBuildInvoiceViewFee(t *testing.T) {
+	inv := testInvoice()
+	inv.Payment.Amount, inv.Payment.Tax, inv.Payment.Total, inv.Payment.Taxes = 20, 0, 20, nil
+	inv.Payment.Tip, inv.Payment.Tenders, inv.Payment.Method = 0, nil, "cash"
+	inv.Payment.Fees = []models.PaymentFee{{Kind: FeeNoShow, Amount: 20, OriginalTotal: 88}}
+
+	v := buildInvoiceView(inv)
+	if len(v.Totals) != 2 || !strings.HasPrefix(v.Totals[0].Label, "No-show fee") {
+		t.Errorf("totals = %v", v.Totals)
+	}
+	if len(v.Payments) != 1 || v.Payments[0] != (invoiceRow{Label: "Cash", Amount: "USD 20.00"}) {
+		t.Errorf("payments = %v", v.Payments)
+	}
+}
+
+func TestInvoiceHTMLEscapes(t *testing.T) {
+	page, err := InvoiceHTML(testInvoice())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(page, []byte("<Admin>")) || !bytes.Contains(page, []byte("Alice &lt;Admin&gt;")) {
+		t.Error("customer name is not escaped")
+	}
+	if !bytes.Contains(page, []byte("Invoice INV-000042")) {
+		t.Error("invoice number missing")
+	}
+}
+
+func TestInvoicePDF(t *testing.T) {
+	doc := InvoicePDF(testInvoice())
+	if !bytes.HasPrefix(doc, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(doc, []byte("%%EOF\n")) {
+		t.Fatal("not a PDF document")
+	}
+	if !bytes.Contains(doc, []byte(`(Blow dry \(long\))`)) {
+		t.Error("parentheses in text are not escaped")
+	}
+
+	// Every cross-reference entry points at its object
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(doc)
+	if m == nil {
+		t.Fatal("no startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(doc[xref:], -1)
+	if len(entries) != 7 {
+		t.Fatalf("%d objects, want 7 for one page", len(entries))
+	}
+	for i, e := range entries {
+		off, _ := strconv.Atoi(string(e[1]))
+		if !bytes.HasPrefix(doc[off:], []byte(fmt.Sprintf("%d 0 obj", i+1))) {
+			t.Errorf("xref entry %d points at the wrong offset", i+1)
+		}
+	}
+}
+
+func TestPDFPageBreaks(t *testing.T) {
+	d := newPDFDoc()
+	for i := 0; i < 100; i++ {
+		d.text(pdfMargin, pdfRegular, 10, "line")
+		d.space(15)
+	}
+	if len(d.pages) != 3 {
+		t.Errorf("%d pages, want 3", len(d.pages))
+	}
+	if !bytes.Contains(d.bytes(), []byte("/Count 3")) {
+		t.Error("page tree does not count every page")
+	}
+}
@@ -0,0 +1,524 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"saloon-backend/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Kinds of loyalty ledger entries
+const (
+	PointsEarn   = "earn"
+	PointsRedeem = "redeem"
+	PointsExpire = "expire"
+	PointsAdjust = "adjust"
+)
+
+// PointsExpiryInterval is how often lapsed points are taken off balances
+const PointsExpiryInterval = time.Hour
+
+// ErrInsufficientPoints is returned when a customer redeems more points than they have
+var ErrInsufficientPoints = errors.New("not enough loyalty points")
+
+type LoyaltyService struct {
+	DB *pgxpool.Pool
+}
+
+func NewLoyaltyService(db *pgxpool.Pool) *LoyaltyService {
+	return &LoyaltyService{DB: db}
+}
+
+// DefaultLoyaltyProgram is the program of a salon that never set one: a point per unit
+// paid, worth a cent each, never expiring
+func DefaultLoyaltyProgram() models.LoyaltyProgram {
+	return models.LoyaltyProgram{Enabled: true, PointsPerUnit: 1, PointValue: 0.01, MaxRedeemPercent: 100}
+}
+
+// LoadLoyaltyProgram reads a salon's loyalty program, or the default one
+func LoadLoyaltyProgram(ctx context.Context, q querier, salonID string) (models.LoyaltyProgram, error) {
+	p := DefaultLoyaltyProgram()
+	err := q.QueryRow(ctx,
+		`SELECT enabled, points_per_unit, point_value, min_redeem_points, max_redeem_percent, expiry_days
+		 FROM loyalty_programs WHERE salon_id = $1`, salonID,
+	).Scan(&p.Enabled, &p.PointsPerUnit, &p.PointValue, &p.MinRedeemPoints, &p.MaxRedeemPercent, &p.ExpiryDays)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return p, fmt.Errorf("failed to fetch loyalty program: %w", err)
+	}
+	return p, nil
+}
+
+// pointsEarned is what paying amount for services earns under a program
+func pointsEarned(p models.LoyaltyProgram, amount float64) int {
+	if !p.Enabled || amount <= 0 {
+		return 0
+	}
+	// Rounded to cents first so 19.99 * 1 isn't floored to 19 by float error
+	return int(math.Floor(roundCents(amount*p.PointsPerUnit) + 1e-9))
+}
+
+// pointsDiscount is what redeeming points out of balance takes off an order of subtotal
+func pointsDiscount(p models.LoyaltyProgram, points, balance int, subtotal float64) (float64, error) {
+	if !p.Enabled {
+		return 0, fmt.Errorf("this salon does not accept loyalty points")
+	}
+	if points < p.MinRedeemPoints {
+		return 0, fmt.Errorf("at least %d points must be redeemed at a time", p.MinRedeemPoints)
+	}
+	if points > balance {
+		return 0, fmt.Errorf("%w: %d available", ErrInsufficientPoints, balance)
+	}
+	discount := roundCents(float64(points) * p.PointValue)
+	if limit := roundCents(math.Max(subtotal, 0) * p.MaxRedeemPercent / 100); discount > limit+0.005 {
+		most := 0
+		if p.PointValue > 0 {
+			most = int(math.Floor(limit/p.PointValue + 1e-9))
+		}
+		return 0, fmt.Errorf("at most %d points can be redeemed on this booking", most)
+	}
+	return discount, nil
+}
+
+// pointsEntry is a ledger entry to add
+type pointsEntry struct {
+	UserID        string
+	SalonID       string
+	Kind          string
+	Points        int
+	AppointmentID string
+	Note          string
+	ActorID       string
+	ExpiresAt     *time.Time
+}
+
+// addPoints writes a ledger entry and moves the customer's total with it
+func addPoints(ctx context.Context, tx pgx.Tx, e pointsEntry) error {
+	if e.Points == 0 {
+		return nil
+	}
+	_, err := tx.Exec(ctx,
+		`INSERT INTO loyalty_transactions (user_id, salon_id, kind, points, appointment_id, note, actor_id, expires_at)
+		 VALUES ($1, $2, $3, $4, NULLIF($5, '')::uuid, NULLIF($6, ''), NULLIF($7, '')::uuid, $8)`,
+		e.UserID, e.SalonID, e.Kind, e.Points, e.AppointmentID, e.Note, e.ActorID, e.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to record loyalty points: %w", err)
+	}
+	_, err = tx.Exec(ctx,
+		"UPDATE users SET loyalty_points = loyalty_points + $1 WHERE id = $2", e.Points, e.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to update loyalty points: %w", err)
+	}
+	return nil
+}
+
+// lockPointsBalance locks the customer's points until tx ends and returns their balance
+// at the salon
+func lockPointsBalance(ctx context.Context, tx pgx.Tx, userID, salonID string) (int, error) {
+	if _, err := tx.Exec(ctx, "SELECT 1 FROM users WHERE id = $1 FOR UPDATE", userID); err != nil {
+		return 0, fmt.Errorf("failed to lock loyalty points: %w", err)
+	}
+	var balance int
+	err := tx.QueryRow(ctx,
+		"SELECT COALESCE(SUM(points), 0) FROM loyalty_transactions WHERE user_id = $1 AND salon_id = $2",
+		userID, salonID).Scan(&balance)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch loyalty points: %w", err)
+	}
+	return balance, nil
+}
+
+// quotePointsRedemption checks that the customer can redeem points on an order of subtotal
+// at the salon and returns the discount. The balance stays locked until tx ends, so the
+// caller can record the redemption with addPoints.
+func quotePointsRedemption(ctx context.Context, tx pgx.Tx, customerID, salonID string, points int, subtotal float64) (float64, error) {
+	program, err := LoadLoyaltyProgram(ctx, tx, salonID)
+	if err != nil {
+		return 0, err
+	}
+	balance, err := lockPointsBalance(ctx, tx, customerID, salonID)
+	if err != nil {
+		return 0, err
+	}
+	return pointsDiscount(program, points, balance, subtotal)
+}
+
+// settlePoints undoes the points of an appointment that fell through: redeemed points go
+// back to the customer and points earned on it are taken off again, as far as the
+// balance allows
+func settlePoints(ctx context.Context, tx pgx.Tx, apptID string) error {
+	var customerID, salonID string
+	var net int
+	err := tx.QueryRow(ctx,
+		`SELECT a.customer_id, a.salon_id,
+		 (SELECT COALESCE(SUM(points), 0) FROM loyalty_transactions WHERE appointment_id = a.id)
+		 FROM appointments a WHERE a.id = $1`, apptID).Scan(&customerID, &salonID, &net)
+	if err != nil {
+		return fmt.Errorf("failed to fetch loyalty points: %w", err)
+	}
+	if net == 0 {
+		return nil
+	}
+	balance, err := lockPointsBalance(ctx, tx, customerID, salonID)
+	if err != nil {
+		return err
+	}
+	points, note := -net, "Points returned: booking cancelled"
+	if net > 0 {
+		points, note = -min(net, max(balance, 0)), "Points reversed: booking refunded"
+	}
+	return addPoints(ctx, tx, pointsEntry{
+		UserID: customerID, SalonID: salonID, Kind: PointsAdjust, Points: points,
+		AppointmentID: apptID, Note: note,
+	})
+}
+
+// EarnPoints credits the customer of a completed appointment with the points its
+// services earn under the salon's program, once per appointment. It returns the points.
+func (s *LoyaltyService) EarnPoints(ctx context.Context, apptID string) (int, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var customerID, salonID, status string
+	var paid float64
+	err = tx.QueryRow(ctx,
+		`SELECT a.customer_id, a.salon_id, a.status,
+		 COALESCE((SELECT amount - discount FROM payments WHERE appointment_id = a.id ORDER BY created_at DESC LIMIT 1),
+		     (SELECT SUM(price) FROM appointment_services WHERE appointment_id = a.id)
+		         - a.promo_discount - a.member_discount - a.points_discount,
+		     0)
+		 FROM appointments a WHERE a.id = $1`, apptID).Scan(&customerID, &salonID, &status, &paid)
+	if err != nil {
+		return 0, fmt.Errorf("appointment not found")
+	}
+	if status != "completed" {
+		return 0, nil
+	}
+	program, err := LoadLoyaltyProgram(ctx, tx, salonID)
+	if err != nil {
+		return 0, err
+	}
+	points := pointsEarned(program, paid)
+	if points <= 0 {
+		return 0, nil
+	}
+	var expires *time.Time
+	if program.ExpiryDays > 0 {
+		t := time.Now().AddDate(0, 0, program.ExpiryDays)
+		expires = &t
+	}
+
+	if _, err := lockPointsBalance(ctx, tx, customerID, salonID); err != nil {
+		return 0, err
+	}
+	var earned bool
+	err = tx.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM loyalty_transactions WHERE appointment_id = $1 AND kind = 'earn')`,
+		apptID).Scan(&earned)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch loyalty points: %w", err)
+	}
+	if earned {
+		return 0, nil
+	}
+	err = addPoints(ctx, tx, pointsEntry{
+		UserID: customerID, SalonID: salonID, Kind: PointsEarn, Points: points,
+		AppointmentID: apptID, Note: "Completed appointment", ExpiresAt: expires,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return points, tx.Commit(ctx)
+}
+
+// AdjustPoints adds points to a customer's balance at a salon, or takes them off when
+// negative, down to zero at most
+func (s *LoyaltyService) AdjustPoints(ctx context.Context, salonID, customerID string, points int, note, actorID string) error {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	balance, err := lockPointsBalance(ctx, tx, customerID, salonID)
+	if err != nil {
+		return err
+	}
+	if balance+points < 0 {
+		return fmt.Errorf("%w: %d available", ErrInsufficientPoints, balance)
+	}
+	err = addPoints(ctx, tx, pointsEntry{
+		UserID: customerID, SalonID: salonID, Kind: PointsAdjust, Points: points,
+		Note: note, ActorID: actorID,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// History returns a customer's balance per salon and their latest ledger entries, of one
+// salon when salonID is set
+func (s *LoyaltyService) History(ctx context.Context, customerID, salonID string, limit int) (*models.LoyaltyHistory, error) {
+	h := &models.LoyaltyHistory{Balances: []models.LoyaltyBalance{}, Transactions: []models.LoyaltyTransaction{}}
+	rows, err := s.DB.Query(ctx,
+		`SELECT t.salon_id, s.name, SUM(t.points)::int,
+		 COALESCE(lp.enabled, true), COALESCE(lp.point_value, 0.01)
+		 FROM loyalty_transactions t
+		 JOIN salons s ON s.id = t.salon_id
+		 LEFT JOIN loyalty_programs lp ON lp.salon_id = t.salon_id
+		 WHERE t.user_id = $1 AND (t.salon_id = NULLIF($2, '')::uuid OR $2 = '')
+		 GROUP BY t.salon_id, s.name, lp.enabled, lp.point_value
+		 HAVING SUM(t.points) <> 0
+		 ORDER BY s.name`, customerID, salonID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch loyalty balances: %w", err)
+	}
+	for rows.Next() {
+		var b models.LoyaltyBalance
+		var enabled bool
+		var value float64
+		if err := rows.Scan(&b.SalonID, &b.SalonName, &b.Points, &enabled, &value); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to fetch loyalty balances: %w", err)
+		}
+		if enabled {
+			b.Value = roundCents(float64(b.Points) * value)
+		}
+		h.TotalPoints += b.Points
+		h.Balances = append(h.Balances, b)
+	}
+	rows.Close()
+
+	rows, err = s.DB.Query(ctx,
+		`SELECT t.id, t.salon_id, t.kind, t.points, t.appointment_id, COALESCE(t.note, ''), t.expires_at, t.created_at, s.name
+		 FROM loyalty_transactions t JOIN salons s ON s.id = t.salon_id
+		 WHERE t.user_id = $1 AND (t.salon_id = NULLIF($2, '')::uuid OR $2 = '')
+		 ORDER BY t.created_at DESC, t.id
+		 LIMIT $3`, customerID, salonID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch loyalty history: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t models.LoyaltyTransaction
+		if err := rows.Scan(&t.ID, &t.SalonID, &t.Kind, &t.Points, &t.AppointmentID, &t.Note,
+			&t.ExpiresAt, &t.CreatedAt, &t.SalonName); err != nil {
+			return nil, fmt.Errorf("failed to fetch loyalty history: %w", err)
+		}
+		h.Transactions = append(h.Transactions, t)
+	}
+	return h, nil
+}
+
+// StartPointsExpiry takes lapsed points off balances until ctx is cancelled. Call this in
+// a goroutine.
+func (s *LoyaltyService) StartPointsExpiry(ctx context.Context) {
+	ticker := time.NewTicker(PointsExpiryInterval)
+	defer ticker.Stop()
+	for {
+		s.ExpirePoints(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// expiringPointsSQL is how many points of a customer at a salon have lapsed: earned points
+// past their expiry that spending hasn't used up yet. Spending counts against the points
+// that expire first, and never more than the balance expires.
+const expiringPointsSQL = `LEAST(SUM(points),
+	COALESCE(SUM(points) FILTER (WHERE points > 0 AND expires_at <= NOW()), 0)
+	+ COALESCE(SUM(points) FILTER (WHERE points < 0), 0))`
+
+// ExpirePoints writes an expire entry for every balance with lapsed points
+func (s *LoyaltyService) ExpirePoints(ctx context.Context) {
+	rows, err := s.DB.Query(ctx,
+		`SELECT user_id, salon_id FROM loyalty_transactions
+		 WHERE user_id IN (SELECT user_id FROM loyalty_transactions WHERE expires_at <= NOW())
+		 GROUP BY user_id, salon_id
+		 HAVING `+expiringPointsSQL+` > 0`)
+	if err != nil {
+		log.Printf("Points expiry: %v", err)
+		return
+	}
+	type balance struct{ userID, salonID string }
+	var due []balance
+	for rows.Next() {
+		var b balance
+		if err := rows.Scan(&b.userID, &b.salonID); err == nil {
+			due = append(due, b)
+		}
+	}
+	rows.Close()
+
+	for _, b := range due {
+		if err := s.expireBalance(ctx, b.userID, b.salonID); err != nil {
+			log.Printf("Points expiry for user %s: %v", b.userID, err)
+		}
+	}
+}
+
+func (s *LoyaltyService) expireBalance(ctx context.Context, userID, salonID string) error {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := lockPointsBalance(ctx, tx, userID, salonID); err != nil {
+		return err
+	}
+	var lapsed int
+	err = tx.QueryRow(ctx,
+		`SELECT `+expiringPointsSQL+` FROM loyalty_transactions WHERE user_id = $1 AND salon_id = $2`,
+		userID, salonID).Scan(&lapsed)
+	if err != nil {
+		return fmt.Errorf("failed to fetch lapsed points: %w", err)
+	}
+	if lapsed <= 0 {
+		return nil
+	}
+	err = addPoints(ctx, tx, pointsEntry{
+		UserID: userID, SalonID: salonID, Kind: PointsExpire, Points: -lapsed, Note: "Points expired",
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// RedeemPoints takes the customer's loyalty points off the amount due on an appointment
+// that hasn't been paid yet. The payment is re-priced with the points discount on top of
+// its promo and member discounts, and the discount is returned.
+func (s *PaymentService) RedeemPoints(ctx context.Context, apptID string, points int) (float64, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var customerID, salonID, apptStatus, paymentID, paymentStatus string
+	var bookedDiscount, pointsDiscount float64
+	err = tx.QueryRow(ctx,
+		`SELECT a.customer_id, a.salon_id, a.status, a.promo_discount + a.member_discount, a.points_discount, p.id, p.status
+		 FROM appointments a
+		 JOIN payments p ON p.appointment_id = a.id
+		 WHERE a.id = $1
+		 ORDER BY p.created_at DESC LIMIT 1
+		 FOR UPDATE`, apptID,
+	).Scan(&customerID, &salonID, &apptStatus, &bookedDiscount, &pointsDiscount, &paymentID, &paymentStatus)
+	if err != nil {
+		return 0, fmt.Errorf("payment not found")
+	}
+	if apptStatus == "cancelled" || apptStatus == "no_show" {
+		return 0, fmt.Errorf("appointment is %s", apptStatus)
+	}
+	if paymentStatus != "pending" && paymentStatus != "authorized" {
+		return 0, fmt.Errorf("payment is already %s", paymentStatus)
+	}
+
+	lines, _, err := appointmentLines(ctx, tx, apptID)
+	if err != nil {
+		return 0, err
+	}
+	subtotal := sumServicePrices(lines) - bookedDiscount - pointsDiscount
+	discount, err := quotePointsRedemption(ctx, tx, customerID, salonID, points, subtotal)
+	if err != nil {
+		return 0, err
+	}
+	err = addPoints(ctx, tx, pointsEntry{
+		UserID: customerID, SalonID: salonID, Kind: PointsRedeem, Points: -points,
+		AppointmentID: apptID, Note: "Redeemed at checkout",
+	})
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(ctx,
+		"UPDATE appointments SET points_discount = points_discount + $1, updated_at = NOW() WHERE id = $2",
+		discount, apptID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to apply points: %w", err)
+	}
+	price, err := priceServiceLines(ctx, tx, salonID, lines, bookedDiscount+pointsDiscount+discount)
+	if err != nil {
+		return 0, err
+	}
+	if err := repricePayment(ctx, tx, paymentID, price); err != nil {
+		return 0, err
+	}
+	return discount, tx.Commit(ctx)
+}
+
+// pointsReturnable reports whether points redeemed at a checkout that then failed go back
+// to the customer: only while the payment hasn't been collected, since a collected one
+// was charged the discounted amount
+func pointsReturnable(paymentStatus string) bool {
+	return paymentStatus == "pending" || paymentStatus == "authorized"
+}
+
+// returnPoints undoes RedeemPoints after a checkout failed: the points go back to the
+// customer and the payment is re-priced without their discount, unless the payment was
+// collected after all
+func (s *PaymentService) returnPoints(ctx context.Context, apptID string, points int, discount float64) error {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var customerID, salonID, paymentID, paymentStatus string
+	var bookedDiscount, pointsDiscount float64
+	err = tx.QueryRow(ctx,
+		`SELECT a.customer_id, a.salon_id, a.promo_discount + a.member_discount, a.points_discount, p.id, p.status
+		 FROM appointments a
+		 JOIN payments p ON p.appointment_id = a.id
+		 WHERE a.id = $1
+		 ORDER BY p.created_at DESC LIMIT 1
+		 FOR UPDATE`, apptID,
+	).Scan(&customerID, &salonID, &bookedDiscount, &pointsDiscount, &paymentID, &paymentStatus)
+	if err != nil {
+		return fmt.Errorf("payment not found")
+	}
+	if !pointsReturnable(paymentStatus) {
+		return nil
+	}
+
+	err = addPoints(ctx, tx, pointsEntry{
+		UserID: customerID, SalonID: salonID, Kind: PointsAdjust, Points: points,
+		AppointmentID: apptID, Note: "Points returned: checkout failed",
+	})
+	if err != nil {
+		return err
+	}
+	pointsDiscount = math.Max(roundCents(pointsDiscount-discount), 0)
+	_, err = tx.Exec(ctx,
+		"UPDATE appointments SET points_discount = $1, updated_at = NOW() WHERE id = $2",
+		pointsDiscount, apptID)
+	if err != nil {
+		return fmt.Errorf("failed to return points: %w", err)
+	}
+	lines, _, err := appointmentLines(ctx, tx, apptID)
+	if err != nil {
+		return err
+	}
+	price, err := priceServiceLines(ctx, tx, salonID, lines, bookedDiscount+pointsDiscount)
+	if err != nil {
+		return err
+	}
+	if err := repricePayment(ctx, tx, paymentID, price); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"saloon-backend/models"
+)
+
+func TestPointsEarned(t *testing.T) {
+	program := DefaultLoyaltyProgram()
+	double := program
+	double.PointsPerUnit = 2
+	off := program
+	off.Enabled = false
+
+	tests := []struct {
+		name    string
+		program models.LoyaltyProgram
+		amount  float64
+		want    int
+	}{
+		{name: "a point per unit", program: program, amount: 80, want: 80},
+		{name: "cents are floored", program: program, amount: 19.99, want: 19},
+		{name: "rate", program: double, amount: 45.50, want: 91},
+		{name: "nothing paid", program: program, amount: 0},
+		{name: "program off", program: off, amount: 80},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pointsEarned(tt.program, tt.amount); got != tt.want {
+				t.Errorf("pointsEarned(%v) = %d, want %d", tt.amount, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPointsDiscount(t *testing.T) {
+	program := models.LoyaltyProgram{Enabled: true, PointValue: 0.05, MinRedeemPoints: 100, MaxRedeemPercent: 50}
+	off := program
+	off.Enabled = false
+
+	tests := []struct {
+		name     string
+		program  models.LoyaltyProgram
+		points   int
+		balance  int
+		subtotal float64
+		want     float64
+		wantErr  bool
+	}{
+		{name: "redeemed", program: program, points: 200, balance: 500, subtotal: 80, want: 10},
+		{name: "up to the limit", program: program, points: 800, balance: 800, subtotal: 80, want: 40},
+		{name: "over the limit", program: program, points: 900, balance: 900, subtotal: 80, wantErr: true},
+		{name: "below the minimum", program: program, points: 50, balance: 500, subtotal: 80, wantErr: true},
+		{name: "more than the balance", program: program, points: 300, balance: 200, subtotal: 80, wantErr: true},
+		{name: "program off", program: off, points: 200, balance: 500, subtotal: 80, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pointsDiscount(tt.program, tt.points, tt.balance, tt.subtotal)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("pointsDiscount error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("pointsDiscount = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	_, err := pointsDiscount(program, 300, 200, 80)
+	if !errors.Is(err, ErrInsufficientPoints) {
+		t.Errorf("error = %v, want ErrInsufficientPoints", err)
+	}
+}
+
+func TestPointsReturnable(t *testing.T) {
+	tests := []struct {
+		name   string
+		status string
+		want   bool
+	}{
+		{name: "checkout failed before the card was held", status: "pending", want: true},
+		{name: "card declined at capture", status: "authorized", want: true},
+		{name: "collected after all", status: "completed"},
+		{name: "refunded", status: "partially_refunded"},
+		{name: "voided", status: "voided"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pointsReturnable(tt.status); got != tt.want {
+				t.Errorf("pointsReturnable(%q) = %v, want %v", tt.status, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// FakeSignatureHeader carries the HMAC of a fake provider webhook body
+const FakeSignatureHeader = "X-Fake-Signature"
+
+// fakeIntent is the fake provider's record of one payment
+type fakeIntent struct {
+	paymentID string
+	amount    float64
+	captured  float64
+	refunded  float64
+	status    string
+}
+
+// FakeProvider is an in-process payment provider for tests and local development. Cards
+// are authorized (deposits captured) as soon as an intent is opened, unless Decline is
+// set, and every call answers with the event a real gateway would send.
+type FakeProvider struct {
+	// Decline makes every new authorization fail
+	Decline bool
+
+	secret  []byte
+	mu      sync.Mutex
+	seq     int
+	intents map[string]*fakeIntent
+}
+
+func NewFakeProvider(webhookSecret string) *FakeProvider {
+	return &FakeProvider{secret: []byte(webhookSecret), intents: make(map[string]*fakeIntent)}
+}
+
+func (f *FakeProvider) Name() string { return "fake" }
+
+// next returns a new sequence number; the caller must hold f.mu
+func (f *FakeProvider) next() int {
+	f.seq++
+	return f.seq
+}
+
+func (f *FakeProvider) event(eventType, intentID string, amount float64) *PaymentEvent {
+	return &PaymentEvent{
+		ID:        fmt.Sprintf("evt_fake_%d", f.next()),
+		Type:      eventType,
+		IntentID:  intentID,
+		PaymentID: f.intents[intentID].paymentID,
+		Amount:    amount,
+	}
+}
+
+func (f *FakeProvider) Authorize(ctx context.Context, req AuthorizeRequest) (*PaymentIntent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := fmt.Sprintf("pi_fake_%d", f.next())
+	intent := &fakeIntent{paymentID: req.PaymentID, amount: req.Amount, status: EventAuthorized}
+	switch {
+	case f.Decline:
+		intent.status = EventFailed
+	case req.DepositID != "":
+		intent.status, intent.captured = EventCaptured, req.Amount
+	}
+	f.intents[id] = intent
+	return &PaymentIntent{
+		ID:           id,
+		ClientSecret: id + "_secret",
+		Event:        f.event(intent.status, id, req.Amount),
+	}, nil
+}
+
+func (f *FakeProvider) Capture(ctx context.Context, intentID string, amount float64) (*PaymentEvent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	intent, ok := f.intents[intentID]
+	if !ok {
+		return nil, fmt.Errorf("no such intent %s", intentID)
+	}
+	if intent.status != EventAuthorized {
+		return nil, fmt.Errorf("intent %s is %s", intentID, intent.status)
+	}
+	if amount > intent.amount {
+		return nil, fmt.Errorf("cannot capture more than the authorized %.2f", intent.amount)
+	}
+	intent.status = EventCaptured
+	intent.captured = amount
+	return f.event(EventCaptured, intentID, amount), nil
+}
+
+func (f *FakeProvider) Void(ctx context.Context, intentID string) (*PaymentEvent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	intent, ok := f.intents[intentID]
+	if !ok {
+		return nil, fmt.Errorf("no such intent %s", intentID)
+	}
+	if intent.status != EventAuthorized {
+		return nil, fmt.Errorf("intent %s is %s", intentID, intent.status)
+	}
+	intent.status = EventVoided
+	return f.event(EventVoided, intentID, 0), nil
+}
+
+func (f *FakeProvider) Refund(ctx context.Context, req RefundRequest) (*PaymentEvent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	intent, ok := f.intents[req.IntentID]
+	if !ok {
+		return nil, fmt.Errorf("no such intent %s", req.IntentID)
+	}
+	if intent.status != EventCaptured {
+		return nil, fmt.Errorf("intent %s is %s", req.IntentID, intent.status)
+	}
+	if intent.refunded+req.Amount > intent.captured+0.005 {
+		return nil, fmt.Errorf("cannot refund more than the captured %.2f", intent.captured)
+	}
+	intent.refunded += req.Amount
+	event := f.event(EventRefunded, req.IntentID, req.Amount)
+	event.RefundID = fmt.Sprintf("re_fake_%d", f.next())
+	event.Reason, event.ActorID = req.Reason, req.ActorID
+	return event, nil
+}
+
+// Sign returns the signature header value for a webhook body
+func (f *FakeProvider) Sign(payload []byte) string {
+	return hex.EncodeToString(hmacSHA256(f.secret, payload))
+}
+
+// VerifyWebhook accepts a JSON-encoded PaymentEvent signed with Sign
+func (f *FakeProvider) VerifyWebhook(payload []byte, header http.Header) (*PaymentEvent, error) {
+	sig, err := hex.DecodeString(header.Get(FakeSignatureHeader))
+	if err != nil || !hmac.Equal(sig, hmacSHA256(f.secret, payload)) {
+		return nil, fmt.Errorf("invalid webhook signature")
+	}
+	var event PaymentEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+	if event.ID == "" || event.Type == "" {
+		return nil, fmt.Errorf("webhook event needs an id and a type")
+	}
+	return &event, nil
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const stripeAPI = "https://api.stripe.com/v1"
+
+// StripeProvider talks to Stripe's REST API. Payment intents use manual capture, so a
+// booking only holds the amount until the appointment is completed.
+type StripeProvider struct {
+	SecretKey     string
+	WebhookSecret string
+	Client        *http.Client
+	// now is replaceable so signature checks can be tested
+	now func() time.Time
+}
+
+func NewStripeProvider(secretKey, webhookSecret string) *StripeProvider {
+	return &StripeProvider{
+		SecretKey:     secretKey,
+		WebhookSecret: webhookSecret,
+		Client:        &http.Client{Timeout: 15 * time.Second},
+		now:           time.Now,
+	}
+}
+
+func (p *StripeProvider) Name() string { return "stripe" }
+
+// stripeObject covers the fields used from payment intents and refunds
+type stripeObject struct {
+	ID               string            `json:"id"`
+	Object           string            `json:"object"`
+	Status           string            `json:"status"`
+	ClientSecret     string            `json:"client_secret"`
+	Amount           int64             `json:"amount"`
+	AmountCapturable int64             `json:"amount_capturable"`
+	AmountReceived   int64             `json:"amount_received"`
+	PaymentIntent    string            `json:"payment_intent"`
+	Metadata         map[string]string `json:"metadata"`
+}
+
+// post sends a form-encoded request; idempotencyKey makes retries safe on Stripe's side
+func (p *StripeProvider) post(ctx context.Context, path string, form url.Values, idempotencyKey string) (*stripeObject, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, stripeAPI+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.SecretKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return nil, fmt.Errorf("stripe: %s (HTTP %d)", apiErr.Error.Message, resp.StatusCode)
+	}
+	var obj stripeObject
+	if err := json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+		return nil, fmt.Errorf("stripe: invalid response: %w", err)
+	}
+	return &obj, nil
+}
+
+// intentEvent turns the state of a payment intent into an event. Ids are derived from the
+// intent and its status so the same state read twice is applied once.
+func intentEvent(obj *stripeObject) *PaymentEvent {
+	event := &PaymentEvent{
+		ID:        obj.ID + ":" + obj.Status,
+		IntentID:  obj.ID,
+		PaymentID: obj.Metadata["payment_id"],
+	}
+	switch obj.Status {
+	case "requires_capture":
+		event.Type, event.Amount = EventAuthorized, fromMinor(obj.AmountCapturable)
+	case "succeeded":
+		event.Type, event.Amount = EventCaptured, fromMinor(obj.AmountReceived)
+	case "canceled":
+		event.Type = EventVoided
+	default:
+		// Still waiting for the customer; nothing has happened yet
+		return nil
+	}
+	return event
+}
+
+func (p *StripeProvider) Authorize(ctx context.Context, req AuthorizeRequest) (*PaymentIntent, error) {
+	form := url.Values{
+		"amount":                             {strconv.FormatInt(toMinor(req.Amount), 10)},
+		"currency":                           {req.Currency},
+		"capture_method":                     {"manual"},
+		"automatic_payment_methods[enabled]": {"true"},
+		"metadata[payment_id]":               {req.PaymentID},
+	}
+	if req.Description != "" {
+		form.Set("description", req.Description)
+	}
+	key := "authorize-" + req.PaymentID
+	if req.DepositID != "" {
+		form.Set("capture_method", "automatic")
+		form.Set("metadata[deposit_id]", req.DepositID)
+		key = "deposit-" + req.DepositID
+	}
+	obj, err := p.post(ctx, "/payment_intents", form, key)
+	if err != nil {
+		return nil, err
+	}
+	return &PaymentIntent{ID: obj.ID, ClientSecret: obj.ClientSecret, Event: intentEvent(obj)}, nil
+}
+
+func (p *StripeProvider) Capture(ctx context.Context, intentID string, amount float64) (*PaymentEvent, error) {
+	form := url.Values{"amount_to_capture": {strconv.FormatInt(toMinor(amount), 10)}}
+	obj, err := p.post(ctx, "/payment_intents/"+intentID+"/capture", form, "capture-"+intentID)
+	if err != nil {
+		return nil, err
+	}
+	return intentEvent(obj), nil
+}
+
+func (p *StripeProvider) Void(ctx context.Context, intentID string) (*PaymentEvent, error) {
+	obj, err := p.post(ctx, "/payment_intents/"+intentID+"/cancel", url.Values{}, "cancel-"+intentID)
+	if err != nil {
+		return nil, err
+	}
+	return intentEvent(obj), nil
+}
+
+func (p *StripeProvider) Refund(ctx context.Context, req RefundRequest) (*PaymentEvent, error) {
+	form := url.Values{
+		"payment_intent":       {req.IntentID},
+		"amount":               {strconv.FormatInt(toMinor(req.Amount), 10)},
+		"metadata[payment_id]": {req.PaymentID},
+		"metadata[reason]":     {req.Reason},
+		"metadata[actor_id]":   {req.ActorID},
+	}
+	// No idempotency key: several partial refunds of the same amount are legitimate
+	obj, err := p.post(ctx, "/refunds", form, "")
+	if err != nil {
+		return nil, err
+	}
+	return refundEvent(obj), nil
+}
+
+// refundEvent reports a refund once Stripe says it went through
+func refundEvent(obj *stripeObject) *PaymentEvent {
+	if obj.Status != "succeeded" {
+		return nil
+	}
+	return &PaymentEvent{
+		ID:        obj.ID + ":" + obj.Status,
+		Type:      EventRefunded,
+		IntentID:  obj.PaymentIntent,
+		PaymentID: obj.Metadata["payment_id"],
+		Amount:    fromMinor(obj.Amount),
+		RefundID:  obj.ID,
+		Reason:    obj.Metadata["reason"],
+		ActorID:   obj.Metadata["actor_id"],
+	}
+}
+
+// VerifyWebhook checks the Stripe-Signature header (HMAC-SHA256 of "timestamp.body") and
+// maps the event to a PaymentEvent. Events this service doesn't act on return nil.
+func (p *StripeProvider) VerifyWebhook(payload []byte, header http.Header) (*PaymentEvent, error) {
+	var timestamp string
+	var signatures [][]byte
+	for _, part := range strings.Split(header.Get("Stripe-Signature"), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			if sig, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return nil, fmt.Errorf("invalid webhook signature")
+	}
+	if age := p.now().Sub(time.Unix(ts, 0)); age > webhookTolerance || age < -webhookTolerance {
+		return nil, fmt.Errorf("webhook timestamp outside the tolerance window")
+	}
+	expected := hmacSHA256([]byte(p.WebhookSecret), []byte(timestamp+"."+string(payload)))
+	valid := false
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			valid = true
+		}
+	}
+	if !valid {
+		return nil, fmt.Errorf("invalid webhook signature")
+	}
+
+	var envelope struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Object stripeObject `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+
+	obj := &envelope.Data.Object
+	var event *PaymentEvent
+	switch envelope.Type {
+	case "payment_intent.amount_capturable_updated", "payment_intent.succeeded", "payment_intent.canceled":
+		event = intentEvent(obj)
+	case "payment_intent.payment_failed":
+		event = &PaymentEvent{Type: EventFailed, IntentID: obj.ID, PaymentID: obj.Metadata["payment_id"]}
+	case "refund.created", "refund.updated":
+		event = refundEvent(obj)
+	}
+	if event != nil {
+		event.ID = envelope.ID
+	}
+	return event, nil
+}
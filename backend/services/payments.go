@@ -0,0 +1,385 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Types of events a payment provider reports; they are the only thing that moves a
+// payment from one status to another
+const (
+	EventAuthorized = "authorized"
+	EventCaptured   = "captured"
+	EventFailed     = "failed"
+	EventVoided     = "voided"
+	EventRefunded   = "refunded"
+)
+
+// ProviderInStore records payments taken at the counter (cash, UPI, wallet), which never
+// go through a gateway
+const ProviderInStore = "in_store"
+
+var (
+	// ErrAmountMismatch is returned when a client-supplied amount differs from what is owed
+	ErrAmountMismatch = errors.New("amount does not match the amount due")
+	// ErrUnknownPayment is returned for provider events about intents this app didn't open
+	ErrUnknownPayment = errors.New("no payment for this intent")
+)
+
+// PaymentEvent is something that happened to a payment at the provider, reported either
+// in the response to a call or through a verified webhook
+type PaymentEvent struct {
+	ID        string  `json:"id"` // provider event id, used to drop duplicates
+	Type      string  `json:"type"`
+	IntentID  string  `json:"intent_id"`
+	PaymentID string  `json:"payment_id,omitempty"` // our payments.id, when the provider echoes it
+	Amount    float64 `json:"amount"`
+	RefundID  string  `json:"refund_id,omitempty"`
+	// Echoed back on refunds issued through RefundPayment
+	Reason  string `json:"reason,omitempty"`
+	ActorID string `json:"actor_id,omitempty"`
+}
+
+// AuthorizeRequest asks the provider to hold an amount for a payment. A request with a
+// DepositID is for a booking deposit, which is captured as soon as the customer confirms it.
+type AuthorizeRequest struct {
+	PaymentID   string
+	Amount      float64
+	Currency    string
+	Description string
+	DepositID   string
+}
+
+// PaymentIntent is the provider-side record of a payment. ClientSecret lets the customer's
+// browser confirm it; Event is set when the provider already authorized it.
+type PaymentIntent struct {
+	ID           string
+	ClientSecret string
+	Event        *PaymentEvent
+}
+
+// PaymentProvider is a payment gateway. Calls return the event the provider reports
+// synchronously, if any; anything else arrives later through VerifyWebhook.
+type PaymentProvider interface {
+	Name() string
+	Authorize(ctx context.Context, req AuthorizeRequest) (*PaymentIntent, error)
+	Capture(ctx context.Context, intentID string, amount float64) (*PaymentEvent, error)
+	Void(ctx context.Context, intentID string) (*PaymentEvent, error)
+	Refund(ctx context.Context, req RefundRequest) (*PaymentEvent, error)
+	VerifyWebhook(payload []byte, header http.Header) (*PaymentEvent, error)
+}
+
+// PaymentService keeps payments in step with the provider
+type PaymentService struct {
+	DB       *pgxpool.Pool
+	Provider PaymentProvider
+	Currency string
+}
+
+func NewPaymentService(db *pgxpool.Pool, provider PaymentProvider, currency string) *PaymentService {
+	return &PaymentService{DB: db, Provider: provider, Currency: currency}
+}
+
+// paymentRow is what the service needs to know about a payment to drive the provider
+type paymentRow struct {
+	ID       string
+	Total    float64
+	Method   string
+	Status   string
+	Provider string
+	IntentID string
+	Deposit  float64 // deposit applied to Total
+	// Held on the card, and the card tender of a checkout (0 without one)
+	Authorized float64
+	Card       float64
+}
+
+// balance is what is left to collect once the deposit is counted
+func (p *paymentRow) balance() float64 {
+	return roundCents(p.Total - p.Deposit)
+}
+
+func (s *PaymentService) loadByAppointment(ctx context.Context, apptID string) (*paymentRow, error) {
+	var p paymentRow
+	err := s.DB.QueryRow(ctx,
+		`SELECT id, total, method, status, COALESCE(provider, ''), COALESCE(provider_intent_id, ''), deposit_applied,
+		 COALESCE(authorized_amount, 0), `+cardTenderSQL+`
+		 FROM payments WHERE appointment_id = $1
+		 ORDER BY created_at DESC LIMIT 1`, apptID,
+	).Scan(&p.ID, &p.Total, &p.Method, &p.Status, &p.Provider, &p.IntentID, &p.Deposit, &p.Authorized, &p.Card)
+	if err != nil {
+		return nil, fmt.Errorf("payment not found")
+	}
+	return &p, nil
+}
+
+// Authorize opens a provider intent for a pending payment so the customer can pay. It
+// returns the client secret for the customer's browser.
+func (s *PaymentService) Authorize(ctx context.Context, paymentID, description string) (string, error) {
+	return s.authorize(ctx, paymentID, 0, description)
+}
+
+// authorize opens the intent for amount, or for the payment's total when amount is 0
+func (s *PaymentService) authorize(ctx context.Context, paymentID string, amount float64, description string) (string, error) {
+	var total float64
+	var status, intentID string
+	err := s.DB.QueryRow(ctx,
+		"SELECT total, status, COALESCE(provider_intent_id, '') FROM payments WHERE id = $1",
+		paymentID).Scan(&total, &status, &intentID)
+	if err != nil {
+		return "", fmt.Errorf("payment not found")
+	}
+	if status != "pending" || intentID != "" {
+		return "", fmt.Errorf("payment is already %s", status)
+	}
+	if amount == 0 {
+		amount = total
+	}
+	if amount <= 0 {
+		return "", nil
+	}
+
+	intent, err := s.Provider.Authorize(ctx, AuthorizeRequest{
+		PaymentID:   paymentID,
+		Amount:      amount,
+		Currency:    s.Currency,
+		Description: description,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to authorize payment: %w", err)
+	}
+	_, err = s.DB.Exec(ctx,
+		`UPDATE payments SET provider = $1, provider_intent_id = $2,
+		 method = CASE WHEN method = 'split' THEN method ELSE 'card' END, updated_at = NOW()
+		 WHERE id = $3`, s.Provider.Name(), intent.ID, paymentID)
+	if err != nil {
+		return "", fmt.Errorf("failed to record payment intent: %w", err)
+	}
+	if intent.Event != nil {
+		if err := s.ApplyEvent(ctx, s.Provider.Name(), intent.Event); err != nil {
+			return "", err
+		}
+	}
+	return intent.ClientSecret, nil
+}
+
+// Capture collects an authorized card payment, less any deposit applied to it, or just the
+// card tender of a checkout. Payments that are not authorized are left alone.
+func (s *PaymentService) Capture(ctx context.Context, apptID string) error {
+	p, err := s.loadByAppointment(ctx, apptID)
+	if err != nil || p.Status != "authorized" {
+		return nil
+	}
+	amount := p.balance()
+	if p.Card > 0 {
+		amount = p.Card
+	}
+	event, err := s.Provider.Capture(ctx, p.IntentID, amount)
+	if err != nil {
+		return fmt.Errorf("failed to capture payment: %w", err)
+	}
+	return s.ApplyEvent(ctx, p.Provider, event)
+}
+
+// CancelPayment settles the payment of a cancelled appointment: an open authorization is
+// voided and whatever was already collected is refunded through the ledger. A payment that
+// was never collected is never marked refunded. A deposit is voided or refunded in full.
+func (s *PaymentService) CancelPayment(ctx context.Context, apptID, actorID string) error {
+	if err := s.releaseDeposit(ctx, apptID, actorID); err != nil {
+		return err
+	}
+	p, err := s.loadByAppointment(ctx, apptID)
+	if err != nil {
+		return nil
+	}
+
+	var event *PaymentEvent
+	provider := p.Provider
+	switch p.Status {
+	case "completed", "partially_refunded":
+		_, err = s.RefundPayment(ctx, p.ID, 0, "Appointment cancelled", actorID)
+		return err
+	case "pending", "authorized":
+		if p.IntentID != "" {
+			event, err = s.Provider.Void(ctx, p.IntentID)
+		} else {
+			provider = ProviderInStore
+			event = inStoreEvent(EventVoided, p.ID, 0)
+		}
+	default:
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to cancel payment: %w", err)
+	}
+	return s.ApplyEvent(ctx, provider, event)
+}
+
+// CancelPayments settles the payments of several cancelled appointments, logging failures
+func (s *PaymentService) CancelPayments(ctx context.Context, apptIDs []string, actorID string) {
+	for _, id := range apptIDs {
+		if err := s.CancelPayment(ctx, id, actorID); err != nil {
+			log.Printf("⚠️  Payment for appointment %s: %v", id, err)
+		}
+	}
+}
+
+// inStoreEvent builds the event for a payment step taken at the salon rather than a gateway
+func inStoreEvent(eventType, paymentID string, amount float64) *PaymentEvent {
+	return &PaymentEvent{ID: "in_store_" + randomID(), Type: eventType, PaymentID: paymentID, Amount: amount}
+}
+
+// randomID returns a random 16-byte hex id
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// nextStatus is the status an event moves a payment to, or "" when the event doesn't
+// apply to a payment in that status (late or out-of-order deliveries). Refunds are settled
+// against the refund ledger by applyRefund instead.
+func nextStatus(current, eventType string) string {
+	switch eventType {
+	case EventAuthorized:
+		if current == "pending" {
+			return "authorized"
+		}
+	case EventCaptured:
+		if current == "pending" || current == "authorized" {
+			return "completed"
+		}
+	case EventFailed:
+		if current == "pending" || current == "authorized" {
+			return "failed"
+		}
+	case EventVoided:
+		if current == "pending" || current == "authorized" {
+			return "voided"
+		}
+	}
+	return ""
+}
+
+// ApplyEvent records a provider event and moves the payment it belongs to on. Events are
+// stored once per provider event id, so webhook retries and events already seen in a call
+// response are no-ops.
+func (s *PaymentService) ApplyEvent(ctx context.Context, provider string, event *PaymentEvent) error {
+	if event == nil {
+		return nil
+	}
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Deposits have intents of their own, which also carry the payment id
+	deposit, err := lockDepositByIntent(ctx, tx, provider, event.IntentID)
+	if err != nil {
+		return err
+	}
+
+	var paymentID, status string
+	if deposit != nil {
+		err = tx.QueryRow(ctx, "SELECT id, status FROM payments WHERE id = $1 FOR UPDATE",
+			deposit.PaymentID).Scan(&paymentID, &status)
+	} else {
+		err = tx.QueryRow(ctx,
+			`SELECT id, status FROM payments
+			 WHERE (provider = $1 AND provider_intent_id = NULLIF($2, ''))
+			    OR id = NULLIF($3, '')::uuid
+			 LIMIT 1 FOR UPDATE`, provider, event.IntentID, event.PaymentID,
+		).Scan(&paymentID, &status)
+	}
+	if err == pgx.ErrNoRows {
+		return ErrUnknownPayment
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find payment: %w", err)
+	}
+
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO payment_events (payment_id, provider, event_id, type, intent_id, amount)
+		 VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)
+		 ON CONFLICT (provider, event_id) DO NOTHING`,
+		paymentID, provider, event.ID, event.Type, event.IntentID, event.Amount)
+	if err != nil {
+		return fmt.Errorf("failed to record payment event: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	// Refunds of an applied deposit are part of the payment's ledger; every other deposit
+	// event only moves the deposit on
+	released := false
+	if deposit != nil && !(event.Type == EventRefunded && deposit.Status == DepositApplied) {
+		if released, err = applyDepositEvent(ctx, tx, deposit, event); err != nil {
+			return err
+		}
+	} else if event.Type == EventRefunded {
+		if err := applyRefund(ctx, tx, paymentID, status, provider, event, deposit != nil); err != nil {
+			return err
+		}
+	} else if next := nextStatus(status, event.Type); next != "" {
+		// A payment checked out with tenders has collected what they add up to, less the tip
+		_, err = tx.Exec(ctx,
+			`UPDATE payments SET status = $1,
+			 authorized_amount = CASE WHEN $2 = 'authorized' THEN $3 ELSE authorized_amount END,
+			 captured_amount = CASE WHEN $2 = 'captured' THEN COALESCE(
+			     (SELECT SUM(t.amount) FROM payment_tenders t WHERE t.payment_id = payments.id) - tip, $3)
+			     ELSE captured_amount END,
+			 updated_at = NOW()
+			 WHERE id = $4`, next, event.Type, event.Amount, paymentID)
+		if err != nil {
+			return fmt.Errorf("failed to update payment: %w", err)
+		}
+		if next == "voided" || next == "failed" {
+			// Nothing was collected, so gift cards get back what the checkout took
+			if err := clearTenders(ctx, tx, paymentID); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	if released {
+		// Paid after the hold ran out: the booking is gone, so the deposit goes back
+		return s.CancelPayment(ctx, deposit.AppointmentID, "")
+	}
+	return nil
+}
+
+// webhookTolerance is how old a signed webhook may be before it is rejected as a replay
+const webhookTolerance = 5 * time.Minute
+
+// toMinor converts an amount to the currency's minor unit (cents)
+func toMinor(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// fromMinor converts an amount in minor units back to the currency's major unit
+func fromMinor(amount int64) float64 {
+	return float64(amount) / 100
+}
+
+// hmacSHA256 signs a webhook body the way both providers do
+func hmacSHA256(secret, payload []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNextStatus(t *testing.T) {
+	tests := []struct {
+		current, event, want string
+	}{
+		{"pending", EventAuthorized, "authorized"},
+		{"authorized", EventCaptured, "completed"},
+		{"pending", EventCaptured, "completed"},
+		{"authorized", EventVoided, "voided"},
+		{"authorized", EventFailed, "failed"},
+		// Late or out-of-order deliveries change nothing
+		{"completed", EventAuthorized, ""},
+		{"completed", EventVoided, ""},
+		{"voided", EventCaptured, ""},
+		{"completed", EventRefunded, ""}, // settled against the refund ledger
+	}
+	for _, tt := range tests {
+		if got := nextStatus(tt.current, tt.event); got != tt.want {
+			t.Errorf("nextStatus(%s, %s) = %q, want %q", tt.current, tt.event, got, tt.want)
+		}
+	}
+}
+
+func TestRefundStatus(t *testing.T) {
+	tests := []struct {
+		collected, refunded float64
+		want                string
+	}{
+		{50, 0, "completed"},
+		{50, 20, "partially_refunded"},
+		{50, 49.99, "partially_refunded"},
+		{50, 50, "refunded"},
+		{50, 49.999, "refunded"}, // rounding noise
+	}
+	for _, tt := range tests {
+		if got := refundStatus(tt.collected, tt.refunded); got != tt.want {
+			t.Errorf("refundStatus(%v, %v) = %q, want %q", tt.collected, tt.refunded, got, tt.want)
+		}
+	}
+}
+
+func TestFakeProvider(t *testing.T) {
+	ctx := context.Background()
+	f := NewFakeProvider("secret")
+
+	intent, err := f.Authorize(ctx, AuthorizeRequest{PaymentID: "pay-1", Amount: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if intent.Event == nil || intent.Event.Type != EventAuthorized || intent.Event.PaymentID != "pay-1" {
+		t.Fatalf("authorize event = %+v, want authorized for pay-1", intent.Event)
+	}
+	if _, err := f.Capture(ctx, intent.ID, 60); err == nil {
+		t.Error("captured more than was authorized")
+	}
+	event, err := f.Capture(ctx, intent.ID, 50)
+	if err != nil || event.Type != EventCaptured || event.Amount != 50 {
+		t.Fatalf("capture = %+v, %v", event, err)
+	}
+	if _, err := f.Void(ctx, intent.ID); err == nil {
+		t.Error("voided a captured intent")
+	}
+	refund, err := f.Refund(ctx, RefundRequest{IntentID: intent.ID, Amount: 30, Reason: "spill"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refund.RefundID == "" || refund.Reason != "spill" {
+		t.Errorf("refund event = %+v, want a refund id and the reason echoed", refund)
+	}
+	if _, err := f.Refund(ctx, RefundRequest{IntentID: intent.ID, Amount: 30}); err == nil {
+		t.Error("refunded more than was captured")
+	}
+
+	f.Decline = true
+	declined, _ := f.Authorize(ctx, AuthorizeRequest{PaymentID: "pay-2", Amount: 20})
+	if declined.Event.Type != EventFailed {
+		t.Errorf("declined authorize event = %s, want %s", declined.Event.Type, EventFailed)
+	}
+}
+
+func TestFakeProviderWebhook(t *testing.T) {
+	f := NewFakeProvider("secret")
+	payload := []byte(`{"id":"evt_1","type":"captured","intent_id":"pi_fake_1","amount":50}`)
+
+	header := http.Header{}
+	header.Set(FakeSignatureHeader, f.Sign(payload))
+	event, err := f.VerifyWebhook(payload, header)
+	if err != nil || event.ID != "evt_1" || event.Type != EventCaptured {
+		t.Fatalf("VerifyWebhook = %+v, %v", event, err)
+	}
+
+	header.Set(FakeSignatureHeader, NewFakeProvider("other").Sign(payload))
+	if _, err := f.VerifyWebhook(payload, header); err == nil {
+		t.Error("accepted a webhook signed with another secret")
+	}
+}
+
+func TestStripeVerifyWebhook(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	p := NewStripeProvider("sk_test", "whsec_test")
+	p.now = func() time.Time { return now }
+
+	payload := []byte(`{"id":"evt_1","type":"payment_intent.amount_capturable_updated",` +
+		`"data":{"object":{"id":"pi_1","status":"requires_capture","amount_capturable":4550,` +
+		`"metadata":{"payment_id":"pay-1"}}}}`)
+	sign := func(ts time.Time, body []byte) http.Header {
+		stamp := fmt.Sprint(ts.Unix())
+		h := http.Header{}
+		h.Set("Stripe-Signature", "t="+stamp+",v1="+hex.EncodeToString(hmacSHA256([]byte("whsec_test"), []byte(stamp+"."+string(body)))))
+		return h
+	}
+
+	event, err := p.VerifyWebhook(payload, sign(now, payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PaymentEvent{ID: "evt_1", Type: EventAuthorized, IntentID: "pi_1", PaymentID: "pay-1", Amount: 45.50}
+	if *event != want {
+		t.Errorf("event = %+v, want %+v", *event, want)
+	}
+
+	if _, err := p.VerifyWebhook(payload, sign(now.Add(-10*time.Minute), payload)); err == nil {
+		t.Error("accepted a webhook outside the tolerance window")
+	}
+	tampered := append([]byte{}, payload...)
+	tampered[len(tampered)-3] = 'X'
+	if _, err := p.VerifyWebhook(tampered, sign(now, payload)); err == nil {
+		t.Error("accepted a tampered body")
+	}
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 in points, and the margin text stays inside
+const (
+	pdfWidth  = 595.0
+	pdfHeight = 842.0
+	pdfMargin = 50.0
+)
+
+// Fonts every PDF reader has built in; Courier is monospaced, which lets amounts be
+// right-aligned without font metrics
+const (
+	pdfRegular = "F1"
+	pdfBold    = "F2"
+	pdfMono    = "F3"
+)
+
+// pdfDoc is a minimal text-only PDF writer: lines of text laid out top to bottom, with a
+// new page whenever one is full
+type pdfDoc struct {
+	pages []*bytes.Buffer
+	y     float64 // baseline of the next line on the current page
+}
+
+func newPDFDoc() *pdfDoc {
+	d := &pdfDoc{}
+	d.newPage()
+	return d
+}
+
+func (d *pdfDoc) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pdfHeight - pdfMargin
+}
+
+// space moves down by points, starting a new page when there is no room left
+func (d *pdfDoc) space(points float64) {
+	d.y -= points
+	if d.y < pdfMargin {
+		d.newPage()
+	}
+}
+
+// text writes s at x on the current line
+func (d *pdfDoc) text(x float64, font string, size float64, s string) {
+	fmt.Fprintf(d.pages[len(d.pages)-1], "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n",
+		font, size, x, d.y, pdfEscape(s))
+}
+
+// textRight writes s in the monospaced font so that it ends at x
+func (d *pdfDoc) textRight(x, size float64, s string) {
+	d.text(x-float64(len([]rune(s)))*size*0.6, pdfMono, size, s)
+}
+
+// rule draws a horizontal line across the page just above the current line
+func (d *pdfDoc) rule() {
+	fmt.Fprintf(d.pages[len(d.pages)-1], "0.5 w %.2f %.2f m %.2f %.2f l S\n",
+		pdfMargin, d.y+12, pdfWidth-pdfMargin, d.y+12)
+}
+
+// pdfEscape makes s a PDF string literal body. The built-in fonts use WinAnsiEncoding,
+// which covers Latin-1; anything else is printed as '?'.
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n' || r == '\r' || r == '\t':
+			b.WriteByte(' ')
+		case r < 32 || r > 255:
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+	return b.String()
+}
+
+// bytes assembles the document: catalog, page tree, fonts, then a page and its content
+// stream per page, followed by the cross-reference table
+func (d *pdfDoc) bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+	const firstPage = 6
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	for _, font := range []string{"Helvetica", "Helvetica-Bold", "Courier"} {
+		object("<< /Type /Font /Subtype /Type1 /BaseFont /" + font + " /Encoding /WinAnsiEncoding >>")
+	}
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R /F3 5 0 R >> >> /Contents %d 0 R >>",
+			pdfWidth, pdfHeight, firstPage+2*i+1))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
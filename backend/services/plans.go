@@ -0,0 +1,469 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"saloon-backend/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Kinds of prepaid plans
+const (
+	PlanPackage    = "package"
+	PlanMembership = "membership"
+)
+
+var (
+	// ErrPlanUnusable is returned when a customer's plan can't pay for a booking
+	ErrPlanUnusable = errors.New("plan cannot be used for this booking")
+	// ErrPlanNotFound is returned for a plan that isn't the salon's
+	ErrPlanNotFound = errors.New("plan not found")
+	// ErrPlanServices is returned when a plan names services the salon doesn't offer
+	ErrPlanServices = errors.New("service_ids must be distinct services of this salon")
+)
+
+// civilDate is the calendar day of t in its location, as midnight UTC
+func civilDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// addMonths moves a day n months on, keeping to the last day of shorter months
+// (Jan 31 + 1 month is Feb 28)
+func addMonths(day time.Time, n int) time.Time {
+	first := time.Date(day.Year(), day.Month()+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(day.Day(), last)-1)
+}
+
+// planPeriodStart is the first day of the period of a plan started on start that day falls
+// in. A membership's credits renew every month from its start; a package has one period.
+func planPeriodStart(kind string, start, day time.Time) time.Time {
+	start, day = civilDate(start), civilDate(day)
+	if kind != PlanMembership || !day.After(start) {
+		return start
+	}
+	months := (day.Year()-start.Year())*12 + int(day.Month()-start.Month())
+	period := addMonths(start, months)
+	if period.After(day) {
+		period = addMonths(start, months-1)
+	}
+	return period
+}
+
+// coverLines picks the lines of a booking a plan pays for: those of its services, one
+// credit each while remaining lasts (-1 for unlimited)
+func coverLines(lines []serviceLine, services map[string]bool, remaining int) []bool {
+	covered := make([]bool, len(lines))
+	for i, l := range lines {
+		if remaining == 0 {
+			break
+		}
+		if services[l.ID] {
+			covered[i] = true
+			if remaining > 0 {
+				remaining--
+			}
+		}
+	}
+	return covered
+}
+
+// creditsLeft is what is left of credits (nil for unlimited) after used, nil when unlimited
+func creditsLeft(credits *int, used int) *int {
+	if credits == nil {
+		return nil
+	}
+	left := max(*credits-used, 0)
+	return &left
+}
+
+// restoresCredit tells whether a policy gives plan credits back on event. A cancellation
+// in time always does; refunds never do, the credit was used.
+func restoresCredit(p models.CancellationPolicy, event string) bool {
+	switch event {
+	case PromoOnCancel:
+		return true
+	case PromoOnLateCancel:
+		return p.RestoreCreditOnLateCancel
+	case PromoOnNoShow:
+		return p.RestoreCreditOnNoShow
+	}
+	return false
+}
+
+// planCover is what a customer's plan pays for in a booking
+type planCover struct {
+	customerPlanID string
+	periodStart    time.Time
+	covered        []bool
+}
+
+// claimPlanCredits works out which lines of a booking at apptTime the customer's plan pays
+// for, with the plan locked so two bookings can't spend the same credit
+func claimPlanCredits(ctx context.Context, tx pgx.Tx, customerID, salonID, customerPlanID string, lines []serviceLine, apptTime time.Time) (*planCover, error) {
+	var planID, kind, status string
+	var credits *int
+	var startsAt time.Time
+	var expiresAt *time.Time
+	err := tx.QueryRow(ctx,
+		`SELECT plan_id, kind, credits, status, starts_at, expires_at FROM customer_plans
+		 WHERE id = $1 AND user_id = $2 AND salon_id = $3
+		 FOR UPDATE`, customerPlanID, customerID, salonID,
+	).Scan(&planID, &kind, &credits, &status, &startsAt, &expiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: no such plan at this salon", ErrPlanUnusable)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch plan: %w", err)
+	}
+	switch {
+	case status != "active":
+		return nil, fmt.Errorf("%w: it is %s", ErrPlanUnusable, status)
+	case expiresAt != nil && !apptTime.Before(*expiresAt):
+		return nil, fmt.Errorf("%w: it expires before the appointment", ErrPlanUnusable)
+	}
+
+	loc := apptTime.Location()
+	period := planPeriodStart(kind, startsAt.In(loc), apptTime)
+	remaining := -1
+	if credits != nil {
+		var used int
+		err := tx.QueryRow(ctx,
+			`SELECT COUNT(*) FROM plan_credit_uses
+			 WHERE customer_plan_id = $1 AND status = 'used' AND ($2 = 'package' OR period_start = $3)`,
+			customerPlanID, kind, period).Scan(&used)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count plan credits: %w", err)
+		}
+		if remaining = *credits - used; remaining <= 0 {
+			return nil, fmt.Errorf("%w: no credits left", ErrPlanUnusable)
+		}
+	}
+
+	rows, err := tx.Query(ctx, "SELECT service_id FROM prepaid_plan_services WHERE plan_id = $1", planID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch plan services: %w", err)
+	}
+	services := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to fetch plan services: %w", err)
+		}
+		services[id] = true
+	}
+	rows.Close()
+
+	cover := &planCover{customerPlanID: customerPlanID, periodStart: period, covered: coverLines(lines, services, remaining)}
+	for _, c := range cover.covered {
+		if c {
+			return cover, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: it doesn't cover these services", ErrPlanUnusable)
+}
+
+// apply returns the lines with the ones the plan pays for at no charge
+func (c *planCover) apply(lines []serviceLine) []serviceLine {
+	out := make([]serviceLine, len(lines))
+	for i, l := range lines {
+		if c.covered[i] {
+			l.Price = 0
+		}
+		out[i] = l
+	}
+	return out
+}
+
+// useCredits records a credit for each appointment service the plan pays for
+func (c *planCover) useCredits(ctx context.Context, tx pgx.Tx, apptID string, items []models.AppointmentService) error {
+	for i, item := range items {
+		if !c.covered[i] {
+			continue
+		}
+		_, err := tx.Exec(ctx,
+			`INSERT INTO plan_credit_uses (customer_plan_id, appointment_id, appointment_service_id, period_start)
+			 VALUES ($1, $2, $3, $4)`, c.customerPlanID, apptID, item.ID, c.periodStart)
+		if err != nil {
+			return fmt.Errorf("failed to use plan credit: %w", err)
+		}
+	}
+	return nil
+}
+
+// memberDiscountPercent is the best member discount of the customer's memberships at the
+// salon that are good at apptTime, 0 without one
+func memberDiscountPercent(ctx context.Context, q querier, customerID, salonID string, apptTime time.Time) (float64, error) {
+	var percent float64
+	err := q.QueryRow(ctx,
+		`SELECT COALESCE(MAX(member_discount_percent), 0) FROM customer_plans
+		 WHERE user_id = $1 AND salon_id = $2 AND kind = 'membership' AND status = 'active'
+		   AND starts_at <= NOW() AND (expires_at IS NULL OR expires_at > $3)`,
+		customerID, salonID, apptTime).Scan(&percent)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch membership: %w", err)
+	}
+	return percent, nil
+}
+
+// restoreCredits gives back the plan credits of an appointment that fell through when the
+// salon's policy restores them on event
+func restoreCredits(ctx context.Context, tx pgx.Tx, apptID, event string) error {
+	var salonID string
+	err := tx.QueryRow(ctx, "SELECT salon_id FROM appointments WHERE id = $1", apptID).Scan(&salonID)
+	if err != nil {
+		return fmt.Errorf("appointment not found")
+	}
+	policy, err := LoadCancellationPolicy(ctx, tx, salonID)
+	if err != nil {
+		return err
+	}
+	if !restoresCredit(policy, event) {
+		return nil
+	}
+	_, err = tx.Exec(ctx,
+		`UPDATE plan_credit_uses SET status = 'restored', restored_at = NOW()
+		 WHERE appointment_id = $1 AND status = 'used'`, apptID)
+	if err != nil {
+		return fmt.Errorf("failed to restore plan credits: %w", err)
+	}
+	return nil
+}
+
+// appointmentCredits counts the plan credits an appointment uses
+func appointmentCredits(ctx context.Context, q querier, apptID string) (int, error) {
+	var n int
+	err := q.QueryRow(ctx,
+		"SELECT COUNT(*) FROM plan_credit_uses WHERE appointment_id = $1 AND status = 'used'", apptID).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count plan credits: %w", err)
+	}
+	return n, nil
+}
+
+type PlanService struct {
+	DB *pgxpool.Pool
+}
+
+func NewPlanService(db *pgxpool.Pool) *PlanService {
+	return &PlanService{DB: db}
+}
+
+// planColumns are the prepaid_plans columns scanned by scanPlan
+const planColumns = `pp.id, pp.salon_id, pp.kind, pp.name, COALESCE(pp.description, ''), pp.price, pp.credits,
+	pp.validity_days, pp.member_discount_percent,
+	ARRAY(SELECT ps.service_id::text FROM prepaid_plan_services ps WHERE ps.plan_id = pp.id),
+	pp.is_active, pp.created_at`
+
+func scanPlan(row pgx.Row, p *models.PrepaidPlan) error {
+	return row.Scan(&p.ID, &p.SalonID, &p.Kind, &p.Name, &p.Description, &p.Price, &p.Credits,
+		&p.ValidityDays, &p.MemberDiscountPercent, &p.ServiceIDs, &p.IsActive, &p.CreatedAt)
+}
+
+// ListPlans returns the packages and memberships of a salon, only those on sale when
+// activeOnly is set
+func (s *PlanService) ListPlans(ctx context.Context, salonID string, activeOnly bool) ([]models.PrepaidPlan, error) {
+	rows, err := s.DB.Query(ctx,
+		`SELECT `+planColumns+` FROM prepaid_plans pp
+		 WHERE pp.salon_id = $1 AND (pp.is_active OR NOT $2)
+		 ORDER BY pp.kind, pp.price`, salonID, activeOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch plans: %w", err)
+	}
+	defer rows.Close()
+	plans := []models.PrepaidPlan{}
+	for rows.Next() {
+		var p models.PrepaidPlan
+		if err := scanPlan(rows, &p); err != nil {
+			return nil, fmt.Errorf("failed to fetch plans: %w", err)
+		}
+		plans = append(plans, p)
+	}
+	return plans, nil
+}
+
+// SavePlan creates a salon's plan, or updates it when planID is set. Plans already sold
+// keep the credits and discount they were sold with.
+func (s *PlanService) SavePlan(ctx context.Context, salonID, planID string, req models.PrepaidPlanRequest) (*models.PrepaidPlan, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	active := req.IsActive == nil || *req.IsActive
+	if planID == "" {
+		err = tx.QueryRow(ctx,
+			`INSERT INTO prepaid_plans (salon_id, kind, name, description, price, credits, validity_days,
+			 member_discount_percent, is_active)
+			 VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9)
+			 RETURNING id`,
+			salonID, req.Kind, req.Name, req.Description, req.Price, req.Credits, req.ValidityDays,
+			req.MemberDiscountPercent, active).Scan(&planID)
+	} else {
+		err = tx.QueryRow(ctx,
+			`UPDATE prepaid_plans SET kind = $3, name = $4, description = NULLIF($5, ''), price = $6, credits = $7,
+			 validity_days = $8, member_discount_percent = $9, is_active = $10, updated_at = NOW()
+			 WHERE id = $1 AND salon_id = $2
+			 RETURNING id`,
+			planID, salonID, req.Kind, req.Name, req.Description, req.Price, req.Credits, req.ValidityDays,
+			req.MemberDiscountPercent, active).Scan(&planID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrPlanNotFound
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save plan: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM prepaid_plan_services WHERE plan_id = $1", planID); err != nil {
+		return nil, fmt.Errorf("failed to save plan services: %w", err)
+	}
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO prepaid_plan_services (plan_id, service_id)
+		 SELECT $1, id FROM services WHERE id = ANY($2) AND salon_id = $3`,
+		planID, req.ServiceIDs, salonID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save plan services: %w", err)
+	}
+	if int(tag.RowsAffected()) != len(req.ServiceIDs) {
+		return nil, ErrPlanServices
+	}
+
+	var plan models.PrepaidPlan
+	if err := scanPlan(tx.QueryRow(ctx, `SELECT `+planColumns+` FROM prepaid_plans pp WHERE pp.id = $1`, planID), &plan); err != nil {
+		return nil, fmt.Errorf("failed to fetch plan: %w", err)
+	}
+	return &plan, tx.Commit(ctx)
+}
+
+// Sell gives a customer one of the salon's plans, paid at the counter. Its credits and
+// member discount are copied from the plan and it can be used from now until its validity
+// runs out.
+func (s *PlanService) Sell(ctx context.Context, salonID, planID, customerID string, pricePaid *float64, actorID string) (*models.CustomerPlan, error) {
+	var id string
+	err := s.DB.QueryRow(ctx,
+		`INSERT INTO customer_plans (user_id, salon_id, plan_id, kind, name, credits, member_discount_percent,
+		 price_paid, expires_at, sold_by)
+		 SELECT $1, pp.salon_id, pp.id, pp.kind, pp.name, pp.credits, pp.member_discount_percent,
+		        COALESCE($4, pp.price), NOW() + pp.validity_days * INTERVAL '1 day', NULLIF($5, '')::uuid
+		 FROM prepaid_plans pp
+		 WHERE pp.id = $2 AND pp.salon_id = $3 AND pp.is_active
+		 RETURNING id`, customerID, planID, salonID, pricePaid, actorID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPlanNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to sell plan: %w", err)
+	}
+	plans, err := s.Holdings(ctx, HoldingsFilter{SalonID: salonID, CustomerPlanID: id})
+	if err != nil || len(plans) == 0 {
+		return nil, fmt.Errorf("failed to fetch plan: %w", err)
+	}
+	return &plans[0], nil
+}
+
+// CancelHolding ends a customer's plan early; bookings it already paid for keep their
+// credits
+func (s *PlanService) CancelHolding(ctx context.Context, salonID, customerPlanID string) error {
+	tag, err := s.DB.Exec(ctx,
+		`UPDATE customer_plans SET status = 'cancelled', cancelled_at = NOW()
+		 WHERE id = $1 AND salon_id = $2 AND status = 'active'`, customerPlanID, salonID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel plan: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPlanNotFound
+	}
+	return nil
+}
+
+// HoldingsFilter selects customer plans; empty fields match everything
+type HoldingsFilter struct {
+	SalonID        string
+	UserID         string
+	PlanID         string
+	CustomerPlanID string
+	ActiveOnly     bool
+}
+
+// Holdings returns customer plans, newest first, with the credits they have left today in
+// the salon's timezone
+func (s *PlanService) Holdings(ctx context.Context, f HoldingsFilter) ([]models.CustomerPlan, error) {
+	rows, err := s.DB.Query(ctx,
+		`SELECT cp.id, cp.user_id, cp.salon_id, cp.plan_id, cp.kind, cp.name, cp.credits, cp.member_discount_percent,
+		 cp.price_paid, cp.starts_at, cp.expires_at,
+		 CASE WHEN cp.status = 'active' AND cp.expires_at <= NOW() THEN 'expired' ELSE cp.status END,
+		 cp.created_at, ARRAY(SELECT ps.service_id::text FROM prepaid_plan_services ps WHERE ps.plan_id = cp.plan_id),
+		 u.name, u.email, s.timezone
+		 FROM customer_plans cp
+		 JOIN users u ON u.id = cp.user_id
+		 JOIN salons s ON s.id = cp.salon_id
+		 WHERE ($1 = '' OR cp.salon_id::text = $1) AND ($2 = '' OR cp.user_id::text = $2)
+		   AND ($3 = '' OR cp.plan_id::text = $3) AND ($4 = '' OR cp.id::text = $4)
+		   AND (NOT $5 OR (cp.status = 'active' AND (cp.expires_at IS NULL OR cp.expires_at > NOW())))
+		 ORDER BY cp.created_at DESC`,
+		f.SalonID, f.UserID, f.PlanID, f.CustomerPlanID, f.ActiveOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch plans: %w", err)
+	}
+	plans := []models.CustomerPlan{}
+	var ids []string
+	for rows.Next() {
+		var p models.CustomerPlan
+		var timezone string
+		err := rows.Scan(&p.ID, &p.UserID, &p.SalonID, &p.PlanID, &p.Kind, &p.Name, &p.Credits,
+			&p.MemberDiscountPercent, &p.PricePaid, &p.StartsAt, &p.ExpiresAt, &p.Status, &p.CreatedAt,
+			&p.ServiceIDs, &p.CustomerName, &p.CustomerEmail, &timezone)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to fetch plans: %w", err)
+		}
+		loc := SalonLocation(timezone)
+		p.PeriodStart = planPeriodStart(p.Kind, p.StartsAt.In(loc), time.Now().In(loc)).Format("2006-01-02")
+		plans = append(plans, p)
+		ids = append(ids, p.ID)
+	}
+	rows.Close()
+	if len(plans) == 0 {
+		return plans, nil
+	}
+
+	// Credits used per plan and period
+	rows, err = s.DB.Query(ctx,
+		`SELECT customer_plan_id, period_start::text, COUNT(*) FROM plan_credit_uses
+		 WHERE customer_plan_id = ANY($1) AND status = 'used'
+		 GROUP BY customer_plan_id, period_start`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count plan credits: %w", err)
+	}
+	defer rows.Close()
+	type periodKey struct{ id, period string }
+	used := map[periodKey]int{}
+	total := map[string]int{}
+	for rows.Next() {
+		var k periodKey
+		var n int
+		if err := rows.Scan(&k.id, &k.period, &n); err != nil {
+			return nil, fmt.Errorf("failed to count plan credits: %w", err)
+		}
+		used[k] += n
+		total[k.id] += n
+	}
+	for i := range plans {
+		p := &plans[i]
+		if p.Kind == PlanMembership {
+			p.CreditsUsed = used[periodKey{p.ID, p.PeriodStart}]
+		} else {
+			p.CreditsUsed = total[p.ID]
+		}
+		p.CreditsRemaining = creditsLeft(p.Credits, p.CreditsUsed)
+	}
+	return plans, nil
+}
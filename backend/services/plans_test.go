@@ -0,0 +1,90 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"saloon-backend/models"
+)
+
+func TestPlanPeriodStart(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	tests := []struct {
+		name       string
+		kind       string
+		start, day string
+		want       string
+	}{
+		{name: "first month", kind: PlanMembership, start: "2026-03-10", day: "2026-03-25", want: "2026-03-10"},
+		{name: "on the renewal day", kind: PlanMembership, start: "2026-03-10", day: "2026-04-10", want: "2026-04-10"},
+		{name: "day before renewal", kind: PlanMembership, start: "2026-03-10", day: "2026-04-09", want: "2026-03-10"},
+		{name: "across a year", kind: PlanMembership, start: "2025-11-15", day: "2026-02-01", want: "2026-01-15"},
+		{name: "month end clamps", kind: PlanMembership, start: "2026-01-31", day: "2026-02-28", want: "2026-02-28"},
+		{name: "back to the 31st", kind: PlanMembership, start: "2026-01-31", day: "2026-03-31", want: "2026-03-31"},
+		{name: "before the start", kind: PlanMembership, start: "2026-03-10", day: "2026-03-01", want: "2026-03-10"},
+		{name: "package has one period", kind: PlanPackage, start: "2026-03-10", day: "2026-09-20", want: "2026-03-10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := planPeriodStart(tt.kind, day(tt.start), day(tt.day)).Format("2006-01-02")
+			if got != tt.want {
+				t.Errorf("planPeriodStart(%s, %s) = %s, want %s", tt.start, tt.day, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoverLines(t *testing.T) {
+	lines := []serviceLine{{ID: "blowdry"}, {ID: "trim"}, {ID: "blowdry"}}
+	tests := []struct {
+		name      string
+		services  map[string]bool
+		remaining int
+		want      []bool
+	}{
+		{name: "covered services", services: map[string]bool{"blowdry": true}, remaining: 5, want: []bool{true, false, true}},
+		{name: "runs out", services: map[string]bool{"blowdry": true, "trim": true}, remaining: 2, want: []bool{true, true, false}},
+		{name: "unlimited", services: map[string]bool{"blowdry": true, "trim": true}, remaining: -1, want: []bool{true, true, true}},
+		{name: "nothing covered", services: map[string]bool{"color": true}, remaining: 5, want: []bool{false, false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := coverLines(lines, tt.services, tt.remaining)
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("coverLines = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRestoresCredit(t *testing.T) {
+	strict := DefaultCancellationPolicy()
+	lenient := strict
+	lenient.RestoreCreditOnLateCancel, lenient.RestoreCreditOnNoShow = true, true
+
+	tests := []struct {
+		name   string
+		policy models.CancellationPolicy
+		event  string
+		want   bool
+	}{
+		{name: "cancelled in time", policy: strict, event: PromoOnCancel, want: true},
+		{name: "cancelled late", policy: strict, event: PromoOnLateCancel},
+		{name: "missed", policy: strict, event: PromoOnNoShow},
+		{name: "cancelled late, lenient", policy: lenient, event: PromoOnLateCancel, want: true},
+		{name: "missed, lenient", policy: lenient, event: PromoOnNoShow, want: true},
+		{name: "refunded", policy: lenient, event: PromoOnRefund},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := restoresCredit(tt.policy, tt.event); got != tt.want {
+				t.Errorf("restoresCredit(%s) = %v, want %v", tt.event, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"saloon-backend/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TaxRate is one named rate of a salon. A rate with a Category applies only to services of
+// that category; a category that has rates of its own ignores the salon-wide ones.
+type TaxRate struct {
+	Name        string
+	RatePercent float64
+	Category    string
+}
+
+// TaxConfig is how a salon taxes its services
+type TaxConfig struct {
+	PricesIncludeTax bool
+	Rates            []TaxRate
+}
+
+// PriceLine is one priced service of a payment
+type PriceLine struct {
+	Category string
+	Price    float64
+}
+
+// Price is the breakdown stored on a payments row
+type Price struct {
+	Amount   float64 // sum of the listed service prices
+	Discount float64
+	Tax      float64
+	Total    float64 // what the customer pays
+	Taxes    []models.PaymentTax
+	// Inclusive is set when Tax is contained in Amount rather than added to it
+	Inclusive bool
+}
+
+// ratesFor returns the rates a service category is taxed at
+func (c TaxConfig) ratesFor(category string) []TaxRate {
+	var own, general []TaxRate
+	for _, r := range c.Rates {
+		switch {
+		case r.Category == "":
+			general = append(general, r)
+		case strings.EqualFold(r.Category, category):
+			own = append(own, r)
+		}
+	}
+	if own != nil {
+		return own
+	}
+	return general
+}
+
+// roundCents rounds an amount to whole cents
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// PriceLines computes amount, discount, tax and total for a set of services. The discount
+// is spread over the services in proportion to their price and tax is charged on what is
+// left. With inclusive pricing the listed prices already contain the tax: the total is
+// the discounted price and the tax is the part of it that goes to the tax authority.
+func PriceLines(cfg TaxConfig, lines []PriceLine, discount float64) Price {
+	p := Price{Inclusive: cfg.PricesIncludeTax}
+	for _, l := range lines {
+		p.Amount += l.Price
+	}
+	p.Amount = roundCents(p.Amount)
+	p.Discount = roundCents(math.Min(math.Max(discount, 0), p.Amount))
+
+	// Tax per rate name, in the order rates first appear
+	byName := make(map[string]int)
+	for _, l := range lines {
+		base := l.Price
+		if p.Amount > 0 {
+			base -= p.Discount * l.Price / p.Amount
+		}
+		rates := cfg.ratesFor(l.Category)
+		if cfg.PricesIncludeTax {
+			combined := 0.0
+			for _, r := range rates {
+				combined += r.RatePercent
+			}
+			base /= 1 + combined/100
+		}
+		for _, r := range rates {
+			i, ok := byName[r.Name]
+			if !ok {
+				i = len(p.Taxes)
+				byName[r.Name] = i
+				p.Taxes = append(p.Taxes, models.PaymentTax{Name: r.Name, RatePercent: r.RatePercent})
+			}
+			t := &p.Taxes[i]
+			t.TaxableAmount += base
+			t.Amount += base * r.RatePercent / 100
+		}
+	}
+	for i := range p.Taxes {
+		p.Taxes[i].TaxableAmount = roundCents(p.Taxes[i].TaxableAmount)
+		p.Taxes[i].Amount = roundCents(p.Taxes[i].Amount)
+		p.Tax += p.Taxes[i].Amount
+	}
+	p.Tax = roundCents(p.Tax)
+
+	p.Total = p.Amount - p.Discount
+	if !cfg.PricesIncludeTax {
+		p.Total += p.Tax
+	}
+	p.Total = roundCents(p.Total)
+	return p
+}
+
+// LoadTaxConfig reads a salon's tax rates
+func LoadTaxConfig(ctx context.Context, q querier, salonID string) (TaxConfig, error) {
+	var cfg TaxConfig
+	err := q.QueryRow(ctx, "SELECT prices_include_tax FROM salons WHERE id = $1", salonID).Scan(&cfg.PricesIncludeTax)
+	if err != nil {
+		return cfg, fmt.Errorf("salon not found")
+	}
+	rows, err := q.Query(ctx,
+		`SELECT name, rate_percent, COALESCE(category, '') FROM tax_rates
+		 WHERE salon_id = $1 ORDER BY created_at, name`, salonID)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to fetch tax rates: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r TaxRate
+		rows.Scan(&r.Name, &r.RatePercent, &r.Category)
+		cfg.Rates = append(cfg.Rates, r)
+	}
+	return cfg, nil
+}
+
+// priceServiceLines prices the services of a booking with the salon's tax rules
+func priceServiceLines(ctx context.Context, q querier, salonID string, lines []serviceLine, discount float64) (Price, error) {
+	cfg, err := LoadTaxConfig(ctx, q, salonID)
+	if err != nil {
+		return Price{}, err
+	}
+	priced := make([]PriceLine, len(lines))
+	for i, l := range lines {
+		priced[i] = PriceLine{Category: l.Category, Price: l.Price}
+	}
+	return PriceLines(cfg, priced, discount), nil
+}
+
+// insertPayment creates the payments row of an appointment with its itemized tax and the
+// next invoice number of the salon. Every path that creates a payment goes through here
+// so they all price and number the same way.
+func insertPayment(ctx context.Context, tx pgx.Tx, salonID, apptID string, price Price, method string) (*models.Payment, error) {
+	number, err := nextInvoiceNumber(ctx, tx, salonID)
+	if err != nil {
+		return nil, err
+	}
+	var payment models.Payment
+	err = tx.QueryRow(ctx,
+		`INSERT INTO payments (appointment_id, amount, discount, tax, total, method, status, receipt_number, tax_inclusive,
+		 salon_id, invoice_number)
+		 VALUES ($1, $2, $3, $4, $5, $6, 'pending', $7, $8, $9, $10)
+		 RETURNING id, appointment_id, amount, discount, tax, total, method, status, receipt_number, created_at, updated_at,
+		 tax_inclusive, invoice_number`,
+		apptID, price.Amount, price.Discount, price.Tax, price.Total, method, InvoiceReceiptNumber(number), price.Inclusive,
+		salonID, number,
+	).Scan(&payment.ID, &payment.AppointmentID, &payment.Amount, &payment.Discount,
+		&payment.Tax, &payment.Total, &payment.Method, &payment.Status,
+		&payment.ReceiptNumber, &payment.CreatedAt, &payment.UpdatedAt, &payment.TaxInclusive, &payment.InvoiceNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payment: %w", err)
+	}
+
+	for _, t := range price.Taxes {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO payment_taxes (payment_id, name, rate_percent, taxable_amount, amount)
+			 VALUES ($1, $2, $3, $4, $5)`,
+			payment.ID, t.Name, t.RatePercent, t.TaxableAmount, t.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record payment tax: %w", err)
+		}
+	}
+	payment.Taxes = price.Taxes
+	return &payment, nil
+}
+
+// repricePayment replaces the price breakdown and itemized tax of a payment that hasn't
+// been collected yet
+func repricePayment(ctx context.Context, tx pgx.Tx, paymentID string, price Price) error {
+	_, err := tx.Exec(ctx,
+		`UPDATE payments SET amount = $1, discount = $2, tax = $3, total = $4, tax_inclusive = $5, updated_at = NOW()
+		 WHERE id = $6`, price.Amount, price.Discount, price.Tax, price.Total, price.Inclusive, paymentID)
+	if err != nil {
+		return fmt.Errorf("failed to re-price payment: %w", err)
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM payment_taxes WHERE payment_id = $1", paymentID); err != nil {
+		return fmt.Errorf("failed to re-price payment: %w", err)
+	}
+	for _, t := range price.Taxes {
+		_, err := tx.Exec(ctx,
+			`INSERT INTO payment_taxes (payment_id, name, rate_percent, taxable_amount, amount)
+			 VALUES ($1, $2, $3, $4, $5)`,
+			paymentID, t.Name, t.RatePercent, t.TaxableAmount, t.Amount)
+		if err != nil {
+			return fmt.Errorf("failed to record payment tax: %w", err)
+		}
+	}
+	return nil
+}
+
+// CreateAppointmentPayment creates the payment of an appointment that has none, priced
+// from its line items and the promo, member and points discounts it was booked with,
+// under the salon's tax rules
+func (s *PaymentService) CreateAppointmentPayment(ctx context.Context, apptID, method string) error {
+	var salonID string
+	var discount float64
+	err := s.DB.QueryRow(ctx,
+		"SELECT salon_id, promo_discount + member_discount + points_discount FROM appointments WHERE id = $1", apptID).Scan(&salonID, &discount)
+	if err != nil {
+		return fmt.Errorf("appointment not found")
+	}
+	lines, _, err := appointmentLines(ctx, s.DB, apptID)
+	if err != nil {
+		return err
+	}
+	price, err := priceServiceLines(ctx, s.DB, salonID, lines, discount)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := insertPayment(ctx, tx, salonID, apptID, price, method); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
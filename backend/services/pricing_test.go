@@ -0,0 +1,51 @@
+package services
+
+import "testing"
+
+func TestPriceLines(t *testing.T) {
+	rates := []TaxRate{
+		{Name: "State", RatePercent: 6},
+		{Name: "City", RatePercent: 2},
+		{Name: "Retail", RatePercent: 10, Category: "Products"},
+	}
+	hair := PriceLine{Category: "Hair", Price: 100}
+	product := PriceLine{Category: "products", Price: 50}
+
+	tests := []struct {
+		name      string
+		cfg       TaxConfig
+		lines     []PriceLine
+		discount  float64
+		wantTax   float64
+		wantTotal float64
+		wantTaxes map[string]float64
+	}{
+		{name: "no rates", lines: []PriceLine{hair}, wantTotal: 100, wantTaxes: map[string]float64{}},
+		{name: "stacked exclusive rates", cfg: TaxConfig{Rates: rates}, lines: []PriceLine{hair},
+			wantTax: 8, wantTotal: 108, wantTaxes: map[string]float64{"State": 6, "City": 2}},
+		{name: "category override replaces salon-wide rates", cfg: TaxConfig{Rates: rates}, lines: []PriceLine{hair, product},
+			wantTax: 13, wantTotal: 163, wantTaxes: map[string]float64{"State": 6, "City": 2, "Retail": 5}},
+		{name: "tax on the discounted price", cfg: TaxConfig{Rates: rates}, lines: []PriceLine{hair, product}, discount: 30,
+			// 20% off each line: hair 80 at 8%, product 40 at 10%
+			wantTax: 10.4, wantTotal: 130.4, wantTaxes: map[string]float64{"State": 4.8, "City": 1.6, "Retail": 4}},
+		{name: "inclusive prices", cfg: TaxConfig{PricesIncludeTax: true, Rates: rates}, lines: []PriceLine{{Price: 108}},
+			wantTax: 8, wantTotal: 108, wantTaxes: map[string]float64{"State": 6, "City": 2}},
+		{name: "discount larger than the price", lines: []PriceLine{hair}, discount: 150, wantTotal: 0, wantTaxes: map[string]float64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := PriceLines(tt.cfg, tt.lines, tt.discount)
+			if p.Tax != tt.wantTax || p.Total != tt.wantTotal {
+				t.Errorf("tax, total = %v, %v, want %v, %v", p.Tax, p.Total, tt.wantTax, tt.wantTotal)
+			}
+			if len(p.Taxes) != len(tt.wantTaxes) {
+				t.Fatalf("taxes = %+v, want %v", p.Taxes, tt.wantTaxes)
+			}
+			for _, tax := range p.Taxes {
+				if tax.Amount != tt.wantTaxes[tax.Name] {
+					t.Errorf("%s = %v, want %v", tax.Name, tax.Amount, tt.wantTaxes[tax.Name])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"saloon-backend/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Discount types of a promo code
+const (
+	PromoPercent = "percent"
+	PromoFixed   = "fixed"
+)
+
+// Reasons a promo code is rejected, reported in PromoError.Reason
+const (
+	PromoNotFound      = "not_found"
+	PromoInactive      = "inactive"
+	PromoNotStarted    = "not_started"
+	PromoExpired       = "expired"
+	PromoUsedUp        = "max_uses"
+	PromoCustomerLimit = "customer_limit"
+	PromoFirstVisit    = "first_visit_only"
+	PromoWrongDay      = "wrong_day"
+	PromoWrongTime     = "wrong_time"
+	PromoMinOrder      = "min_order"
+	PromoNotApplicable = "no_eligible_services"
+)
+
+// PromoError explains why a promo code can't be used
+type PromoError struct {
+	Reason  string
+	Message string
+}
+
+func (e *PromoError) Error() string { return e.Message }
+
+func rejectPromo(reason, format string, args ...any) *PromoError {
+	return &PromoError{Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
+// PromoColumns are the promo_codes columns (aliased pc) scanned by ScanPromo
+const PromoColumns = `pc.id, pc.salon_id, pc.code, pc.discount_percent, pc.valid_from, pc.valid_until, pc.max_uses,
+	pc.used_count, pc.is_active, pc.created_at, pc.discount_type, pc.discount_amount, pc.min_order_amount,
+	ARRAY(SELECT pcs.service_id::text FROM promo_code_services pcs WHERE pcs.promo_code_id = pc.id),
+	pc.categories, pc.first_visit_only, pc.max_uses_per_customer, pc.valid_weekdays,
+	COALESCE(TO_CHAR(pc.valid_start_time, 'HH24:MI'), ''), COALESCE(TO_CHAR(pc.valid_end_time, 'HH24:MI'), '')`
+
+func ScanPromo(row pgx.Row, p *models.PromoCode) error {
+	return row.Scan(&p.ID, &p.SalonID, &p.Code, &p.DiscountPercent, &p.ValidFrom, &p.ValidUntil, &p.MaxUses,
+		&p.UsedCount, &p.IsActive, &p.CreatedAt, &p.DiscountType, &p.DiscountAmount, &p.MinOrderAmount,
+		&p.ServiceIDs, &p.Categories, &p.FirstVisitOnly, &p.MaxUsesPerCustomer, &p.ValidWeekdays,
+		&p.ValidStartTime, &p.ValidEndTime)
+}
+
+// promoOrder is the booking a code is evaluated against. Lines is empty and Date is ""
+// while they are not known yet, which skips the rules that depend on them.
+type promoOrder struct {
+	Lines []serviceLine
+	Date  string // YYYY-MM-DD in the salon's timezone
+	Start string // HH:MM
+}
+
+// promoUsage is how much the customer has used the code, counting uses that weren't given
+// back, and how often they visited the salon, not counting cancelled bookings
+type promoUsage struct {
+	CustomerUses int
+	Visits       int
+}
+
+var weekdayNames = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+
+// evaluatePromo applies a promo's rules to an order at now and returns the discount, or a
+// *PromoError saying which rule the order breaks
+func evaluatePromo(p *models.PromoCode, order promoOrder, usage promoUsage, now time.Time) (float64, error) {
+	if !p.IsActive {
+		return 0, rejectPromo(PromoInactive, "promo code is no longer active")
+	}
+	if now.Before(p.ValidFrom) {
+		return 0, rejectPromo(PromoNotStarted, "promo code is valid from %s", p.ValidFrom.Format("2006-01-02"))
+	}
+	if p.ValidUntil != nil && !now.Before(*p.ValidUntil) {
+		return 0, rejectPromo(PromoExpired, "promo code has expired")
+	}
+	if p.MaxUses != nil && p.UsedCount >= *p.MaxUses {
+		return 0, rejectPromo(PromoUsedUp, "promo code has reached maximum uses")
+	}
+	if p.MaxUsesPerCustomer != nil && usage.CustomerUses >= *p.MaxUsesPerCustomer {
+		return 0, rejectPromo(PromoCustomerLimit, "promo code can be used %d time(s) per customer", *p.MaxUsesPerCustomer)
+	}
+	if p.FirstVisitOnly && usage.Visits > 0 {
+		return 0, rejectPromo(PromoFirstVisit, "promo code is only valid on a first visit")
+	}
+
+	if order.Date != "" {
+		if len(p.ValidWeekdays) > 0 {
+			date, err := time.Parse("2006-01-02", order.Date)
+			if err != nil {
+				return 0, fmt.Errorf("invalid date format, use YYYY-MM-DD")
+			}
+			ok := false
+			var days []string
+			for _, d := range p.ValidWeekdays {
+				ok = ok || time.Weekday(d) == date.Weekday()
+				days = append(days, weekdayNames[d%7])
+			}
+			if !ok {
+				return 0, rejectPromo(PromoWrongDay, "promo code is only valid on %s", strings.Join(days, ", "))
+			}
+		}
+		start := order.Start
+		if len(start) > 5 {
+			start = start[:5]
+		}
+		if (p.ValidStartTime != "" && start < p.ValidStartTime) || (p.ValidEndTime != "" && start >= p.ValidEndTime) {
+			return 0, rejectPromo(PromoWrongTime, "promo code is only valid for appointments %s", promoWindow(p))
+		}
+	}
+
+	if len(order.Lines) == 0 {
+		return 0, nil
+	}
+	if subtotal := sumServicePrices(order.Lines); subtotal < p.MinOrderAmount-0.005 {
+		return 0, rejectPromo(PromoMinOrder, "promo code needs an order of at least %.2f", p.MinOrderAmount)
+	}
+	eligible := 0.0
+	for _, l := range order.Lines {
+		if promoCovers(p, l) {
+			eligible += l.Price
+		}
+	}
+	if eligible <= 0 {
+		return 0, rejectPromo(PromoNotApplicable, "promo code does not apply to the selected services")
+	}
+	if p.DiscountType == PromoFixed {
+		return roundCents(math.Min(p.DiscountAmount, eligible)), nil
+	}
+	return roundCents(eligible * p.DiscountPercent / 100), nil
+}
+
+// promoCovers tells whether a service is in the promo's scope
+func promoCovers(p *models.PromoCode, l serviceLine) bool {
+	if len(p.ServiceIDs) == 0 && len(p.Categories) == 0 {
+		return true
+	}
+	for _, id := range p.ServiceIDs {
+		if id == l.ID {
+			return true
+		}
+	}
+	for _, c := range p.Categories {
+		if l.Category != "" && strings.EqualFold(c, l.Category) {
+			return true
+		}
+	}
+	return false
+}
+
+// promoWindow describes the time window of a promo, e.g. "between 09:00 and 12:00"
+func promoWindow(p *models.PromoCode) string {
+	switch {
+	case p.ValidStartTime != "" && p.ValidEndTime != "":
+		return "between " + p.ValidStartTime + " and " + p.ValidEndTime
+	case p.ValidStartTime != "":
+		return "from " + p.ValidStartTime
+	default:
+		return "before " + p.ValidEndTime
+	}
+}
+
+// evaluatePromoCode looks up a salon's code and evaluates it for the customer's order.
+// forUpdate locks the code until the caller's transaction ends so its uses can be counted.
+func evaluatePromoCode(ctx context.Context, q querier, salonID, customerID, code string, order promoOrder, forUpdate bool) (*models.PromoCode, float64, error) {
+	query := `SELECT ` + PromoColumns + ` FROM promo_codes pc WHERE pc.salon_id = $1 AND pc.code = $2`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+	var p models.PromoCode
+	err := ScanPromo(q.QueryRow(ctx, query, salonID, strings.TrimSpace(code)), &p)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, 0, rejectPromo(PromoNotFound, "invalid promo code")
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch promo code: %w", err)
+	}
+
+	var usage promoUsage
+	err = q.QueryRow(ctx,
+		`SELECT (SELECT COUNT(*) FROM promo_redemptions
+		         WHERE promo_code_id = $1 AND customer_id = $2 AND status = 'active'),
+		 COUNT(*)
+		 FROM appointments WHERE customer_id = $2 AND salon_id = $3 AND status <> 'cancelled'`,
+		p.ID, customerID, salonID).Scan(&usage.CustomerUses, &usage.Visits)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count promo uses: %w", err)
+	}
+
+	discount, err := evaluatePromo(&p, order, usage, time.Now())
+	if err != nil {
+		return nil, 0, err
+	}
+	return &p, discount, nil
+}
+
+// PromoCheck is a promo code a customer wants to use, with the services, date and start
+// time of the booking when they are known
+type PromoCheck struct {
+	SalonID    string
+	CustomerID string
+	Code       string
+	ServiceIDs []string
+	Date       string
+	StartTime  string
+}
+
+// CheckPromo evaluates a code the way booking will, returning the promo and the discount
+// it gives (0 until services are known), or a *PromoError explaining the rejection
+func CheckPromo(ctx context.Context, q querier, check PromoCheck) (*models.PromoCode, float64, error) {
+	order := promoOrder{Date: check.Date, Start: check.StartTime}
+	if len(check.ServiceIDs) > 0 {
+		lines, salonID, err := loadServiceLines(ctx, q, check.ServiceIDs)
+		if err != nil {
+			return nil, 0, err
+		}
+		if salonID != check.SalonID {
+			return nil, 0, fmt.Errorf("service does not belong to this salon")
+		}
+		order.Lines = lines
+	}
+	return evaluatePromoCode(ctx, q, check.SalonID, check.CustomerID, check.Code, order, false)
+}
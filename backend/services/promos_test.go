@@ -0,0 +1,88 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"saloon-backend/models"
+)
+
+func TestEvaluatePromo(t *testing.T) {
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	yesterday, tomorrow := now.AddDate(0, 0, -1), now.AddDate(0, 0, 1)
+	two := 2
+	lines := []serviceLine{
+		{ID: "cut", Price: 60, Category: "Hair"},
+		{ID: "nails", Price: 40, Category: "Nails"},
+	}
+	// 2026-03-03 is a Tuesday
+	order := promoOrder{Lines: lines, Date: "2026-03-03", Start: "10:30"}
+	base := func() models.PromoCode {
+		return models.PromoCode{IsActive: true, ValidFrom: yesterday, DiscountType: PromoPercent, DiscountPercent: 20}
+	}
+
+	tests := []struct {
+		name   string
+		edit   func(p *models.PromoCode)
+		order  *promoOrder // the default order when nil
+		usage  promoUsage
+		want   float64
+		reason string
+	}{
+		{name: "percent of the order", want: 20},
+		{name: "fixed amount", edit: func(p *models.PromoCode) { p.DiscountType, p.DiscountAmount = PromoFixed, 15 }, want: 15},
+		{name: "fixed amount capped at the eligible services", want: 40, edit: func(p *models.PromoCode) {
+			p.DiscountType, p.DiscountAmount, p.Categories = PromoFixed, 50, []string{"nails"}
+		}},
+		{name: "scoped to a service", edit: func(p *models.PromoCode) { p.ServiceIDs = []string{"cut"} }, want: 12},
+		{name: "scoped elsewhere", edit: func(p *models.PromoCode) { p.Categories = []string{"Spa"} }, reason: PromoNotApplicable},
+		{name: "minimum order met", edit: func(p *models.PromoCode) { p.MinOrderAmount = 100 }, want: 20},
+		{name: "minimum order missed", edit: func(p *models.PromoCode) { p.MinOrderAmount = 100.01 }, reason: PromoMinOrder},
+		{name: "inactive", edit: func(p *models.PromoCode) { p.IsActive = false }, reason: PromoInactive},
+		{name: "not started", edit: func(p *models.PromoCode) { p.ValidFrom = tomorrow }, reason: PromoNotStarted},
+		{name: "expired", edit: func(p *models.PromoCode) { p.ValidUntil = &yesterday }, reason: PromoExpired},
+		{name: "used up", edit: func(p *models.PromoCode) { p.MaxUses, p.UsedCount = &two, 2 }, reason: PromoUsedUp},
+		{name: "customer limit", edit: func(p *models.PromoCode) { p.MaxUsesPerCustomer = &two },
+			usage: promoUsage{CustomerUses: 2, Visits: 2}, reason: PromoCustomerLimit},
+		{name: "first visit", edit: func(p *models.PromoCode) { p.FirstVisitOnly = true }, want: 20},
+		{name: "returning customer", edit: func(p *models.PromoCode) { p.FirstVisitOnly = true },
+			usage: promoUsage{Visits: 1}, reason: PromoFirstVisit},
+		{name: "valid weekday", edit: func(p *models.PromoCode) { p.ValidWeekdays = []int{2, 3} }, want: 20},
+		{name: "wrong weekday", edit: func(p *models.PromoCode) { p.ValidWeekdays = []int{0, 6} }, reason: PromoWrongDay},
+		{name: "inside the time window", want: 20, edit: func(p *models.PromoCode) {
+			p.ValidStartTime, p.ValidEndTime = "09:00", "12:00"
+		}},
+		{name: "window end is exclusive", order: &promoOrder{Lines: lines, Date: "2026-03-03", Start: "12:00:00"},
+			reason: PromoWrongTime, edit: func(p *models.PromoCode) { p.ValidStartTime, p.ValidEndTime = "09:00", "12:00" }},
+		{name: "no booking yet skips booking rules", order: &promoOrder{}, want: 0, edit: func(p *models.PromoCode) {
+			p.MinOrderAmount, p.ValidWeekdays, p.ValidStartTime = 500, []int{0}, "18:00"
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := base()
+			if tt.edit != nil {
+				tt.edit(&p)
+			}
+			o := order
+			if tt.order != nil {
+				o = *tt.order
+			}
+			got, err := evaluatePromo(&p, o, tt.usage, now)
+			if tt.reason != "" {
+				var promoErr *PromoError
+				if !errors.As(err, &promoErr) || promoErr.Reason != tt.reason {
+					t.Fatalf("err = %v, want reason %s", err, tt.reason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("discount = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
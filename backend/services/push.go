@@ -52,18 +52,22 @@ func (ps *PushService) RemoveSubscription(ctx context.Context, userID, endpoint
 }
 
 // SendToUser sends a push notification to all subscriptions for a user
-func (ps *PushService) SendToUser(ctx context.Context, userID string, payload PushPayload) {
+func (ps *PushService) SendToUser(ctx context.Context, userID string, payload PushPayload) error {
 	rows, err := ps.DB.Query(ctx,
 		"SELECT endpoint, p256dh_key, auth_key FROM push_subscriptions WHERE user_id = $1",
 		userID)
 	if err != nil {
 		log.Printf("Push: failed to query subscriptions for user %s: %v", userID, err)
-		return
+		return err
 	}
 	defer rows.Close()
 
 	payloadBytes, _ := json.Marshal(payload)
 
+	// Only an error when every subscription failed; users without any are not an error
+	var attempted, delivered int
+	var lastErr error
+
 	for rows.Next() {
 		var endpoint, p256dh, authKey string
 		if err := rows.Scan(&endpoint, &p256dh, &authKey); err != nil {
@@ -78,6 +82,7 @@ func (ps *PushService) SendToUser(ctx context.Context, userID string, payload Pu
 			},
 		}
 
+		attempted++
 		resp, err := webpush.SendNotification(payloadBytes, sub, &webpush.Options{
 			Subscriber:      ps.VAPIDContact,
 			VAPIDPublicKey:  ps.VAPIDPublicKey,
@@ -90,10 +95,17 @@ func (ps *PushService) SendToUser(ctx context.Context, userID string, payload Pu
 			if resp != nil && resp.StatusCode == 410 {
 				ps.RemoveSubscription(ctx, userID, endpoint)
 			}
+			lastErr = err
 			continue
 		}
 		resp.Body.Close()
+		delivered++
 
 		fmt.Printf("Push: sent to user %s (status %d)\n", userID[:8], resp.StatusCode)
 	}
+
+	if attempted > 0 && delivered == 0 {
+		return fmt.Errorf("push failed for all %d subscriptions: %w", attempted, lastErr)
+	}
+	return nil
 }
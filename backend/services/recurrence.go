@@ -0,0 +1,64 @@
+package services
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaxSeriesOccurrences caps how far ahead a recurring series is materialized
+const MaxSeriesOccurrences = 52
+
+// RecurrenceRule is the subset of RFC 5545 RRULE the salon supports:
+// FREQ=DAILY|WEEKLY|MONTHLY;INTERVAL=n;COUNT=n or UNTIL=date
+type RecurrenceRule struct {
+	Frequency string
+	Interval  int
+	Count     int       // 0 = bounded by Until only
+	Until     time.Time // zero = bounded by Count only
+}
+
+func (r RecurrenceRule) Validate() error {
+	switch r.Frequency {
+	case "daily", "weekly", "monthly":
+	default:
+		return fmt.Errorf("frequency must be daily, weekly or monthly")
+	}
+	if r.Interval < 1 {
+		return fmt.Errorf("interval must be at least 1")
+	}
+	if r.Count < 0 {
+		return fmt.Errorf("count must be positive")
+	}
+	if r.Count == 0 && r.Until.IsZero() {
+		return fmt.Errorf("either count or until_date is required")
+	}
+	return nil
+}
+
+// Dates expands the rule from start (the first occurrence). Monthly rules skip months
+// that don't have the start day (e.g. the 31st), as RRULE does.
+func (r RecurrenceRule) Dates(start time.Time) []time.Time {
+	var dates []time.Time
+	for n := 0; len(dates) < MaxSeriesOccurrences; n++ {
+		var d time.Time
+		switch r.Frequency {
+		case "daily":
+			d = start.AddDate(0, 0, n*r.Interval)
+		case "weekly":
+			d = start.AddDate(0, 0, 7*n*r.Interval)
+		case "monthly":
+			d = start.AddDate(0, n*r.Interval, 0)
+			if d.Day() != start.Day() && (r.Until.IsZero() || !d.After(r.Until)) {
+				continue
+			}
+		}
+		if !r.Until.IsZero() && d.After(r.Until) {
+			break
+		}
+		dates = append(dates, d)
+		if r.Count > 0 && len(dates) >= r.Count {
+			break
+		}
+	}
+	return dates
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecurrenceDates(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	tests := []struct {
+		name  string
+		rule  RecurrenceRule
+		start string
+		want  []string
+	}{
+		{
+			name:  "daily every other day",
+			rule:  RecurrenceRule{Frequency: "daily", Interval: 2, Count: 3},
+			start: "2026-03-10",
+			want:  []string{"2026-03-10", "2026-03-12", "2026-03-14"},
+		},
+		{
+			name:  "weekly by count",
+			rule:  RecurrenceRule{Frequency: "weekly", Interval: 1, Count: 4},
+			start: "2026-03-10",
+			want:  []string{"2026-03-10", "2026-03-17", "2026-03-24", "2026-03-31"},
+		},
+		{
+			name:  "fortnightly until a date",
+			rule:  RecurrenceRule{Frequency: "weekly", Interval: 2, Until: day("2026-04-07")},
+			start: "2026-03-10",
+			want:  []string{"2026-03-10", "2026-03-24", "2026-04-07"},
+		},
+		{
+			name:  "until before the next occurrence",
+			rule:  RecurrenceRule{Frequency: "weekly", Interval: 1, Until: day("2026-03-16")},
+			start: "2026-03-10",
+			want:  []string{"2026-03-10"},
+		},
+		{
+			name:  "count stops before until",
+			rule:  RecurrenceRule{Frequency: "weekly", Interval: 1, Count: 2, Until: day("2026-12-31")},
+			start: "2026-03-10",
+			want:  []string{"2026-03-10", "2026-03-17"},
+		},
+		{
+			name:  "until stops before count",
+			rule:  RecurrenceRule{Frequency: "monthly", Interval: 1, Count: 10, Until: day("2026-05-15")},
+			start: "2026-03-15",
+			want:  []string{"2026-03-15", "2026-04-15", "2026-05-15"},
+		},
+		{
+			name:  "monthly skips months without the day",
+			rule:  RecurrenceRule{Frequency: "monthly", Interval: 1, Count: 4},
+			start: "2026-01-31",
+			want:  []string{"2026-01-31", "2026-03-31", "2026-05-31", "2026-07-31"},
+		},
+		{
+			name:  "monthly on the 29th across February",
+			rule:  RecurrenceRule{Frequency: "monthly", Interval: 1, Until: day("2026-04-30")},
+			start: "2026-01-29",
+			want:  []string{"2026-01-29", "2026-03-29", "2026-04-29"},
+		},
+		{
+			name:  "every other month across a year",
+			rule:  RecurrenceRule{Frequency: "monthly", Interval: 2, Count: 3},
+			start: "2026-11-05",
+			want:  []string{"2026-11-05", "2027-01-05", "2027-03-05"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.rule.Dates(day(tt.start))
+			if len(got) != len(tt.want) {
+				t.Fatalf("Dates = %v, want %v", got, tt.want)
+			}
+			for i, d := range got {
+				if d.Format("2006-01-02") != tt.want[i] {
+					t.Errorf("Dates[%d] = %s, want %s", i, d.Format("2006-01-02"), tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRecurrenceDatesCap(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	rule := RecurrenceRule{Frequency: "daily", Interval: 1, Until: start.AddDate(5, 0, 0)}
+	if got := len(rule.Dates(start)); got != MaxSeriesOccurrences {
+		t.Errorf("len(Dates) = %d, want %d", got, MaxSeriesOccurrences)
+	}
+}
+
+// A weekly series keeps its wall-clock time in the salon's zone across a DST change
+func TestRecurrenceDatesDST(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skip("timezone data not available")
+	}
+	start := time.Date(2026, 3, 22, 10, 0, 0, 0, loc)
+	rule := RecurrenceRule{Frequency: "weekly", Interval: 1, Count: 3}
+
+	got := rule.Dates(start)
+	if len(got) != 3 {
+		t.Fatalf("Dates = %v, want 3 occurrences", got)
+	}
+	for i, d := range got {
+		if d.Hour() != 10 || d.Minute() != 0 {
+			t.Errorf("Dates[%d] = %s, want 10:00 local", i, d)
+		}
+	}
+	// 2026-03-29 starts BST, so that week is an hour shorter in absolute time
+	if gap := got[2].Sub(got[1]); gap != 7*24*time.Hour {
+		t.Errorf("gap after the change = %s, want 168h", gap)
+	}
+	if gap := got[1].Sub(got[0]); gap != 7*24*time.Hour-time.Hour {
+		t.Errorf("gap across the change = %s, want 167h", gap)
+	}
+}
+
+func TestRecurrenceRuleValidate(t *testing.T) {
+	until := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		rule    RecurrenceRule
+		wantErr bool
+	}{
+		{name: "count", rule: RecurrenceRule{Frequency: "weekly", Interval: 1, Count: 4}},
+		{name: "until", rule: RecurrenceRule{Frequency: "monthly", Interval: 1, Until: until}},
+		{name: "unknown frequency", rule: RecurrenceRule{Frequency: "yearly", Interval: 1, Count: 4}, wantErr: true},
+		{name: "zero interval", rule: RecurrenceRule{Frequency: "daily", Count: 4}, wantErr: true},
+		{name: "negative count", rule: RecurrenceRule{Frequency: "daily", Interval: 1, Count: -1, Until: until}, wantErr: true},
+		{name: "unbounded", rule: RecurrenceRule{Frequency: "daily", Interval: 1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"saloon-backend/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Ways a booking with a promo code can fall through, each settled per the salon's policy
+const (
+	PromoOnCancel     = "cancel"
+	PromoOnLateCancel = "late_cancel"
+	PromoOnNoShow     = "no_show"
+	PromoOnRefund     = "refund"
+)
+
+// releasesPromo tells whether a policy gives the promo code use back on event
+func releasesPromo(p models.CancellationPolicy, event string) bool {
+	switch event {
+	case PromoOnCancel:
+		return p.ReleasePromoOnCancel
+	case PromoOnLateCancel:
+		return p.ReleasePromoOnLateCancel
+	case PromoOnNoShow:
+		return p.ReleasePromoOnNoShow
+	case PromoOnRefund:
+		return p.ReleasePromoOnRefund
+	}
+	return false
+}
+
+// redeemPromo records a booking's use of a promo code and counts it. Call it in the
+// transaction that books the appointment, with the code locked.
+func redeemPromo(ctx context.Context, tx pgx.Tx, promoID, customerID, apptID string, discount float64) error {
+	_, err := tx.Exec(ctx,
+		`INSERT INTO promo_redemptions (promo_code_id, customer_id, appointment_id, discount)
+		 VALUES ($1, $2, $3, $4)`, promoID, customerID, apptID, discount)
+	if err != nil {
+		return fmt.Errorf("failed to redeem promo code: %w", err)
+	}
+	if _, err := tx.Exec(ctx, "UPDATE promo_codes SET used_count = used_count + 1 WHERE id = $1", promoID); err != nil {
+		return fmt.Errorf("failed to redeem promo code: %w", err)
+	}
+	return nil
+}
+
+// releaseRedemption gives back the promo code use of an appointment that fell through when
+// the salon's policy releases it on event; otherwise the redemption is kept. Refunds only
+// settle bookings that went ahead; cancelled and missed ones were settled already.
+func releaseRedemption(ctx context.Context, tx pgx.Tx, apptID, event string) error {
+	var redemptionID, promoID, salonID, apptStatus string
+	err := tx.QueryRow(ctx,
+		`SELECT r.id, r.promo_code_id, a.salon_id, a.status
+		 FROM promo_redemptions r JOIN appointments a ON a.id = r.appointment_id
+		 WHERE r.appointment_id = $1 AND r.status = 'active'
+		 FOR UPDATE OF r`, apptID).Scan(&redemptionID, &promoID, &salonID, &apptStatus)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch promo redemption: %w", err)
+	}
+	if event == PromoOnRefund && (apptStatus == "cancelled" || apptStatus == "no_show") {
+		return nil
+	}
+
+	policy, err := LoadCancellationPolicy(ctx, tx, salonID)
+	if err != nil {
+		return err
+	}
+	if !releasesPromo(policy, event) {
+		return nil
+	}
+	_, err = tx.Exec(ctx,
+		`UPDATE promo_redemptions SET status = 'released', release_reason = $1, released_at = NOW()
+		 WHERE id = $2`, event, redemptionID)
+	if err != nil {
+		return fmt.Errorf("failed to release promo redemption: %w", err)
+	}
+	_, err = tx.Exec(ctx,
+		"UPDATE promo_codes SET used_count = GREATEST(used_count - 1, 0) WHERE id = $1", promoID)
+	if err != nil {
+		return fmt.Errorf("failed to release promo redemption: %w", err)
+	}
+	return nil
+}
+
+// settleDiscounts settles the discounts of an appointment that fell through on event: the
+// promo code use and prepaid plan credits per the salon's policy, and the loyalty points it
+// redeemed or earned
+func settleDiscounts(ctx context.Context, tx pgx.Tx, apptID, event string) error {
+	if err := releaseRedemption(ctx, tx, apptID, event); err != nil {
+		return err
+	}
+	if err := restoreCredits(ctx, tx, apptID, event); err != nil {
+		return err
+	}
+	return settlePoints(ctx, tx, apptID)
+}
+
+// SettleDiscounts settles the discounts of appointments that were cancelled or missed,
+// each in its own transaction
+func SettleDiscounts(ctx context.Context, db *pgxpool.Pool, apptIDs []string, event string) error {
+	for _, id := range apptIDs {
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		if err := settleDiscounts(ctx, tx, id, event); err != nil {
+			tx.Rollback(ctx)
+			return err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadPromoStats returns the redemption stats of a salon's promo codes by code id
+func LoadPromoStats(ctx context.Context, q querier, salonID string) (map[string]*models.PromoStats, error) {
+	rows, err := q.Query(ctx,
+		`SELECT r.promo_code_id, COUNT(*),
+		 COUNT(*) FILTER (WHERE r.status = 'active'),
+		 COUNT(*) FILTER (WHERE r.status = 'released'),
+		 COALESCE(SUM(r.discount) FILTER (WHERE r.status = 'active'), 0),
+		 COALESCE(SUM(
+		     (SELECT SUM(`+collectedSQL+` - (SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE payment_id = payments.id))
+		      FROM payments
+		      WHERE payments.appointment_id = r.appointment_id
+		        AND payments.status IN ('completed', 'partially_refunded', 'refunded'))
+		 ) FILTER (WHERE r.status = 'active'), 0)
+		 FROM promo_redemptions r JOIN promo_codes pc ON pc.id = r.promo_code_id
+		 WHERE pc.salon_id = $1
+		 GROUP BY r.promo_code_id`, salonID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch promo stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats := map[string]*models.PromoStats{}
+	for rows.Next() {
+		var id string
+		var st models.PromoStats
+		if err := rows.Scan(&id, &st.Redemptions, &st.Active, &st.Released, &st.TotalDiscount, &st.AttributedRevenue); err != nil {
+			return nil, fmt.Errorf("failed to fetch promo stats: %w", err)
+		}
+		st.AttributedRevenue = roundCents(st.AttributedRevenue)
+		stats[id] = &st
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"testing"
+
+	"saloon-backend/models"
+)
+
+func TestReleasesPromo(t *testing.T) {
+	strict := DefaultCancellationPolicy()
+	strict.ReleasePromoOnCancel, strict.ReleasePromoOnRefund = false, false
+	lenient := DefaultCancellationPolicy()
+	lenient.ReleasePromoOnLateCancel, lenient.ReleasePromoOnNoShow = true, true
+
+	tests := []struct {
+		name   string
+		policy models.CancellationPolicy
+		event  string
+		want   bool
+	}{
+		{name: "default gives back a cancellation", policy: DefaultCancellationPolicy(), event: PromoOnCancel, want: true},
+		{name: "default keeps a late cancellation", policy: DefaultCancellationPolicy(), event: PromoOnLateCancel},
+		{name: "default keeps a no-show", policy: DefaultCancellationPolicy(), event: PromoOnNoShow},
+		{name: "default gives back a refund", policy: DefaultCancellationPolicy(), event: PromoOnRefund, want: true},
+		{name: "strict keeps a cancellation", policy: strict, event: PromoOnCancel},
+		{name: "strict keeps a refund", policy: strict, event: PromoOnRefund},
+		{name: "lenient gives back a late cancellation", policy: lenient, event: PromoOnLateCancel, want: true},
+		{name: "lenient gives back a no-show", policy: lenient, event: PromoOnNoShow, want: true},
+		{name: "unknown event", policy: lenient, event: "completed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := releasesPromo(tt.policy, tt.event); got != tt.want {
+				t.Errorf("releasesPromo(%s) = %v, want %v", tt.event, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"saloon-backend/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrRefundTooLarge is returned when a refund exceeds what is left of the collected amount
+var ErrRefundTooLarge = errors.New("refund exceeds the amount left to refund")
+
+// RefundRequest asks the provider to give back part or all of a captured payment. Reason
+// and ActorID are echoed in the refund event so the ledger keeps them.
+type RefundRequest struct {
+	IntentID  string
+	PaymentID string
+	Amount    float64
+	Reason    string
+	ActorID   string
+}
+
+// collectedSQL is what a payments row brought in: the captured amount (legacy rows only
+// have the total) plus the deposit applied to it
+const collectedSQL = `COALESCE(captured_amount, total - deposit_applied) + deposit_applied`
+
+// refundStatus is the status of a payment given how much of the collected amount has
+// been refunded
+func refundStatus(collected, refunded float64) string {
+	if refunded <= 0 {
+		return "completed"
+	}
+	if refunded >= collected-0.005 {
+		return "refunded"
+	}
+	return "partially_refunded"
+}
+
+// applyRefund adds a refund event to the ledger, once per provider refund, and derives the
+// payment status from the ledger total. fromDeposit marks refunds made through the intent
+// of the deposit applied to the payment. The caller holds the payment row lock.
+func applyRefund(ctx context.Context, tx pgx.Tx, paymentID, status, provider string, event *PaymentEvent, fromDeposit bool) error {
+	if status != "completed" && status != "partially_refunded" {
+		return nil
+	}
+	ref := event.RefundID
+	if ref == "" {
+		ref = event.ID
+	}
+	tag, err := tx.Exec(ctx,
+		`INSERT INTO refunds (payment_id, amount, reason, actor_id, provider, provider_ref, from_deposit)
+		 VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, '')::uuid, $5, $6, $7)
+		 ON CONFLICT (provider, provider_ref) DO NOTHING`,
+		paymentID, event.Amount, event.Reason, event.ActorID, provider, ref, fromDeposit)
+	if err != nil {
+		return fmt.Errorf("failed to record refund: %w", err)
+	}
+	if provider == ProviderGiftCard && tag.RowsAffected() > 0 {
+		if err := refundToGiftCards(ctx, tx, paymentID, event.Amount, event.ActorID, event.Reason); err != nil {
+			return err
+		}
+	}
+
+	var collected, refunded float64
+	err = tx.QueryRow(ctx,
+		`SELECT `+collectedSQL+`,
+		 (SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE payment_id = payments.id)
+		 FROM payments WHERE id = $1`, paymentID).Scan(&collected, &refunded)
+	if err != nil {
+		return fmt.Errorf("failed to total refunds: %w", err)
+	}
+	next := refundStatus(collected, refunded)
+	var apptID string
+	err = tx.QueryRow(ctx,
+		"UPDATE payments SET status = $1, updated_at = NOW() WHERE id = $2 RETURNING appointment_id",
+		next, paymentID).Scan(&apptID)
+	if err != nil {
+		return fmt.Errorf("failed to update payment: %w", err)
+	}
+	if next == "refunded" {
+		return settleDiscounts(ctx, tx, apptID, PromoOnRefund)
+	}
+	return nil
+}
+
+// RefundPayment gives back amount of a collected payment (0 = everything not yet refunded).
+// Card payments are refunded through the provider, gift card payments back onto the cards,
+// counter payments are recorded as handed back at the salon, and split payments in that
+// order. Once what was collected on the payment
+// itself is used up, the rest comes out of its deposit. The payment status follows once
+// the refund is in the ledger.
+func (s *PaymentService) RefundPayment(ctx context.Context, paymentID string, amount float64, reason, actorID string) (*models.Refund, error) {
+	var p paymentRow
+	var collected, refunded, depositRefunded, cardRefunded, giftCard, giftCardRefunded float64
+	var depositProvider, depositIntentID string
+	err := s.DB.QueryRow(ctx,
+		`SELECT id, method, status, COALESCE(provider, ''), COALESCE(provider_intent_id, ''), deposit_applied,
+		 `+cardTenderSQL+`, `+collectedSQL+`,
+		 (SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE payment_id = payments.id),
+		 (SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE payment_id = payments.id AND from_deposit),
+		 (SELECT COALESCE(SUM(amount), 0) FROM refunds
+		  WHERE payment_id = payments.id AND provider = payments.provider AND NOT from_deposit),
+		 (SELECT COALESCE(SUM(t.amount), 0) FROM payment_tenders t
+		  WHERE t.payment_id = payments.id AND t.method = 'gift_card'),
+		 (SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE payment_id = payments.id AND provider = 'gift_card'),
+		 COALESCE(d.provider, ''), COALESCE(d.provider_intent_id, '')
+		 FROM payments LEFT JOIN deposits d ON d.payment_id = payments.id AND d.status = 'applied'
+		 WHERE payments.id = $1`, paymentID,
+	).Scan(&p.ID, &p.Method, &p.Status, &p.Provider, &p.IntentID, &p.Deposit, &p.Card,
+		&collected, &refunded, &depositRefunded, &cardRefunded, &giftCard, &giftCardRefunded,
+		&depositProvider, &depositIntentID)
+	if err != nil {
+		return nil, fmt.Errorf("payment not found")
+	}
+	if p.Status != "completed" && p.Status != "partially_refunded" {
+		return nil, fmt.Errorf("only collected payments can be refunded (payment is %s)", p.Status)
+	}
+
+	remaining := math.Round((collected-refunded)*100) / 100
+	if amount == 0 {
+		amount = remaining
+	}
+	if amount < 0 {
+		return nil, fmt.Errorf("refund amount must be positive")
+	}
+	if amount > remaining+0.005 {
+		return nil, ErrRefundTooLarge
+	}
+	if amount == 0 {
+		return nil, fmt.Errorf("nothing left to refund")
+	}
+
+	// Split between the payment's own channel and its deposit
+	depositLeft := math.Max(roundCents(p.Deposit-depositRefunded), 0)
+	ownPart := math.Min(amount, math.Max(roundCents(remaining-depositLeft), 0))
+	depositPart := roundCents(amount - ownPart)
+
+	// A split payment gives back to the card first, up to what the card was charged, then
+	// to its gift cards up to what they paid, and the rest at the counter
+	cardPart := 0.0
+	switch p.Method {
+	case "card":
+		cardPart = ownPart
+	case MethodSplit:
+		cardPart = math.Min(ownPart, math.Max(roundCents(p.Card-cardRefunded), 0))
+	}
+	giftCardPart := math.Min(roundCents(ownPart-cardPart), math.Max(roundCents(giftCard-giftCardRefunded), 0))
+	parts := []struct {
+		provider, intentID string
+		amount             float64
+	}{
+		{p.Provider, p.IntentID, cardPart},
+		{ProviderGiftCard, "", giftCardPart},
+		{ProviderInStore, "", roundCents(ownPart - cardPart - giftCardPart)},
+		{depositProvider, depositIntentID, depositPart},
+	}
+
+	var refund *models.Refund
+	for _, part := range parts {
+		if part.amount <= 0 {
+			continue
+		}
+		r, err := s.issueRefund(ctx, p.ID, part.provider, part.intentID, part.amount, reason, actorID)
+		if err != nil {
+			return refund, err
+		}
+		if refund == nil {
+			refund = r
+		}
+	}
+	return refund, nil
+}
+
+// issueRefund gives back amount through a provider intent, or onto gift cards or at the
+// counter when there is no intent, and returns the ledger entry. It returns nil when the provider accepted the
+// refund but has not settled it yet; its webhook adds it to the ledger.
+func (s *PaymentService) issueRefund(ctx context.Context, paymentID, provider, intentID string, amount float64, reason, actorID string) (*models.Refund, error) {
+	var event *PaymentEvent
+	var err error
+	if intentID != "" {
+		event, err = s.Provider.Refund(ctx, RefundRequest{
+			IntentID:  intentID,
+			PaymentID: paymentID,
+			Amount:    amount,
+			Reason:    reason,
+			ActorID:   actorID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to refund payment: %w", err)
+		}
+	} else {
+		if provider != ProviderGiftCard {
+			provider = ProviderInStore
+		}
+		event = inStoreEvent(EventRefunded, paymentID, amount)
+		event.RefundID = event.ID
+		event.Reason, event.ActorID = reason, actorID
+	}
+	if event == nil {
+		return nil, nil
+	}
+	if err := s.ApplyEvent(ctx, provider, event); err != nil {
+		return nil, err
+	}
+
+	ref := event.RefundID
+	if ref == "" {
+		ref = event.ID
+	}
+	var r models.Refund
+	err = s.DB.QueryRow(ctx,
+		`SELECT id, payment_id, amount, COALESCE(reason, ''), actor_id, provider, provider_ref, created_at
+		 FROM refunds WHERE provider = $1 AND provider_ref = $2`, provider, ref,
+	).Scan(&r.ID, &r.PaymentID, &r.Amount, &r.Reason, &r.ActorID, &r.Provider, &r.ProviderRef, &r.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch refund: %w", err)
+	}
+	return &r, nil
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ResourceNeed is one resource a booking holds while one of its services is performed,
+// relative to the booking start
+type ResourceNeed struct {
+	ResourceID string
+	Offset     time.Duration
+	Length     time.Duration
+	Quantity   int
+}
+
+// ResourceUse is a resource held by an existing appointment's service
+type ResourceUse struct {
+	ResourceID string
+	Interval
+	Quantity int
+}
+
+// ResourceDay is what decides whether the salon's shared resources can take a booking
+type ResourceDay struct {
+	Needs    []ResourceNeed
+	Capacity map[string]int
+	Use      []ResourceUse
+}
+
+// Fits reports whether every resource the booking needs stays within its capacity for
+// the whole time the booking holds it
+func (r *ResourceDay) Fits(start time.Time) bool {
+	if r == nil {
+		return true
+	}
+	for _, n := range r.Needs {
+		window := Interval{Start: start.Add(n.Offset), End: start.Add(n.Offset + n.Length)}
+		if r.peak(n.ResourceID, window)+n.Quantity > r.Capacity[n.ResourceID] {
+			return false
+		}
+	}
+	return true
+}
+
+// peak is the highest number of units of a resource in use at any moment of window.
+// Usage only rises at a use's start, so it is enough to look at window.Start and every
+// use start inside the window.
+func (r *ResourceDay) peak(resourceID string, window Interval) int {
+	var uses []ResourceUse
+	points := []time.Time{window.Start}
+	for _, u := range r.Use {
+		if u.ResourceID == resourceID && u.Overlaps(window) {
+			uses = append(uses, u)
+			if u.Start.After(window.Start) {
+				points = append(points, u.Start)
+			}
+		}
+	}
+
+	peak := 0
+	for _, p := range points {
+		inUse := 0
+		for _, u := range uses {
+			if !p.Before(u.Start) && p.Before(u.End) {
+				inUse += u.Quantity
+			}
+		}
+		if inUse > peak {
+			peak = inUse
+		}
+	}
+	return peak
+}
+
+// lineIDs returns the distinct service ids of a booking
+func lineIDs(lines []serviceLine) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, l := range lines {
+		if !seen[l.ID] {
+			seen[l.ID] = true
+			ids = append(ids, l.ID)
+		}
+	}
+	return ids
+}
+
+// lockResources locks the rows of every resource the services need, in id order, so
+// bookings for different staff members can't both take the last unit of a resource
+func lockResources(ctx context.Context, tx pgx.Tx, lines []serviceLine) error {
+	_, err := tx.Exec(ctx,
+		`SELECT 1 FROM salon_resources
+		 WHERE id IN (SELECT resource_id FROM service_resources WHERE service_id = ANY($1))
+		 ORDER BY id FOR UPDATE`, lineIDs(lines))
+	if err != nil {
+		return fmt.Errorf("failed to lock resources: %w", err)
+	}
+	return nil
+}
+
+// loadResources reads what the services of a booking need and how much of it other
+// appointments of the salon already hold on date. excludeApptID leaves out the appointment
+// being moved. It returns nil when the services need no resources.
+func loadResources(ctx context.Context, q querier, salonID string, date time.Time, lines []serviceLine, excludeApptID string) (*ResourceDay, error) {
+	rows, err := q.Query(ctx,
+		`SELECT sr.service_id, sr.resource_id, sr.quantity, r.capacity
+		 FROM service_resources sr
+		 JOIN salon_resources r ON r.id = sr.resource_id
+		 WHERE sr.service_id = ANY($1) AND r.salon_id = $2 AND r.is_active = true`,
+		lineIDs(lines), salonID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch service resources: %w", err)
+	}
+	type requirement struct {
+		resourceID string
+		quantity   int
+	}
+	required := make(map[string][]requirement)
+	r := &ResourceDay{Capacity: make(map[string]int)}
+	for rows.Next() {
+		var serviceID string
+		var req requirement
+		var capacity int
+		rows.Scan(&serviceID, &req.resourceID, &req.quantity, &capacity)
+		required[serviceID] = append(required[serviceID], req)
+		r.Capacity[req.resourceID] = capacity
+	}
+	rows.Close()
+	if len(r.Capacity) == 0 {
+		return nil, nil
+	}
+
+	// Each service holds its resources for its own duration, not its buffer
+	var offset time.Duration
+	for _, l := range lines {
+		length := time.Duration(l.Duration) * time.Minute
+		for _, req := range required[l.ID] {
+			r.Needs = append(r.Needs, ResourceNeed{
+				ResourceID: req.resourceID,
+				Offset:     offset,
+				Length:     length,
+				Quantity:   req.quantity,
+			})
+		}
+		offset += length + time.Duration(l.Buffer)*time.Minute
+	}
+
+	resourceIDs := make([]string, 0, len(r.Capacity))
+	for id := range r.Capacity {
+		resourceIDs = append(resourceIDs, id)
+	}
+	rows, err = q.Query(ctx,
+		`SELECT sr.resource_id, sr.quantity, aps.start_time::text, aps.end_time::text
+		 FROM appointment_services aps
+		 JOIN appointments a ON a.id = aps.appointment_id
+		 JOIN service_resources sr ON sr.service_id = aps.service_id
+		 WHERE a.salon_id = $1 AND a.appointment_date = $2
+		 AND `+occupiesSlotSQL+`
+		 AND sr.resource_id = ANY($3)
+		 AND a.id IS DISTINCT FROM NULLIF($4, '')::uuid`,
+		salonID, date.Format("2006-01-02"), resourceIDs, excludeApptID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check resource usage: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var u ResourceUse
+		var startStr, endStr string
+		rows.Scan(&u.ResourceID, &u.Quantity, &startStr, &endStr)
+		u.Start, _ = ParseClock(startStr)
+		u.End, _ = ParseClock(endStr)
+		r.Use = append(r.Use, u)
+	}
+	return r, nil
+}
+
+// appointmentLines rebuilds the service lines of an existing appointment from its line
+// items, so that durations and the buffers between them match the booked times (overruns
+// included). It also returns the appointment start.
+func appointmentLines(ctx context.Context, q querier, apptID string) ([]serviceLine, time.Time, error) {
+	rows, err := q.Query(ctx,
+		`SELECT aps.service_id, sv.name, aps.price, aps.start_time::text, aps.end_time::text,
+		 COALESCE(aps.buffer_minutes, 0), COALESCE(sv.category, '')
+		 FROM appointment_services aps
+		 JOIN services sv ON sv.id = aps.service_id
+		 WHERE aps.appointment_id = $1
+		 ORDER BY aps.position`, apptID)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to fetch line items: %w", err)
+	}
+	var lines []serviceLine
+	var starts, ends []time.Time
+	for rows.Next() {
+		var l serviceLine
+		var startStr, endStr string
+		rows.Scan(&l.ID, &l.Name, &l.Price, &startStr, &endStr, &l.Buffer, &l.Category)
+		start, _ := ParseClock(startStr)
+		end, _ := ParseClock(endStr)
+		l.Duration = int(end.Sub(start) / time.Minute)
+		lines = append(lines, l)
+		starts = append(starts, start)
+		ends = append(ends, end)
+	}
+	rows.Close()
+
+	if len(lines) == 0 {
+		// Appointment without line items: the whole appointment is one service
+		var l serviceLine
+		var startStr, endStr string
+		err := q.QueryRow(ctx,
+			`SELECT a.service_id, sv.name, sv.price, a.start_time::text, a.end_time::text,
+			 COALESCE(sv.buffer_minutes, 0), COALESCE(sv.category, '')
+			 FROM appointments a JOIN services sv ON sv.id = a.service_id WHERE a.id = $1`,
+			apptID).Scan(&l.ID, &l.Name, &l.Price, &startStr, &endStr, &l.Buffer, &l.Category)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("appointment not found")
+		}
+		start, _ := ParseClock(startStr)
+		end, _ := ParseClock(endStr)
+		l.Duration = int(end.Sub(start) / time.Minute)
+		return []serviceLine{l}, start, nil
+	}
+
+	// The buffer before the next service is whatever gap the booked times leave
+	for i := 0; i < len(lines)-1; i++ {
+		lines[i].Buffer = int(starts[i+1].Sub(ends[i]) / time.Minute)
+	}
+	return lines, starts[0], nil
+}
+
+// checkAppointmentResources verifies an existing appointment, at its current times, keeps
+// every resource it needs within capacity. The caller must hold the resource locks.
+func checkAppointmentResources(ctx context.Context, tx pgx.Tx, salonID string, date time.Time, apptID string) error {
+	lines, start, err := appointmentLines(ctx, tx, apptID)
+	if err != nil {
+		return err
+	}
+	resources, err := loadResources(ctx, tx, salonID, date, lines, apptID)
+	if err != nil {
+		return err
+	}
+	if !resources.Fits(start) {
+		return ErrResourceUnavailable
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"saloon-backend/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Review report statuses
+const (
+	ReportOpen      = "open"
+	ReportUpheld    = "upheld"
+	ReportDismissed = "dismissed"
+)
+
+// ReviewReplyMaxLength caps the salon's answer to a review, in characters
+const ReviewReplyMaxLength = 1000
+
+var (
+	// ErrReportExists is returned when the user already reported the review
+	ErrReportExists = errors.New("you have already reported this review")
+	// ErrReviewHidden is returned for a report of a review the moderators already hid
+	ErrReviewHidden = errors.New("this review has already been hidden")
+	// ErrReplyInvalid is returned for an empty or too long reply
+	ErrReplyInvalid = fmt.Errorf("reply must be 1 to %d characters", ReviewReplyMaxLength)
+)
+
+// cleanReply trims a reply and checks its length
+func cleanReply(reply string) (string, error) {
+	reply = strings.TrimSpace(reply)
+	if reply == "" || utf8.RuneCountInString(reply) > ReviewReplyMaxLength {
+		return "", ErrReplyInvalid
+	}
+	return reply, nil
+}
+
+// reportableReview is what decides whether a user may report a review
+type reportableReview struct {
+	SalonID         string
+	Hidden          bool
+	AlreadyReported bool // by the same user
+}
+
+// checkReport applies the report rules: the review must belong to salonID when set (an
+// owner reports their own salon's reviews), must still be visible, and each user reports
+// it once
+func checkReport(r reportableReview, salonID string) error {
+	switch {
+	case salonID != "" && r.SalonID != salonID:
+		return ErrReviewNotFound
+	case r.Hidden:
+		return ErrReviewHidden
+	case r.AlreadyReported:
+		return ErrReportExists
+	}
+	return nil
+}
+
+// reportResolution is the status the open reports of a review get when a moderator hides
+// it (upheld) or keeps it (dismissed)
+func reportResolution(hide bool) string {
+	if hide {
+		return ReportUpheld
+	}
+	return ReportDismissed
+}
+
+// Reply sets the salon's public answer to one of its reviews, or removes it when reply is
+// empty. The reviewer is notified of a new answer.
+func (s *ReviewService) Reply(ctx context.Context, salonID, reviewID, userID, reply string) (*models.Review, error) {
+	if reply != "" {
+		var err error
+		if reply, err = cleanReply(reply); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var hadReply bool
+	err = tx.QueryRow(ctx,
+		"SELECT owner_reply IS NOT NULL FROM reviews WHERE id = $1 AND salon_id = $2 FOR UPDATE",
+		reviewID, salonID).Scan(&hadReply)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrReviewNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch review: %w", err)
+	}
+
+	var review models.Review
+	err = ScanReview(tx.QueryRow(ctx,
+		`UPDATE reviews r SET owner_reply = NULLIF($2, ''),
+		 owner_reply_by = CASE WHEN $2 = '' THEN NULL ELSE $3::uuid END,
+		 owner_replied_at = CASE WHEN $2 = '' THEN NULL ELSE NOW() END
+		 WHERE r.id = $1
+		 RETURNING `+ReviewColumns, reviewID, reply, userID), &review)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save reply: %w", err)
+	}
+
+	if reply != "" && !hadReply && !review.IsHidden {
+		_, err = tx.Exec(ctx,
+			`INSERT INTO notifications (user_id, type, title, message, appointment_id)
+			 SELECT $1, 'general', 'The salon replied to your review', s.name || ' replied to your review.', $3
+			 FROM salons s WHERE s.id = $2`,
+			review.CustomerID, salonID, review.AppointmentID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to notify reviewer: %w", err)
+		}
+	}
+	return &review, tx.Commit(ctx)
+}
+
+// Report flags a visible review for the moderators. salonID, when set, limits it to the
+// reviews of that salon (a salon owner reporting a review of their salon).
+func (s *ReviewService) Report(ctx context.Context, reviewID, salonID, reporterID string, req models.ReportReviewRequest) (*models.ReviewReport, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var review reportableReview
+	err = tx.QueryRow(ctx,
+		`SELECT r.salon_id, r.is_hidden,
+		 EXISTS(SELECT 1 FROM review_reports rr WHERE rr.review_id = r.id AND rr.reporter_id = $2)
+		 FROM reviews r WHERE r.id = $1 FOR SHARE`, reviewID, reporterID).Scan(
+		&review.SalonID, &review.Hidden, &review.AlreadyReported)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrReviewNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch review: %w", err)
+	}
+	if err := checkReport(review, salonID); err != nil {
+		return nil, err
+	}
+
+	var report models.ReviewReport
+	err = tx.QueryRow(ctx,
+		`INSERT INTO review_reports (review_id, reporter_id, reason, details)
+		 VALUES ($1, $2, $3, NULLIF($4, ''))
+		 RETURNING id, review_id, reporter_id, reason, COALESCE(details, ''), status, created_at`,
+		reviewID, reporterID, req.Reason, strings.TrimSpace(req.Details)).Scan(
+		&report.ID, &report.ReviewID, &report.ReporterID, &report.Reason, &report.Details,
+		&report.Status, &report.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return nil, ErrReportExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to report review: %w", err)
+	}
+	return &report, tx.Commit(ctx)
+}
+
+// ModerationQueue lists the reviews with open reports, longest waiting first, or the
+// hidden reviews, most recently hidden first, each with the reports against it
+func (s *ReviewService) ModerationQueue(ctx context.Context, hidden bool) ([]models.ModerationItem, error) {
+	query := `SELECT ` + ReviewColumns + `, COALESCE(u.name, ''), s.name,
+		 (SELECT COUNT(*) FROM review_reports rr WHERE rr.review_id = r.id AND rr.status = 'open')
+		 FROM reviews r
+		 JOIN salons s ON s.id = r.salon_id
+		 LEFT JOIN users u ON u.id = r.customer_id`
+	if hidden {
+		query += ` WHERE r.is_hidden ORDER BY r.moderated_at DESC NULLS LAST`
+	} else {
+		query += ` WHERE EXISTS (SELECT 1 FROM review_reports rr WHERE rr.review_id = r.id AND rr.status = 'open')
+		 ORDER BY (SELECT MIN(created_at) FROM review_reports rr WHERE rr.review_id = r.id AND rr.status = 'open')`
+	}
+	rows, err := s.DB.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch moderation queue: %w", err)
+	}
+	defer rows.Close()
+
+	items := []models.ModerationItem{}
+	index := map[string]int{}
+	var ids []string
+	for rows.Next() {
+		var item models.ModerationItem
+		r := &item.Review
+		if err := rows.Scan(&r.ID, &r.CustomerID, &r.SalonID, &r.StaffID, &r.AppointmentID, &r.Rating,
+			&r.Comment, &r.CreatedAt, &r.UpdatedAt, &r.IsVerified,
+			&r.OwnerReply, &r.OwnerRepliedAt, &r.IsHidden, &r.HiddenReason,
+			&r.CustomerName, &item.SalonName, &item.OpenReports); err != nil {
+			return nil, err
+		}
+		item.Reports = []models.ReviewReport{}
+		index[r.ID] = len(items)
+		ids = append(ids, r.ID)
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return items, nil
+	}
+
+	reportRows, err := s.DB.Query(ctx,
+		`SELECT rr.id, rr.review_id, rr.reporter_id, rr.reason, COALESCE(rr.details, ''), rr.status,
+		 rr.resolved_at, rr.created_at, COALESCE(u.name, ''), COALESCE(u.role, '')
+		 FROM review_reports rr
+		 LEFT JOIN users u ON u.id = rr.reporter_id
+		 WHERE rr.review_id = ANY($1)
+		 ORDER BY rr.created_at`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch reports: %w", err)
+	}
+	defer reportRows.Close()
+	for reportRows.Next() {
+		var rp models.ReviewReport
+		if err := reportRows.Scan(&rp.ID, &rp.ReviewID, &rp.ReporterID, &rp.Reason, &rp.Details, &rp.Status,
+			&rp.ResolvedAt, &rp.CreatedAt, &rp.ReporterName, &rp.ReporterRole); err != nil {
+			return nil, err
+		}
+		i := index[rp.ReviewID]
+		items[i].Reports = append(items[i].Reports, rp)
+	}
+	return items, reportRows.Err()
+}
+
+// Hide takes a review out of the salon's listing and rating and upholds its open reports
+func (s *ReviewService) Hide(ctx context.Context, reviewID, adminID, reason string) (*models.Review, error) {
+	return s.moderate(ctx, reviewID, adminID, true, strings.TrimSpace(reason))
+}
+
+// Restore puts a hidden review back, or keeps a reported one, and dismisses its open
+// reports
+func (s *ReviewService) Restore(ctx context.Context, reviewID, adminID string) (*models.Review, error) {
+	return s.moderate(ctx, reviewID, adminID, false, "")
+}
+
+func (s *ReviewService) moderate(ctx context.Context, reviewID, adminID string, hide bool, reason string) (*models.Review, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var salonID string
+	err = tx.QueryRow(ctx, "SELECT salon_id FROM reviews WHERE id = $1 FOR UPDATE", reviewID).Scan(&salonID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrReviewNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch review: %w", err)
+	}
+	if err := lockSalonRating(ctx, tx, salonID); err != nil {
+		return nil, err
+	}
+
+	var review models.Review
+	err = ScanReview(tx.QueryRow(ctx,
+		`UPDATE reviews r SET is_hidden = $2, hidden_reason = NULLIF($3, ''),
+		 moderated_by = $4, moderated_at = NOW()
+		 WHERE r.id = $1
+		 RETURNING `+ReviewColumns, reviewID, hide, reason, adminID), &review)
+	if err != nil {
+		return nil, fmt.Errorf("failed to moderate review: %w", err)
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE review_reports SET status = $2, resolved_by = $3, resolved_at = NOW()
+		 WHERE review_id = $1 AND status = 'open'`, reviewID, reportResolution(hide), adminID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve reports: %w", err)
+	}
+	if err := recomputeSalonRating(ctx, tx, salonID); err != nil {
+		return nil, err
+	}
+	return &review, tx.Commit(ctx)
+}
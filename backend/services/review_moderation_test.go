@@ -0,0 +1,87 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCleanReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain", reply: "Thanks for visiting!", want: "Thanks for visiting!"},
+		{name: "trimmed", reply: "  See you soon \n", want: "See you soon"},
+		{name: "blank", reply: "   ", wantErr: true},
+		{name: "at the limit", reply: strings.Repeat("é", ReviewReplyMaxLength), want: strings.Repeat("é", ReviewReplyMaxLength)},
+		{name: "too long", reply: strings.Repeat("a", ReviewReplyMaxLength+1), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cleanReply(tt.reply)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("cleanReply error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("cleanReply = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckReport(t *testing.T) {
+	visible := reportableReview{SalonID: "salon-1"}
+	tests := []struct {
+		name    string
+		review  reportableReview
+		salonID string
+		want    error
+	}{
+		{name: "customer reports a visible review", review: visible},
+		{name: "owner reports their salon's review", review: visible, salonID: "salon-1"},
+		{name: "owner reports another salon's review", review: visible, salonID: "salon-2", want: ErrReviewNotFound},
+		{name: "already hidden", review: reportableReview{SalonID: "salon-1", Hidden: true}, want: ErrReviewHidden},
+		{name: "reported twice", review: reportableReview{SalonID: "salon-1", AlreadyReported: true}, want: ErrReportExists},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkReport(tt.review, tt.salonID); err != tt.want {
+				t.Errorf("checkReport = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReportResolution(t *testing.T) {
+	if got := reportResolution(true); got != ReportUpheld {
+		t.Errorf("reportResolution(hide) = %s, want %s", got, ReportUpheld)
+	}
+	if got := reportResolution(false); got != ReportDismissed {
+		t.Errorf("reportResolution(restore) = %s, want %s", got, ReportDismissed)
+	}
+}
+
+func TestSalonRating(t *testing.T) {
+	tests := []struct {
+		name      string
+		reviews   []reviewRating
+		want      float64
+		wantCount int
+	}{
+		{name: "no reviews"},
+		{name: "all visible", reviews: []reviewRating{{Rating: 5}, {Rating: 4}, {Rating: 4}}, want: 4.33, wantCount: 3},
+		{name: "hidden one left out", reviews: []reviewRating{{Rating: 5}, {Rating: 4}, {Rating: 1, Hidden: true}}, want: 4.5, wantCount: 2},
+		{name: "restored one counts again", reviews: []reviewRating{{Rating: 5}, {Rating: 4}, {Rating: 1}}, want: 3.33, wantCount: 3},
+		{name: "all hidden", reviews: []reviewRating{{Rating: 1, Hidden: true}, {Rating: 2, Hidden: true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, count := salonRating(tt.reviews)
+			if got != tt.want || count != tt.wantCount {
+				t.Errorf("salonRating = %v, %d, want %v, %d", got, count, tt.want, tt.wantCount)
+			}
+		})
+	}
+}
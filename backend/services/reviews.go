@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"saloon-backend/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ReviewEditWindow is how long after posting a review the customer can still change it
+const ReviewEditWindow = 7 * 24 * time.Hour
+
+var (
+	// ErrReviewNotAllowed is returned for a review of an appointment that isn't the
+	// reviewer's own completed one
+	ErrReviewNotAllowed = errors.New("reviews can only be written for your own completed appointments")
+	// ErrReviewExists is returned for a second review of the same appointment
+	ErrReviewExists = errors.New("this appointment has already been reviewed")
+	// ErrReviewNotFound is returned for a review that isn't the customer's
+	ErrReviewNotFound = errors.New("review not found")
+	// ErrReviewLocked is returned for an edit after the edit window closed
+	ErrReviewLocked = errors.New("reviews can only be edited within 7 days of posting")
+)
+
+// reviewEditable tells whether a review posted at createdAt can still be edited at now
+func reviewEditable(createdAt, now time.Time) bool {
+	return now.Before(createdAt.Add(ReviewEditWindow))
+}
+
+// ReviewColumns are the reviews columns scanned by ScanReview
+const ReviewColumns = `r.id, r.customer_id, r.salon_id, r.staff_id, r.appointment_id, r.rating,
+	COALESCE(r.comment, ''), r.created_at, r.updated_at, r.is_verified,
+	COALESCE(r.owner_reply, ''), r.owner_replied_at, r.is_hidden, COALESCE(r.hidden_reason, '')`
+
+func ScanReview(row pgx.Row, r *models.Review) error {
+	return row.Scan(&r.ID, &r.CustomerID, &r.SalonID, &r.StaffID, &r.AppointmentID, &r.Rating,
+		&r.Comment, &r.CreatedAt, &r.UpdatedAt, &r.IsVerified,
+		&r.OwnerReply, &r.OwnerRepliedAt, &r.IsHidden, &r.HiddenReason)
+}
+
+// lockSalonRating locks the salon row so reviews posted at the same time recompute its
+// rating one after the other, each seeing the others
+func lockSalonRating(ctx context.Context, tx pgx.Tx, salonID string) error {
+	if _, err := tx.Exec(ctx, "SELECT 1 FROM salons WHERE id = $1 FOR UPDATE", salonID); err != nil {
+		return fmt.Errorf("failed to lock salon: %w", err)
+	}
+	return nil
+}
+
+// reviewRating is one review's say in its salon's rating
+type reviewRating struct {
+	Rating int
+	Hidden bool
+}
+
+// salonRating averages the ratings of the reviews that aren't hidden, to two decimals,
+// and counts them
+func salonRating(reviews []reviewRating) (float64, int) {
+	sum, count := 0, 0
+	for _, r := range reviews {
+		if r.Hidden {
+			continue
+		}
+		sum += r.Rating
+		count++
+	}
+	if count == 0 {
+		return 0, 0
+	}
+	return roundCents(float64(sum) / float64(count)), count
+}
+
+// recomputeSalonRating sets a salon's average rating and review count from its reviews
+// that aren't hidden
+func recomputeSalonRating(ctx context.Context, tx pgx.Tx, salonID string) error {
+	rows, err := tx.Query(ctx, "SELECT rating, is_hidden FROM reviews WHERE salon_id = $1", salonID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch ratings: %w", err)
+	}
+	var reviews []reviewRating
+	for rows.Next() {
+		var r reviewRating
+		if err := rows.Scan(&r.Rating, &r.Hidden); err != nil {
+			rows.Close()
+			return err
+		}
+		reviews = append(reviews, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rating, count := salonRating(reviews)
+	_, err = tx.Exec(ctx,
+		"UPDATE salons SET rating = $2, total_reviews = $3, updated_at = NOW() WHERE id = $1",
+		salonID, rating, count)
+	if err != nil {
+		return fmt.Errorf("failed to update salon rating: %w", err)
+	}
+	return nil
+}
+
+type ReviewService struct {
+	DB *pgxpool.Pool
+}
+
+func NewReviewService(db *pgxpool.Pool) *ReviewService {
+	return &ReviewService{DB: db}
+}
+
+// Create posts a customer's review of their completed appointment, for the salon and
+// stylist of that appointment, and updates the salon's rating
+func (s *ReviewService) Create(ctx context.Context, customerID string, req models.CreateReviewRequest) (*models.Review, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var salonID, apptCustomerID, status string
+	var staffID *string
+	err = tx.QueryRow(ctx,
+		"SELECT salon_id, staff_id, customer_id, status FROM appointments WHERE id = $1",
+		req.AppointmentID).Scan(&salonID, &staffID, &apptCustomerID, &status)
+	if err != nil || apptCustomerID != customerID || status != "completed" ||
+		(req.SalonID != "" && req.SalonID != salonID) {
+		return nil, ErrReviewNotAllowed
+	}
+	if err := lockSalonRating(ctx, tx, salonID); err != nil {
+		return nil, err
+	}
+
+	var review models.Review
+	err = ScanReview(tx.QueryRow(ctx,
+		`INSERT INTO reviews AS r (customer_id, salon_id, staff_id, appointment_id, rating, comment, is_verified)
+		 VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), true)
+		 RETURNING `+ReviewColumns,
+		customerID, salonID, staffID, req.AppointmentID, req.Rating, req.Comment), &review)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return nil, ErrReviewExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create review: %w", err)
+	}
+	if err := recomputeSalonRating(ctx, tx, salonID); err != nil {
+		return nil, err
+	}
+	return &review, tx.Commit(ctx)
+}
+
+// Update changes the rating and, when given, the comment of a customer's review within
+// ReviewEditWindow of posting it
+func (s *ReviewService) Update(ctx context.Context, customerID, reviewID string, rating int, comment *string) (*models.Review, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	salonID, createdAt, err := s.lockOwnReview(ctx, tx, customerID, reviewID)
+	if err != nil {
+		return nil, err
+	}
+	if !reviewEditable(createdAt, time.Now()) {
+		return nil, ErrReviewLocked
+	}
+	if err := lockSalonRating(ctx, tx, salonID); err != nil {
+		return nil, err
+	}
+
+	var review models.Review
+	err = ScanReview(tx.QueryRow(ctx,
+		`UPDATE reviews r SET rating = $1,
+		 comment = CASE WHEN $2::text IS NULL THEN r.comment ELSE NULLIF($2, '') END,
+		 updated_at = NOW()
+		 WHERE r.id = $3
+		 RETURNING `+ReviewColumns, rating, comment, reviewID), &review)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update review: %w", err)
+	}
+	if err := recomputeSalonRating(ctx, tx, salonID); err != nil {
+		return nil, err
+	}
+	return &review, tx.Commit(ctx)
+}
+
+// Delete removes a customer's review and updates the salon's rating
+func (s *ReviewService) Delete(ctx context.Context, customerID, reviewID string) error {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	salonID, _, err := s.lockOwnReview(ctx, tx, customerID, reviewID)
+	if err != nil {
+		return err
+	}
+	if err := lockSalonRating(ctx, tx, salonID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM reviews WHERE id = $1", reviewID); err != nil {
+		return fmt.Errorf("failed to delete review: %w", err)
+	}
+	if err := recomputeSalonRating(ctx, tx, salonID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// lockOwnReview locks a customer's review and returns its salon and when it was posted
+func (s *ReviewService) lockOwnReview(ctx context.Context, tx pgx.Tx, customerID, reviewID string) (string, time.Time, error) {
+	var salonID string
+	var createdAt time.Time
+	err := tx.QueryRow(ctx,
+		"SELECT salon_id, created_at FROM reviews WHERE id = $1 AND customer_id = $2 FOR UPDATE",
+		reviewID, customerID).Scan(&salonID, &createdAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", time.Time{}, ErrReviewNotFound
+	}
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to fetch review: %w", err)
+	}
+	return salonID, createdAt, nil
+}
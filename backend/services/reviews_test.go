@@ -0,0 +1,28 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReviewEditable(t *testing.T) {
+	posted := time.Date(2026, 3, 10, 14, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		now  time.Time
+		want bool
+	}{
+		{name: "just posted", now: posted, want: true},
+		{name: "six days later", now: posted.Add(6 * 24 * time.Hour), want: true},
+		{name: "a minute before the window closes", now: posted.Add(ReviewEditWindow - time.Minute), want: true},
+		{name: "when the window closes", now: posted.Add(ReviewEditWindow)},
+		{name: "weeks later", now: posted.Add(30 * 24 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reviewEditable(posted, tt.now); got != tt.want {
+				t.Errorf("reviewEditable(%s) = %v, want %v", tt.now, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"saloon-backend/models"
+)
+
+// SalonWeek returns the hours of all seven weekdays, Sunday first. Weekdays without a
+// salon_hours row use the salon's flat opening and closing time.
+func SalonWeek(ctx context.Context, q querier, salonID string) ([]models.SalonHours, error) {
+	rows, err := q.Query(ctx,
+		`SELECT d.day, COALESCE(h.open_time, s.opening_time)::text, COALESCE(h.close_time, s.closing_time)::text,
+		 COALESCE(h.is_closed, false)
+		 FROM salons s
+		 CROSS JOIN generate_series(0, 6) AS d(day)
+		 LEFT JOIN salon_hours h ON h.salon_id = s.id AND h.day_of_week = d.day
+		 WHERE s.id = $1
+		 ORDER BY d.day`, salonID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch salon hours: %w", err)
+	}
+	defer rows.Close()
+
+	var week []models.SalonHours
+	for rows.Next() {
+		var h models.SalonHours
+		if err := rows.Scan(&h.DayOfWeek, &h.OpenTime, &h.CloseTime, &h.IsClosed); err != nil {
+			return nil, err
+		}
+		week = append(week, h)
+	}
+	if len(week) != 7 {
+		return nil, fmt.Errorf("salon not found")
+	}
+	return week, nil
+}
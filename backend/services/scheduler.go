@@ -2,13 +2,22 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// ReminderPollInterval is how often the worker looks for due reminder jobs
+const ReminderPollInterval = 30 * time.Second
+
+// reminderBatch caps how many jobs one poll works through before sleeping again
+const reminderBatch = 50
+
 type Scheduler struct {
 	DB   *pgxpool.Pool
 	Push *PushService
@@ -18,125 +27,235 @@ func NewScheduler(db *pgxpool.Pool, push *PushService) *Scheduler {
 	return &Scheduler{DB: db, Push: push}
 }
 
-// Start begins the background reminder loop. Call this in a goroutine.
+// execer is satisfied by both *pgxpool.Pool and pgx.Tx
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// EnqueueReminders (re)queues the reminder jobs of an appointment at the salon's
+// reminder offsets. Call it inside the transaction that creates or moves the
+// appointment. Unsent jobs of a moved appointment are reset to its new time; reminders
+// already sent, or given up on, are left alone.
+func EnqueueReminders(ctx context.Context, db execer, apptID string) error {
+	_, err := db.Exec(ctx,
+		`INSERT INTO reminder_jobs (appointment_id, offset_minutes, run_at)
+		 SELECT a.id, o.minutes, ((a.appointment_date + a.start_time) AT TIME ZONE s.timezone) - make_interval(mins => o.minutes)
+		 FROM appointments a
+		 JOIN salons s ON s.id = a.salon_id
+		 CROSS JOIN LATERAL unnest(s.reminder_offsets) AS o(minutes)
+		 WHERE a.id = $1
+		 AND ((a.appointment_date + a.start_time) AT TIME ZONE s.timezone) - make_interval(mins => o.minutes) > NOW()
+		 ON CONFLICT (appointment_id, offset_minutes) DO UPDATE
+		 SET run_at = EXCLUDED.run_at, status = 'pending', attempts = 0, last_error = NULL,
+		     updated_at = NOW()
+		 WHERE reminder_jobs.status IN ('pending', 'skipped')
+		 AND reminder_jobs.run_at IS DISTINCT FROM EXCLUDED.run_at`, apptID)
+	if err != nil {
+		return fmt.Errorf("failed to queue reminders: %w", err)
+	}
+	return nil
+}
+
+// RequeueSalonReminders rebuilds the pending reminder jobs of a salon's upcoming
+// appointments. Call it inside the transaction that changes the salon's timezone or
+// reminder offsets, since run_at was worked out from the old ones.
+func RequeueSalonReminders(ctx context.Context, tx pgx.Tx, salonID string) error {
+	_, err := tx.Exec(ctx,
+		`DELETE FROM reminder_jobs j USING appointments a
+		 WHERE a.id = j.appointment_id AND a.salon_id = $1 AND j.status = 'pending'`, salonID)
+	if err != nil {
+		return fmt.Errorf("failed to clear reminders: %w", err)
+	}
+
+	rows, err := tx.Query(ctx,
+		`SELECT id FROM appointments
+		 WHERE salon_id = $1 AND status IN ('awaiting_deposit', 'pending', 'confirmed')
+		 AND appointment_date >= CURRENT_DATE - 1`, salonID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch upcoming appointments: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := EnqueueReminders(ctx, tx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start runs the reminder worker until ctx is cancelled. Call this in a goroutine.
+// Any number of replicas can run it: jobs are claimed with FOR UPDATE SKIP LOCKED.
 func (s *Scheduler) Start(ctx context.Context) {
-	log.Println("📅 Appointment reminder scheduler started (1-hour optimized mode)")
-	ticker := time.NewTicker(1 * time.Hour)
+	log.Println("📅 Appointment reminder worker started")
+	ticker := time.NewTicker(ReminderPollInterval)
 	defer ticker.Stop()
 
-	// Run immediately on start
-	s.checkReminders(ctx)
+	// Run immediately on start to catch up on anything due during downtime
+	s.processDue(ctx)
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("📅 Scheduler stopped")
+			log.Println("📅 Reminder worker stopped")
 			return
 		case <-ticker.C:
-			s.checkReminders(ctx)
+			s.processDue(ctx)
 		}
 	}
 }
 
-func (s *Scheduler) checkReminders(ctx context.Context) {
-	// Look ahead for appointments in the next 1 hour + 5 min buffer
-	s.queryAndSchedule(ctx, 65)
+func (s *Scheduler) processDue(ctx context.Context) {
+	for i := 0; i < reminderBatch && ctx.Err() == nil; i++ {
+		more, err := s.processOne(ctx)
+		if err != nil {
+			log.Printf("Scheduler: %v", err)
+			return
+		}
+		if !more {
+			return
+		}
+	}
 }
 
-func (s *Scheduler) queryAndSchedule(ctx context.Context, lookaheadMinutes int) {
-	// Query for appointments that need EITHER 1h or 20m reminders in the next window
-	query := `
-		SELECT a.id, a.customer_id, a.appointment_date, a.start_time, 
-		       s.name AS service_name, sal.name AS salon_name,
-		       a.reminder_1h_sent, a.reminder_20m_sent
-		FROM appointments a
-		JOIN services s ON s.id = a.service_id
-		JOIN salons sal ON sal.id = a.salon_id
-		WHERE a.status IN ('confirmed', 'pending')
-		  AND (a.reminder_1h_sent = false OR a.reminder_20m_sent = false)
-		  AND (a.appointment_date + a.start_time) BETWEEN 
-		      NOW() AND (NOW() + INTERVAL '1 minute' * $1)
-	`
-	rows, err := s.DB.Query(ctx, query, lookaheadMinutes)
+// processOne claims a single due job and runs it in its own transaction, so the row
+// stays locked (and invisible to other workers) until its outcome is recorded.
+// It reports whether a job was found.
+func (s *Scheduler) processOne(ctx context.Context) (bool, error) {
+	tx, err := s.DB.Begin(ctx)
 	if err != nil {
-		log.Printf("Scheduler: query error: %v", err)
-		return
+		return false, fmt.Errorf("failed to start transaction: %w", err)
 	}
-	defer rows.Close()
+	defer tx.Rollback(ctx)
 
-	for rows.Next() {
-		var apptID, customerID, serviceName, salonName string
-		var apptDate time.Time
-		var startTimeStr string
-		var sent1h, sent20m bool
-
-		if err := rows.Scan(&apptID, &customerID, &apptDate, &startTimeStr, &serviceName, &salonName, &sent1h, &sent20m); err != nil {
-			log.Printf("Scheduler: scan error: %v", err)
-			continue
-		}
-
-		// Parse full appointment time
-		format := "15:04:05"
-		if len(startTimeStr) == 5 {
-			format = "15:04"
-		}
-		st, _ := time.Parse(format, startTimeStr)
-		apptTime := time.Date(apptDate.Year(), apptDate.Month(), apptDate.Day(), st.Hour(), st.Minute(), 0, 0, time.Local)
-
-		// Schedule 1h reminder
-		if !sent1h {
-			s.ScheduleReminder(ctx, apptTime, 60, apptID, customerID, serviceName, salonName, "reminder_1h_sent", "Appointment in 1 Hour", "Your appointment for %s at %s is in 1 hour. Get ready! 💇")
-		}
-
-		// Schedule 20m reminder
-		if !sent20m {
-			s.ScheduleReminder(ctx, apptTime, 20, apptID, customerID, serviceName, salonName, "reminder_20m_sent", "Appointment in 20 Minutes", "Your appointment for %s at %s starts in 20 minutes. Head over! 🏃")
-		}
+	var jobID, apptID, customerID, apptStatus, dateStr, startStr, serviceName, salonName, timezone string
+	var attempts, maxAttempts int
+	err = tx.QueryRow(ctx,
+		`SELECT j.id, j.attempts, j.max_attempts, a.id, a.customer_id, a.status,
+		 a.appointment_date::text, a.start_time::text,
+		 COALESCE((SELECT string_agg(lsv.name, ' + ' ORDER BY aps.position)
+		           FROM appointment_services aps JOIN services lsv ON lsv.id = aps.service_id
+		           WHERE aps.appointment_id = a.id), sv.name),
+		 s.name, s.timezone
+		 FROM reminder_jobs j
+		 JOIN appointments a ON a.id = j.appointment_id
+		 JOIN services sv ON sv.id = a.service_id
+		 JOIN salons s ON s.id = a.salon_id
+		 WHERE j.status = 'pending' AND j.run_at <= NOW()
+		 ORDER BY j.run_at
+		 LIMIT 1
+		 FOR UPDATE OF j SKIP LOCKED`).Scan(&jobID, &attempts, &maxAttempts, &apptID, &customerID, &apptStatus,
+		&dateStr, &startStr, &serviceName, &salonName, &timezone)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim reminder job: %w", err)
 	}
-}
 
-func (s *Scheduler) ScheduleReminder(ctx context.Context, apptTime time.Time, minBefore int, apptID, customerID, serviceName, salonName, column, title, template string) {
-	reminderTime := apptTime.Add(-time.Duration(minBefore) * time.Minute)
-	delay := time.Until(reminderTime)
+	apptTime, _ := AppointmentTime(dateStr, startStr, SalonLocation(timezone))
+	until := time.Until(apptTime)
 
-	// If the time has already passed but is very recent (e.g. within 1 min), send it now
-	if delay <= 0 && delay > -1*time.Minute {
-		delay = 0
+	// Cancelled, no-show or already started: nothing left to remind about
+	if (apptStatus != "pending" && apptStatus != "confirmed") || until <= 0 {
+		tx.Exec(ctx, "UPDATE reminder_jobs SET status = 'skipped', updated_at = NOW() WHERE id = $1", jobID)
+		return true, tx.Commit(ctx)
 	}
 
-	if delay >= 0 {
-		time.AfterFunc(delay, func() {
-			s.executeReminder(context.Background(), apptID, customerID, serviceName, salonName, column, title, template)
-		})
+	if err := s.sendReminder(ctx, tx, apptID, customerID, serviceName, salonName, until); err != nil {
+		attempts++
+		if attempts >= maxAttempts {
+			log.Printf("📅 Reminder job %s dead-lettered after %d attempts: %v", jobID, attempts, err)
+			tx.Exec(ctx,
+				`UPDATE reminder_jobs SET status = 'dead', attempts = $1, last_error = $2, updated_at = NOW()
+				 WHERE id = $3`, attempts, err.Error(), jobID)
+		} else {
+			tx.Exec(ctx,
+				`UPDATE reminder_jobs SET attempts = $1, last_error = $2, run_at = NOW() + $3::interval, updated_at = NOW()
+				 WHERE id = $4`, attempts, err.Error(), fmt.Sprintf("%d seconds", int(reminderBackoff(attempts).Seconds())), jobID)
+		}
+		return true, tx.Commit(ctx)
 	}
-}
 
-func (s *Scheduler) executeReminder(ctx context.Context, apptID, customerID, serviceName, salonName, column, title, template string) {
-	// Re-verify the appointment hasn't been cancelled or already sent by another process
-	var alreadySent bool
-	err := s.DB.QueryRow(ctx, fmt.Sprintf("SELECT %s FROM appointments WHERE id = $1 AND status NOT IN ('cancelled', 'no_show')", column), apptID).Scan(&alreadySent)
-	if err != nil || alreadySent {
-		return
-	}
+	tx.Exec(ctx,
+		`UPDATE reminder_jobs SET status = 'sent', attempts = attempts + 1, sent_at = NOW(), last_error = NULL, updated_at = NOW()
+		 WHERE id = $1`, jobID)
+	log.Printf("📅 Reminder sent: %s for user %s", serviceName, customerID[:8])
+	return true, tx.Commit(ctx)
+}
 
-	body := fmt.Sprintf(template, serviceName, salonName)
+// sendReminder records the in-app notification and pushes the reminder. The text uses the
+// time actually left, so a reminder delivered late after a retry still reads correctly.
+// The notification goes in under a savepoint: when it or the push fails, only the savepoint
+// is rolled back and the job's transaction can still record the failed attempt.
+func (s *Scheduler) sendReminder(ctx context.Context, tx pgx.Tx, apptID, customerID, serviceName, salonName string, until time.Duration) error {
+	left := humanizeDuration(until)
+	title := "Appointment in " + left
+	body := fmt.Sprintf("Your appointment for %s at %s starts in %s. See you soon! 💇", serviceName, salonName, left)
 
-	// 1. Send Push
-	s.Push.SendToUser(ctx, customerID, PushPayload{
-		Title: title,
-		Body:  body,
-		Icon:  "/vite.svg",
-		URL:   "/appointments",
-	})
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create savepoint: %w", err)
+	}
+	defer sp.Rollback(ctx)
 
-	// 2. Create In-App
-	s.DB.Exec(ctx,
+	_, err = sp.Exec(ctx,
 		`INSERT INTO notifications (user_id, type, title, message, appointment_id)
 		 VALUES ($1, 'appointment_reminder', $2, $3, $4)`,
 		customerID, title, body, apptID)
+	if err != nil {
+		return err
+	}
 
-	// 3. Mark Sent
-	s.DB.Exec(ctx, fmt.Sprintf("UPDATE appointments SET %s = true WHERE id = $1", column), apptID)
+	if s.Push != nil {
+		if err := s.Push.SendToUser(ctx, customerID, PushPayload{
+			Title: title,
+			Body:  body,
+			Icon:  "/vite.svg",
+			URL:   "/appointments",
+		}); err != nil {
+			return err
+		}
+	}
+	return sp.Commit(ctx)
+}
 
-	log.Printf("📅 Reminder sent (%s): %s for user %s", column, serviceName, customerID[:8])
+// reminderBackoff doubles the wait after each failed attempt: 1m, 2m, 4m ... capped at 1h
+func reminderBackoff(attempt int) time.Duration {
+	if attempt > 6 {
+		return time.Hour
+	}
+	return time.Minute << (attempt - 1)
+}
+
+// humanizeDuration renders a reminder lead time like "1 hour", "20 minutes" or "1 day"
+func humanizeDuration(d time.Duration) string {
+	minutes := int((d + 30*time.Second) / time.Minute)
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s", unit)
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	switch {
+	case minutes >= 24*60 && minutes%(24*60) == 0:
+		return plural(minutes/(24*60), "day")
+	case minutes >= 60 && minutes%60 == 0:
+		return plural(minutes/60, "hour")
+	case minutes > 90:
+		return plural((minutes+30)/60, "hour")
+	}
+	return plural(minutes, "minute")
 }
@@ -0,0 +1,343 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"saloon-backend/models"
+)
+
+// conflictReason maps booking errors onto the availability reasons used by TimeSlot
+func conflictReason(err error) string {
+	switch {
+	case errors.Is(err, ErrSlotBooked):
+		return ReasonBooked
+	case errors.Is(err, ErrSalonClosed):
+		return ReasonClosed
+	case errors.Is(err, ErrStaffUnavailable):
+		return ReasonOutOfShift
+	case errors.Is(err, ErrStaffTimeOff):
+		return ReasonTimeOff
+	case errors.Is(err, ErrStaffOnBreak):
+		return ReasonBreak
+	case errors.Is(err, ErrResourceUnavailable):
+		return ReasonResource
+	case errors.Is(err, ErrInPast):
+		return "past"
+	}
+	return err.Error()
+}
+
+// CreateSeries stores a recurring series and books every occurrence through the regular
+// locking path. Occurrences that conflict are reported and skipped, not fatal.
+func (s *BookingService) CreateSeries(ctx context.Context, customerID string, req models.CreateSeriesRequest) (*models.SeriesResponse, error) {
+	if req.Interval == 0 {
+		req.Interval = 1
+	}
+	rule := RecurrenceRule{Frequency: req.Frequency, Interval: req.Interval}
+	if req.Count != nil {
+		rule.Count = *req.Count
+	}
+	if req.UntilDate != "" {
+		until, err := time.Parse("2006-01-02", req.UntilDate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid until_date format, use YYYY-MM-DD")
+		}
+		rule.Until = until
+	}
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+
+	startDate, err := time.Parse("2006-01-02", req.StartDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start_date format, use YYYY-MM-DD")
+	}
+	if _, err := time.Parse("15:04", req.StartTime); err != nil {
+		return nil, fmt.Errorf("invalid start time format, use HH:MM")
+	}
+
+	serviceIDs := RequestedServiceIDs(req.ServiceID, req.ServiceIDs)
+	lines, serviceSalonID, err := s.loadServiceLines(ctx, serviceIDs)
+	if err != nil {
+		return nil, err
+	}
+	if serviceSalonID != req.SalonID {
+		return nil, fmt.Errorf("service does not belong to this salon")
+	}
+	if depositFor(lines) > 0 {
+		return nil, ErrSeriesDeposit
+	}
+
+	var series models.AppointmentSeries
+	err = s.DB.QueryRow(ctx,
+		`INSERT INTO appointment_series (customer_id, salon_id, staff_id, service_ids, frequency, interval, count, until_date, start_date, start_time, notes)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, '')::date, $9, $10, $11)
+		 RETURNING id, customer_id, salon_id, staff_id, service_ids::text[], frequency, interval, count, until_date::text,
+		 start_date::text, start_time::text, COALESCE(notes,''), status, created_at, updated_at`,
+		customerID, req.SalonID, req.StaffID, serviceIDs, req.Frequency, req.Interval, req.Count, req.UntilDate,
+		req.StartDate, req.StartTime, req.Notes,
+	).Scan(&series.ID, &series.CustomerID, &series.SalonID, &series.StaffID, &series.ServiceIDs,
+		&series.Frequency, &series.Interval, &series.Count, &series.UntilDate,
+		&series.StartDate, &series.StartTime, &series.Notes, &series.Status, &series.CreatedAt, &series.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create series: %w", err)
+	}
+
+	resp := &models.SeriesResponse{Series: series, Occurrences: []models.SeriesOccurrence{}}
+	for i, d := range rule.Dates(startDate) {
+		occ := models.SeriesOccurrence{Occurrence: i + 1, Date: d.Format("2006-01-02"), StartTime: req.StartTime}
+
+		appt, _, err := s.book(ctx, customerID, models.BookAppointmentRequest{
+			SalonID:    req.SalonID,
+			StaffID:    req.StaffID,
+			ServiceIDs: serviceIDs,
+			Date:       occ.Date,
+			StartTime:  req.StartTime,
+			Notes:      req.Notes,
+		}, bookingOptions{SeriesID: &series.ID, Occurrence: i + 1, Quiet: true})
+		if err != nil {
+			occ.Status = "conflict"
+			occ.Reason = conflictReason(err)
+			resp.ConflictCount++
+		} else {
+			occ.Status = "booked"
+			occ.AppointmentID = &appt.ID
+			resp.BookedCount++
+		}
+		resp.Occurrences = append(resp.Occurrences, occ)
+	}
+
+	// One summary notification instead of one per occurrence
+	s.DB.Exec(ctx,
+		`INSERT INTO notifications (user_id, type, title, message)
+		 VALUES ($1, 'appointment_confirmed', 'Recurring Appointments Booked', $2)`,
+		customerID,
+		fmt.Sprintf("%d of %d appointments for %s (every %d %s at %s) were booked.",
+			resp.BookedCount, len(resp.Occurrences), joinServiceNames(lines), req.Interval, frequencyUnit(req.Frequency), req.StartTime))
+
+	return resp, nil
+}
+
+func frequencyUnit(frequency string) string {
+	switch frequency {
+	case "daily":
+		return "day(s)"
+	case "weekly":
+		return "week(s)"
+	}
+	return "month(s)"
+}
+
+// GetSeries returns the series with all of its materialized appointments
+func (s *BookingService) GetSeries(ctx context.Context, seriesID string) (*models.AppointmentSeries, error) {
+	var series models.AppointmentSeries
+	err := s.DB.QueryRow(ctx,
+		`SELECT id, customer_id, salon_id, staff_id, service_ids::text[], frequency, interval, count, until_date::text,
+		 start_date::text, start_time::text, COALESCE(notes,''), status, created_at, updated_at
+		 FROM appointment_series WHERE id = $1`, seriesID,
+	).Scan(&series.ID, &series.CustomerID, &series.SalonID, &series.StaffID, &series.ServiceIDs,
+		&series.Frequency, &series.Interval, &series.Count, &series.UntilDate,
+		&series.StartDate, &series.StartTime, &series.Notes, &series.Status, &series.CreatedAt, &series.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("series not found")
+	}
+
+	rows, err := s.DB.Query(ctx,
+		`SELECT id, customer_id, salon_id, staff_id, service_id, appointment_date::text, start_time::text,
+		 end_time::text, status, COALESCE(notes,''), promo_code_id, series_id, created_at, updated_at
+		 FROM appointments WHERE series_id = $1
+		 ORDER BY appointment_date, start_time`, seriesID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a models.Appointment
+		rows.Scan(&a.ID, &a.CustomerID, &a.SalonID, &a.StaffID, &a.ServiceID, &a.AppointmentDate,
+			&a.StartTime, &a.EndTime, &a.Status, &a.Notes, &a.PromoCodeID, &a.SeriesID, &a.CreatedAt, &a.UpdatedAt)
+		series.Appointments = append(series.Appointments, a)
+	}
+	if series.Appointments == nil {
+		series.Appointments = []models.Appointment{}
+	}
+	return &series, nil
+}
+
+// seriesUpcoming selects the occurrences of series $1 that CancelSeries cancels: those
+// still ahead on/after $2 ("" = today in the salon's timezone)
+const seriesUpcoming = `series_id = $1 AND status IN ('pending', 'confirmed')
+	 AND appointment_date >= COALESCE(NULLIF($2, '')::date,
+	     (SELECT (NOW() AT TIME ZONE timezone)::date FROM salons WHERE salons.id = appointments.salon_id))`
+
+// QuoteSeriesCancellation quotes cancelling each upcoming occurrence on/after fromDate
+// now, as the customer, keyed by appointment
+func (s *BookingService) QuoteSeriesCancellation(ctx context.Context, seriesID, fromDate string) (map[string]*models.CancellationQuote, error) {
+	rows, err := s.DB.Query(ctx, "SELECT id FROM appointments WHERE "+seriesUpcoming, seriesID, fromDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch occurrences: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	quotes := make(map[string]*models.CancellationQuote, len(ids))
+	for _, id := range ids {
+		if quotes[id], err = s.QuoteCancellation(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	return quotes, nil
+}
+
+// SeriesCancellationCost adds up the late-cancel fees and forfeited plan credits of the
+// quoted occurrences
+func SeriesCancellationCost(quotes map[string]*models.CancellationQuote) (float64, int) {
+	var fees float64
+	var credits int
+	for _, q := range quotes {
+		fees += q.Fee
+		credits += q.CreditsForfeited
+	}
+	return roundCents(fees), credits
+}
+
+// CancelSeries cancels every upcoming occurrence on/after fromDate ("" = today) and, when
+// cancelling from today, ends the series. actorID is who cancelled, for the refund ledger.
+// A customer's cancellation passes the quotes of QuoteSeriesCancellation: occurrences
+// inside the free-cancel window are charged the late-cancel fee and settled as late
+// cancellations, like CancelAppointment does. The salon's cancellations (nil quotes) are
+// free. It returns the cancelled appointments so the caller can release their slots to the
+// waitlist.
+func (s *BookingService) CancelSeries(ctx context.Context, seriesID, fromDate, actorID string, quotes map[string]*models.CancellationQuote) ([]models.Appointment, error) {
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx,
+		`UPDATE appointments SET status = 'cancelled', updated_at = NOW()
+		 WHERE `+seriesUpcoming+`
+		 RETURNING id, customer_id, salon_id, staff_id, service_id, appointment_date::text, start_time::text`,
+		seriesID, fromDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel series: %w", err)
+	}
+	var cancelled []models.Appointment
+	for rows.Next() {
+		var a models.Appointment
+		rows.Scan(&a.ID, &a.CustomerID, &a.SalonID, &a.StaffID, &a.ServiceID, &a.AppointmentDate, &a.StartTime)
+		cancelled = append(cancelled, a)
+	}
+	rows.Close()
+
+	if fromDate == "" {
+		_, err = tx.Exec(ctx,
+			"UPDATE appointment_series SET status = 'cancelled', updated_at = NOW() WHERE id = $1", seriesID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to cancel series: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	// Charge the late-cancel fee or release or refund each payment through the provider,
+	// outside the transaction, then settle the discounts as on-time or late cancellations
+	byEvent := map[string][]string{}
+	for _, a := range cancelled {
+		var quote *models.CancellationQuote
+		if quotes != nil {
+			if quote = quotes[a.ID]; quote == nil {
+				quote = &models.CancellationQuote{} // became upcoming after it was quoted
+			}
+		}
+		fee, event := CancellationCharge(quote)
+		if s.Payments != nil {
+			if err := s.Payments.ChargeFee(ctx, a.ID, FeeLateCancel, fee, actorID); err != nil {
+				log.Printf("⚠️  Payment for appointment %s: %v", a.ID, err)
+			}
+		}
+		byEvent[event] = append(byEvent[event], a.ID)
+	}
+	for event, ids := range byEvent {
+		if err := SettleDiscounts(ctx, s.DB, ids, event); err != nil {
+			log.Printf("Discounts of series %s: %v", seriesID, err)
+		}
+	}
+	return cancelled, nil
+}
+
+// RescheduleSeries moves every upcoming occurrence to a new start time (and optionally a
+// different day). Each move runs in its own transaction under the staff row lock; an
+// occurrence that would conflict stays where it is and is reported.
+func (s *BookingService) RescheduleSeries(ctx context.Context, seriesID string, req models.RescheduleSeriesRequest) ([]models.SeriesOccurrence, error) {
+	newStart, err := time.Parse("15:04", req.StartTime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start time format, use HH:MM")
+	}
+
+	rows, err := s.DB.Query(ctx,
+		`SELECT id, salon_id, staff_id, appointment_date::text, start_time::text, COALESCE(series_occurrence, 0)
+		 FROM appointments
+		 WHERE series_id = $1 AND status IN ('pending', 'confirmed')
+		 AND appointment_date >= COALESCE(NULLIF($2, '')::date,
+		     (SELECT (NOW() AT TIME ZONE timezone)::date FROM salons WHERE salons.id = appointments.salon_id))
+		 ORDER BY appointment_date, start_time`, seriesID, req.FromDate)
+	if err != nil {
+		return nil, err
+	}
+	type upcoming struct {
+		id, salonID, staffID, date, start string
+		occurrence                        int
+	}
+	var list []upcoming
+	for rows.Next() {
+		var u upcoming
+		rows.Scan(&u.id, &u.salonID, &u.staffID, &u.date, &u.start, &u.occurrence)
+		list = append(list, u)
+	}
+	rows.Close()
+
+	results := []models.SeriesOccurrence{}
+	for _, u := range list {
+		d, _ := time.Parse("2006-01-02", u.date)
+		d = d.AddDate(0, 0, req.DayOffset)
+		occ := models.SeriesOccurrence{
+			Occurrence:    u.occurrence,
+			Date:          d.Format("2006-01-02"),
+			StartTime:     req.StartTime,
+			AppointmentID: &u.id,
+		}
+
+		if err := s.moveAppointment(ctx, u.id, u.salonID, u.staffID, u.start, d, newStart, false); err != nil {
+			occ.Status = "conflict"
+			occ.Reason = conflictReason(err)
+		} else {
+			occ.Status = "rescheduled"
+		}
+		results = append(results, occ)
+	}
+
+	s.DB.Exec(ctx,
+		"UPDATE appointment_series SET start_time = $1, updated_at = NOW() WHERE id = $2",
+		req.StartTime, seriesID)
+
+	return results, nil
+}
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"saloon-backend/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// AnyStaff is the staff_id value a customer sends when any stylist will do
+const AnyStaff = "any"
+
+// How the server picks a stylist for an "any staff" booking
+const (
+	PreferRoundRobin  = "round_robin"  // the stylist who was assigned least recently
+	PreferLeastBooked = "least_booked" // the stylist with the fewest bookings that day
+	PreferHighRated   = "highest_rated"
+)
+
+// eligibleStaff returns the active staff of the salon who perform every one of the services
+func eligibleStaff(ctx context.Context, q querier, salonID string, lines []serviceLine) ([]string, error) {
+	distinct := make(map[string]bool)
+	var ids []string
+	for _, l := range lines {
+		if !distinct[l.ID] {
+			distinct[l.ID] = true
+			ids = append(ids, l.ID)
+		}
+	}
+
+	rows, err := q.Query(ctx,
+		`SELECT st.id FROM staff st
+		 JOIN staff_services ss ON ss.staff_id = st.id
+		 WHERE st.salon_id = $1 AND st.is_active = true AND ss.service_id = ANY($2)
+		 GROUP BY st.id
+		 HAVING COUNT(DISTINCT ss.service_id) = $3
+		 ORDER BY st.id`, salonID, ids, len(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch staff: %w", err)
+	}
+	defer rows.Close()
+
+	var staff []string
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		staff = append(staff, id)
+	}
+	return staff, nil
+}
+
+// assignStaff picks a stylist for an "any staff" booking inside tx. Every candidate's
+// staff row is locked up front (in id order, so concurrent bookings can't deadlock)
+// before they are ranked by preference and checked with the availability engine.
+// movingApptID is an existing appointment being handed over, whose resources are not
+// counted twice.
+func assignStaff(ctx context.Context, tx pgx.Tx, salonID string, lines []serviceLine, preference string, date, start time.Time, movingApptID string) (string, error) {
+	candidates, err := eligibleStaff(ctx, tx, salonID, lines)
+	if err != nil {
+		return "", err
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no staff member offers this service")
+	}
+
+	if _, err := tx.Exec(ctx,
+		"SELECT 1 FROM staff WHERE id = ANY($1) ORDER BY id FOR UPDATE", candidates); err != nil {
+		return "", fmt.Errorf("failed to lock staff rows: %w", err)
+	}
+
+	// Resources are shared by every stylist, so a full resource rules the time out for all
+	if err := lockResources(ctx, tx, lines); err != nil {
+		return "", err
+	}
+	resources, err := loadResources(ctx, tx, salonID, date, lines, movingApptID)
+	if err != nil {
+		return "", err
+	}
+	if !resources.Fits(start) {
+		return "", ErrResourceUnavailable
+	}
+
+	var order string
+	switch preference {
+	case "", PreferRoundRobin:
+		order = `SELECT st.id FROM staff st
+		 LEFT JOIN appointments a ON a.staff_id = st.id AND a.status <> 'cancelled'
+		 WHERE st.id = ANY($1)
+		 GROUP BY st.id ORDER BY MAX(a.created_at) NULLS FIRST, st.id`
+	case PreferLeastBooked:
+		order = `SELECT st.id FROM staff st
+		 LEFT JOIN appointments a ON a.staff_id = st.id AND a.appointment_date = $2
+		 AND a.status NOT IN ('cancelled', 'no_show')
+		 WHERE st.id = ANY($1)
+		 GROUP BY st.id ORDER BY COUNT(a.id), st.id`
+	case PreferHighRated:
+		order = `SELECT st.id FROM staff st
+		 LEFT JOIN reviews r ON r.staff_id = st.id AND NOT r.is_hidden
+		 WHERE st.id = ANY($1)
+		 GROUP BY st.id ORDER BY AVG(r.rating) DESC NULLS LAST, COUNT(r.id) DESC, st.id`
+	default:
+		return "", fmt.Errorf("staff_preference must be round_robin, least_booked or highest_rated")
+	}
+
+	args := []any{candidates}
+	if preference == PreferLeastBooked {
+		args = append(args, date.Format("2006-01-02"))
+	}
+	rows, err := tx.Query(ctx, order, args...)
+	if err != nil {
+		return "", fmt.Errorf("failed to rank staff: %w", err)
+	}
+	var ranked []string
+	for rows.Next() {
+		var id string
+		rows.Scan(&id)
+		ranked = append(ranked, id)
+	}
+	rows.Close()
+
+	serviceLen := time.Duration(serviceMinutes(lines)) * time.Minute
+	blockLen := time.Duration(blockMinutes(lines)) * time.Minute
+	for _, staffID := range ranked {
+		day, err := loadDay(ctx, tx, salonID, staffID, date, "")
+		if err != nil {
+			return "", err
+		}
+		if day.Check(start, serviceLen, blockLen) == ReasonAvailable {
+			return staffID, nil
+		}
+	}
+	return "", ErrSlotBooked
+}
+
+// GetAnyStaffSlots merges the slots of every staff member who can perform the services:
+// a start time is available when at least one of them is free.
+func (s *BookingService) GetAnyStaffSlots(ctx context.Context, serviceIDs []string, dateStr string) ([]models.TimeSlot, error) {
+	lines, salonID, err := s.loadServiceLines(ctx, serviceIDs)
+	if err != nil {
+		return nil, err
+	}
+	date, err := time.Parse("2006-01-02", dateStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date")
+	}
+
+	staff, err := eligibleStaff(ctx, s.DB, salonID, lines)
+	if err != nil {
+		return nil, err
+	}
+
+	resources, err := loadResources(ctx, s.DB, salonID, date, lines, "")
+	if err != nil {
+		return nil, err
+	}
+
+	serviceLen := time.Duration(serviceMinutes(lines)) * time.Minute
+	blockLen := time.Duration(blockMinutes(lines)) * time.Minute
+
+	var perStaff [][]models.TimeSlot
+	for _, staffID := range staff {
+		day, err := loadDay(ctx, s.DB, salonID, staffID, date, "")
+		if err != nil {
+			return nil, err
+		}
+		day.Resources = resources
+		if day.Closed {
+			return []models.TimeSlot{{
+				StartTime:          day.SalonOpen.Format("15:04"),
+				EndTime:            day.SalonClose.Format("15:04"),
+				Available:          false,
+				AvailabilityReason: ReasonClosed,
+			}}, nil
+		}
+		day.HidePast(date, time.Now())
+		perStaff = append(perStaff, day.Slots(serviceLen, blockLen))
+	}
+
+	return MergeSlots(perStaff), nil
+}
+
+// reasonRank decides which reason a merged slot reports when nobody is free
+var reasonRank = map[string]int{
+	ReasonAvailable:  3,
+	ReasonBooked:     2,
+	ReasonResource:   2,
+	ReasonOutOfShift: 1,
+	ReasonTimeOff:    1,
+	ReasonBreak:      1,
+	ReasonClosed:     0,
+}
+
+// MergeSlots combines per-staff slot lists by start time. A merged slot is available when
+// any staff member is, carries the best score among them and counts how many are free.
+func MergeSlots(perStaff [][]models.TimeSlot) []models.TimeSlot {
+	byStart := make(map[string]*models.TimeSlot)
+	for _, slots := range perStaff {
+		for _, slot := range slots {
+			m, ok := byStart[slot.StartTime]
+			if !ok {
+				merged := slot
+				merged.AvailableStaff = 0
+				byStart[slot.StartTime] = &merged
+				m = &merged
+			} else if reasonRank[slot.AvailabilityReason] > reasonRank[m.AvailabilityReason] {
+				m.AvailabilityReason = slot.AvailabilityReason
+				m.Available = slot.Available
+			}
+			if slot.Available {
+				m.AvailableStaff++
+				if slot.Score > m.Score {
+					m.Score = slot.Score
+				}
+			}
+		}
+	}
+
+	merged := make([]models.TimeSlot, 0, len(byStart))
+	for _, m := range byStart {
+		merged = append(merged, *m)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].StartTime < merged[j].StartTime })
+	return merged
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Kinds of staff_time_off rows
+const (
+	TimeOffOff   = "off"   // not available, all day or between start_time and end_time
+	TimeOffHours = "hours" // works start_time..end_time instead of the weekly shift
+)
+
+// TimeOffConflicts returns the open appointments of a staff member between two dates that
+// no longer fit the staff member's schedule, checked with the availability engine
+func (s *BookingService) TimeOffConflicts(ctx context.Context, salonID, staffID, startDate, endDate string) ([]string, error) {
+	rows, err := s.DB.Query(ctx,
+		`SELECT id, appointment_date::text, start_time::text FROM appointments
+		 WHERE salon_id = $1 AND staff_id = $2
+		 AND appointment_date >= $3::date AND appointment_date <= $4::date
+		 AND status NOT IN ('cancelled', 'completed', 'no_show')
+		 ORDER BY appointment_date, start_time`, salonID, staffID, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch appointments: %w", err)
+	}
+	type booking struct{ id, date, start string }
+	var bookings []booking
+	for rows.Next() {
+		var b booking
+		rows.Scan(&b.id, &b.date, &b.start)
+		bookings = append(bookings, b)
+	}
+	rows.Close()
+
+	var conflicts []string
+	for _, b := range bookings {
+		date, _ := time.Parse("2006-01-02", b.date)
+		start, _ := ParseClock(b.start)
+		day, err := loadDay(ctx, s.DB, salonID, staffID, date, b.id)
+		if err != nil {
+			return nil, err
+		}
+		lines, _, err := appointmentLines(ctx, s.DB, b.id)
+		if err != nil {
+			return nil, err
+		}
+		serviceLen := time.Duration(serviceMinutes(lines)) * time.Minute
+		blockLen := time.Duration(blockMinutes(lines)) * time.Minute
+		switch day.Check(start, serviceLen, blockLen) {
+		case ReasonTimeOff, ReasonOutOfShift, ReasonBreak:
+			conflicts = append(conflicts, b.id)
+		}
+	}
+	return conflicts, nil
+}
+
+// ReassignAppointment hands an appointment to another staff member who performs all of its
+// services and is free for its whole block, picked the same way as an "any staff" booking.
+// It returns the new staff member's id.
+func (s *BookingService) ReassignAppointment(ctx context.Context, apptID, preference string) (string, error) {
+	var salonID, dateStr string
+	err := s.DB.QueryRow(ctx,
+		`SELECT salon_id, appointment_date::text FROM appointments
+		 WHERE id = $1 AND status NOT IN ('cancelled', 'completed', 'no_show')`,
+		apptID).Scan(&salonID, &dateStr)
+	if err != nil {
+		return "", fmt.Errorf("appointment not found")
+	}
+	date, _ := time.Parse("2006-01-02", dateStr)
+	lines, start, err := appointmentLines(ctx, s.DB, apptID)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	// The current staff member is never picked: the appointment itself still occupies their block
+	staffID, err := assignStaff(ctx, tx, salonID, lines, preference, date, start, apptID)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(ctx,
+		"UPDATE appointments SET staff_id = $1, updated_at = NOW() WHERE id = $2", staffID, apptID)
+	if err != nil {
+		return "", fmt.Errorf("failed to reassign appointment: %w", err)
+	}
+
+	return staffID, tx.Commit(ctx)
+}
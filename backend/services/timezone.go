@@ -0,0 +1,34 @@
+package services
+
+import (
+	"time"
+)
+
+// ValidTimezone reports whether name is an IANA timezone Go can load
+func ValidTimezone(name string) bool {
+	_, err := time.LoadLocation(name)
+	return name != "" && err == nil
+}
+
+// SalonLocation loads a salon's timezone, falling back to UTC for unknown names
+func SalonLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "" {
+		return time.UTC
+	}
+	return loc
+}
+
+// AppointmentTime turns an appointment's naive DATE and TIME into an instant in the
+// salon's timezone
+func AppointmentTime(dateStr, clockStr string, loc *time.Location) (time.Time, error) {
+	d, err := time.Parse("2006-01-02", dateStr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	c, err := ParseClock(clockStr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(d.Year(), d.Month(), d.Day(), c.Hour(), c.Minute(), 0, 0, loc), nil
+}
@@ -3,7 +3,8 @@ package services
 import (
 	"context"
 	"fmt"
-	"time"
+
+	"saloon-backend/models"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -11,29 +12,23 @@ import (
 type WaitlistService struct {
 	DB          *pgxpool.Pool
 	PushService *PushService
+	Booking     *BookingService
 }
 
-func NewWaitlistService(db *pgxpool.Pool, ps *PushService) *WaitlistService {
-	return &WaitlistService{DB: db, PushService: ps}
+func NewWaitlistService(db *pgxpool.Pool, booking *BookingService, ps *PushService) *WaitlistService {
+	return &WaitlistService{DB: db, Booking: booking, PushService: ps}
 }
 
 func (s *WaitlistService) AutoAssignWaitlist(ctx context.Context, salonID, serviceID, staffID, dateStr, startTime string) {
-	if s.PushService == nil {
+	if s.PushService == nil || s.Booking == nil {
 		return
 	}
 
 	fmt.Printf("Waitlist: Attempting auto-assign for salon %s, date %s, time %s\n", salonID, dateStr, startTime)
 
-	tx, err := s.DB.Begin(ctx)
-	if err != nil {
-		fmt.Printf("Waitlist: Failed to start transaction: %v\n", err)
-		return
-	}
-	defer tx.Rollback(ctx)
-
 	// 1. Find the earliest customer waiting for this exact slot
 	var waitlistID, customerID, reqServiceID string
-	err = tx.QueryRow(ctx,
+	err := s.DB.QueryRow(ctx,
 		`SELECT id, customer_id, service_id 
 		 FROM waitlist 
 		 WHERE salon_id = $1 AND preferred_date = $2 AND preferred_time = $3 AND status = 'waiting'
@@ -45,86 +40,64 @@ func (s *WaitlistService) AutoAssignWaitlist(ctx context.Context, salonID, servi
 		return
 	}
 
-	// 2. Fetch service details for appointment creation
-	var serviceName string
-	var servicePrice float64
-	var duration int
-	err = tx.QueryRow(ctx, "SELECT name, price, duration_minutes FROM services WHERE id = $1", reqServiceID).
-		Scan(&serviceName, &servicePrice, &duration)
-	if err != nil {
-		fmt.Printf("Waitlist: Failed to fetch service details: %v\n", err)
-		return
-	}
-
-	// Calculate end time
-	parsedStart, _ := time.Parse("15:04:05", startTime)
-	if parsedStart.IsZero() {
-		// Try without seconds if stored differently
-		parsedStart, _ = time.Parse("15:04", startTime)
-	}
-	endTime := parsedStart.Add(time.Duration(duration) * time.Minute).Format("15:04:05")
-
-	// 3. Create the appointment
-	var apptID string
-	err = tx.QueryRow(ctx,
-		`INSERT INTO appointments (customer_id, salon_id, staff_id, service_id, appointment_date, start_time, end_time, status, notes)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, 'pending', 'Auto-assigned from waitlist')
-		 RETURNING id`,
-		customerID, salonID, staffID, reqServiceID, dateStr, startTime, endTime).Scan(&apptID)
+	// 2. Book it like any other booking: the slot is re-checked under lock, the payment is
+	// priced and taxed, and a service that requires a deposit holds the slot until it is paid
+	appt, _, err := s.Booking.book(ctx, customerID, models.BookAppointmentRequest{
+		SalonID:    salonID,
+		StaffID:    staffID,
+		ServiceIDs: []string{reqServiceID},
+		Date:       dateStr,
+		StartTime:  startTime[:5],
+		Notes:      "Auto-assigned from waitlist",
+	}, bookingOptions{TakeDeposit: true})
 	if err != nil {
-		fmt.Printf("Waitlist: Failed to create auto-appointment: %v\n", err)
+		fmt.Printf("Waitlist: Failed to auto-assign slot: %v\n", err)
 		return
 	}
 
-	// 4. Create payment record (0 tax as per previous requirement)
-	receiptNumber := fmt.Sprintf("RCP-AUTO-%s-%s", time.Now().Format("20060102"), apptID[:8])
-	_, err = tx.Exec(ctx,
-		`INSERT INTO payments (appointment_id, amount, discount, tax, total, method, status, receipt_number)
-		 VALUES ($1, $2, 0, 0, $2, 'cash', 'pending', $3)`,
-		apptID, servicePrice, receiptNumber)
-	if err != nil {
-		fmt.Printf("Waitlist: Failed to create payment: %v\n", err)
-		return
-	}
-
-	// 5. Mark all waitlist entries for this user on this date as 'booked'
-	_, err = tx.Exec(ctx,
+	// 3. Mark all waitlist entries for this user on this date as 'booked'
+	_, err = s.DB.Exec(ctx,
 		"UPDATE waitlist SET status = 'booked' WHERE customer_id = $1 AND preferred_date = $2 AND salon_id = $3",
 		customerID, dateStr, salonID)
 	if err != nil {
 		fmt.Printf("Waitlist: Failed to update waitlist status: %v\n", err)
-		return
 	}
 
-	// 6. Check for an existing "safe" appointment to cancel (Slot Swap)
+	// 4. Cancel the customer's existing "safe" appointment that day (Slot Swap), unless the
+	// new one still waits for its deposit and may lapse
 	var oldApptID, oldStartTime string
-	err = tx.QueryRow(ctx,
-		`SELECT id, start_time::text FROM appointments 
-		 WHERE customer_id = $1 AND appointment_date = $2 AND salon_id = $3 
-		 AND status IN ('pending', 'confirmed') AND id != $4 LIMIT 1`,
-		customerID, dateStr, salonID, apptID).Scan(&oldApptID, &oldStartTime)
-
 	swapped := false
-	if err == nil {
-		_, err = tx.Exec(ctx,
-			"UPDATE appointments SET status = 'cancelled', notes = $1 WHERE id = $2",
-			fmt.Sprintf("Cancelled in favor of preferred slot at %s", startTime[:5]), oldApptID)
-		if err == nil {
-			swapped = true
-		}
+	if appt.Status != "awaiting_deposit" {
+		err = s.DB.QueryRow(ctx,
+			`UPDATE appointments SET status = 'cancelled', notes = $4, updated_at = NOW()
+			 WHERE id = (SELECT id FROM appointments
+			             WHERE customer_id = $1 AND appointment_date = $2 AND salon_id = $3
+			             AND status IN ('pending', 'confirmed') AND id != $5 LIMIT 1)
+			 AND status IN ('pending', 'confirmed')
+			 RETURNING id, start_time::text`,
+			customerID, dateStr, salonID,
+			fmt.Sprintf("Cancelled in favor of preferred slot at %s", startTime[:5]), appt.ID).Scan(&oldApptID, &oldStartTime)
+		swapped = err == nil
 	}
-
-	if err := tx.Commit(ctx); err != nil {
-		fmt.Printf("Waitlist: Failed to commit auto-assignment: %v\n", err)
-		return
+	if swapped {
+		// Release the replaced booking's card hold or refund what it collected, and give back
+		// its discounts
+		if s.Booking.Payments != nil {
+			s.Booking.Payments.CancelPayments(ctx, []string{oldApptID}, "")
+		}
+		if err := SettleDiscounts(ctx, s.DB, []string{oldApptID}, PromoOnCancel); err != nil {
+			fmt.Printf("Waitlist: Failed to settle discounts of swapped appointment: %v\n", err)
+		}
 	}
 
-	// 7. Notify the user
+	// 5. Notify the user
 	var salonName string
 	s.DB.QueryRow(ctx, "SELECT name FROM salons WHERE id = $1", salonID).Scan(&salonName)
 
 	body := fmt.Sprintf("You've been auto-assigned to the %s slot at %s on %s!", startTime[:5], salonName, dateStr)
-	if swapped {
+	if appt.Status == "awaiting_deposit" {
+		body = fmt.Sprintf("The %s slot at %s on %s is yours! Pay the deposit to keep it.", startTime[:5], salonName, dateStr)
+	} else if swapped {
 		body = fmt.Sprintf("Moved to your preferred %s slot at %s! Your original %s booking was cancelled.", startTime[:5], salonName, oldStartTime[:5])
 	}
 
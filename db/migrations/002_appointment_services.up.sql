@@ -0,0 +1,25 @@
+-- =============================================
+-- APPOINTMENT SERVICES (line items of a multi-service booking)
+-- =============================================
+CREATE TABLE appointment_services (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    appointment_id UUID NOT NULL REFERENCES appointments(id) ON DELETE CASCADE,
+    service_id UUID NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL DEFAULT 0,
+    price NUMERIC(10,2) NOT NULL,
+    duration_minutes INTEGER NOT NULL,
+    buffer_minutes INTEGER DEFAULT 0,
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE(appointment_id, position)
+);
+
+CREATE INDEX idx_appointment_services_appointment ON appointment_services(appointment_id);
+CREATE INDEX idx_appointment_services_service ON appointment_services(service_id);
+
+-- Backfill existing single-service appointments as one line item each
+INSERT INTO appointment_services (appointment_id, service_id, position, price, duration_minutes, buffer_minutes, start_time, end_time)
+SELECT a.id, a.service_id, 0, sv.price, sv.duration_minutes, COALESCE(sv.buffer_minutes, 0), a.start_time, a.end_time
+FROM appointments a
+JOIN services sv ON sv.id = a.service_id;
@@ -0,0 +1,3 @@
+ALTER TABLE appointments DROP COLUMN IF EXISTS series_occurrence;
+ALTER TABLE appointments DROP COLUMN IF EXISTS series_id;
+DROP TABLE IF EXISTS appointment_series CASCADE;
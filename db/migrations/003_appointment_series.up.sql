@@ -0,0 +1,29 @@
+-- =============================================
+-- APPOINTMENT SERIES (recurring bookings)
+-- =============================================
+CREATE TABLE appointment_series (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    customer_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    salon_id UUID NOT NULL REFERENCES salons(id) ON DELETE CASCADE,
+    staff_id UUID NOT NULL REFERENCES staff(id) ON DELETE CASCADE,
+    service_ids UUID[] NOT NULL,
+    frequency VARCHAR(10) NOT NULL CHECK (frequency IN ('daily', 'weekly', 'monthly')),
+    interval INTEGER NOT NULL DEFAULT 1 CHECK (interval >= 1),
+    count INTEGER CHECK (count >= 1),
+    until_date DATE,
+    start_date DATE NOT NULL,
+    start_time TIME NOT NULL,
+    notes TEXT,
+    status VARCHAR(20) DEFAULT 'active' CHECK (status IN ('active', 'cancelled')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    CHECK (count IS NOT NULL OR until_date IS NOT NULL)
+);
+
+CREATE INDEX idx_appointment_series_customer ON appointment_series(customer_id);
+CREATE INDEX idx_appointment_series_salon ON appointment_series(salon_id);
+
+ALTER TABLE appointments ADD COLUMN series_id UUID REFERENCES appointment_series(id) ON DELETE SET NULL;
+ALTER TABLE appointments ADD COLUMN series_occurrence INTEGER;
+
+CREATE INDEX idx_appointments_series ON appointments(series_id);
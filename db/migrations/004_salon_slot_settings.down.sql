@@ -0,0 +1,2 @@
+ALTER TABLE salons DROP COLUMN IF EXISTS minimize_gaps;
+ALTER TABLE salons DROP COLUMN IF EXISTS slot_interval_minutes;
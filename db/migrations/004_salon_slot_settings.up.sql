@@ -0,0 +1,5 @@
+-- Per-salon slot grid: how often start times are offered and whether
+-- only gap-free start times (next to bookings or shift edges) are shown
+ALTER TABLE salons ADD COLUMN slot_interval_minutes INTEGER NOT NULL DEFAULT 30
+    CHECK (slot_interval_minutes IN (5, 10, 15, 30));
+ALTER TABLE salons ADD COLUMN minimize_gaps BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1 @@
+ALTER TABLE salons DROP COLUMN IF EXISTS timezone;
@@ -0,0 +1,16 @@
+-- IANA timezone each salon's appointment DATE + TIME values are expressed in.
+-- Existing salons are given the zone the backend process has been interpreting their hours
+-- in (its local time), which the database can't know. Set it for the run with
+--   PGOPTIONS='-c saloon.default_timezone=Asia/Kolkata' psql -f 005_salon_timezone.up.sql
+-- Without it they default to UTC, the zone of the backend container image.
+ALTER TABLE salons ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
+
+DO $$
+DECLARE
+    tz TEXT := COALESCE(NULLIF(current_setting('saloon.default_timezone', true), ''), 'UTC');
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_timezone_names WHERE name = tz) THEN
+        RAISE EXCEPTION 'saloon.default_timezone % is not an IANA timezone', tz;
+    END IF;
+    UPDATE salons SET timezone = tz;
+END $$;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS reminder_jobs CASCADE;
+ALTER TABLE salons DROP COLUMN IF EXISTS reminder_offsets;
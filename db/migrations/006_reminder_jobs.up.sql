@@ -0,0 +1,33 @@
+-- Minutes before an appointment each reminder goes out, per salon
+ALTER TABLE salons ADD COLUMN reminder_offsets INTEGER[] NOT NULL DEFAULT '{60,20}';
+
+-- =============================================
+-- REMINDER JOBS (durable queue, claimed with FOR UPDATE SKIP LOCKED)
+-- =============================================
+CREATE TABLE reminder_jobs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    appointment_id UUID NOT NULL REFERENCES appointments(id) ON DELETE CASCADE,
+    offset_minutes INTEGER NOT NULL,
+    run_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'sent', 'skipped', 'dead')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 5,
+    last_error TEXT,
+    sent_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (appointment_id, offset_minutes)
+);
+
+CREATE INDEX idx_reminder_jobs_due ON reminder_jobs(run_at) WHERE status = 'pending';
+CREATE INDEX idx_reminder_jobs_status ON reminder_jobs(status);
+
+-- Queue reminders for appointments that are still ahead
+INSERT INTO reminder_jobs (appointment_id, offset_minutes, run_at)
+SELECT a.id, o.minutes, ((a.appointment_date + a.start_time) AT TIME ZONE s.timezone) - make_interval(mins => o.minutes)
+FROM appointments a
+JOIN salons s ON s.id = a.salon_id
+CROSS JOIN LATERAL unnest(s.reminder_offsets) AS o(minutes)
+WHERE a.status IN ('pending', 'confirmed')
+AND ((a.appointment_date + a.start_time) AT TIME ZONE s.timezone) - make_interval(mins => o.minutes) > NOW();
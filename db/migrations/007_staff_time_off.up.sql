@@ -0,0 +1,22 @@
+-- =============================================
+-- STAFF TIME OFF / PER-DATE OVERRIDES
+-- kind 'off':   not available; all day, or between start_time and end_time
+-- kind 'hours': works start_time..end_time instead of the weekly pattern
+-- =============================================
+CREATE TABLE staff_time_off (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    staff_id UUID NOT NULL REFERENCES staff(id) ON DELETE CASCADE,
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    start_time TIME,
+    end_time TIME,
+    kind VARCHAR(10) NOT NULL DEFAULT 'off' CHECK (kind IN ('off', 'hours')),
+    reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    CHECK (end_date >= start_date),
+    CHECK ((start_time IS NULL) = (end_time IS NULL)),
+    CHECK (start_time IS NULL OR end_time > start_time),
+    CHECK (kind = 'off' OR start_time IS NOT NULL)
+);
+
+CREATE INDEX idx_staff_time_off_staff ON staff_time_off(staff_id, start_date, end_date);
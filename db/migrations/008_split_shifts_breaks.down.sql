@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_staff_working_hours_staff_day;
+
+-- Keep only the earliest shift of each day
+DELETE FROM staff_working_hours WHERE kind = 'break';
+DELETE FROM staff_working_hours h
+USING staff_working_hours e
+WHERE e.staff_id = h.staff_id AND e.day_of_week = h.day_of_week
+  AND (e.start_time, e.id) < (h.start_time, h.id);
+
+ALTER TABLE staff_working_hours DROP COLUMN IF EXISTS kind;
+ALTER TABLE staff_working_hours ADD CONSTRAINT staff_working_hours_staff_id_day_of_week_key UNIQUE (staff_id, day_of_week);
@@ -0,0 +1,11 @@
+-- =============================================
+-- SPLIT SHIFTS & BREAKS
+-- A day can now hold several shift rows (e.g. 09:00-13:00 and 16:00-20:00)
+-- plus recurring break rows inside them
+-- =============================================
+ALTER TABLE staff_working_hours DROP CONSTRAINT IF EXISTS staff_working_hours_staff_id_day_of_week_key;
+
+ALTER TABLE staff_working_hours
+    ADD COLUMN kind VARCHAR(10) NOT NULL DEFAULT 'shift' CHECK (kind IN ('shift', 'break'));
+
+CREATE INDEX idx_staff_working_hours_staff_day ON staff_working_hours(staff_id, day_of_week);
@@ -0,0 +1,14 @@
+-- =============================================
+-- SALON HOURS PER WEEKDAY
+-- A weekday without a row uses salons.opening_time / closing_time
+-- =============================================
+CREATE TABLE salon_hours (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    salon_id UUID NOT NULL REFERENCES salons(id) ON DELETE CASCADE,
+    day_of_week INTEGER NOT NULL CHECK (day_of_week BETWEEN 0 AND 6),
+    open_time TIME NOT NULL,
+    close_time TIME NOT NULL,
+    is_closed BOOLEAN NOT NULL DEFAULT false,
+    UNIQUE(salon_id, day_of_week),
+    CHECK (is_closed OR close_time > open_time)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS service_resources CASCADE;
+DROP TABLE IF EXISTS salon_resources CASCADE;
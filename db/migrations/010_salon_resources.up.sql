@@ -0,0 +1,26 @@
+-- =============================================
+-- SALON RESOURCES (chairs, wash stations, treatment rooms)
+-- A service holds `quantity` units of each mapped resource while it is performed;
+-- no more than `capacity` units may be held at once
+-- =============================================
+CREATE TABLE salon_resources (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    salon_id UUID NOT NULL REFERENCES salons(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    resource_type VARCHAR(50),
+    capacity INTEGER NOT NULL DEFAULT 1 CHECK (capacity > 0),
+    is_active BOOLEAN DEFAULT true,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_salon_resources_salon ON salon_resources(salon_id);
+
+CREATE TABLE service_resources (
+    service_id UUID NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+    resource_id UUID NOT NULL REFERENCES salon_resources(id) ON DELETE CASCADE,
+    quantity INTEGER NOT NULL DEFAULT 1 CHECK (quantity > 0),
+    PRIMARY KEY (service_id, resource_id)
+);
+
+CREATE INDEX idx_service_resources_resource ON service_resources(resource_id);
@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS payment_events CASCADE;
+DROP INDEX IF EXISTS idx_payments_provider_intent;
+
+ALTER TABLE payments
+    DROP COLUMN IF EXISTS captured_amount,
+    DROP COLUMN IF EXISTS authorized_amount,
+    DROP COLUMN IF EXISTS provider_intent_id,
+    DROP COLUMN IF EXISTS provider;
+
+UPDATE payments SET status = 'pending' WHERE status = 'authorized';
+UPDATE payments SET status = 'failed' WHERE status = 'voided';
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_status_check;
+ALTER TABLE payments ADD CONSTRAINT payments_status_check
+    CHECK (status IN ('pending', 'completed', 'refunded', 'failed'));
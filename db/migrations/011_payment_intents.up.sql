@@ -0,0 +1,31 @@
+-- =============================================
+-- PAYMENT GATEWAY INTENTS & EVENTS
+-- payments.status only changes when a provider event is applied
+-- =============================================
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_status_check;
+ALTER TABLE payments ADD CONSTRAINT payments_status_check
+    CHECK (status IN ('pending', 'authorized', 'completed', 'refunded', 'failed', 'voided'));
+
+ALTER TABLE payments
+    ADD COLUMN provider VARCHAR(30),
+    ADD COLUMN provider_intent_id VARCHAR(255),
+    ADD COLUMN authorized_amount NUMERIC(10,2),
+    ADD COLUMN captured_amount NUMERIC(10,2);
+
+CREATE UNIQUE INDEX idx_payments_provider_intent ON payments(provider, provider_intent_id)
+    WHERE provider_intent_id IS NOT NULL;
+
+-- Every provider event, applied or not; (provider, event_id) makes webhook retries idempotent
+CREATE TABLE payment_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    payment_id UUID REFERENCES payments(id) ON DELETE CASCADE,
+    provider VARCHAR(30) NOT NULL,
+    event_id VARCHAR(255) NOT NULL,
+    type VARCHAR(30) NOT NULL,
+    intent_id VARCHAR(255),
+    amount NUMERIC(10,2),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE(provider, event_id)
+);
+
+CREATE INDEX idx_payment_events_payment ON payment_events(payment_id);
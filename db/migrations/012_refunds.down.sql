@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS refunds CASCADE;
+
+UPDATE payments SET status = 'refunded' WHERE status = 'partially_refunded';
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_status_check;
+ALTER TABLE payments ADD CONSTRAINT payments_status_check
+    CHECK (status IN ('pending', 'authorized', 'completed', 'refunded', 'failed', 'voided'));
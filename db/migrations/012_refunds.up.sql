@@ -0,0 +1,26 @@
+-- =============================================
+-- REFUND LEDGER
+-- A payment is partially_refunded/refunded according to the sum of its refunds
+-- =============================================
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_status_check;
+ALTER TABLE payments ADD CONSTRAINT payments_status_check
+    CHECK (status IN ('pending', 'authorized', 'completed', 'partially_refunded', 'refunded', 'failed', 'voided'));
+
+CREATE TABLE refunds (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    payment_id UUID NOT NULL REFERENCES payments(id) ON DELETE CASCADE,
+    amount NUMERIC(10,2) NOT NULL CHECK (amount > 0),
+    reason TEXT,
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL, -- NULL when issued from the provider's dashboard
+    provider VARCHAR(30) NOT NULL,
+    provider_ref VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE(provider, provider_ref)
+);
+
+CREATE INDEX idx_refunds_payment ON refunds(payment_id);
+
+-- Payments marked refunded before the ledger existed are refunded in full
+INSERT INTO refunds (payment_id, amount, reason, provider, provider_ref)
+SELECT id, total, 'Refunded before the refund ledger existed', 'in_store', 'legacy-' || id
+FROM payments WHERE status = 'refunded' AND total > 0;
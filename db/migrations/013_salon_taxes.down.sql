@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS payment_taxes CASCADE;
+DROP TABLE IF EXISTS tax_rates CASCADE;
+ALTER TABLE payments DROP COLUMN IF EXISTS tax_inclusive;
+ALTER TABLE salons DROP COLUMN IF EXISTS prices_include_tax;
@@ -0,0 +1,36 @@
+-- =============================================
+-- SALON TAX RULES
+-- Named rates stack. A rate with a category applies to services of that category only,
+-- and a category with its own rates ignores the salon-wide (category IS NULL) rates.
+-- =============================================
+ALTER TABLE salons ADD COLUMN prices_include_tax BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE tax_rates (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    salon_id UUID NOT NULL REFERENCES salons(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    rate_percent NUMERIC(6,3) NOT NULL CHECK (rate_percent >= 0 AND rate_percent <= 100),
+    category VARCHAR(100),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_tax_rates_salon ON tax_rates(salon_id);
+
+-- Whether the payment's tax is contained in its amount (inclusive pricing) or added on top
+ALTER TABLE payments ADD COLUMN tax_inclusive BOOLEAN NOT NULL DEFAULT false;
+
+-- Tax charged on a payment, one row per named rate, frozen when the payment is created
+CREATE TABLE payment_taxes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    payment_id UUID NOT NULL REFERENCES payments(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    rate_percent NUMERIC(6,3) NOT NULL,
+    taxable_amount NUMERIC(10,2) NOT NULL,
+    amount NUMERIC(10,2) NOT NULL
+);
+
+CREATE INDEX idx_payment_taxes_payment ON payment_taxes(payment_id);
+
+-- Until now the only taxed payments were the flat 8% ones taken at the counter
+INSERT INTO payment_taxes (payment_id, name, rate_percent, taxable_amount, amount)
+SELECT id, 'Sales tax', 8, amount - discount, tax FROM payments WHERE tax > 0;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS payment_fees CASCADE;
+DROP TABLE IF EXISTS cancellation_policies CASCADE;
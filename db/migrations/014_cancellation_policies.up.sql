@@ -0,0 +1,29 @@
+-- =============================================
+-- CANCELLATION POLICIES
+-- Cancelling within free_cancel_hours of the start costs the late-cancel fee; a no-show
+-- costs the no-show fee. Fees are flat amounts or a percent of the appointment total.
+-- A salon without a row charges no fees.
+-- =============================================
+CREATE TABLE cancellation_policies (
+    salon_id UUID PRIMARY KEY REFERENCES salons(id) ON DELETE CASCADE,
+    free_cancel_hours INTEGER NOT NULL DEFAULT 24 CHECK (free_cancel_hours >= 0),
+    late_cancel_fee_type VARCHAR(10) NOT NULL DEFAULT 'none' CHECK (late_cancel_fee_type IN ('none', 'flat', 'percent')),
+    late_cancel_fee NUMERIC(10,2) NOT NULL DEFAULT 0 CHECK (late_cancel_fee >= 0),
+    no_show_fee_type VARCHAR(10) NOT NULL DEFAULT 'none' CHECK (no_show_fee_type IN ('none', 'flat', 'percent')),
+    no_show_fee NUMERIC(10,2) NOT NULL DEFAULT 0 CHECK (no_show_fee >= 0),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    CHECK (late_cancel_fee_type <> 'percent' OR late_cancel_fee <= 100),
+    CHECK (no_show_fee_type <> 'percent' OR no_show_fee <= 100)
+);
+
+-- Fees charged against an appointment's payment; the payment is re-priced to the fee
+CREATE TABLE payment_fees (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    payment_id UUID NOT NULL REFERENCES payments(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('late_cancel', 'no_show')),
+    amount NUMERIC(10,2) NOT NULL CHECK (amount > 0),
+    original_total NUMERIC(10,2) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_payment_fees_payment ON payment_fees(payment_id);
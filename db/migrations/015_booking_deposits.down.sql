@@ -0,0 +1,15 @@
+ALTER TABLE refunds DROP COLUMN IF EXISTS from_deposit;
+DROP TABLE IF EXISTS deposits CASCADE;
+ALTER TABLE payments DROP COLUMN IF EXISTS deposit_applied;
+
+UPDATE appointments SET status = 'cancelled' WHERE status = 'awaiting_deposit';
+ALTER TABLE appointments DROP COLUMN IF EXISTS deposit_expires_at;
+ALTER TABLE appointments DROP CONSTRAINT IF EXISTS appointments_status_check;
+ALTER TABLE appointments ADD CONSTRAINT appointments_status_check
+    CHECK (status IN ('pending', 'confirmed', 'in_progress', 'completed', 'cancelled', 'no_show'));
+
+ALTER TABLE salons DROP COLUMN IF EXISTS deposit_hold_minutes;
+ALTER TABLE services
+    DROP CONSTRAINT IF EXISTS services_deposit_percent_check,
+    DROP COLUMN IF EXISTS deposit_value,
+    DROP COLUMN IF EXISTS deposit_type;
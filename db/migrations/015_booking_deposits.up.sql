@@ -0,0 +1,42 @@
+-- =============================================
+-- BOOKING DEPOSITS
+-- Services can require part of their price up front. Such a booking waits in
+-- awaiting_deposit, holding its slot until deposit_expires_at; an unpaid hold is
+-- cancelled when it runs out. A paid deposit is applied to the payment when the
+-- appointment is settled, so only the balance is still collected.
+-- =============================================
+ALTER TABLE services
+    ADD COLUMN deposit_type VARCHAR(10) NOT NULL DEFAULT 'none' CHECK (deposit_type IN ('none', 'flat', 'percent')),
+    ADD COLUMN deposit_value NUMERIC(10,2) NOT NULL DEFAULT 0 CHECK (deposit_value >= 0),
+    ADD CONSTRAINT services_deposit_percent_check CHECK (deposit_type <> 'percent' OR deposit_value <= 100);
+
+ALTER TABLE salons ADD COLUMN deposit_hold_minutes INTEGER NOT NULL DEFAULT 30 CHECK (deposit_hold_minutes > 0);
+
+ALTER TABLE appointments DROP CONSTRAINT IF EXISTS appointments_status_check;
+ALTER TABLE appointments ADD CONSTRAINT appointments_status_check
+    CHECK (status IN ('awaiting_deposit', 'pending', 'confirmed', 'in_progress', 'completed', 'cancelled', 'no_show'));
+ALTER TABLE appointments ADD COLUMN deposit_expires_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE payments ADD COLUMN deposit_applied NUMERIC(10,2) NOT NULL DEFAULT 0;
+
+CREATE TABLE deposits (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    appointment_id UUID NOT NULL UNIQUE REFERENCES appointments(id) ON DELETE CASCADE,
+    payment_id UUID NOT NULL REFERENCES payments(id) ON DELETE CASCADE,
+    amount NUMERIC(10,2) NOT NULL CHECK (amount > 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'paid', 'applied', 'refunded', 'voided', 'failed')),
+    provider VARCHAR(30),
+    provider_intent_id VARCHAR(255),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    paid_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_deposits_provider_intent ON deposits(provider, provider_intent_id)
+    WHERE provider_intent_id IS NOT NULL;
+CREATE INDEX idx_deposits_expiry ON deposits(expires_at) WHERE status = 'pending';
+
+-- Refunds of an applied deposit go back through the deposit's own intent
+ALTER TABLE refunds ADD COLUMN from_deposit BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS payment_tenders CASCADE;
+DROP INDEX IF EXISTS idx_payments_tip_staff;
+ALTER TABLE payments
+    DROP COLUMN IF EXISTS tip_staff_id,
+    DROP COLUMN IF EXISTS tip;
+
+-- Without its tenders a split payment is recorded as taken at the counter
+UPDATE payments SET method = 'cash' WHERE method = 'split';
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_method_check;
+ALTER TABLE payments ADD CONSTRAINT payments_method_check
+    CHECK (method IN ('cash', 'card', 'upi', 'wallet'));
@@ -0,0 +1,26 @@
+-- =============================================
+-- TIPS & SPLIT TENDER
+-- A payment can be collected with several tenders (part cash, part card). They cover
+-- the amount due plus the tip, which goes to the appointment's stylist and is kept
+-- apart from the payment's total, so revenue stays service revenue.
+-- =============================================
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_method_check;
+ALTER TABLE payments ADD CONSTRAINT payments_method_check
+    CHECK (method IN ('cash', 'card', 'upi', 'wallet', 'split'));
+
+ALTER TABLE payments
+    ADD COLUMN tip NUMERIC(10,2) NOT NULL DEFAULT 0 CHECK (tip >= 0),
+    ADD COLUMN tip_staff_id UUID REFERENCES staff(id) ON DELETE SET NULL;
+
+-- The tenders a payment was collected with; at most one of them is a card
+CREATE TABLE payment_tenders (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    payment_id UUID NOT NULL REFERENCES payments(id) ON DELETE CASCADE,
+    method VARCHAR(30) NOT NULL CHECK (method IN ('cash', 'card', 'upi', 'wallet')),
+    amount NUMERIC(10,2) NOT NULL CHECK (amount > 0),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_payment_tenders_payment ON payment_tenders(payment_id);
+CREATE UNIQUE INDEX idx_payment_tenders_card ON payment_tenders(payment_id) WHERE method = 'card';
+CREATE INDEX idx_payments_tip_staff ON payments(tip_staff_id) WHERE tip > 0;
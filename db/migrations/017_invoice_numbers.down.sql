@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS invoice_counters CASCADE;
+
+DROP INDEX IF EXISTS idx_payments_salon_receipt;
+DROP INDEX IF EXISTS idx_payments_salon_invoice;
+-- Per-salon receipt numbers repeat across salons; keep the first and make the rest unique
+UPDATE payments SET receipt_number = receipt_number || '-' || LEFT(salon_id::text, 8)
+WHERE id NOT IN (SELECT DISTINCT ON (receipt_number) id FROM payments ORDER BY receipt_number, created_at);
+ALTER TABLE payments ADD CONSTRAINT payments_receipt_number_key UNIQUE (receipt_number);
+
+ALTER TABLE payments
+    DROP COLUMN IF EXISTS invoice_number,
+    DROP COLUMN IF EXISTS salon_id;
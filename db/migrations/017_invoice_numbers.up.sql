@@ -0,0 +1,37 @@
+-- =============================================
+-- INVOICE NUMBERING
+-- Every payment gets the next number of its salon's invoice sequence, allocated in
+-- the transaction that creates it. The counter row is locked until that transaction
+-- ends, so a rolled-back payment gives its number back and the sequence has no gaps.
+-- =============================================
+ALTER TABLE payments
+    ADD COLUMN salon_id UUID REFERENCES salons(id) ON DELETE CASCADE,
+    ADD COLUMN invoice_number INTEGER;
+
+-- Existing payments are numbered in the order they were created; their receipt numbers
+-- were already handed out and stay as they are
+WITH numbered AS (
+    SELECT p.id, a.salon_id,
+           ROW_NUMBER() OVER (PARTITION BY a.salon_id ORDER BY p.created_at, p.id) AS n
+    FROM payments p JOIN appointments a ON a.id = p.appointment_id
+)
+UPDATE payments p SET salon_id = numbered.salon_id, invoice_number = numbered.n
+FROM numbered WHERE numbered.id = p.id;
+
+ALTER TABLE payments
+    ALTER COLUMN salon_id SET NOT NULL,
+    ALTER COLUMN invoice_number SET NOT NULL;
+
+CREATE UNIQUE INDEX idx_payments_salon_invoice ON payments(salon_id, invoice_number);
+
+-- Receipt numbers are unique per salon now that each salon counts from 1
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_receipt_number_key;
+CREATE UNIQUE INDEX idx_payments_salon_receipt ON payments(salon_id, receipt_number);
+
+CREATE TABLE invoice_counters (
+    salon_id UUID PRIMARY KEY REFERENCES salons(id) ON DELETE CASCADE,
+    last_number INTEGER NOT NULL CHECK (last_number >= 0)
+);
+
+INSERT INTO invoice_counters (salon_id, last_number)
+SELECT salon_id, MAX(invoice_number) FROM payments GROUP BY salon_id;
@@ -0,0 +1,19 @@
+ALTER TABLE appointments DROP COLUMN IF EXISTS promo_discount;
+
+DROP TABLE IF EXISTS promo_code_services CASCADE;
+
+-- Fixed-amount promos have no percentage to fall back to
+UPDATE promo_codes SET is_active = false WHERE discount_type = 'fixed';
+ALTER TABLE promo_codes
+    DROP COLUMN IF EXISTS valid_end_time,
+    DROP COLUMN IF EXISTS valid_start_time,
+    DROP COLUMN IF EXISTS valid_weekdays,
+    DROP COLUMN IF EXISTS max_uses_per_customer,
+    DROP COLUMN IF EXISTS first_visit_only,
+    DROP COLUMN IF EXISTS categories,
+    DROP COLUMN IF EXISTS min_order_amount,
+    DROP COLUMN IF EXISTS discount_amount,
+    DROP COLUMN IF EXISTS discount_type;
+
+DROP INDEX IF EXISTS idx_promo_codes_salon_code;
+ALTER TABLE promo_codes ADD CONSTRAINT promo_codes_code_key UNIQUE (code);
@@ -0,0 +1,35 @@
+-- =============================================
+-- PROMO CODE RULES
+-- Codes are unique per salon. A promo takes a percentage or a fixed amount off the
+-- services it is scoped to (all of them when it has no scope), and can require a minimum
+-- order, a customer's first visit, a per-customer limit and a weekday/time window that
+-- the appointment must fall in.
+-- =============================================
+ALTER TABLE promo_codes DROP CONSTRAINT IF EXISTS promo_codes_code_key;
+CREATE UNIQUE INDEX idx_promo_codes_salon_code ON promo_codes(salon_id, code);
+
+ALTER TABLE promo_codes
+    ADD COLUMN discount_type VARCHAR(10) NOT NULL DEFAULT 'percent' CHECK (discount_type IN ('percent', 'fixed')),
+    ADD COLUMN discount_amount NUMERIC(10,2) NOT NULL DEFAULT 0 CHECK (discount_amount >= 0),
+    ADD COLUMN min_order_amount NUMERIC(10,2) NOT NULL DEFAULT 0 CHECK (min_order_amount >= 0),
+    ADD COLUMN categories TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN first_visit_only BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN max_uses_per_customer INTEGER CHECK (max_uses_per_customer > 0),
+    -- 0 = Sunday; empty = every day
+    ADD COLUMN valid_weekdays INTEGER[] NOT NULL DEFAULT '{}',
+    ADD COLUMN valid_start_time TIME,
+    ADD COLUMN valid_end_time TIME;
+
+CREATE TABLE promo_code_services (
+    promo_code_id UUID NOT NULL REFERENCES promo_codes(id) ON DELETE CASCADE,
+    service_id UUID NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+    PRIMARY KEY (promo_code_id, service_id)
+);
+
+-- The discount a booking got, so its payment can be priced again later without
+-- re-evaluating rules that may no longer hold
+ALTER TABLE appointments ADD COLUMN promo_discount NUMERIC(10,2) NOT NULL DEFAULT 0;
+
+UPDATE appointments a SET promo_discount = p.discount
+FROM payments p
+WHERE p.appointment_id = a.id AND a.promo_code_id IS NOT NULL AND p.discount > 0;
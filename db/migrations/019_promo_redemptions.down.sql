@@ -0,0 +1,13 @@
+-- Released uses were taken back before the redemption ledger existed
+UPDATE promo_codes pc SET used_count = pc.used_count + r.released
+FROM (SELECT promo_code_id, COUNT(*) AS released FROM promo_redemptions
+      WHERE status = 'released' GROUP BY promo_code_id) r
+WHERE r.promo_code_id = pc.id;
+
+ALTER TABLE cancellation_policies
+    DROP COLUMN IF EXISTS release_promo_on_refund,
+    DROP COLUMN IF EXISTS release_promo_on_no_show,
+    DROP COLUMN IF EXISTS release_promo_on_late_cancel,
+    DROP COLUMN IF EXISTS release_promo_on_cancel;
+
+DROP TABLE IF EXISTS promo_redemptions CASCADE;
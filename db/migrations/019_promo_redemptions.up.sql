@@ -0,0 +1,43 @@
+-- =============================================
+-- PROMO REDEMPTIONS
+-- One row per booking that used a promo code. A redemption stays active while it counts
+-- towards the code's used_count and the customer's limit; it is released (and the use
+-- given back) when the booking is cancelled, missed or refunded and the salon's
+-- cancellation policy says so.
+-- =============================================
+CREATE TABLE promo_redemptions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    promo_code_id UUID NOT NULL REFERENCES promo_codes(id) ON DELETE CASCADE,
+    customer_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    appointment_id UUID NOT NULL UNIQUE REFERENCES appointments(id) ON DELETE CASCADE,
+    discount NUMERIC(10,2) NOT NULL DEFAULT 0,
+    status VARCHAR(10) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'released')),
+    release_reason VARCHAR(20) CHECK (release_reason IN ('cancel', 'late_cancel', 'no_show', 'refund')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    released_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_promo_redemptions_promo ON promo_redemptions(promo_code_id, status);
+CREATE INDEX idx_promo_redemptions_customer ON promo_redemptions(customer_id, promo_code_id);
+
+-- Whether a use is given back on each way a booking can fall through
+ALTER TABLE cancellation_policies
+    ADD COLUMN release_promo_on_cancel BOOLEAN NOT NULL DEFAULT true,
+    ADD COLUMN release_promo_on_late_cancel BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN release_promo_on_no_show BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN release_promo_on_refund BOOLEAN NOT NULL DEFAULT true;
+
+-- Past bookings; uses of bookings already cancelled are given back
+INSERT INTO promo_redemptions (promo_code_id, customer_id, appointment_id, discount, status, release_reason, created_at, released_at)
+SELECT a.promo_code_id, a.customer_id, a.id, a.promo_discount,
+       CASE WHEN a.status = 'cancelled' THEN 'released' ELSE 'active' END,
+       CASE WHEN a.status = 'cancelled' THEN 'cancel' END,
+       a.created_at,
+       CASE WHEN a.status = 'cancelled' THEN a.updated_at END
+FROM appointments a
+WHERE a.promo_code_id IS NOT NULL;
+
+UPDATE promo_codes pc SET used_count = GREATEST(pc.used_count - r.released, 0)
+FROM (SELECT promo_code_id, COUNT(*) AS released FROM promo_redemptions
+      WHERE status = 'released' GROUP BY promo_code_id) r
+WHERE r.promo_code_id = pc.id;
@@ -0,0 +1,4 @@
+ALTER TABLE appointments DROP COLUMN IF EXISTS points_discount;
+
+DROP TABLE IF EXISTS loyalty_transactions CASCADE;
+DROP TABLE IF EXISTS loyalty_programs CASCADE;
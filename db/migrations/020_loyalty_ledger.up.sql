@@ -0,0 +1,55 @@
+-- =============================================
+-- LOYALTY POINTS
+-- Every change to a customer's points at a salon is a ledger entry: points earned on a
+-- completed appointment, redeemed as a discount, expired, or adjusted (by the salon, or
+-- when a booking falls through). users.loyalty_points is kept as the total over all salons.
+-- =============================================
+CREATE TABLE loyalty_programs (
+    salon_id UUID PRIMARY KEY REFERENCES salons(id) ON DELETE CASCADE,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    -- Points earned per unit of currency paid for services
+    points_per_unit NUMERIC(10,2) NOT NULL DEFAULT 1 CHECK (points_per_unit >= 0),
+    -- What one point takes off a booking
+    point_value NUMERIC(10,4) NOT NULL DEFAULT 0.01 CHECK (point_value >= 0),
+    min_redeem_points INTEGER NOT NULL DEFAULT 0 CHECK (min_redeem_points >= 0),
+    max_redeem_percent NUMERIC(5,2) NOT NULL DEFAULT 100 CHECK (max_redeem_percent BETWEEN 0 AND 100),
+    -- 0 = points never expire
+    expiry_days INTEGER NOT NULL DEFAULT 0 CHECK (expiry_days >= 0),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE loyalty_transactions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    salon_id UUID NOT NULL REFERENCES salons(id) ON DELETE CASCADE,
+    kind VARCHAR(10) NOT NULL CHECK (kind IN ('earn', 'redeem', 'expire', 'adjust')),
+    points INTEGER NOT NULL CHECK (points <> 0),
+    appointment_id UUID REFERENCES appointments(id) ON DELETE SET NULL,
+    note TEXT,
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    -- Earned points lapse at this time unless spent first
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    CHECK ((kind = 'earn' AND points > 0) OR (kind IN ('redeem', 'expire') AND points < 0) OR kind = 'adjust')
+);
+
+CREATE INDEX idx_loyalty_transactions_user ON loyalty_transactions(user_id, salon_id, created_at);
+CREATE INDEX idx_loyalty_transactions_appointment ON loyalty_transactions(appointment_id);
+CREATE INDEX idx_loyalty_transactions_expiry ON loyalty_transactions(expires_at) WHERE expires_at IS NOT NULL;
+-- An appointment earns once
+CREATE UNIQUE INDEX idx_loyalty_transactions_earn ON loyalty_transactions(appointment_id) WHERE kind = 'earn';
+
+-- The points discount a booking got, next to its promo discount
+ALTER TABLE appointments ADD COLUMN points_discount NUMERIC(10,2) NOT NULL DEFAULT 0;
+
+-- Points used to be awarded at booking, including for bookings that never happened.
+-- Balances are rebuilt from the completed appointments at one point per unit paid.
+INSERT INTO loyalty_transactions (user_id, salon_id, kind, points, appointment_id, note, created_at)
+SELECT a.customer_id, a.salon_id, 'earn', FLOOR(p.amount - p.discount)::int, a.id, 'Completed appointment', a.updated_at
+FROM appointments a
+JOIN LATERAL (SELECT amount, discount FROM payments WHERE appointment_id = a.id
+              ORDER BY created_at DESC LIMIT 1) p ON true
+WHERE a.status = 'completed' AND FLOOR(p.amount - p.discount) >= 1;
+
+UPDATE users u SET loyalty_points = COALESCE(
+    (SELECT SUM(points) FROM loyalty_transactions t WHERE t.user_id = u.id), 0);
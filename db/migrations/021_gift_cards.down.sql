@@ -0,0 +1,17 @@
+ALTER TABLE payment_tenders
+    DROP CONSTRAINT IF EXISTS payment_tenders_gift_card_check,
+    DROP COLUMN IF EXISTS gift_card_id;
+
+-- Gift card tenders are recorded as taken at the counter
+ALTER TABLE payment_tenders DROP CONSTRAINT IF EXISTS payment_tenders_method_check;
+UPDATE payment_tenders SET method = 'cash' WHERE method = 'gift_card';
+ALTER TABLE payment_tenders ADD CONSTRAINT payment_tenders_method_check
+    CHECK (method IN ('cash', 'card', 'upi', 'wallet'));
+
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_method_check;
+UPDATE payments SET method = 'cash' WHERE method = 'gift_card';
+ALTER TABLE payments ADD CONSTRAINT payments_method_check
+    CHECK (method IN ('cash', 'card', 'upi', 'wallet', 'split'));
+
+DROP TABLE IF EXISTS gift_card_transactions CASCADE;
+DROP TABLE IF EXISTS gift_cards CASCADE;
@@ -0,0 +1,52 @@
+-- =============================================
+-- GIFT CARDS
+-- Stored-value cards a salon sells, redeemable by code as a checkout tender at that salon.
+-- Every change to a card's balance is a transaction: issued, redeemed by a payment,
+-- reversed when that payment didn't go through, refunded back to the card, or voided.
+-- =============================================
+CREATE TABLE gift_cards (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    salon_id UUID NOT NULL REFERENCES salons(id) ON DELETE CASCADE,
+    code VARCHAR(32) NOT NULL UNIQUE,
+    initial_amount NUMERIC(10,2) NOT NULL CHECK (initial_amount > 0),
+    balance NUMERIC(10,2) NOT NULL CHECK (balance >= 0),
+    status VARCHAR(10) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'voided')),
+    expires_at TIMESTAMP WITH TIME ZONE,
+    recipient_name VARCHAR(255),
+    recipient_email VARCHAR(255),
+    note TEXT,
+    issued_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    voided_at TIMESTAMP WITH TIME ZONE,
+    void_reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_gift_cards_salon ON gift_cards(salon_id, created_at);
+
+CREATE TABLE gift_card_transactions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    gift_card_id UUID NOT NULL REFERENCES gift_cards(id) ON DELETE CASCADE,
+    kind VARCHAR(10) NOT NULL CHECK (kind IN ('issue', 'redeem', 'reverse', 'refund', 'void')),
+    -- Negative when it leaves the balance
+    amount NUMERIC(10,2) NOT NULL CHECK (amount <> 0),
+    payment_id UUID REFERENCES payments(id) ON DELETE SET NULL,
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_gift_card_transactions_card ON gift_card_transactions(gift_card_id, created_at);
+CREATE INDEX idx_gift_card_transactions_payment ON gift_card_transactions(payment_id);
+
+-- Gift cards as a tender
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_method_check;
+ALTER TABLE payments ADD CONSTRAINT payments_method_check
+    CHECK (method IN ('cash', 'card', 'upi', 'wallet', 'gift_card', 'split'));
+
+ALTER TABLE payment_tenders DROP CONSTRAINT IF EXISTS payment_tenders_method_check;
+ALTER TABLE payment_tenders ADD CONSTRAINT payment_tenders_method_check
+    CHECK (method IN ('cash', 'card', 'upi', 'wallet', 'gift_card'));
+ALTER TABLE payment_tenders
+    ADD COLUMN gift_card_id UUID REFERENCES gift_cards(id) ON DELETE SET NULL,
+    ADD CONSTRAINT payment_tenders_gift_card_check CHECK (gift_card_id IS NULL OR method = 'gift_card');
@@ -0,0 +1,9 @@
+ALTER TABLE cancellation_policies
+    DROP COLUMN IF EXISTS restore_credit_on_late_cancel,
+    DROP COLUMN IF EXISTS restore_credit_on_no_show;
+ALTER TABLE appointments DROP COLUMN IF EXISTS member_discount;
+
+DROP TABLE IF EXISTS plan_credit_uses CASCADE;
+DROP TABLE IF EXISTS customer_plans CASCADE;
+DROP TABLE IF EXISTS prepaid_plan_services CASCADE;
+DROP TABLE IF EXISTS prepaid_plans CASCADE;
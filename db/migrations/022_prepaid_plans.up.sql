@@ -0,0 +1,82 @@
+-- =============================================
+-- PREPAID PACKAGES AND MEMBERSHIPS
+-- A salon sells plans: packages are a bundle of service credits, memberships a monthly
+-- allowance of credits (or unlimited) plus a member discount on everything else. A plan a
+-- customer holds pays for the services it covers when they book; each service it pays for
+-- uses one credit, given back when the booking falls through per the cancellation policy.
+-- =============================================
+CREATE TABLE prepaid_plans (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    salon_id UUID NOT NULL REFERENCES salons(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('package', 'membership')),
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    price NUMERIC(10,2) NOT NULL CHECK (price >= 0),
+    -- Package: credits in the bundle. Membership: credits per month, NULL for unlimited.
+    credits INT CHECK (credits IS NULL OR credits > 0),
+    -- Days a plan can be used from the day it is sold, NULL for no end
+    validity_days INT CHECK (validity_days IS NULL OR validity_days > 0),
+    member_discount_percent NUMERIC(5,2) NOT NULL DEFAULT 0
+        CHECK (member_discount_percent >= 0 AND member_discount_percent <= 100),
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    CHECK (kind = 'membership' OR (credits IS NOT NULL AND member_discount_percent = 0))
+);
+
+CREATE INDEX idx_prepaid_plans_salon ON prepaid_plans(salon_id);
+
+-- Services a plan's credits pay for
+CREATE TABLE prepaid_plan_services (
+    plan_id UUID NOT NULL REFERENCES prepaid_plans(id) ON DELETE CASCADE,
+    service_id UUID NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+    PRIMARY KEY (plan_id, service_id)
+);
+
+-- Plans sold to customers. Credits and discount are copied from the plan when it is sold
+-- so later changes to the plan don't alter what the customer bought.
+CREATE TABLE customer_plans (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    salon_id UUID NOT NULL REFERENCES salons(id) ON DELETE CASCADE,
+    plan_id UUID NOT NULL REFERENCES prepaid_plans(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('package', 'membership')),
+    name VARCHAR(255) NOT NULL,
+    credits INT CHECK (credits IS NULL OR credits > 0),
+    member_discount_percent NUMERIC(5,2) NOT NULL DEFAULT 0,
+    price_paid NUMERIC(10,2) NOT NULL CHECK (price_paid >= 0),
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE,
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'cancelled')),
+    sold_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    cancelled_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_customer_plans_user ON customer_plans(user_id, salon_id);
+CREATE INDEX idx_customer_plans_salon ON customer_plans(salon_id, status);
+
+-- One credit per appointment service paid for by a plan. period_start is the membership
+-- month the booking falls in (the sale date for packages).
+CREATE TABLE plan_credit_uses (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    customer_plan_id UUID NOT NULL REFERENCES customer_plans(id) ON DELETE CASCADE,
+    appointment_id UUID NOT NULL REFERENCES appointments(id) ON DELETE CASCADE,
+    appointment_service_id UUID NOT NULL UNIQUE REFERENCES appointment_services(id) ON DELETE CASCADE,
+    period_start DATE NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'used' CHECK (status IN ('used', 'restored')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    restored_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_plan_credit_uses_plan ON plan_credit_uses(customer_plan_id, period_start) WHERE status = 'used';
+CREATE INDEX idx_plan_credit_uses_appointment ON plan_credit_uses(appointment_id);
+
+-- Member discount taken off a booking, alongside the promo and points discounts
+ALTER TABLE appointments ADD COLUMN member_discount NUMERIC(10,2) NOT NULL DEFAULT 0;
+
+-- Credits come back on a free cancellation; late cancellations and no-shows forfeit them
+-- unless the salon gives them back
+ALTER TABLE cancellation_policies
+    ADD COLUMN restore_credit_on_late_cancel BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN restore_credit_on_no_show BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_reviews_appointment;
+ALTER TABLE reviews DROP COLUMN IF EXISTS is_verified;
@@ -0,0 +1,24 @@
+-- =============================================
+-- VERIFIED REVIEWS
+-- A review is written for the reviewer's own completed appointment, once per appointment.
+-- Older reviews that can't be tied to one are kept but not marked verified.
+-- =============================================
+ALTER TABLE reviews ADD COLUMN is_verified BOOLEAN NOT NULL DEFAULT false;
+
+-- Only the first review of an appointment keeps it
+UPDATE reviews r SET appointment_id = NULL
+WHERE r.appointment_id IS NOT NULL
+  AND EXISTS (
+      SELECT 1 FROM reviews o
+      WHERE o.appointment_id = r.appointment_id
+        AND (o.created_at, o.id) < (r.created_at, r.id)
+  );
+
+UPDATE reviews r SET is_verified = true
+FROM appointments a
+WHERE a.id = r.appointment_id
+  AND a.customer_id = r.customer_id
+  AND a.salon_id = r.salon_id
+  AND a.status = 'completed';
+
+CREATE UNIQUE INDEX idx_reviews_appointment ON reviews(appointment_id) WHERE appointment_id IS NOT NULL;
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS review_reports;
+DROP INDEX IF EXISTS idx_reviews_hidden;
+ALTER TABLE reviews
+    DROP COLUMN IF EXISTS owner_reply,
+    DROP COLUMN IF EXISTS owner_reply_by,
+    DROP COLUMN IF EXISTS owner_replied_at,
+    DROP COLUMN IF EXISTS is_hidden,
+    DROP COLUMN IF EXISTS hidden_reason,
+    DROP COLUMN IF EXISTS moderated_by,
+    DROP COLUMN IF EXISTS moderated_at;
@@ -0,0 +1,30 @@
+-- =============================================
+-- REVIEW REPLIES AND MODERATION
+-- The salon can answer a review publicly. Customers and owners report abusive reviews;
+-- an admin hides the review (it drops out of the salon's rating) or restores it.
+-- =============================================
+ALTER TABLE reviews
+    ADD COLUMN owner_reply TEXT,
+    ADD COLUMN owner_reply_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN owner_replied_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN is_hidden BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN hidden_reason TEXT,
+    ADD COLUMN moderated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN moderated_at TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE review_reports (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    review_id UUID NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+    reporter_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason VARCHAR(20) NOT NULL CHECK (reason IN ('spam', 'offensive', 'fake', 'off_topic', 'other')),
+    details TEXT,
+    -- open until an admin hides the review (upheld) or keeps it (dismissed)
+    status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'upheld', 'dismissed')),
+    resolved_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (review_id, reporter_id)
+);
+
+CREATE INDEX idx_review_reports_open ON review_reports(review_id) WHERE status = 'open';
+CREATE INDEX idx_reviews_hidden ON reviews(salon_id) WHERE is_hidden;
@@ -0,0 +1,4 @@
+UPDATE notifications SET type = 'general' WHERE type = 'appointment_reassigned';
+ALTER TABLE notifications DROP CONSTRAINT IF EXISTS notifications_type_check;
+ALTER TABLE notifications ADD CONSTRAINT notifications_type_check
+    CHECK (type IN ('appointment_reminder', 'appointment_confirmed', 'appointment_cancelled', 'waitlist_available', 'promo', 'general'));
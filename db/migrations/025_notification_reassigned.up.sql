@@ -0,0 +1,8 @@
+-- =============================================
+-- REASSIGNMENT NOTIFICATIONS
+-- Customers are told when their appointment moves to another stylist because of
+-- staff time off.
+-- =============================================
+ALTER TABLE notifications DROP CONSTRAINT IF EXISTS notifications_type_check;
+ALTER TABLE notifications ADD CONSTRAINT notifications_type_check
+    CHECK (type IN ('appointment_reminder', 'appointment_confirmed', 'appointment_cancelled', 'appointment_reassigned', 'waitlist_available', 'promo', 'general'));